@@ -1,5 +1,5 @@
 : ${PROTOC:="/usr/local/bin/protoc"}
-PROTO_INCLUDE="-I=/usr/include -I=."
+PROTO_INCLUDE="-I=/usr/include -I=${GOPATH}/src/github.com/grpc-ecosystem/grpc-gateway/third_party/googleapis -I=."
 
 case $1 in
     lint)
@@ -15,6 +15,7 @@ case $1 in
         ;;
     golang | go)
         ${PROTOC} ${PROTO_INCLUDE} --go_out=plugins=grpc:${GOPATH}/src ./mnemosynerpc/*.proto
+        ${PROTOC} ${PROTO_INCLUDE} --grpc-gateway_out=logtostderr=true:. --swagger_out=logtostderr=true:. ./mnemosynerpc/*.proto
         goimports -w ./mnemosynerpc
         ;;
     *)
@@ -1,14 +1,20 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"os"
+	"strconv"
 	"strings"
 
 	"time"
 
+	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
+	"github.com/piotrkowalczuk/mnemosyne/internal/certificate"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosyned"
 )
 
 var (
@@ -16,18 +22,25 @@ var (
 )
 
 type configuration struct {
+	config struct {
+		file string
+		dump bool
+	}
 	host string
 	port int
 	grpc struct {
 		debug bool
 	}
 	cluster struct {
-		listen string
-		seeds  arrayFlags
+		listen      string
+		seeds       arrayFlags
+		secret      string
+		partitioned bool
 	}
 	catalog struct {
-		http string
-		dns  string
+		http     string
+		dns      string
+		interval time.Duration
 	}
 	tracing struct {
 		agent struct {
@@ -40,54 +53,135 @@ type configuration struct {
 		level       string
 	}
 	session struct {
-		ttl time.Duration
-		ttc time.Duration
+		ttl   time.Duration
+		ttc   time.Duration
+		limit struct {
+			max       int
+			policy    string
+			perClient bool
+			failOpen  bool
+			clients   arrayFlags
+		}
+	}
+	cache struct {
+		ttl  time.Duration
+		size int
+	}
+	replication struct {
+		factor int
+		quorum int
 	}
 	postgres struct {
 		address string
 		table   string
 		schema  string
+		token   struct {
+			secret   string
+			previous arrayFlags
+		}
+	}
+	redis struct {
+		address  string
+		password string
+		db       int
+		prefix   string
+	}
+	embedded struct {
+		path string
 	}
 	tls struct {
-		enabled  bool
-		certFile string
-		keyFile  string
+		enabled      bool
+		certFile     string
+		keyFile      string
+		caFile       string
+		clientAuth   string
+		peerCertFile string
+		peerKeyFile  string
+	}
+	debug struct {
+		tls bool
+	}
+	gateway struct {
+		enabled bool
+	}
+	shutdown struct {
+		timeout time.Duration
+	}
+	token struct {
+		keys     arrayFlags
+		unsigned bool
 	}
 }
 
-func (c *configuration) init() {
+func (c *configuration) init(fs *flag.FlagSet) {
 	if c == nil {
 		*c = configuration{}
 	}
 
-	flag.StringVar(&c.host, "host", "127.0.0.1", "Host")
-	flag.IntVar(&c.port, "port", 8080, "Port")
+	fs.StringVar(&c.config.file, "config", "", "Path to a configuration file (yaml or toml). Options it contains are overridden by environment variables and flags.")
+	fs.BoolVar(&c.config.dump, "config.dump", false, "If true, effective configuration is printed (with secrets redacted) and the process exits.")
+
+	fs.StringVar(&c.host, "host", "127.0.0.1", "Host")
+	fs.IntVar(&c.port, "port", 8080, "Port")
+	fs.DurationVar(&c.shutdown.timeout, "shutdown.timeout", mnemosyned.DefaultShutdownTimeout, "How long in-flight requests are drained on SIGINT or SIGTERM, before remaining connections are closed.")
 	// GRPC
-	flag.BoolVar(&c.grpc.debug, "grpc.debug", false, "If true, enables very verbose gRPC to debug mode. Useful to track connectivity issues.")
+	fs.BoolVar(&c.grpc.debug, "grpc.debug", false, "If true, enables very verbose gRPC to debug mode. Useful to track connectivity issues.")
 	// CLUSTER
-	flag.StringVar(&c.cluster.listen, "cluster.listen", "", "Complete instance address (including port).")
-	flag.Var(&c.cluster.seeds, "cluster.seeds", "List of comma-separated instances addresses that are part of the cluster. An entry that overlaps with cluster.listen value will be ignored.")
+	fs.StringVar(&c.cluster.listen, "cluster.listen", "", "Complete instance address (including port).")
+	fs.Var(&c.cluster.seeds, "cluster.seeds", "List of comma-separated instances addresses that are part of the cluster. An entry that overlaps with cluster.listen value will be ignored.")
+	fs.StringVar(&c.cluster.secret, "cluster.secret", "", "Secret shared by all instances of the cluster, used to authenticate requests they send to each other. Required if the cluster has more than one member.")
+	fs.BoolVar(&c.cluster.partitioned, "cluster.partitioned", false, "If true, access tokens carry a partition that keeps them with the instance that started them, when others join the cluster. All instances need to agree on it.")
 	// CATALOG
-	flag.StringVar(&c.catalog.http, "catalog.http", "http://localhost:8500/v1/catalog/service/mnemosyned", "Address of a service catalog (experimental).")
-	flag.StringVar(&c.catalog.dns, "catalog.dns", "", "A DNS server address that can resolve SRV lookup (experimental).")
+	fs.StringVar(&c.catalog.http, "catalog.http", "", "Address of a service catalog, e.g. http://localhost:8500/v1/catalog/service/mnemosyned. If set, cluster members are resolved periodically.")
+	fs.StringVar(&c.catalog.dns, "catalog.dns", "", "A domain name under which SRV records of mnemosyned grpc service can be found. If set, cluster members are resolved periodically.")
+	fs.DurationVar(&c.catalog.interval, "catalog.interval", mnemosyned.DefaultDiscoveryInterval, "How often cluster members are resolved using a service catalog.")
 	// TRACING
-	flag.StringVar(&c.tracing.agent.address, "tracing.agent.address", "", "Address of a tracing agent.")
+	fs.StringVar(&c.tracing.agent.address, "tracing.agent.address", "", "Address of a tracing agent.")
 	// SESSION
-	flag.DurationVar(&c.session.ttl, "ttl", storage.DefaultTTL, "Session time to live, after which session is deleted.")
-	flag.DurationVar(&c.session.ttc, "ttc", storage.DefaultTTC, "Session time to cleanup, how often cleanup will be performed.")
+	fs.DurationVar(&c.session.ttl, "ttl", storage.DefaultTTL, "Default session time to live (idle timeout), after which inactive session is deleted. It can be overridden per session.")
+	fs.DurationVar(&c.session.ttc, "ttc", storage.DefaultTTC, "Session time to cleanup, how often cleanup will be performed.")
+	fs.IntVar(&c.session.limit.max, "session.limit.max", 0, "Maximum number of active sessions a subject can have across the cluster. If zero, there is no limit.")
+	fs.StringVar(&c.session.limit.policy, "session.limit.policy", mnemosyned.SessionLimitPolicyReject, "What happens if a new session would exceed the limit (reject, evict_oldest, evict_lru).")
+	fs.BoolVar(&c.session.limit.perClient, "session.limit.per-client", false, "If true, sessions of a subject are counted separately for each subject client.")
+	fs.BoolVar(&c.session.limit.failOpen, "session.limit.fail-open", false, "If true, sessions held by nodes that cannot be reached are not counted, instead of rejecting new sessions.")
+	fs.Var(&c.session.limit.clients, "session.limit.client", "List of comma-separated client:limit pairs that override session.limit.max for sessions of given subject clients. Zero means no limit.")
+	// CACHE
+	fs.DurationVar(&c.cache.ttl, "cache.ttl", cache.DefaultTTL, "How long a session read from the storage is served from the local cache.")
+	fs.IntVar(&c.cache.size, "cache.size", cache.DefaultSize, "Maximum number of sessions held in the local cache, least recently used are evicted first.")
+	fs.IntVar(&c.replication.factor, "replication.factor", 1, "Number of cluster nodes that hold a copy of each session, owner included.")
+	fs.IntVar(&c.replication.quorum, "replication.quorum", 0, "Number of copies that have to be written for a write to succeed. If not set, majority of the replication factor is used.")
 	// LOGGER
-	flag.StringVar(&c.logger.environment, "log.environment", "production", "Logger environment config (production, stackdriver or development).")
-	flag.StringVar(&c.logger.level, "log.level", "info", "Logger level (debug, info, warn, error, dpanic, panic, fatal)")
+	fs.StringVar(&c.logger.environment, "log.environment", "production", "Logger environment config (production, stackdriver or development).")
+	fs.StringVar(&c.logger.level, "log.level", "info", "Logger level (debug, info, warn, error, dpanic, panic, fatal)")
 	// STORAGE
-	flag.StringVar(&c.storage, "storage", storage.EnginePostgres, "Storage engine (postgres).") // TODO: change to in memory when implemented
+	fs.StringVar(&c.storage, "storage", storage.EnginePostgres, "Storage engine (in_memory, postgres, redis, embedded).")
 	// POSTGRES
-	flag.StringVar(&c.postgres.address, "postgres.address", "postgres://localhost?sslmode=disable", "Storage postgres connection string.")
-	flag.StringVar(&c.postgres.table, "postgres.table", "session", "Postgres table name.")
-	flag.StringVar(&c.postgres.schema, "postgres.schema", "mnemosyne", "Postgres schema name.")
+	fs.StringVar(&c.postgres.address, "postgres.address", "postgres://localhost?sslmode=disable", "Storage postgres connection string.")
+	fs.StringVar(&c.postgres.table, "postgres.table", "session", "Postgres table name.")
+	fs.StringVar(&c.postgres.schema, "postgres.schema", "mnemosyne", "Postgres schema name.")
+	fs.StringVar(&c.postgres.token.secret, "postgres.token-secret", "", "If set, only keyed hashes (HMAC-SHA256) of tokens are stored. Has to be the same on every node of the cluster.")
+	fs.Var(&c.postgres.token.previous, "postgres.token-secret.previous", "List of comma-separated token secrets that postgres.token-secret replaced. Sessions stored using them can still be found.")
+	// REDIS
+	fs.StringVar(&c.redis.address, "redis.address", "localhost:6379", "Storage redis address (host:port).")
+	fs.StringVar(&c.redis.password, "redis.password", "", "Redis password.")
+	fs.IntVar(&c.redis.db, "redis.db", 0, "Redis database number.")
+	fs.StringVar(&c.redis.prefix, "redis.prefix", "mnemosyne", "Prefix of every redis key.")
+	// EMBEDDED
+	fs.StringVar(&c.embedded.path, "embedded.path", "mnemosyne.db", "Path to the embedded storage file.")
 	// TLS
-	flag.BoolVar(&c.tls.enabled, "tls", false, "If true, TLS is enabled.")
-	flag.StringVar(&c.tls.certFile, "tls.crt", "", "Path to TLS cert file.")
-	flag.StringVar(&c.tls.keyFile, "tls.key", "", "Path to TLS key file.")
+	fs.BoolVar(&c.tls.enabled, "tls", false, "If true, TLS is enabled.")
+	fs.StringVar(&c.tls.certFile, "tls.crt", "", "Path to TLS cert file.")
+	fs.StringVar(&c.tls.keyFile, "tls.key", "", "Path to TLS key file.")
+	fs.StringVar(&c.tls.caFile, "tls.ca", "", "Path to file with certificate authorities that client and peer certificates are verified against. If not set, system pool is used.")
+	fs.StringVar(&c.tls.clientAuth, "tls.client-auth", certificate.ClientAuthNone, "Client certificate authentication mode (none, request, require).")
+	fs.StringVar(&c.tls.peerCertFile, "tls.peer.crt", "", "Path to TLS cert file presented to other cluster members. If not set, tls.crt is used.")
+	fs.StringVar(&c.tls.peerKeyFile, "tls.peer.key", "", "Path to TLS key file presented to other cluster members. If not set, tls.key is used.")
+	// GATEWAY
+	fs.BoolVar(&c.gateway.enabled, "gateway", false, "If true, HTTP/JSON gateway is listening on port+2.")
+	// TOKEN
+	fs.Var(&c.token.keys, "token.key", "List of comma-separated id:secret pairs. If set, access tokens are signed using the first key and verified using any of them, before the storage is queried.")
+	fs.BoolVar(&c.token.unsigned, "token.unsigned", false, "If true, access tokens that are not signed are accepted as well, e.g. until sessions started before token.key was set expire.")
+	fs.BoolVar(&c.debug.tls, "debug.tls", false, "If true, debug server (metrics, health checks and profiling) is served over TLS. Requires tls to be enabled.")
 }
 
 func (c *configuration) parse() {
@@ -99,15 +193,69 @@ func (c *configuration) parse() {
 			os.Exit(0)
 		}
 	}
+	if err := c.load(flag.CommandLine, os.Environ()); err != nil {
+		fmt.Fprintf(os.Stderr, "configuration failure: %s\n", err.Error())
+		os.Exit(2)
+	}
+	if c.config.dump {
+		if err := dump(os.Stdout, flag.CommandLine); err != nil {
+			fmt.Fprintf(os.Stderr, "configuration dump failure: %s\n", err.Error())
+			os.Exit(1)
+		}
+		os.Exit(0)
+	}
+}
+
+// accessTokenKeys parses token.key entries.
+func (c *configuration) accessTokenKeys() ([]mnemosyne.AccessTokenKey, error) {
+	keys := make([]mnemosyne.AccessTokenKey, 0, len(c.token.keys))
+	for _, k := range c.token.keys {
+		parts := strings.SplitN(k, ":", 2)
+		if len(parts) != 2 {
+			return nil, errors.New("token.key has to be in the id:secret format")
+		}
+		key := mnemosyne.AccessTokenKey{ID: parts[0], Secret: []byte(parts[1])}
+		if err := key.Validate(); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, nil
+}
+
+// sessionLimits parses session.limit.client entries.
+func (c *configuration) sessionLimits() (map[string]int, error) {
+	limits := make(map[string]int, len(c.session.limit.clients))
+	for _, l := range c.session.limit.clients {
+		i := strings.LastIndex(l, ":")
+		if i < 0 {
+			return nil, errors.New("session.limit.client has to be in the client:limit format")
+		}
+		limit, err := strconv.Atoi(l[i+1:])
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("session.limit.client has to be a non-negative number: %s", l)
+		}
+		limits[l[:i]] = limit
+	}
+	return limits, nil
 }
 
 type arrayFlags []string
 
 func (i *arrayFlags) String() string {
-	return "my string representation"
+	return strings.Join(*i, ",")
+}
+
+// Get implements flag Getter interface.
+func (i *arrayFlags) Get() interface{} {
+	return []string(*i)
 }
 
 func (i *arrayFlags) Set(value string) error {
-	*i = append(*i, strings.Split(value, ",")...)
+	for _, v := range strings.Split(value, ",") {
+		if v != "" {
+			*i = append(*i, v)
+		}
+	}
 	return nil
 }
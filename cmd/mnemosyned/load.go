@@ -0,0 +1,303 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/piotrkowalczuk/mnemosyne/internal/certificate"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosyned"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	envPrefix = "MNEMOSYNED_"
+	// redacted replaces secrets in the configuration dump, the same way url.URL.Redacted does.
+	redacted = "xxxxx"
+)
+
+// internalFlags are not part of the configuration, they are not read from a file and not dumped.
+var internalFlags = map[string]bool{
+	"config":      true,
+	"config.dump": true,
+	"version":     true,
+}
+
+// secretFlags are redacted in the configuration dump.
+var secretFlags = map[string]bool{
+	"cluster.secret":                 true,
+	"redis.password":                 true,
+	"postgres.token-secret":          true,
+	"postgres.token-secret.previous": true,
+}
+
+// envName returns name of an environment variable that corresponds to given flag,
+// e.g. tls.client-auth becomes MNEMOSYNED_TLS_CLIENT_AUTH.
+func envName(flagName string) string {
+	return envPrefix + strings.ToUpper(strings.NewReplacer(".", "_", "-", "_").Replace(flagName))
+}
+
+// load applies options from the configuration file and environment variables to flags that were not set explicitly.
+// Precedence is flag > environment variable > configuration file > default.
+func (c *configuration) load(fs *flag.FlagSet, environ []string) error {
+	explicit := make(map[string]bool)
+	fs.Visit(func(f *flag.Flag) {
+		explicit[f.Name] = true
+	})
+
+	env := make(map[string]string)
+	for _, kv := range environ {
+		if i := strings.Index(kv, "="); i > 0 && strings.HasPrefix(kv[:i], envPrefix) {
+			env[kv[:i]] = kv[i+1:]
+		}
+	}
+
+	var (
+		values  = make(map[string]string)
+		sources = make(map[string]string)
+	)
+
+	path := c.config.file
+	if v, ok := env[envName("config")]; ok && !explicit["config"] {
+		path = v
+	}
+	if path != "" {
+		options, err := readConfigFile(path)
+		if err != nil {
+			return err
+		}
+		for name, value := range options {
+			if fs.Lookup(name) == nil || internalFlags[name] {
+				return fmt.Errorf("config file %s: unknown option %s", path, name)
+			}
+			values[name], sources[name] = value, "config file "+path
+		}
+	}
+
+	// Unknown variables are ignored, the prefix is shared with variables injected by orchestrators.
+	fs.VisitAll(func(f *flag.Flag) {
+		if f.Name == "config" || f.Name == "version" {
+			return
+		}
+		if v, ok := env[envName(f.Name)]; ok {
+			values[f.Name], sources[f.Name] = v, "environment variable "+envName(f.Name)
+		}
+	})
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		if explicit[name] {
+			continue
+		}
+		if err := fs.Set(name, values[name]); err != nil {
+			return fmt.Errorf("%s: invalid value %q for %s: %s", sources[name], values[name], name, err.Error())
+		}
+	}
+
+	return c.validate()
+}
+
+// validate checks combinations of options that flag types cannot express.
+func (c *configuration) validate() error {
+	// Debug server and gateway listen on consecutive ports.
+	maxPort := 65534
+	if c.gateway.enabled {
+		maxPort--
+	}
+	if c.port < 1 || c.port > maxPort {
+		return fmt.Errorf("port out of range: %d", c.port)
+	}
+	switch c.storage {
+	case storage.EngineInMemory, storage.EnginePostgres, storage.EngineRedis, storage.EngineEmbedded:
+	default:
+		return fmt.Errorf("unknown storage engine: %s", c.storage)
+	}
+	if c.tls.enabled && (c.tls.certFile == "" || c.tls.keyFile == "") {
+		return errors.New("tls.crt and tls.key are required if tls is enabled")
+	}
+	if _, err := certificate.ParseClientAuth(c.tls.clientAuth); err != nil {
+		return err
+	}
+	if c.debug.tls && !c.tls.enabled {
+		return errors.New("debug.tls requires tls to be enabled")
+	}
+	if c.replication.factor < 1 {
+		return fmt.Errorf("replication.factor has to be positive: %d", c.replication.factor)
+	}
+	if c.replication.quorum < 0 || c.replication.quorum > c.replication.factor {
+		return fmt.Errorf("replication.quorum has to be between 0 and replication.factor (%d): %d", c.replication.factor, c.replication.quorum)
+	}
+	if _, err := c.accessTokenKeys(); err != nil {
+		return err
+	}
+	if c.session.limit.max < 0 {
+		return fmt.Errorf("session.limit.max cannot be negative: %d", c.session.limit.max)
+	}
+	switch c.session.limit.policy {
+	case mnemosyned.SessionLimitPolicyReject, mnemosyned.SessionLimitPolicyEvictOldest, mnemosyned.SessionLimitPolicyEvictLRU:
+	default:
+		return fmt.Errorf("unknown session.limit.policy: %s", c.session.limit.policy)
+	}
+	if _, err := c.sessionLimits(); err != nil {
+		return err
+	}
+	return nil
+}
+
+// readConfigFile reads options from a yaml or toml file.
+// Nested sections are flattened, so {postgres: {address: x}} is equivalent of {postgres.address: x}.
+func readConfigFile(path string) (map[string]string, error) {
+	buf, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file cannot be read: %s", err.Error())
+	}
+
+	var raw map[string]interface{}
+	switch ext := strings.ToLower(filepath.Ext(path)); ext {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(buf, &raw)
+	case ".toml":
+		_, err = toml.Decode(string(buf), &raw)
+	default:
+		return nil, fmt.Errorf("config file %s: unsupported format %q, expected .yaml, .yml or .toml", path, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %s", path, err.Error())
+	}
+
+	options := make(map[string]string)
+	if err := flatten(options, "", raw); err != nil {
+		return nil, fmt.Errorf("config file %s: %s", path, err.Error())
+	}
+	return options, nil
+}
+
+func flatten(dst map[string]string, prefix string, value interface{}) error {
+	join := func(key interface{}) string {
+		if prefix == "" {
+			return fmt.Sprint(key)
+		}
+		return prefix + "." + fmt.Sprint(key)
+	}
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, val := range v {
+			if err := flatten(dst, join(key), val); err != nil {
+				return err
+			}
+		}
+	case map[interface{}]interface{}:
+		for key, val := range v {
+			if err := flatten(dst, join(key), val); err != nil {
+				return err
+			}
+		}
+	case nil:
+		return fmt.Errorf("option %s has no value", prefix)
+	default:
+		if _, ok := dst[prefix]; ok {
+			return fmt.Errorf("option %s is defined more than once", prefix)
+		}
+		dst[prefix] = scalar(v)
+	}
+	return nil
+}
+
+func scalar(value interface{}) string {
+	switch v := value.(type) {
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+		return strings.Join(items, ",")
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// dump writes effective configuration in the yaml format, so it can be used as a configuration file.
+// Secrets are redacted.
+func dump(w io.Writer, fs *flag.FlagSet) error {
+	var out yaml.MapSlice
+	fs.VisitAll(func(f *flag.Flag) {
+		if internalFlags[f.Name] {
+			return
+		}
+
+		var value interface{} = f.Value.String()
+		if getter, ok := f.Value.(flag.Getter); ok {
+			value = getter.Get()
+		}
+		switch v := value.(type) {
+		case time.Duration:
+			value = v.String()
+		case string:
+			value = redact(f.Name, v)
+		case []string:
+			redacted := make([]string, 0, len(v))
+			for _, item := range v {
+				redacted = append(redacted, redact(f.Name, item))
+			}
+			value = redacted
+		}
+		out = append(out, yaml.MapItem{Key: f.Name, Value: value})
+	})
+
+	buf, err := yaml.Marshal(out)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+func redact(name, value string) string {
+	if value == "" {
+		return value
+	}
+	if secretFlags[name] {
+		return redacted
+	}
+	// Key ids are not secret, they help to tell which keys are active.
+	if name == "token.key" {
+		if i := strings.Index(value, ":"); i >= 0 {
+			return value[:i+1] + redacted
+		}
+		return redacted
+	}
+	if name == "postgres.address" {
+		u, err := url.Parse(value)
+		if err != nil || u.Scheme == "" {
+			// Key-value connection string.
+			if strings.Contains(value, "password") {
+				return redacted
+			}
+			return value
+		}
+		if _, ok := u.User.Password(); ok {
+			u.User = url.UserPassword(u.User.Username(), redacted)
+		}
+		if q := u.Query(); q.Get("password") != "" {
+			q.Set("password", redacted)
+			u.RawQuery = q.Encode()
+		}
+		return u.String()
+	}
+	return value
+}
@@ -1,10 +1,14 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
 	"net"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
 
 	_ "github.com/lib/pq"
 	"github.com/piotrkowalczuk/mnemosyne/internal/service/logger"
@@ -16,7 +20,7 @@ import (
 
 func main() {
 	var config configuration
-	config.init()
+	config.init(flag.CommandLine)
 	config.parse()
 
 	l, err := logger.Init(logger.Opts{
@@ -29,30 +33,78 @@ func main() {
 		os.Exit(1)
 	}
 
+	if args := flag.Args(); len(args) > 0 {
+		if args[0] != "migrate" {
+			fmt.Fprintf(os.Stderr, "unknown command: %s\n", args[0])
+			os.Exit(2)
+		}
+		if err := migrate(l.Named("migrate"), &config, args[1:]); err != nil {
+			l.Fatal("migration failure", zap.Error(err))
+		}
+		return
+	}
+
 	if config.grpc.debug {
 		grpclog.SetLogger(zapgrpc.NewLogger(l, zapgrpc.WithDebug()))
 	}
 
 	rpcListener := initListener(l, config.host, config.port)
 	debugListener := initListener(l, config.host, config.port+1)
+	var gatewayListener net.Listener
+	if config.gateway.enabled {
+		gatewayListener = initListener(l, config.host, config.port+2)
+	}
+
+	// Keys and limits are validated already, together with the rest of the configuration.
+	accessTokenKeys, _ := config.accessTokenKeys()
+	sessionLimits, _ := config.sessionLimits()
 
 	daemon, err := mnemosyned.NewDaemon(&mnemosyned.DaemonOpts{
-		Version:             version,
-		SessionTTL:          config.session.ttl,
-		SessionTTC:          config.session.ttc,
-		Storage:             config.storage,
-		PostgresAddress:     config.postgres.address + "&application_name=mnemosyned_" + version,
-		PostgresTable:       config.postgres.table,
-		PostgresSchema:      config.postgres.schema,
-		TLS:                 config.tls.enabled,
-		TLSCertFile:         config.tls.certFile,
-		TLSKeyFile:          config.tls.keyFile,
-		ClusterListenAddr:   config.cluster.listen,
-		ClusterSeeds:        config.cluster.seeds,
-		RPCListener:         rpcListener,
-		Logger:              l.Named("daemon"),
-		DebugListener:       debugListener,
-		TracingAgentAddress: config.tracing.agent.address,
+		Version:                      version,
+		SessionTTL:                   config.session.ttl,
+		SessionTTC:                   config.session.ttc,
+		CacheTTL:                     config.cache.ttl,
+		CacheSize:                    config.cache.size,
+		Storage:                      config.storage,
+		PostgresAddress:              config.postgres.address + "&application_name=mnemosyned_" + version,
+		PostgresTable:                config.postgres.table,
+		PostgresSchema:               config.postgres.schema,
+		RedisAddress:                 config.redis.address,
+		RedisPassword:                config.redis.password,
+		RedisDB:                      config.redis.db,
+		RedisPrefix:                  config.redis.prefix,
+		EmbeddedPath:                 config.embedded.path,
+		TLS:                          config.tls.enabled,
+		TLSCertFile:                  config.tls.certFile,
+		TLSKeyFile:                   config.tls.keyFile,
+		TLSCAFile:                    config.tls.caFile,
+		TLSClientAuth:                config.tls.clientAuth,
+		TLSPeerCertFile:              config.tls.peerCertFile,
+		TLSPeerKeyFile:               config.tls.peerKeyFile,
+		DebugTLS:                     config.debug.tls,
+		ClusterListenAddr:            config.cluster.listen,
+		ClusterSeeds:                 config.cluster.seeds,
+		ClusterSecret:                config.cluster.secret,
+		ClusterDiscoveryHTTP:         config.catalog.http,
+		ClusterDiscoveryDNS:          config.catalog.dns,
+		ClusterDiscoveryInterval:     config.catalog.interval,
+		ClusterPartitioned:           config.cluster.partitioned,
+		ReplicationFactor:            config.replication.factor,
+		ReplicationQuorum:            config.replication.quorum,
+		RPCListener:                  rpcListener,
+		Logger:                       l.Named("daemon"),
+		DebugListener:                debugListener,
+		GatewayListener:              gatewayListener,
+		TracingAgentAddress:          config.tracing.agent.address,
+		PostgresTokenSecret:          config.postgres.token.secret,
+		PostgresPreviousTokenSecrets: config.postgres.token.previous,
+		AccessTokenKeys:              accessTokenKeys,
+		AccessTokenUnsigned:          config.token.unsigned,
+		SessionLimit:                 config.session.limit.max,
+		SessionLimitPolicy:           config.session.limit.policy,
+		SessionLimitPerClient:        config.session.limit.perClient,
+		SessionLimitFailOpen:         config.session.limit.failOpen,
+		SessionLimits:                sessionLimits,
 	})
 	if err != nil {
 		l.Fatal("daemon allocation failure", zap.Error(err))
@@ -61,10 +113,33 @@ func main() {
 	if err := daemon.Run(); err != nil {
 		l.Fatal("daemon run failure", zap.Error(err))
 	}
-	defer daemon.Close()
 
-	done := make(chan struct{})
-	<-done
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, syscall.SIGHUP, syscall.SIGINT, syscall.SIGTERM)
+	for s := range sig {
+		if s != syscall.SIGHUP {
+			l.Info("daemon shutdown", zap.Stringer("signal", s), zap.Duration("timeout", config.shutdown.timeout))
+			break
+		}
+		// SIGHUP reloads TLS certificates, without interrupting established connections.
+		if err := daemon.Reload(); err != nil {
+			l.Error("daemon reload failure", zap.Error(err))
+			continue
+		}
+		l.Info("daemon reloaded")
+	}
+	// Second signal terminates the process immediately.
+	signal.Reset(syscall.SIGINT, syscall.SIGTERM)
+
+	ctx, cancel := context.WithTimeout(context.Background(), config.shutdown.timeout)
+	defer cancel()
+
+	if err := daemon.Shutdown(ctx); err != nil {
+		l.Error("daemon shutdown failure", zap.Error(err))
+		cancel()
+		os.Exit(1)
+	}
+	l.Info("daemon shutdown finished")
 }
 
 func initListener(logger *zap.Logger, host string, port int) net.Listener {
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/service/postgres"
+	storagepq "github.com/piotrkowalczuk/mnemosyne/internal/storage/postgres"
+	"go.uber.org/zap"
+)
+
+const migrateUsage = "usage: mnemosyned [flags] migrate up|down [steps]|version|tokens"
+
+// migrate runs postgres schema migrations, according to given arguments, and returns.
+func migrate(l *zap.Logger, config *configuration, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	db, err := postgres.Init(config.postgres.address+"&application_name=mnemosyned_migrate_"+version, postgres.Opts{
+		Logger: l,
+	})
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	m := storagepq.NewMigrator(storagepq.MigratorOpts{
+		Conn:                 db,
+		Schema:               config.postgres.schema,
+		Table:                config.postgres.table,
+		TTL:                  config.session.ttl,
+		TokenSecret:          []byte(config.postgres.token.secret),
+		PreviousTokenSecrets: secrets(config.postgres.token.previous),
+	})
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		if len(args) > 1 {
+			return errors.New(migrateUsage)
+		}
+		n, err := m.Up(ctx)
+		if err != nil {
+			return err
+		}
+		l.Info("migrations applied", zap.Int("count", n), zap.Int64("version", m.Latest()))
+	case "down":
+		steps := 1
+		if len(args) > 1 {
+			if steps, err = strconv.Atoi(args[1]); err != nil || steps < 1 || len(args) > 2 {
+				return errors.New(migrateUsage)
+			}
+		}
+		n, err := m.Down(ctx, steps)
+		if err != nil {
+			return err
+		}
+		l.Info("migrations reverted", zap.Int("count", n))
+	case "version":
+		v, err := m.Version(ctx)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d/%d\n", v, m.Latest())
+	case "tokens":
+		keys, err := m.TokenKeys(ctx)
+		if err != nil {
+			return err
+		}
+		names := make([]string, 0, len(keys))
+		for name := range keys {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			fmt.Printf("%s\t%d\n", name, keys[name])
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+	return nil
+}
+
+func secrets(in []string) [][]byte {
+	out := make([][]byte, 0, len(in))
+	for _, s := range in {
+		out = append(out, []byte(s))
+	}
+	return out
+}
@@ -0,0 +1,80 @@
+package mnemosyne
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
+)
+
+// TokenFingerprintVersion prefixes every token fingerprint.
+const TokenFingerprintVersion = "fp1"
+
+// TokenFingerprint stands for a token that is stored only as its keyed hash, e.g. if postgres token secret is set.
+// Storage returns fingerprints instead of tokens it does not know, nodes of the cluster use them to refer to such sessions.
+// Its string form is: version.key_id.route.hash, it never looks like a token generated by the daemon.
+type TokenFingerprint struct {
+	// KeyID identifies the secret the token is hashed with.
+	KeyID string
+	// Route is what the cluster routes the access token by, see TokenRoute. It is empty for refresh tokens.
+	Route string
+	// Hash is hex encoded keyed hash of the token.
+	Hash string
+}
+
+// String implements fmt Stringer interface.
+func (f TokenFingerprint) String() string {
+	return strings.Join([]string{TokenFingerprintVersion, f.KeyID, f.Route, f.Hash}, signedAccessTokenSeparator)
+}
+
+// ParseTokenFingerprint returns fingerprint represented by given value, or false if it is not a fingerprint.
+func ParseTokenFingerprint(s string) (*TokenFingerprint, bool) {
+	if !strings.HasPrefix(s, TokenFingerprintVersion+signedAccessTokenSeparator) {
+		return nil, false
+	}
+	parts := strings.Split(s, signedAccessTokenSeparator)
+	if len(parts) != 4 || parts[1] == "" || parts[3] == "" {
+		return nil, false
+	}
+	if _, ok := routeSum64(parts[2]); !ok && parts[2] != "" {
+		return nil, false
+	}
+	return &TokenFingerprint{KeyID: parts[1], Route: parts[2], Hash: parts[3]}, true
+}
+
+// TokenRoute returns route of given access token, that is carried by its fingerprint.
+// It consists of the partition, if the token carries one, and the hash of the token the cluster routes it by.
+func TokenRoute(token string) string {
+	route := fmt.Sprintf("%016x", jump.Sum64(token))
+	if p, ok := AccessTokenPartition(token); ok {
+		return formatPartition(p) + route
+	}
+	return route
+}
+
+// AccessTokenSum64 returns hash of given access token that the cluster routes it by.
+// Fingerprint that carries a route has the same hash as the token itself.
+func AccessTokenSum64(token string) uint64 {
+	if fp, ok := ParseTokenFingerprint(token); ok {
+		if sum, ok := routeSum64(fp.Route); ok {
+			return sum
+		}
+	}
+	return jump.Sum64(token)
+}
+
+// routeSum64 returns hash encoded in given route, partition is skipped.
+func routeSum64(route string) (uint64, bool) {
+	if strings.HasPrefix(route, partitionPrefix) {
+		if len(route) < partitionLength {
+			return 0, false
+		}
+		route = route[partitionLength:]
+	}
+	if len(route) != 16 {
+		return 0, false
+	}
+	sum, err := strconv.ParseUint(route, 16, 64)
+	return sum, err == nil
+}
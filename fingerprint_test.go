@@ -0,0 +1,62 @@
+package mnemosyne_test
+
+import (
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
+)
+
+func TestParseTokenFingerprint(t *testing.T) {
+	signed, err := mnemosyne.RandomSignedAccessToken(mnemosyne.AccessTokenKey{ID: "current", Secret: []byte("secret")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	cases := map[string]struct {
+		value string
+		ok    bool
+	}{
+		"access":      {value: mnemosyne.TokenFingerprint{KeyID: "k", Route: mnemosyne.TokenRoute("token"), Hash: "abc"}.String(), ok: true},
+		"refresh":     {value: mnemosyne.TokenFingerprint{KeyID: "k", Hash: "abc"}.String(), ok: true},
+		"signed":      {value: signed},
+		"missing-key": {value: "fp1..0123456789abcdef.abc"},
+		"wrong-route": {value: "fp1.k.route.abc"},
+		"missing":     {value: "fp1.k.0123456789abcdef."},
+		"too-long":    {value: "fp1.k.0123456789abcdef.abc.def"},
+	}
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			fp, ok := mnemosyne.ParseTokenFingerprint(c.value)
+			if ok != c.ok {
+				t.Fatalf("wrong result, expected %t but got %t", c.ok, ok)
+			}
+			if ok && fp.String() != c.value {
+				t.Errorf("fingerprint should be formatted back the same way, got %s", fp.String())
+			}
+		})
+	}
+}
+
+func TestAccessTokenSum64(t *testing.T) {
+	partitioned, err := mnemosyne.RandomAccessTokenInPartition(0xbeef)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	for _, token := range []string{"token", partitioned} {
+		fp := mnemosyne.TokenFingerprint{KeyID: "k", Route: mnemosyne.TokenRoute(token), Hash: "abc"}.String()
+		if got := mnemosyne.AccessTokenSum64(fp); got != jump.Sum64(token) {
+			t.Errorf("fingerprint should be routed as the token, expected %d but got %d", jump.Sum64(token), got)
+		}
+		exp, expOK := mnemosyne.AccessTokenPartition(token)
+		if got, ok := mnemosyne.AccessTokenPartition(fp); got != exp || ok != expOK {
+			t.Errorf("fingerprint should carry partition of the token, expected %d (%t) but got %d (%t)", exp, expOK, got, ok)
+		}
+	}
+
+	refresh := mnemosyne.TokenFingerprint{KeyID: "k", Hash: "abc"}.String()
+	if got := mnemosyne.AccessTokenSum64(refresh); got != jump.Sum64(refresh) {
+		t.Errorf("fingerprint without route should be routed by itself, got %d", got)
+	}
+}
@@ -1,6 +1,8 @@
 package cache
 
 import (
+	"container/list"
+	"context"
 	"sync"
 	"time"
 
@@ -8,80 +10,259 @@ import (
 	"github.com/prometheus/client_golang/prometheus"
 )
 
-// DefaultSize determines how big cache should be at the beginning.
-const DefaultSize = 100000
+const (
+	// DefaultSize is the maximum number of entries cache holds if not specified otherwise.
+	DefaultSize = 100000
+	// DefaultTTL is how long entry is considered fresh if not specified otherwise.
+	DefaultTTL = 5 * time.Second
+	// DefaultShards is the number of independently locked partitions cache is split into.
+	DefaultShards = 32
+)
 
+// Entry is a cached session. It is never modified once returned by Read.
 type Entry struct {
 	Ses     mnemosynerpc.Session
 	Exp     time.Time
 	Refresh bool
 }
 
+// Opts is a set of options that can be passed to the New constructor function.
+type Opts struct {
+	// TTL is how long entry is considered fresh.
+	TTL time.Duration
+	// Size is the maximum number of entries, least recently used entries are evicted first.
+	Size int
+	// Shards is the number of independently locked partitions.
+	Shards int
+	// Namespace of prometheus metrics.
+	Namespace string
+}
+
+type item struct {
+	key   uint64
+	entry *Entry
+}
+
+type shard struct {
+	sync.Mutex
+	capacity int
+	data     map[uint64]*list.Element
+	// lru keeps most recently used elements at the front.
+	lru *list.List
+}
+
+// Cache is a bounded, sharded LRU cache of sessions.
 type Cache struct {
-	data     map[uint64]*Entry
-	dataLock sync.RWMutex
-	TTL      time.Duration
+	shards []*shard
+	TTL    time.Duration
 	// monitoring
-	hitsTotal    prometheus.Counter
-	missesTotal  prometheus.Counter
-	refreshTotal prometheus.Counter
+	hitsTotal      prometheus.Counter
+	missesTotal    prometheus.Counter
+	refreshTotal   prometheus.Counter
+	evictionsTotal *prometheus.CounterVec
+	size           prometheus.Gauge
 }
 
-func New(ttl time.Duration, namespace string) *Cache {
-	return &Cache{
-		TTL:  ttl,
-		data: make(map[uint64]*Entry, DefaultSize),
+// New allocates new cache instance using given options.
+func New(opts Opts) *Cache {
+	if opts.TTL == 0 {
+		opts.TTL = DefaultTTL
+	}
+	if opts.Size == 0 {
+		opts.Size = DefaultSize
+	}
+	if opts.Shards == 0 {
+		opts.Shards = DefaultShards
+	}
+	if opts.Shards > opts.Size {
+		opts.Shards = opts.Size
+	}
+
+	c := &Cache{
+		TTL:    opts.TTL,
+		shards: make([]*shard, opts.Shards),
 		hitsTotal: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
+			Namespace: opts.Namespace,
 			Subsystem: "cache",
 			Name:      "hits_total",
 			Help:      "Total number of cache hits.",
 		}),
 		missesTotal: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
+			Namespace: opts.Namespace,
 			Subsystem: "cache",
 			Name:      "misses_total",
 			Help:      "Total number of cache misses.",
 		}),
 		refreshTotal: prometheus.NewCounter(prometheus.CounterOpts{
-			Namespace: namespace,
+			Namespace: opts.Namespace,
 			Subsystem: "cache",
 			Name:      "refresh_total",
 			Help:      "Total number of times cache Refresh.",
 		}),
+		evictionsTotal: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Subsystem: "cache",
+			Name:      "evictions_total",
+			Help:      "Total number of entries evicted from the cache.",
+		}, []string{"reason"}),
+		size: prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: opts.Namespace,
+			Subsystem: "cache",
+			Name:      "size",
+			Help:      "Number of entries in the cache.",
+		}),
 	}
+
+	// Capacity is rounded up, so the cache never holds less than requested.
+	capacity := (opts.Size + opts.Shards - 1) / opts.Shards
+	for i := range c.shards {
+		c.shards[i] = &shard{
+			capacity: capacity,
+			data:     make(map[uint64]*list.Element),
+			lru:      list.New(),
+		}
+	}
+
+	return c
 }
 
+func (c *Cache) shard(k uint64) *shard {
+	return c.shards[k%uint64(len(c.shards))]
+}
+
+// Refresh marks entry as being refreshed, so concurrent readers keep using it in the meantime.
+// It is a no-op if entry does not exist.
 func (c *Cache) Refresh(k uint64) {
 	c.refreshTotal.Add(1)
 
-	c.dataLock.Lock()
-	c.data[k].Refresh = true
-	c.dataLock.Unlock()
+	s := c.shard(k)
+	s.Lock()
+	if el, ok := s.data[k]; ok {
+		it := el.Value.(*item)
+		// Entries that were already returned to the readers are never mutated.
+		ent := *it.entry
+		ent.Refresh = true
+		it.entry = &ent
+	}
+	s.Unlock()
 }
 
+// Put inserts or replaces an entry, least recently used entry is evicted if shard is full.
 func (c *Cache) Put(k uint64, ses mnemosynerpc.Session) {
-	c.dataLock.Lock()
-	c.data[k] = &Entry{Ses: ses, Exp: time.Now().Add(c.TTL), Refresh: false}
-	c.dataLock.Unlock()
+	ent := &Entry{Ses: ses, Exp: time.Now().Add(c.TTL), Refresh: false}
+
+	s := c.shard(k)
+	s.Lock()
+	defer s.Unlock()
+
+	if el, ok := s.data[k]; ok {
+		el.Value.(*item).entry = ent
+		s.lru.MoveToFront(el)
+		return
+	}
+
+	s.data[k] = s.lru.PushFront(&item{key: k, entry: ent})
+	c.size.Inc()
+
+	for s.lru.Len() > s.capacity {
+		c.remove(s, s.lru.Back())
+		c.evictionsTotal.WithLabelValues("capacity").Inc()
+	}
 }
 
+// Del removes an entry if it exists.
 func (c *Cache) Del(k uint64) {
-	c.dataLock.Lock()
-	delete(c.data, k)
-	c.dataLock.Unlock()
+	s := c.shard(k)
+	s.Lock()
+	if el, ok := s.data[k]; ok {
+		c.remove(s, el)
+	}
+	s.Unlock()
+}
+
+// DelFunc removes all entries for which given function returns true.
+// It returns number of removed entries.
+func (c *Cache) DelFunc(fn func(*Entry) bool) (n int) {
+	for _, s := range c.shards {
+		s.Lock()
+		for _, el := range s.data {
+			if fn(el.Value.(*item).entry) {
+				c.remove(s, el)
+				n++
+			}
+		}
+		s.Unlock()
+	}
+	return n
 }
 
+// Read returns an entry, even if it is already expired.
 func (c *Cache) Read(k uint64) (*Entry, bool) {
-	c.dataLock.RLock()
-	entry, ok := c.data[k]
-	c.dataLock.RUnlock()
+	var ent *Entry
+
+	s := c.shard(k)
+	s.Lock()
+	el, ok := s.data[k]
+	if ok {
+		s.lru.MoveToFront(el)
+		ent = el.Value.(*item).entry
+	}
+	s.Unlock()
+
 	if ok {
 		c.hitsTotal.Add(1)
 	} else {
 		c.missesTotal.Add(1)
 	}
-	return entry, ok
+	return ent, ok
+}
+
+// Len returns number of entries in the cache.
+func (c *Cache) Len() (n int) {
+	for _, s := range c.shards {
+		s.Lock()
+		n += s.lru.Len()
+		s.Unlock()
+	}
+	return n
+}
+
+// Sweep periodically removes entries that expired at least TTL ago.
+// Such entries are stale and would be refetched anyway,
+// including those whose refresh never completed.
+// It blocks until given context is canceled.
+func (c *Cache) Sweep(ctx context.Context) {
+	ticker := time.NewTicker(c.TTL)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			c.sweep(time.Now().Add(-c.TTL))
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (c *Cache) sweep(before time.Time) {
+	for _, s := range c.shards {
+		s.Lock()
+		for _, el := range s.data {
+			if el.Value.(*item).entry.Exp.Before(before) {
+				c.remove(s, el)
+				c.evictionsTotal.WithLabelValues("expired").Inc()
+			}
+		}
+		s.Unlock()
+	}
+}
+
+// remove expects shard lock to be acquired.
+func (c *Cache) remove(s *shard, el *list.Element) {
+	delete(s.data, el.Value.(*item).key)
+	s.lru.Remove(el)
+	c.size.Dec()
 }
 
 // Collect implements prometheus Collector interface.
@@ -89,6 +270,8 @@ func (c *Cache) Collect(in chan<- prometheus.Metric) {
 	c.hitsTotal.Collect(in)
 	c.refreshTotal.Collect(in)
 	c.missesTotal.Collect(in)
+	c.evictionsTotal.Collect(in)
+	c.size.Collect(in)
 }
 
 // Describe implements prometheus Collector interface.
@@ -96,4 +279,6 @@ func (c *Cache) Describe(in chan<- *prometheus.Desc) {
 	c.hitsTotal.Describe(in)
 	c.refreshTotal.Describe(in)
 	c.missesTotal.Describe(in)
+	c.evictionsTotal.Describe(in)
+	c.size.Describe(in)
 }
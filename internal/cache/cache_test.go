@@ -0,0 +1,85 @@
+package cache_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+)
+
+func TestCache_Put(t *testing.T) {
+	c := cache.New(cache.Opts{Size: 2, Shards: 1})
+
+	c.Put(1, mnemosynerpc.Session{AccessToken: "1"})
+	c.Put(2, mnemosynerpc.Session{AccessToken: "2"})
+	if _, ok := c.Read(1); !ok {
+		t.Fatal("entry expected")
+	}
+	// 2 is least recently used now.
+	c.Put(3, mnemosynerpc.Session{AccessToken: "3"})
+
+	if _, ok := c.Read(2); ok {
+		t.Error("least recently used entry should be evicted")
+	}
+	for _, k := range []uint64{1, 3} {
+		if _, ok := c.Read(k); !ok {
+			t.Errorf("entry %d expected", k)
+		}
+	}
+	if c.Len() != 2 {
+		t.Errorf("wrong number of entries, expected 2 but got %d", c.Len())
+	}
+}
+
+func TestCache_Refresh(t *testing.T) {
+	c := cache.New(cache.Opts{})
+	c.Refresh(1) // missing key is a no-op
+
+	c.Put(1, mnemosynerpc.Session{AccessToken: "1"})
+	before, _ := c.Read(1)
+	c.Refresh(1)
+	after, _ := c.Read(1)
+
+	if before.Refresh {
+		t.Error("entry returned before refresh should not be modified")
+	}
+	if !after.Refresh {
+		t.Error("entry should be marked as being refreshed")
+	}
+}
+
+func TestCache_Sweep(t *testing.T) {
+	c := cache.New(cache.Opts{TTL: 10 * time.Millisecond})
+	c.Put(1, mnemosynerpc.Session{AccessToken: "1"})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.Sweep(ctx)
+
+	deadline := time.Now().Add(time.Second)
+	for c.Len() > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("expired entry should be swept")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestCache_DelFunc(t *testing.T) {
+	c := cache.New(cache.Opts{})
+	c.Put(1, mnemosynerpc.Session{AccessToken: "1", SubjectId: "a"})
+	c.Put(2, mnemosynerpc.Session{AccessToken: "2", SubjectId: "b"})
+	c.Put(3, mnemosynerpc.Session{AccessToken: "3", SubjectId: "a"})
+
+	n := c.DelFunc(func(ent *cache.Entry) bool {
+		return ent.Ses.SubjectId == "a"
+	})
+	if n != 2 {
+		t.Errorf("wrong number of removed entries, expected 2 but got %d", n)
+	}
+	if _, ok := c.Read(2); !ok || c.Len() != 1 {
+		t.Error("only entry 2 should remain")
+	}
+}
@@ -0,0 +1,275 @@
+// Package certificate keeps TLS certificates loaded from disk up to date.
+package certificate
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+)
+
+// DefaultReloadInterval is how often certificate files are checked for changes if not specified otherwise.
+const DefaultReloadInterval = 10 * time.Second
+
+const (
+	// ClientAuthNone does not ask for client certificates.
+	ClientAuthNone = "none"
+	// ClientAuthRequest verifies client certificate, if one is given.
+	ClientAuthRequest = "request"
+	// ClientAuthRequire rejects clients without a valid certificate.
+	ClientAuthRequire = "require"
+)
+
+// ParseClientAuth converts name of a client authentication mode into its tls equivalent.
+// Empty string is treated as ClientAuthNone.
+func ParseClientAuth(s string) (tls.ClientAuthType, error) {
+	switch s {
+	case "", ClientAuthNone:
+		return tls.NoClientCert, nil
+	case ClientAuthRequest:
+		return tls.VerifyClientCertIfGiven, nil
+	case ClientAuthRequire:
+		return tls.RequireAndVerifyClientCert, nil
+	default:
+		return tls.NoClientCert, fmt.Errorf("certificate: unknown client auth mode: %s", s)
+	}
+}
+
+// Opts holds paths of files the Reloader loads certificates from.
+type Opts struct {
+	CertFile string
+	KeyFile  string
+	// PeerCertFile and PeerKeyFile hold the certificate presented to other nodes.
+	// If not set, CertFile and KeyFile are used.
+	PeerCertFile string
+	PeerKeyFile  string
+	// CAFile holds certificates of authorities that client and peer certificates are verified against.
+	// If not set, system pool is used.
+	CAFile     string
+	ClientAuth tls.ClientAuthType
+	Logger     *zap.Logger
+}
+
+// Reloader keeps certificates loaded from disk.
+// Configurations it returns always use the most recently loaded ones,
+// so connections established after a reload are not affected by a restart.
+type Reloader struct {
+	opts Opts
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	peerCert *tls.Certificate
+	roots    *x509.CertPool
+	modTimes map[string]time.Time
+}
+
+// NewReloader allocates new Reloader and loads certificates for the first time.
+func NewReloader(opts Opts) (*Reloader, error) {
+	if opts.CertFile == "" || opts.KeyFile == "" {
+		return nil, errors.New("certificate: cert and key files are required")
+	}
+	if opts.PeerCertFile == "" && opts.PeerKeyFile == "" {
+		opts.PeerCertFile, opts.PeerKeyFile = opts.CertFile, opts.KeyFile
+	}
+	if opts.Logger == nil {
+		opts.Logger = zap.NewNop()
+	}
+
+	r := &Reloader{opts: opts}
+	if err := r.Reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Reload loads all certificates from disk.
+// If any of them cannot be loaded, previous ones are kept.
+func (r *Reloader) Reload() error {
+	modTimes, err := r.stat()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.opts.CertFile, r.opts.KeyFile)
+	if err != nil {
+		return fmt.Errorf("certificate: key pair cannot be loaded: %s", err.Error())
+	}
+	peerCert, err := tls.LoadX509KeyPair(r.opts.PeerCertFile, r.opts.PeerKeyFile)
+	if err != nil {
+		return fmt.Errorf("certificate: peer key pair cannot be loaded: %s", err.Error())
+	}
+	var roots *x509.CertPool
+	if r.opts.CAFile != "" {
+		buf, err := ioutil.ReadFile(r.opts.CAFile)
+		if err != nil {
+			return fmt.Errorf("certificate: certificate authorities cannot be loaded: %s", err.Error())
+		}
+		roots = x509.NewCertPool()
+		if !roots.AppendCertsFromPEM(buf) {
+			return fmt.Errorf("certificate: no certificate authority found in %s", r.opts.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.peerCert, r.roots, r.modTimes = &cert, &peerCert, roots, modTimes
+	r.mu.Unlock()
+
+	return nil
+}
+
+func (r *Reloader) files() []string {
+	files := []string{r.opts.CertFile, r.opts.KeyFile, r.opts.PeerCertFile, r.opts.PeerKeyFile}
+	if r.opts.CAFile != "" {
+		files = append(files, r.opts.CAFile)
+	}
+	return files
+}
+
+func (r *Reloader) stat() (map[string]time.Time, error) {
+	modTimes := make(map[string]time.Time)
+	for _, f := range r.files() {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, fmt.Errorf("certificate: %s", err.Error())
+		}
+		modTimes[f] = info.ModTime()
+	}
+	return modTimes, nil
+}
+
+// changed returns true if any of the files was modified since the last reload.
+func (r *Reloader) changed() bool {
+	modTimes, err := r.stat()
+	if err != nil {
+		// File can be missing for a moment while it is being replaced.
+		return false
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for f, t := range modTimes {
+		if !t.Equal(r.modTimes[f]) {
+			return true
+		}
+	}
+	return false
+}
+
+// Watch checks files periodically and reloads certificates once any of them changes.
+// It blocks until given context is canceled.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if !r.changed() {
+				continue
+			}
+			if err := r.Reload(); err != nil {
+				r.opts.Logger.Error("certificates reload failure", zap.Error(err))
+				continue
+			}
+			r.opts.Logger.Info("certificates reloaded")
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// ServerConfig returns configuration of a server that uses the most recently loaded certificate
+// and verifies client certificates according to the client auth mode.
+func (r *Reloader) ServerConfig(nextProtos ...string) *tls.Config {
+	return r.serverConfig(func() tls.ClientAuthType { return r.opts.ClientAuth }, nextProtos)
+}
+
+// ServerConfigWithoutClientAuth works like ServerConfig, but it never asks for client certificates.
+// It is meant for endpoints polled by tools that do not have one, e.g. health checks and metrics scrapers.
+func (r *Reloader) ServerConfigWithoutClientAuth(nextProtos ...string) *tls.Config {
+	return r.serverConfig(func() tls.ClientAuthType { return tls.NoClientCert }, nextProtos)
+}
+
+func (r *Reloader) serverConfig(clientAuth func() tls.ClientAuthType, nextProtos []string) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		NextProtos: nextProtos,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				NextProtos:   nextProtos,
+				Certificates: []tls.Certificate{*r.cert},
+				ClientCAs:    r.roots,
+				ClientAuth:   clientAuth(),
+			}, nil
+		},
+	}
+}
+
+// ServerName returns a name the most recently loaded server certificate is valid for.
+// It allows a client that connects to the very same process over a loopback address to verify it, see ClientConfig.
+func (r *Reloader) ServerName() (string, error) {
+	r.mu.RLock()
+	cert := r.cert
+	r.mu.RUnlock()
+
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return "", fmt.Errorf("certificate: server certificate cannot be parsed: %s", err.Error())
+	}
+	switch {
+	case len(leaf.DNSNames) > 0:
+		return leaf.DNSNames[0], nil
+	case len(leaf.IPAddresses) > 0:
+		return leaf.IPAddresses[0].String(), nil
+	}
+	return "", errors.New("certificate: server certificate does not hold any name")
+}
+
+// ClientConfig returns configuration of a client that connects to other nodes.
+// It presents the peer certificate and verifies the server against the most recently loaded authorities.
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			r.mu.RLock()
+			defer r.mu.RUnlock()
+
+			return r.peerCert, nil
+		},
+		// Authorities can change at runtime, so the verification is done against the current pool instead.
+		InsecureSkipVerify: true,
+		VerifyConnection:   r.verifyServer,
+	}
+}
+
+func (r *Reloader) verifyServer(cs tls.ConnectionState) error {
+	if len(cs.PeerCertificates) == 0 {
+		return errors.New("certificate: server did not present a certificate")
+	}
+
+	r.mu.RLock()
+	roots := r.roots
+	r.mu.RUnlock()
+
+	opts := x509.VerifyOptions{
+		DNSName:       cs.ServerName,
+		Roots:         roots,
+		Intermediates: x509.NewCertPool(),
+	}
+	for _, cert := range cs.PeerCertificates[1:] {
+		opts.Intermediates.AddCert(cert)
+	}
+	_, err := cs.PeerCertificates[0].Verify(opts)
+	return err
+}
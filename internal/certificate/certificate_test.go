@@ -0,0 +1,349 @@
+package certificate_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/certificate"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+}
+
+func newAuthority(t *testing.T, dir, name string) *authority {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	tpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, tpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	writePEM(t, filepath.Join(dir, name+".crt"), "CERTIFICATE", der)
+
+	return &authority{cert: cert, key: key}
+}
+
+// issue writes key pair signed by the authority into the dir, as <name>.crt and <name>.key.
+func (a *authority) issue(t *testing.T, dir, name string, serial int64) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	tpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tpl, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	buf, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	writePEM(t, filepath.Join(dir, name+".crt"), "CERTIFICATE", der)
+	writePEM(t, filepath.Join(dir, name+".key"), "EC PRIVATE KEY", buf)
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "mnemosyne-certificate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		os.RemoveAll(dir)
+	})
+	return dir
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	if err := ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+}
+
+func newReloader(t *testing.T, dir string, clientAuth tls.ClientAuthType) *certificate.Reloader {
+	r, err := certificate.NewReloader(certificate.Opts{
+		CertFile:     filepath.Join(dir, "server.crt"),
+		KeyFile:      filepath.Join(dir, "server.key"),
+		PeerCertFile: filepath.Join(dir, "peer.crt"),
+		PeerKeyFile:  filepath.Join(dir, "peer.key"),
+		CAFile:       filepath.Join(dir, "ca.crt"),
+		ClientAuth:   clientAuth,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return r
+}
+
+// handshake establishes connection between given configurations and returns certificate presented by the server.
+func handshake(t *testing.T, server, client *tls.Config) (*x509.Certificate, error) {
+	lis, err := tls.Listen("tcp", "127.0.0.1:0", server)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defer lis.Close()
+
+	go func() {
+		conn, err := lis.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		conn.(*tls.Conn).Handshake()
+		// Client reports rejection only after reading from the connection.
+		conn.Write([]byte{0})
+	}()
+
+	conn, err := tls.Dial("tcp", lis.Addr().String(), client)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if _, err := conn.Read(make([]byte, 1)); err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestReloader(t *testing.T) {
+	dir := tempDir(t)
+	ca := newAuthority(t, dir, "ca")
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "peer", 3)
+
+	r := newReloader(t, dir, tls.RequireAndVerifyClientCert)
+
+	cert, err := handshake(t, r.ServerConfig(), r.ClientConfig())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if cert.Subject.CommonName != "server" {
+		t.Errorf("wrong server certificate: %s", cert.Subject.CommonName)
+	}
+}
+
+func TestReloader_clientAuth(t *testing.T) {
+	dir := tempDir(t)
+	ca := newAuthority(t, dir, "ca")
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "peer", 3)
+
+	// Client that trusts the server, but does not present any certificate.
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	anonymous := &tls.Config{RootCAs: roots}
+
+	cases := map[string]struct {
+		clientAuth tls.ClientAuthType
+		accepted   bool
+	}{
+		"none":    {clientAuth: tls.NoClientCert, accepted: true},
+		"request": {clientAuth: tls.VerifyClientCertIfGiven, accepted: true},
+		"require": {clientAuth: tls.RequireAndVerifyClientCert, accepted: false},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			r := newReloader(t, dir, c.clientAuth)
+
+			_, err := handshake(t, r.ServerConfig(), anonymous)
+			if c.accepted && err != nil {
+				t.Errorf("unexpected error: %s", err.Error())
+			}
+			if !c.accepted && err == nil {
+				t.Error("client without certificate should be rejected")
+			}
+		})
+	}
+}
+
+func TestReloader_ServerConfigWithoutClientAuth(t *testing.T) {
+	dir := tempDir(t)
+	ca := newAuthority(t, dir, "ca")
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "peer", 3)
+
+	roots := x509.NewCertPool()
+	roots.AddCert(ca.cert)
+	anonymous := &tls.Config{RootCAs: roots}
+
+	r := newReloader(t, dir, tls.RequireAndVerifyClientCert)
+	if _, err := handshake(t, r.ServerConfigWithoutClientAuth(), anonymous); err != nil {
+		t.Errorf("client without certificate should be accepted, got: %s", err.Error())
+	}
+}
+
+func TestReloader_ServerName(t *testing.T) {
+	dir := tempDir(t)
+	ca := newAuthority(t, dir, "ca")
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "peer", 3)
+
+	r := newReloader(t, dir, tls.RequireAndVerifyClientCert)
+	name, err := r.ServerName()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if name != "127.0.0.1" {
+		t.Errorf("wrong server name: %s", name)
+	}
+
+	config := r.ClientConfig()
+	config.ServerName = name
+	if _, err := handshake(t, r.ServerConfig(), config); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestReloader_untrusted(t *testing.T) {
+	dir, other := tempDir(t), tempDir(t)
+	ca := newAuthority(t, dir, "ca")
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "peer", 3)
+	// Peer certificate issued by an authority the server does not trust.
+	newAuthority(t, other, "ca").issue(t, dir, "peer", 4)
+
+	r := newReloader(t, dir, tls.RequireAndVerifyClientCert)
+
+	if _, err := handshake(t, r.ServerConfig(), r.ClientConfig()); err == nil {
+		t.Error("peer with untrusted certificate should be rejected")
+	}
+}
+
+func TestReloader_Reload(t *testing.T) {
+	dir := tempDir(t)
+	ca := newAuthority(t, dir, "ca")
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "peer", 3)
+
+	r := newReloader(t, dir, tls.NoClientCert)
+	server, client := r.ServerConfig(), r.ClientConfig()
+
+	ca.issue(t, dir, "server", 5)
+	if err := r.Reload(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	cert, err := handshake(t, server, client)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if cert.SerialNumber.Int64() != 5 {
+		t.Errorf("reloaded certificate expected, got serial number %s", cert.SerialNumber)
+	}
+
+	// Broken key pair should not replace the one that works.
+	if err := ioutil.WriteFile(filepath.Join(dir, "server.crt"), []byte("broken"), 0600); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := r.Reload(); err == nil {
+		t.Fatal("expected error")
+	}
+	if _, err := handshake(t, server, client); err != nil {
+		t.Errorf("previous certificate should be kept, got error: %s", err.Error())
+	}
+}
+
+func TestReloader_Watch(t *testing.T) {
+	dir := tempDir(t)
+	ca := newAuthority(t, dir, "ca")
+	ca.issue(t, dir, "server", 2)
+	ca.issue(t, dir, "peer", 3)
+
+	r := newReloader(t, dir, tls.NoClientCert)
+	server, client := r.ServerConfig(), r.ClientConfig()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go r.Watch(ctx, 10*time.Millisecond)
+
+	ca.issue(t, dir, "server", 6)
+	// Modification time resolution of some file systems is coarse.
+	future := time.Now().Add(time.Minute)
+	if err := os.Chtimes(filepath.Join(dir, "server.crt"), future, future); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cert, err := handshake(t, server, client)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if cert.SerialNumber.Int64() == 6 {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("certificate was not reloaded, got serial number %s", cert.SerialNumber)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestNewReloader_missingFiles(t *testing.T) {
+	if _, err := certificate.NewReloader(certificate.Opts{}); err == nil {
+		t.Error("expected error")
+	}
+	if _, err := certificate.NewReloader(certificate.Opts{CertFile: "missing.crt", KeyFile: "missing.key"}); err == nil {
+		t.Error("expected error")
+	}
+}
+
+func TestParseClientAuth(t *testing.T) {
+	cases := map[string]tls.ClientAuthType{
+		"":        tls.NoClientCert,
+		"none":    tls.NoClientCert,
+		"request": tls.VerifyClientCertIfGiven,
+		"require": tls.RequireAndVerifyClientCert,
+	}
+
+	for given, exp := range cases {
+		got, err := certificate.ParseClientAuth(given)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if got != exp {
+			t.Errorf("wrong client auth type for %q, expected %s but got %s", given, exp, got)
+		}
+	}
+	if _, err := certificate.ParseClientAuth("always"); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -3,12 +3,12 @@ package cluster
 import (
 	"context"
 	"encoding/json"
+	"hash/fnv"
 	"sort"
 	"strconv"
-	"strings"
-
-	"github.com/piotrkowalczuk/mnemosyne/internal/constant"
+	"sync"
 
+	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 	"go.uber.org/zap"
@@ -23,14 +23,27 @@ type Node struct {
 	Addr   string                            `json:"addr"`
 	Client mnemosynerpc.SessionManagerClient `json:"-"`
 	Health grpc_health_v1.HealthClient       `json:"-"`
+	conn   *grpc.ClientConn
 }
 
 // Cluster ...
 type Cluster struct {
-	listen  string
-	buckets int
-	nodes   []*Node
-	logger  *zap.Logger
+	listen string
+	logger *zap.Logger
+	// mu guards the ring, nodes slice is never modified, it is replaced if membership changes.
+	mu        sync.RWMutex
+	buckets   int
+	nodes     []*Node
+	previous  []*Node
+	connected bool
+	dialOpts  []grpc.DialOption
+
+	// partitioned if true, access tokens that carry a partition are routed using the partition map.
+	partitioned bool
+	// homes map home partitions to indexes of nodes (and previous nodes) that claimed them.
+	homes, previousHomes map[uint16]int
+	// partition is the partition of access tokens started by the current node, negative if there is none.
+	partition int32
 }
 
 // Opts ...
@@ -38,47 +51,105 @@ type Opts struct {
 	Listen string
 	Seeds  []string
 	Logger *zap.Logger
+	// Partitioned if true, access tokens that carry a partition are owned by the node the partition map assigns it to,
+	// instead of the one the whole token hashes to. All nodes of the cluster need to agree on it.
+	Partitioned bool
 }
 
 // New ...
 func New(opts Opts) (csr *Cluster, err error) {
-	var (
-		nodes  []string
-		exists bool
-	)
-	for _, seed := range opts.Seeds {
-		if seed == opts.Listen {
-			exists = true
-		}
-	}
-	if !exists {
-		nodes = append(nodes, opts.Listen)
-	}
-
-	nodes = append(nodes, opts.Seeds...)
-	sort.Strings(nodes)
-
 	csr = &Cluster{
-		nodes:  make([]*Node, 0),
-		listen: opts.Listen,
-		logger: opts.Logger,
+		nodes:       make([]*Node, 0),
+		listen:      opts.Listen,
+		logger:      opts.Logger,
+		partitioned: opts.Partitioned,
 	}
 
-	for i, addr := range nodes {
-		if addr == "" {
-			continue
-		}
+	for i, addr := range members(opts.Listen, opts.Seeds) {
 		csr.buckets++
 		csr.nodes = append(csr.nodes, &Node{
 			ID:   i,
 			Addr: addr,
 		})
 	}
+	csr.homes = homes(csr.nodes)
+	csr.partition = partition(csr.listen, csr.nodes, csr.homes)
 	return csr, nil
 }
 
+// homes returns home partitions of given nodes. If nodes collide, the first one claims the partition.
+func homes(nodes []*Node) map[uint16]int {
+	res := make(map[uint16]int, len(nodes))
+	for i, n := range nodes {
+		p := mnemosyne.HomePartition(n.Addr)
+		if _, ok := res[p]; !ok {
+			res[p] = i
+		}
+	}
+	return res
+}
+
+// partitionOwner returns index of a node that owns given partition.
+// Partitions that are not claimed by any node are spread using jump hash.
+func partitionOwner(nodes []*Node, homes map[uint16]int, p uint16) int {
+	if i, ok := homes[p]; ok {
+		return i
+	}
+	return int(jump.Hash(uint64(p), len(nodes)))
+}
+
+// partition returns home partition of the node with given address.
+// If it was claimed by another node, the first partition the node owns is returned instead.
+func partition(listen string, nodes []*Node, homes map[uint16]int) int32 {
+	if len(nodes) == 0 {
+		return -1
+	}
+	home := mnemosyne.HomePartition(listen)
+	if i, ok := homes[home]; ok && nodes[i].Addr == listen {
+		return int32(home)
+	}
+	for p := 0; p < mnemosyne.Partitions; p++ {
+		if nodes[partitionOwner(nodes, homes, uint16(p))].Addr == listen {
+			return int32(p)
+		}
+	}
+	return -1
+}
+
+// owner returns index of a node that owns given access token.
+// Token fingerprint is owned by the same node as the token itself.
+func (c *Cluster) owner(nodes []*Node, homes map[uint16]int, accessToken string) int {
+	if c.partitioned {
+		if p, ok := mnemosyne.AccessTokenPartition(accessToken); ok {
+			return partitionOwner(nodes, homes, p)
+		}
+	}
+	return int(jump.Hash(mnemosyne.AccessTokenSum64(accessToken), len(nodes)))
+}
+
+// members returns sorted, unique and non-empty addresses, including listen address.
+func members(listen string, seeds []string) []string {
+	unique := make(map[string]struct{}, len(seeds)+1)
+	nodes := make([]string, 0, len(seeds)+1)
+	for _, addr := range append([]string{listen}, seeds...) {
+		if _, ok := unique[addr]; ok || addr == "" {
+			continue
+		}
+		unique[addr] = struct{}{}
+		nodes = append(nodes, addr)
+	}
+	sort.Strings(nodes)
+	return nodes
+}
+
 // Connect ...
 func (c *Cluster) Connect(ctx context.Context, opts ...grpc.DialOption) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.connected = true
+	c.dialOpts = opts
+
 	for i, n := range c.nodes {
 		if n.Addr == c.listen {
 			continue
@@ -88,41 +159,178 @@ func (c *Cluster) Connect(ctx context.Context, opts ...grpc.DialOption) error {
 			c.logger.Debug("cluster node attempt to connect", zap.String("address", n.Addr), zap.Int("index", i))
 		}
 
-		conn, err := grpc.DialContext(ctx, n.Addr, opts...)
-		if err != nil {
+		if err := c.dial(ctx, n); err != nil {
 			return err
 		}
 
 		if c.logger != nil {
 			c.logger.Debug("cluster node connection success", zap.String("address", n.Addr), zap.Int("index", i))
 		}
+	}
 
-		n.Client = mnemosynerpc.NewSessionManagerClient(conn)
-		n.Health = grpc_health_v1.NewHealthClient(conn)
+	return nil
+}
+
+func (c *Cluster) dial(ctx context.Context, n *Node) error {
+	conn, err := grpc.DialContext(ctx, n.Addr, c.dialOpts...)
+	if err != nil {
+		return err
 	}
 
+	n.conn = conn
+	n.Client = mnemosynerpc.NewSessionManagerClient(conn)
+	n.Health = grpc_health_v1.NewHealthClient(conn)
 	return nil
 }
 
+// Update replaces cluster members with given addresses, listen address is always a member.
+// Connections of nodes that stay in the cluster are reused,
+// new nodes are connected (if Connect was called before) and connections of removed nodes are closed.
+// It returns nodes that joined and left the cluster, both are empty if membership has not changed.
+func (c *Cluster) Update(ctx context.Context, seeds []string) (joined, left []*Node, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	current := make(map[string]*Node, len(c.nodes))
+	for _, n := range c.nodes {
+		current[n.Addr] = n
+	}
+
+	addrs := members(c.listen, seeds)
+	nodes := make([]*Node, 0, len(addrs))
+	for i, addr := range addrs {
+		n := &Node{ID: i, Addr: addr}
+		if prev, ok := current[addr]; ok {
+			n.Client, n.Health, n.conn = prev.Client, prev.Health, prev.conn
+			delete(current, addr)
+		} else {
+			joined = append(joined, n)
+		}
+		nodes = append(nodes, n)
+	}
+	for _, n := range c.nodes {
+		if _, ok := current[n.Addr]; ok {
+			left = append(left, n)
+		}
+	}
+
+	if len(joined) == 0 && len(left) == 0 {
+		return nil, nil, nil
+	}
+
+	if c.connected {
+		for i, n := range joined {
+			if n.Addr == c.listen {
+				continue
+			}
+			if err := c.dial(ctx, n); err != nil {
+				for _, n := range joined[:i] {
+					if n.conn != nil {
+						n.conn.Close()
+					}
+				}
+				return nil, nil, err
+			}
+		}
+	}
+	for _, n := range left {
+		if n.conn == nil {
+			continue
+		}
+		if err := n.conn.Close(); err != nil && c.logger != nil {
+			c.logger.Warn("cluster node connection close failure", zap.String("address", n.Addr), zap.Error(err))
+		}
+	}
+
+	c.previous, c.previousHomes = c.nodes, c.homes
+	c.nodes, c.homes = nodes, homes(nodes)
+	c.buckets = len(nodes)
+	c.partition = partition(c.listen, c.nodes, c.homes)
+
+	return joined, left, nil
+}
+
+// Replicas returns nodes that hold given access token, the owner first followed by its successors.
+// At most n nodes are returned, current node included.
+func (c *Cluster) Replicas(accessToken string, n int) []*Node {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	nodes, homes := c.nodes, c.homes
+	c.mu.RUnlock()
+
+	return c.replicas(nodes, homes, accessToken, n)
+}
+
+// PreviousReplicas returns addresses of nodes that held given access token before the last membership change, see Replicas.
+// Returns nil if membership has never changed.
+func (c *Cluster) PreviousReplicas(accessToken string, n int) []string {
+	if c == nil {
+		return nil
+	}
+
+	c.mu.RLock()
+	previous, previousHomes := c.previous, c.previousHomes
+	c.mu.RUnlock()
+
+	replicas := c.replicas(previous, previousHomes, accessToken, n)
+	if len(replicas) == 0 {
+		return nil
+	}
+	res := make([]string, 0, len(replicas))
+	for _, r := range replicas {
+		res = append(res, r.Addr)
+	}
+	return res
+}
+
+func (c *Cluster) replicas(nodes []*Node, homes map[uint16]int, accessToken string, n int) []*Node {
+	if len(nodes) == 0 {
+		return nil
+	}
+	if n > len(nodes) {
+		n = len(nodes)
+	}
+
+	owner := c.owner(nodes, homes, accessToken)
+	res := make([]*Node, 0, n)
+	for i := 0; i < n; i++ {
+		res = append(res, nodes[(owner+i)%len(nodes)])
+	}
+	return res
+}
+
 // Get if possible returns node for a given bucket id.
 func (c *Cluster) Get(k int32) (*Node, bool) {
-	if len(c.nodes) == 0 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	return get(c.nodes, k)
+}
+
+func get(nodes []*Node, k int32) (*Node, bool) {
+	if len(nodes) == 0 {
 		return nil, false
 	}
-	if len(c.nodes)-1 < int(k) {
+	if len(nodes)-1 < int(k) {
 		return nil, false
 	}
-	return c.nodes[k], true
+	return nodes[k], true
 }
 
 // Nodes returns all available nodes.
 func (c *Cluster) Nodes() []*Node {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return c.nodes
 }
 
 // ExternalNodes returns all available nodes except host.
 func (c *Cluster) ExternalNodes() (res []*Node) {
-	for _, n := range c.nodes {
+	for _, n := range c.Nodes() {
 		if n.Addr != c.listen {
 			res = append(res, n)
 		}
@@ -130,8 +338,31 @@ func (c *Cluster) ExternalNodes() (res []*Node) {
 	return
 }
 
+// Member returns true if node with given address belongs to the cluster.
+func (c *Cluster) Member(addr string) bool {
+	for _, n := range c.Nodes() {
+		if n.Addr == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Checksum returns a checksum of cluster members, it changes with every membership change.
+func (c *Cluster) Checksum() uint64 {
+	h := fnv.New64a()
+	for _, n := range c.Nodes() {
+		h.Write([]byte(n.Addr))
+		h.Write([]byte{0})
+	}
+	return h.Sum64()
+}
+
 // Len returns number of nodes.
 func (c *Cluster) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	return c.buckets
 }
 
@@ -146,11 +377,17 @@ func (c *Cluster) GetOther(accessToken string) (*Node, bool) {
 	if c == nil {
 		return nil, false
 	}
-	if c.Len() == 1 {
+
+	// The same snapshot of the ring needs to be used for hashing and lookup.
+	c.mu.RLock()
+	nodes, homes := c.nodes, c.homes
+	c.mu.RUnlock()
+
+	if len(nodes) <= 1 {
 		return nil, false
 	}
 
-	if node, ok := c.Get(jump.HashString(accessToken, c.Len())); ok {
+	if node, ok := get(nodes, int32(c.owner(nodes, homes, accessToken))); ok {
 		if node.Addr != c.listen {
 			if node.Client != nil {
 				return node, true
@@ -160,8 +397,54 @@ func (c *Cluster) GetOther(accessToken string) (*Node, bool) {
 	return nil, false
 }
 
+// GetPrevious returns node that owned given access token before the last membership change.
+// Returns false if membership has never changed, the node was the current one or it is no longer a member.
+// Returned node holds current connection.
+func (c *Cluster) GetPrevious(accessToken string) (*Node, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	c.mu.RLock()
+	previous, previousHomes, nodes := c.previous, c.previousHomes, c.nodes
+	c.mu.RUnlock()
+
+	if len(previous) == 0 {
+		return nil, false
+	}
+	prev, ok := get(previous, int32(c.owner(previous, previousHomes, accessToken)))
+	if !ok || prev.Addr == c.listen {
+		return nil, false
+	}
+	for _, n := range nodes {
+		if n.Addr == prev.Addr && n.Client != nil {
+			return n, true
+		}
+	}
+	return nil, false
+}
+
+// Partition returns partition that access tokens started by the current node should carry, so that it owns them.
+// Returns false if cluster is nil or not partitioned.
+func (c *Cluster) Partition() (uint16, bool) {
+	if c == nil || !c.partitioned {
+		return 0, false
+	}
+
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.partition < 0 {
+		return 0, false
+	}
+	return uint16(c.partition), true
+}
+
 // GoString implements fmt GoStringer interface.
 func (c *Cluster) GoString() string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
 	buf, _ := json.Marshal(map[string]interface{}{
 		"listen":  c.listen,
 		"nodes":   c.nodes,
@@ -170,13 +453,20 @@ func (c *Cluster) GoString() string {
 	return string(buf)
 }
 
-func IsInternalRequest(ctx context.Context) bool {
+// localMetadataKey marks request that should be handled by the receiver,
+// even if according to the current topology it is not the owner.
+const localMetadataKey = "mnemosyne-local"
+
+// WithLocal returns context of a request that is handled by the receiver, regardless of the current topology.
+// It is used to read from the previous owner or a replica and to write to replicas.
+func WithLocal(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, localMetadataKey, "true")
+}
+
+// IsLocalRequest returns true if request was sent using context created by WithLocal.
+func IsLocalRequest(ctx context.Context) bool {
 	if md, ok := metadata.FromIncomingContext(ctx); ok {
-		if ua, ok := md["user-agent"]; ok {
-			if len(ua) > 0 {
-				return strings.Contains(ua[0], constant.Subsystem)
-			}
-		}
+		return len(md[localMetadataKey]) > 0 && IsInternalRequest(ctx)
 	}
 	return false
 }
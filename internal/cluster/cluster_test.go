@@ -13,6 +13,7 @@ import (
 	"strings"
 
 	_ "github.com/lib/pq"
+	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosyned"
 	"google.golang.org/grpc"
@@ -202,3 +203,187 @@ func testCluster(t *testing.T) (*cluster.Cluster, func()) {
 		m1c.Close()
 	}
 }
+
+func TestCluster_Update(t *testing.T) {
+	c, err := cluster.New(cluster.Opts{
+		Listen: "172.17.0.1",
+		Seeds:  []string{"172.17.0.2", "172.17.0.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := c.Connect(context.TODO(), grpc.WithInsecure()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	before, _ := c.Get(1)
+
+	joined, left, err := c.Update(context.TODO(), []string{"172.17.0.2", "172.17.0.4"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(joined) != 1 || joined[0].Addr != "172.17.0.4" {
+		t.Errorf("wrong joined nodes: %v", joined)
+	}
+	if len(left) != 1 || left[0].Addr != "172.17.0.3" {
+		t.Errorf("wrong left nodes: %v", left)
+	}
+	if c.Len() != 3 {
+		t.Errorf("wrong number of nodes, expected 3 but got %d", c.Len())
+	}
+	if !c.Member(c.Listen()) {
+		t.Error("current node should always be a member")
+	}
+	for i, n := range c.Nodes() {
+		if n.ID != i {
+			t.Errorf("node %s has wrong id, expected %d but got %d", n.Addr, i, n.ID)
+		}
+		if n.Addr != c.Listen() && n.Client == nil {
+			t.Errorf("node %s should be connected", n.Addr)
+		}
+	}
+	if after, _ := c.Get(1); after.Client != before.Client {
+		t.Error("connection of remaining node should be reused")
+	}
+
+	joined, left, err = c.Update(context.TODO(), []string{"172.17.0.4", "172.17.0.2", "172.17.0.1"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(joined) != 0 || len(left) != 0 {
+		t.Errorf("membership should not change, got joined %v and left %v", joined, left)
+	}
+}
+
+func TestCluster_PreviousReplicas(t *testing.T) {
+	c, err := cluster.New(cluster.Opts{
+		Listen: "172.17.0.1",
+		Seeds:  []string{"172.17.0.2", "172.17.0.3"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := c.Connect(context.TODO(), grpc.WithInsecure()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if got := c.PreviousReplicas("token", 2); got != nil {
+		t.Fatalf("membership has never changed, got %v", got)
+	}
+
+	before := c.Replicas("token", 2)
+	if _, _, err := c.Update(context.TODO(), []string{"172.17.0.2", "172.17.0.3", "172.17.0.4"}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	got := c.PreviousReplicas("token", 2)
+	if len(got) != len(before) {
+		t.Fatalf("wrong number of previous replicas, expected %d but got %d", len(before), len(got))
+	}
+	for i, n := range before {
+		if got[i] != n.Addr {
+			t.Errorf("wrong previous replica %d, expected %s but got %s", i, n.Addr, got[i])
+		}
+	}
+}
+
+func TestCluster_Partition(t *testing.T) {
+	c, err := cluster.New(cluster.Opts{
+		Listen:      "172.17.0.1:8080",
+		Seeds:       []string{"172.17.0.2:8080", "172.17.0.3:8080"},
+		Partitioned: true,
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := c.Connect(context.TODO(), grpc.WithInsecure()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	p, ok := c.Partition()
+	if !ok {
+		t.Fatal("partitioned cluster should assign a partition to the current node")
+	}
+	local, err := mnemosyne.RandomAccessTokenInPartition(p)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	remote, err := mnemosyne.RandomAccessTokenInPartition(mnemosyne.HomePartition("172.17.0.2:8080"))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	assert := func(stage string) {
+		t.Helper()
+
+		if n, ok := c.GetOther(local); ok {
+			t.Errorf("%s: token should be owned by the current node, got %s", stage, n.Addr)
+		}
+		if n, ok := c.GetOther(remote); !ok || n.Addr != "172.17.0.2:8080" {
+			t.Errorf("%s: token should be owned by its home node, got %v", stage, n)
+		}
+		if replicas := c.Replicas(remote, 2); len(replicas) != 2 || replicas[0].Addr != "172.17.0.2:8080" {
+			t.Errorf("%s: home node should hold the first replica, got %v", stage, replicas)
+		}
+	}
+	assert("initial")
+
+	seeds := []string{"172.17.0.2:8080", "172.17.0.3:8080"}
+	for i := 4; i < 10; i++ {
+		seeds = append(seeds, fmt.Sprintf("172.17.0.%d:8080", i))
+		if _, _, err := c.Update(context.TODO(), seeds); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		assert(fmt.Sprintf("%d nodes", c.Len()))
+	}
+
+	if _, _, err := c.Update(context.TODO(), seeds[1:]); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n, ok := c.GetPrevious(remote); ok {
+		t.Errorf("previous owner left the cluster, got %s", n.Addr)
+	}
+	if n, ok := c.GetOther(remote); ok && n.Addr == "172.17.0.2:8080" {
+		t.Error("partition of a node that left should be taken over by another one")
+	}
+}
+
+func TestCluster_Partition_disabled(t *testing.T) {
+	c, err := cluster.New(cluster.Opts{
+		Listen: "172.17.0.1:8080",
+		Seeds:  []string{"172.17.0.2:8080"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, ok := c.Partition(); ok {
+		t.Error("cluster that is not partitioned should not assign partitions")
+	}
+}
+
+func TestCluster_GetOther_fingerprint(t *testing.T) {
+	for _, partitioned := range []bool{false, true} {
+		c, err := cluster.New(cluster.Opts{
+			Listen:      "172.17.0.1:8080",
+			Seeds:       []string{"172.17.0.2:8080", "172.17.0.3:8080"},
+			Partitioned: partitioned,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if err := c.Connect(context.TODO(), grpc.WithInsecure()); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+
+		for i := 0; i < 100; i++ {
+			token, err := mnemosyne.RandomAccessTokenInPartition(uint16(i))
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			fp := mnemosyne.TokenFingerprint{KeyID: "key", Route: mnemosyne.TokenRoute(token), Hash: "hash"}.String()
+
+			exp, expOK := c.GetOther(token)
+			if got, ok := c.GetOther(fp); ok != expOK || (ok && got.Addr != exp.Addr) {
+				t.Fatalf("partitioned %t: fingerprint should be owned by the same node as the token, expected %v but got %v", partitioned, exp, got)
+			}
+		}
+	}
+}
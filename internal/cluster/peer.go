@@ -0,0 +1,303 @@
+package cluster
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	peerAddrMetadataKey      = "mnemosyne-peer-addr"
+	peerTimeMetadataKey      = "mnemosyne-peer-time"
+	peerSignatureMetadataKey = "mnemosyne-peer-signature"
+	peerNonceMetadataKey     = "mnemosyne-peer-nonce"
+	hopsMetadataKey          = "mnemosyne-hops"
+
+	// signedMetadataPrefix is a prefix of metadata keys covered by the signature,
+	// e.g. the ones that make the receiver handle the request locally.
+	signedMetadataPrefix = "mnemosyne-"
+
+	// peerTokenSkew is how much clocks of cluster nodes can differ, older signatures are rejected.
+	peerTokenSkew = time.Minute
+	// peerNonceSize is a number of random bytes that make each signed request unique.
+	peerNonceSize = 16
+)
+
+var errPeerSignatureMismatch = errors.New("signature mismatch")
+
+// peerContextKey is a context key under which authenticated peer is stored.
+type peerContextKey struct{}
+
+type peer struct {
+	addr string
+	hops int
+}
+
+// Authenticator signs requests sent to other nodes of the cluster and verifies requests received from them.
+// Each request carries the sender address, a timestamp, a nonce and a hop counter.
+// They are signed with HMAC-SHA256 keyed with a secret shared by all nodes,
+// together with the method, metadata prefixed with mnemosyne- and a digest of the request message.
+// Messages of streams are not covered, only the metadata they are opened with.
+// Requests without signature are treated as external, requests with invalid or reused one are rejected.
+type Authenticator struct {
+	listen string
+	secret []byte
+	now    func() time.Time
+	nonces nonces
+}
+
+// NewAuthenticator allocates new Authenticator for the node under given address.
+func NewAuthenticator(listen string, secret []byte) (*Authenticator, error) {
+	if len(secret) == 0 {
+		return nil, errors.New("cluster: empty peer secret")
+	}
+	return &Authenticator{
+		listen: listen,
+		secret: secret,
+		now:    time.Now,
+	}, nil
+}
+
+// sign returns signature of the method, the metadata prefixed with mnemosyne- and the digest of the request message.
+func (a *Authenticator) sign(method string, md metadata.MD, digest []byte) string {
+	keys := make([]string, 0, len(md))
+	for k := range md {
+		if k != peerSignatureMetadataKey && strings.HasPrefix(k, signedMetadataPrefix) {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+
+	mac := hmac.New(sha256.New, a.secret)
+	write := func(part string) {
+		mac.Write([]byte(part))
+		mac.Write([]byte{0})
+	}
+	write(method)
+	for _, k := range keys {
+		write(k)
+		write(strconv.Itoa(len(md[k])))
+		for _, v := range md[k] {
+			write(v)
+		}
+	}
+	mac.Write(digest)
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// digest returns hash of the request message, it is empty for streams.
+func digest(req interface{}) ([]byte, error) {
+	msg, ok := req.(proto.Message)
+	if !ok || msg == nil {
+		return nil, nil
+	}
+	// Maps have to be encoded in the same order by the sender and the receiver.
+	buf := proto.NewBuffer(nil)
+	buf.SetDeterministic(true)
+	if err := buf.Marshal(msg); err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(buf.Bytes())
+	return sum[:], nil
+}
+
+// outgoing returns context with signed peer metadata.
+// Hop counter is incremented, so the receiver knows how many times the request was forwarded.
+func (a *Authenticator) outgoing(ctx context.Context, method string, req interface{}) (context.Context, error) {
+	nonce := make([]byte, peerNonceSize)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, status.Errorf(codes.Internal, "peer nonce generation failure: %s", err.Error())
+	}
+	dgst, err := digest(req)
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "request digest failure: %s", err.Error())
+	}
+
+	ctx = metadata.AppendToOutgoingContext(ctx,
+		peerAddrMetadataKey, a.listen,
+		peerTimeMetadataKey, strconv.FormatInt(a.now().UnixNano(), 10),
+		peerNonceMetadataKey, base64.RawURLEncoding.EncodeToString(nonce),
+		hopsMetadataKey, strconv.Itoa(Hops(ctx)+1),
+	)
+	md, _ := metadata.FromOutgoingContext(ctx)
+
+	return metadata.AppendToOutgoingContext(ctx, peerSignatureMetadataKey, a.sign(method, md, dgst)), nil
+}
+
+// incoming verifies peer metadata of the request and returns context of an authenticated peer.
+// Context is returned untouched if there is no signature at all.
+func (a *Authenticator) incoming(ctx context.Context, method string, req interface{}) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok || len(md[peerSignatureMetadataKey]) == 0 {
+		return ctx, nil
+	}
+
+	p, err := a.verify(method, md, req)
+	if err != nil {
+		return nil, status.Errorf(codes.Unauthenticated, "peer authentication failure: %s", err.Error())
+	}
+	return context.WithValue(ctx, peerContextKey{}, p), nil
+}
+
+func (a *Authenticator) verify(method string, md metadata.MD, req interface{}) (*peer, error) {
+	first := func(key string) string {
+		if v := md[key]; len(v) == 1 {
+			return v[0]
+		}
+		return ""
+	}
+	addr, timestamp, nonce, hops := first(peerAddrMetadataKey), first(peerTimeMetadataKey), first(peerNonceMetadataKey), first(hopsMetadataKey)
+
+	dgst, err := digest(req)
+	if err != nil {
+		return nil, errors.New("malformed request")
+	}
+	if !hmac.Equal([]byte(first(peerSignatureMetadataKey)), []byte(a.sign(method, md, dgst))) {
+		return nil, errPeerSignatureMismatch
+	}
+
+	nanos, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, errors.New("malformed timestamp")
+	}
+	signedAt, now := time.Unix(0, nanos), a.now()
+	if skew := now.Sub(signedAt); skew > peerTokenSkew || skew < -peerTokenSkew {
+		return nil, errors.New("signature expired")
+	}
+
+	n, err := strconv.Atoi(hops)
+	if err != nil || n < 1 {
+		return nil, errors.New("malformed hop counter")
+	}
+
+	buf, err := base64.RawURLEncoding.DecodeString(nonce)
+	if err != nil || len(buf) != peerNonceSize {
+		return nil, errors.New("malformed nonce")
+	}
+	var key [peerNonceSize]byte
+	copy(key[:], buf)
+	if !a.nonces.add(key, signedAt, now) {
+		return nil, errors.New("signature reused")
+	}
+
+	return &peer{addr: addr, hops: n}, nil
+}
+
+// nonces remembers nonces of requests signed within the accepted clock skew, so that none of them can be replayed.
+// They are grouped by the second the request was signed in, a replay carries the same signed timestamp.
+// Groups that fall out of the accepted skew are dropped at once.
+type nonces struct {
+	mu      sync.Mutex
+	seconds map[int64]map[[peerNonceSize]byte]struct{}
+}
+
+// add returns false if given nonce was already used by a request signed at the same time.
+func (n *nonces) add(nonce [peerNonceSize]byte, signedAt, now time.Time) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	sec := signedAt.Unix()
+	group, ok := n.seconds[sec]
+	if !ok {
+		if n.seconds == nil {
+			n.seconds = make(map[int64]map[[peerNonceSize]byte]struct{})
+		}
+		oldest := now.Add(-peerTokenSkew).Unix()
+		for s := range n.seconds {
+			if s < oldest {
+				delete(n.seconds, s)
+			}
+		}
+		group = make(map[[peerNonceSize]byte]struct{})
+		n.seconds[sec] = group
+	}
+	if _, ok := group[nonce]; ok {
+		return false
+	}
+	group[nonce] = struct{}{}
+	return true
+}
+
+// UnaryClientInterceptor returns interceptor that signs unary requests sent to other nodes.
+func (a *Authenticator) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		ctx, err := a.outgoing(ctx, method, req)
+		if err != nil {
+			return err
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// StreamClientInterceptor returns interceptor that signs streams opened to other nodes.
+func (a *Authenticator) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		ctx, err := a.outgoing(ctx, method, nil)
+		if err != nil {
+			return nil, err
+		}
+		return streamer(ctx, desc, cc, method, opts...)
+	}
+}
+
+// UnaryServerInterceptor returns interceptor that authenticates unary requests sent by other nodes.
+func (a *Authenticator) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := a.incoming(ctx, info.FullMethod, req)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor returns interceptor that authenticates streams opened by other nodes.
+func (a *Authenticator) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := a.incoming(ss.Context(), info.FullMethod, nil)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &peerServerStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// peerServerStream overrides the context of a stream with the one that holds authenticated peer.
+type peerServerStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+// Context implements grpc ServerStream interface.
+func (pss *peerServerStream) Context() context.Context {
+	return pss.ctx
+}
+
+// IsInternalRequest returns true if request was sent by an authenticated node of the cluster.
+func IsInternalRequest(ctx context.Context) bool {
+	_, ok := ctx.Value(peerContextKey{}).(*peer)
+	return ok
+}
+
+// Hops returns how many times the request was forwarded between nodes of the cluster.
+// It is always zero for requests that do not come from an authenticated peer.
+func Hops(ctx context.Context) int {
+	if p, ok := ctx.Value(peerContextKey{}).(*peer); ok {
+		return p.hops
+	}
+	return 0
+}
@@ -0,0 +1,193 @@
+package cluster_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const testMethod = "/mnemosynerpc.SessionManager/Get"
+
+func newAuthenticator(t *testing.T, listen, secret string) *cluster.Authenticator {
+	auth, err := cluster.NewAuthenticator(listen, []byte(secret))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return auth
+}
+
+// sign passes a request through client interceptor of the sender and returns metadata it was sent with.
+func sign(t *testing.T, ctx context.Context, sender *cluster.Authenticator, req interface{}) metadata.MD {
+	var md metadata.MD
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		md, _ = metadata.FromOutgoingContext(ctx)
+		return nil
+	}
+	if err := sender.UnaryClientInterceptor()(ctx, testMethod, req, nil, nil, invoker); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return md
+}
+
+// receive passes a request through server interceptor of the receiver.
+// It returns context the handler was called with.
+func receive(receiver *cluster.Authenticator, md metadata.MD, req interface{}) (context.Context, error) {
+	var got context.Context
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		got = ctx
+		return nil, nil
+	}
+	info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+	_, err := receiver.UnaryServerInterceptor()(metadata.NewIncomingContext(context.Background(), md), req, info, handler)
+	return got, err
+}
+
+// send passes a request through client interceptor of the sender and server interceptor of the receiver.
+// It returns context the handler was called with.
+func send(t *testing.T, ctx context.Context, sender, receiver *cluster.Authenticator, tamper func(metadata.MD)) (context.Context, error) {
+	md := sign(t, ctx, sender, nil)
+	if tamper != nil {
+		tamper(md)
+	}
+	return receive(receiver, md, nil)
+}
+
+func TestAuthenticator(t *testing.T) {
+	sender := newAuthenticator(t, "127.0.0.1:9001", "secret")
+	receiver := newAuthenticator(t, "127.0.0.1:9002", "secret")
+
+	ctx, err := send(t, context.Background(), sender, receiver, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !cluster.IsInternalRequest(ctx) {
+		t.Error("request should be internal")
+	}
+	if hops := cluster.Hops(ctx); hops != 1 {
+		t.Errorf("wrong number of hops, expected 1 but got %d", hops)
+	}
+
+	// Receiver forwards the request further.
+	ctx, err = send(t, ctx, receiver, sender, nil)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if hops := cluster.Hops(ctx); hops != 2 {
+		t.Errorf("wrong number of hops, expected 2 but got %d", hops)
+	}
+}
+
+func TestAuthenticator_rejected(t *testing.T) {
+	receiver := newAuthenticator(t, "127.0.0.1:9002", "secret")
+
+	cases := map[string]struct {
+		sender *cluster.Authenticator
+		tamper func(metadata.MD)
+	}{
+		"wrong-secret": {
+			sender: newAuthenticator(t, "127.0.0.1:9001", "other"),
+		},
+		"tampered-hops": {
+			sender: newAuthenticator(t, "127.0.0.1:9001", "secret"),
+			tamper: func(md metadata.MD) { md.Set("mnemosyne-hops", "0") },
+		},
+		"tampered-addr": {
+			sender: newAuthenticator(t, "127.0.0.1:9001", "secret"),
+			tamper: func(md metadata.MD) { md.Set("mnemosyne-peer-addr", "127.0.0.1:9003") },
+		},
+		"expired": {
+			sender: newAuthenticator(t, "127.0.0.1:9001", "secret"),
+			tamper: func(md metadata.MD) { md.Set("mnemosyne-peer-time", "0") },
+		},
+		"added-local": {
+			sender: newAuthenticator(t, "127.0.0.1:9001", "secret"),
+			tamper: func(md metadata.MD) { md.Set("mnemosyne-local", "true") },
+		},
+		"tampered-nonce": {
+			sender: newAuthenticator(t, "127.0.0.1:9001", "secret"),
+			tamper: func(md metadata.MD) { md.Set("mnemosyne-peer-nonce", "AAAAAAAAAAAAAAAAAAAAAA") },
+		},
+		"missing-nonce": {
+			sender: newAuthenticator(t, "127.0.0.1:9001", "secret"),
+			tamper: func(md metadata.MD) { delete(md, "mnemosyne-peer-nonce") },
+		},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			_, err := send(t, context.Background(), c.sender, receiver, c.tamper)
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("wrong error code, expected %s but got %s", codes.Unauthenticated, status.Code(err))
+			}
+		})
+	}
+}
+
+func TestAuthenticator_replayed(t *testing.T) {
+	sender := newAuthenticator(t, "127.0.0.1:9001", "secret")
+	receiver := newAuthenticator(t, "127.0.0.1:9002", "secret")
+
+	md := sign(t, context.Background(), sender, nil)
+	if _, err := receive(receiver, md, nil); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, err := receive(receiver, md, nil); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("replayed request should be rejected, got %s", status.Code(err))
+	}
+}
+
+func TestAuthenticator_request(t *testing.T) {
+	sender := newAuthenticator(t, "127.0.0.1:9001", "secret")
+	receiver := newAuthenticator(t, "127.0.0.1:9002", "secret")
+
+	req := &mnemosynerpc.SetValueRequest{AccessToken: "access-token", Key: "key", Value: "value"}
+	md := sign(t, cluster.WithLocal(context.Background()), sender, req)
+	if _, err := receive(receiver, md, &mnemosynerpc.SetValueRequest{AccessToken: "other-access-token", Key: "key", Value: "value"}); status.Code(err) != codes.Unauthenticated {
+		t.Errorf("request other than the signed one should be rejected, got %s", status.Code(err))
+	}
+	if _, err := receive(receiver, md, req); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestAuthenticator_external(t *testing.T) {
+	receiver := newAuthenticator(t, "127.0.0.1:9002", "secret")
+
+	cases := map[string]metadata.MD{
+		"none":       nil,
+		"user-agent": metadata.Pairs("user-agent", "mnemosyned:v1.0.0"),
+		"hops":       metadata.Pairs("mnemosyne-hops", "5"),
+	}
+
+	for hint, md := range cases {
+		t.Run(hint, func(t *testing.T) {
+			var got context.Context
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				got = ctx
+				return nil, nil
+			}
+			info := &grpc.UnaryServerInfo{FullMethod: testMethod}
+			if _, err := receiver.UnaryServerInterceptor()(metadata.NewIncomingContext(context.Background(), md), nil, info, handler); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if cluster.IsInternalRequest(got) {
+				t.Error("request should not be internal")
+			}
+			if hops := cluster.Hops(got); hops != 0 {
+				t.Errorf("external request should have no hops, got %d", hops)
+			}
+		})
+	}
+}
+
+func TestNewAuthenticator_emptySecret(t *testing.T) {
+	if _, err := cluster.NewAuthenticator("127.0.0.1:9001", nil); err == nil {
+		t.Error("expected error")
+	}
+}
@@ -1,26 +1,60 @@
-// Package discovery is under development.
+// Package discovery resolves addresses of cluster members.
 package discovery
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
 	"net/http"
+	"strings"
 )
 
+// Discoverer is implemented by any source of cluster members.
+type Discoverer interface {
+	// Discover returns addresses (host:port) of all cluster members.
+	Discover(context.Context) ([]string, error)
+}
+
+// Resolver is the subset of net.Resolver that DNS discovery depends on.
+type Resolver interface {
+	LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error)
+}
+
 type service struct {
 	Address string `json:"ServiceAddress"`
 	Port    int    `json:"ServicePort"`
 }
 
-// DiscoverHTTP ...
-func DiscoverHTTP(endpoint string) ([]string, error) {
-	res, err := http.Get(endpoint)
+// HTTP discovers members using service catalog HTTP API, compatible with Consul catalog.
+type HTTP struct {
+	Endpoint string
+	// Client is used to query the catalog, http.DefaultClient if nil.
+	Client *http.Client
+}
+
+// Discover implements Discoverer interface.
+func (h *HTTP) Discover(ctx context.Context) ([]string, error) {
+	client := h.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	req, err := http.NewRequest(http.MethodGet, h.Endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: request failure: %s", err.Error())
+	}
+	res, err := client.Do(req.WithContext(ctx))
 	if err != nil {
 		return nil, fmt.Errorf("discovery: request failure: %s", err.Error())
 	}
 	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("discovery: unexpected response status: %s", res.Status)
+	}
+
 	var (
 		tmp      []service
 		services []string
@@ -34,9 +68,21 @@ func DiscoverHTTP(endpoint string) ([]string, error) {
 	return services, nil
 }
 
-// DiscoverDNS ...
-func DiscoverDNS(address string) ([]string, error) {
-	_, addresses, err := net.LookupSRV("mnemosyned", "grpc", address)
+// DNS discovers members using SRV records of the mnemosyned grpc service under given name.
+type DNS struct {
+	Name string
+	// Resolver is used to lookup records, net.DefaultResolver if nil.
+	Resolver Resolver
+}
+
+// Discover implements Discoverer interface.
+func (d *DNS) Discover(ctx context.Context) ([]string, error) {
+	var resolver Resolver = net.DefaultResolver
+	if d.Resolver != nil {
+		resolver = d.Resolver
+	}
+
+	_, addresses, err := resolver.LookupSRV(ctx, "mnemosyned", "grpc", d.Name)
 	if err != nil {
 		return nil, err
 	}
@@ -44,15 +90,20 @@ func DiscoverDNS(address string) ([]string, error) {
 	if len(addresses) == 0 {
 		return nil, errors.New("discovery: srv lookup retured nothing")
 	}
-	var (
-		tmp      []service
-		services []string
-	)
+	services := make([]string, 0, len(addresses))
 	for _, addr := range addresses {
-		tmp = append(tmp, service{Address: addr.Target, Port: int(addr.Port)})
-	}
-	for _, s := range tmp {
-		services = append(services, fmt.Sprintf("%s:%d", s.Address, s.Port))
+		// Targets are fully qualified, trailing dot would not match listen address of a node.
+		services = append(services, fmt.Sprintf("%s:%d", strings.TrimSuffix(addr.Target, "."), addr.Port))
 	}
 	return services, nil
 }
+
+// DiscoverHTTP ...
+func DiscoverHTTP(endpoint string) ([]string, error) {
+	return (&HTTP{Endpoint: endpoint}).Discover(context.Background())
+}
+
+// DiscoverDNS ...
+func DiscoverDNS(address string) ([]string, error) {
+	return (&DNS{Name: address}).Discover(context.Background())
+}
@@ -0,0 +1,86 @@
+package discovery_test
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/discovery"
+)
+
+func TestHTTP_Discover(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(`[
+			{"ServiceAddress": "10.0.0.1", "ServicePort": 8080},
+			{"ServiceAddress": "10.0.0.2", "ServicePort": 8081}
+		]`))
+	}))
+	defer ts.Close()
+
+	got, err := (&discovery.HTTP{Endpoint: ts.URL}).Discover(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	exp := []string{"10.0.0.1:8080", "10.0.0.2:8081"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("wrong members, expected %v but got %v", exp, got)
+	}
+}
+
+func TestHTTP_Discover_status(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	if _, err := (&discovery.HTTP{Endpoint: ts.URL}).Discover(context.Background()); err == nil {
+		t.Error("expected error")
+	}
+}
+
+type resolverMock struct {
+	name  string
+	addrs []*net.SRV
+	err   error
+}
+
+func (rm *resolverMock) LookupSRV(_ context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	rm.name = name
+	return "", rm.addrs, rm.err
+}
+
+func TestDNS_Discover(t *testing.T) {
+	resolver := &resolverMock{addrs: []*net.SRV{
+		{Target: "node-1.mnemosyne.local.", Port: 8080},
+		{Target: "node-2.mnemosyne.local", Port: 8080},
+	}}
+
+	got, err := (&discovery.DNS{Name: "mnemosyne.local", Resolver: resolver}).Discover(context.Background())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if resolver.name != "mnemosyne.local" {
+		t.Errorf("wrong name looked up: %s", resolver.name)
+	}
+	exp := []string{"node-1.mnemosyne.local:8080", "node-2.mnemosyne.local:8080"}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("wrong members, expected %v but got %v", exp, got)
+	}
+}
+
+func TestDNS_Discover_error(t *testing.T) {
+	for name, resolver := range map[string]*resolverMock{
+		"failure": {err: errors.New("lookup failure")},
+		"empty":   {},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := (&discovery.DNS{Resolver: resolver}).Discover(context.Background()); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -4,18 +4,19 @@ import (
 	"bytes"
 	"database/sql/driver"
 	"encoding/gob"
+	"encoding/json"
 	"errors"
 )
 
 // Bag is a simple abstraction on the top of a map.
-// It can be stored in a SQL database as a gob BLOB.
+// It can be stored in a SQL database as a JSON document.
 type Bag map[string]string
 
 // Scan satisfy sql.Scanner interface.
 func (b *Bag) Scan(src interface{}) (err error) {
 	switch t := src.(type) {
 	case []byte:
-		err = gob.NewDecoder(bytes.NewReader(t)).Decode(b)
+		err = json.Unmarshal(t, b)
 	default:
 		return errors.New("unsupported data source type")
 	}
@@ -25,13 +26,11 @@ func (b *Bag) Scan(src interface{}) (err error) {
 
 // Value satisfy driver.Valuer interface.
 func (b Bag) Value() (driver.Value, error) {
-	buf := bytes.NewBuffer(nil)
-	err := gob.NewEncoder(buf).Encode(b)
-	if err != nil {
-		return nil, err
+	if b == nil {
+		return []byte("{}"), nil
 	}
 
-	return buf.Bytes(), nil
+	return json.Marshal(b)
 }
 
 // Set assigns the value to a given key.
@@ -50,3 +49,33 @@ func (b *Bag) Has(key string) bool {
 
 	return ok
 }
+
+// GobBag is a Bag stored as a gob BLOB, the format used before bags were stored as JSON documents.
+// It is kept to read rows that were not converted yet.
+type GobBag Bag
+
+// Scan satisfy sql.Scanner interface.
+// NULL leaves the bag nil.
+func (b *GobBag) Scan(src interface{}) (err error) {
+	switch t := src.(type) {
+	case nil:
+		*b = nil
+	case []byte:
+		err = gob.NewDecoder(bytes.NewReader(t)).Decode(b)
+	default:
+		return errors.New("unsupported data source type")
+	}
+
+	return
+}
+
+// Value satisfy driver.Valuer interface.
+func (b GobBag) Value() (driver.Value, error) {
+	buf := bytes.NewBuffer(nil)
+	err := gob.NewEncoder(buf).Encode(b)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -44,3 +44,37 @@ func TestBackpack_Scan(t *testing.T) {
 		t.Error("error expected, got nil")
 	}
 }
+
+func TestBackpack_Value(t *testing.T) {
+	val, err := model.Bag{"A": "B"}.Value()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if string(val.([]byte)) != `{"A":"B"}` {
+		t.Errorf("wrong output, got %s", val)
+	}
+	if val, err = model.Bag(nil).Value(); err != nil || string(val.([]byte)) != "{}" {
+		t.Errorf("nil bag should be stored as an empty object, got %s and %v", val, err)
+	}
+}
+
+func TestGobBag_Scan(t *testing.T) {
+	b := model.GobBag{"A": "B"}
+	val, err := b.Value()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	var got model.GobBag
+	if err = got.Scan(val); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if got["A"] != "B" {
+		t.Errorf("wrong output, got %s", got["A"])
+	}
+	if err = got.Scan(nil); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if got != nil {
+		t.Errorf("bag should be nil, got %v", got)
+	}
+}
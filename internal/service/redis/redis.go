@@ -0,0 +1,60 @@
+package redis
+
+import (
+	"errors"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"go.uber.org/zap"
+)
+
+var Timeout = errors.New("redis connection timeout")
+
+type Opts struct {
+	Logger         *zap.Logger
+	Password       string
+	DB             int
+	Retry, Timeout time.Duration
+}
+
+// Init allocates redis client and waits until the server responds or timeout is reached.
+func Init(address string, opts Opts) (*goredis.Client, error) {
+	timeout, retry := opts.Timeout, opts.Retry
+	if timeout == time.Duration(0) {
+		timeout = 10 * time.Second
+	}
+	if retry == time.Duration(0) {
+		retry = 1 * time.Second
+	}
+
+	opts.Logger.Debug("redis connection attempt", zap.String("redis_address", address), zap.Int("redis_db", opts.DB))
+
+	client := goredis.NewClient(&goredis.Options{
+		Addr:     address,
+		Password: opts.Password,
+		DB:       opts.DB,
+	})
+
+	if err := client.Ping().Err(); err != nil {
+		cancel := time.NewTimer(timeout)
+		defer cancel.Stop()
+
+	PingLoop:
+		for {
+			select {
+			case <-time.After(retry):
+				if err := client.Ping().Err(); err != nil {
+					opts.Logger.Debug("redis connection ping failure", zap.String("redis_address", address), zap.Error(err))
+					continue PingLoop
+				}
+				opts.Logger.Info("redis connection has been established", zap.String("redis_address", address))
+				break PingLoop
+			case <-cancel.C:
+				client.Close()
+				return nil, Timeout
+			}
+		}
+	}
+
+	return client, nil
+}
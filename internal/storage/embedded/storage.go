@@ -0,0 +1,807 @@
+package embedded
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/opentracing/opentracing-go"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"github.com/prometheus/client_golang/prometheus"
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	bucketSessions = []byte("sessions")
+	bucketSubject  = []byte("subject")
+	bucketRefresh  = []byte("refresh")
+	bucketExpire   = []byte("expire")
+	// bucketRotated maps rotated refresh tokens onto their expiration time and successor.
+	bucketRotated = []byte("rotated")
+)
+
+// separator splits indexed value and access token within index keys.
+const separator = 0x00
+
+var errSessionExists = errors.New("embedded: session with given access token already exists")
+
+var monitoringEmbeddedLabels = []string{
+	"query",
+}
+
+// Storage keeps sessions within a local file.
+// Sessions are stored in a bucket indexed by access token.
+// Additional buckets serve as indexes by subject id, refresh token and expiration time.
+// Rotated refresh tokens are kept in a separate bucket, so their reuse can be detected.
+type Storage struct {
+	db  *bolt.DB
+	ttl time.Duration
+	// monitoring
+	transactions    prometheus.Gauge
+	queriesTotal    *prometheus.CounterVec
+	queriesDuration *prometheus.HistogramVec
+	errors          *prometheus.CounterVec
+}
+
+// StorageOpts is a set of arguments that can be passed to the NewStorage constructor function.
+type StorageOpts struct {
+	DB        *bolt.DB
+	Namespace string
+	TTL       time.Duration
+}
+
+// NewStorage allocates new embedded storage.
+func NewStorage(opts StorageOpts) storage.Storage {
+	return &Storage{
+		db:  opts.DB,
+		ttl: opts.TTL,
+		queriesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "embedded_queries_total",
+				Help:      "Total number of transactions made.",
+			},
+			monitoringEmbeddedLabels,
+		),
+		queriesDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "embedded_query_duration_seconds",
+				Help:      "The transaction latencies in seconds.",
+			},
+			monitoringEmbeddedLabels,
+		),
+		transactions: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "embedded_open_transactions",
+				Help:      "Number of currently open read transactions.",
+			},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "embedded_errors_total",
+				Help:      "Total number of errors that happen during transactions.",
+			},
+			monitoringEmbeddedLabels,
+		),
+	}
+}
+
+// Start implements storage interface.
+func (s *Storage) Start(ctx context.Context, accessToken, refreshToken, sid, sc string, b map[string]string, opts storage.StartOpts) (*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.start")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, storage.ErrMissingAccessToken
+	}
+
+	now := time.Now()
+	idleTimeout := opts.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = s.ttl
+	}
+	var absoluteExpireAt time.Time
+	if opts.MaxLifetime > 0 {
+		absoluteExpireAt = now.Add(opts.MaxLifetime)
+	}
+
+	ses := &mnemosynerpc.Session{
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		SubjectId:     sid,
+		SubjectClient: sc,
+		Bag:           b,
+		IdleTimeout:   ptypes.DurationProto(idleTimeout),
+	}
+	err := setLifetime(ses, now, idleTimeout, absoluteExpireAt)
+	if err != nil {
+		return nil, err
+	}
+	if !opts.CreatedAt.IsZero() {
+		if ses.CreatedAt, err = ptypes.TimestampProto(opts.CreatedAt); err != nil {
+			return nil, err
+		}
+	}
+
+	err = s.update("save", func(tx *bolt.Tx) error {
+		if tx.Bucket(bucketSessions).Get([]byte(accessToken)) != nil {
+			return errSessionExists
+		}
+		return put(tx, ses)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ses, nil
+}
+
+// Get implements storage interface.
+// Each successful call extends session expiration time by its idle timeout, but never past its absolute deadline.
+func (s *Storage) Get(ctx context.Context, accessToken string) (*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.get")
+	defer span.Finish()
+
+	var ses *mnemosynerpc.Session
+	err := s.update("get", func(tx *bolt.Tx) (err error) {
+		now := time.Now()
+		if ses, err = get(tx, accessToken); err != nil {
+			return err
+		}
+		// Expired session is removed by the cleanup routine, until then it cannot be retrieved.
+		if !between(ses, &now, nil) {
+			return storage.ErrSessionNotFound
+		}
+		if err = tx.Bucket(bucketExpire).Delete(expireKey(ses)); err != nil {
+			return err
+		}
+		if ses.ExpireAt, err = ptypes.TimestampProto(storage.ExpireAt(now, s.idleTimeout(ses), absoluteExpireAt(ses))); err != nil {
+			return err
+		}
+		return put(tx, ses)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return ses, nil
+}
+
+// List implements storage interface.
+// Sessions are ordered by expiration time and access token.
+// If query contains subject id or refresh token, corresponding index is used instead of a full scan.
+func (s *Storage) List(ctx context.Context, offset, limit int64, query storage.ListQuery) ([]*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.list")
+	defer span.Finish()
+
+	if limit == 0 {
+		return nil, errors.New("cannot retrieve list of sessions, limit needs to be higher than 0")
+	}
+
+	sessions := make([]*mnemosynerpc.Session, 0, limit)
+	err := s.view("list", func(tx *bolt.Tx) error {
+		if b, _ := index(tx, query); b == nil {
+			return scan(tx, query, func(ses *mnemosynerpc.Session) (bool, error) {
+				if offset > 0 {
+					offset--
+					return true, nil
+				}
+				sessions = append(sessions, ses)
+				return int64(len(sessions)) < limit, nil
+			})
+		}
+
+		// Index entries are not ordered by expiration time, sessions need to be sorted before pagination.
+		var found []*mnemosynerpc.Session
+		err := scan(tx, query, func(ses *mnemosynerpc.Session) (bool, error) {
+			found = append(found, ses)
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		sort.Slice(found, func(i, j int) bool {
+			return bytes.Compare(expireKey(found[i]), expireKey(found[j])) < 0
+		})
+		if offset >= int64(len(found)) {
+			return nil
+		}
+		found = found[offset:]
+		if limit < int64(len(found)) {
+			found = found[:limit]
+		}
+		sessions = append(sessions, found...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Count implements storage interface.
+func (s *Storage) Count(ctx context.Context, query storage.ListQuery) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.count")
+	defer span.Finish()
+
+	query.After = nil
+
+	var count int64
+	err := s.view("count", func(tx *bolt.Tx) error {
+		return scan(tx, query, func(*mnemosynerpc.Session) (bool, error) {
+			count++
+			return true, nil
+		})
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// Exists implements storage interface.
+func (s *Storage) Exists(ctx context.Context, accessToken string) (exists bool, err error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.exists")
+	defer span.Finish()
+
+	err = s.view("exists", func(tx *bolt.Tx) error {
+		now := time.Now()
+		ses, err := get(tx, accessToken)
+		switch err {
+		case nil:
+			exists = between(ses, &now, nil)
+		case storage.ErrSessionNotFound:
+		default:
+			return err
+		}
+		return nil
+	})
+	return
+}
+
+// Abandon implements storage interface.
+func (s *Storage) Abandon(ctx context.Context, accessToken string) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.abandon")
+	defer span.Finish()
+
+	err := s.update("abandon", func(tx *bolt.Tx) error {
+		ses, err := get(tx, accessToken)
+		if err != nil {
+			return err
+		}
+		return remove(tx, ses)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// SetValue implements storage interface.
+// Read and write happen within single transaction.
+func (s *Storage) SetValue(ctx context.Context, accessToken string, key, value string) (map[string]string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.set-value")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, storage.ErrMissingAccessToken
+	}
+
+	var bag map[string]string
+	err := s.update("set_value", func(tx *bolt.Tx) error {
+		ses, err := get(tx, accessToken)
+		if err != nil {
+			return err
+		}
+		if ses.Bag == nil {
+			ses.Bag = make(map[string]string, 1)
+		}
+		ses.Bag[key] = value
+		bag = ses.Bag
+
+		return put(tx, ses)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return bag, nil
+}
+
+// Delete implements storage interface.
+// Only one of subject id, access token and refresh token is taken into account, in that order.
+func (s *Storage) Delete(ctx context.Context, subjectID, accessToken, refreshToken string, expiredAtFrom, expiredAtTo *time.Time) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.delete")
+	defer span.Finish()
+
+	if subjectID == "" && accessToken == "" && refreshToken == "" && expiredAtFrom == nil && expiredAtTo == nil {
+		return 0, errors.New("session cannot be deleted, no where parameter provided")
+	}
+
+	var affected int64
+	err := s.update("delete", func(tx *bolt.Tx) error {
+		var tokens [][]byte
+		collect := func(accessToken []byte) (bool, error) {
+			tokens = append(tokens, append([]byte(nil), accessToken...))
+			return true, nil
+		}
+
+		var err error
+		switch {
+		case subjectID != "":
+			err = scanIndex(tx.Bucket(bucketSubject), subjectID, collect)
+		case accessToken != "":
+			tokens = append(tokens, []byte(accessToken))
+		case refreshToken != "":
+			err = scanIndex(tx.Bucket(bucketRefresh), refreshToken, collect)
+		default:
+			err = scanExpire(tx, expiredAtFrom, expiredAtTo, nil, collect)
+			if err == nil && expiredAtTo != nil {
+				err = purgeRotated(tx, *expiredAtTo)
+			}
+		}
+		if err != nil {
+			return err
+		}
+
+		for _, at := range tokens {
+			ses, err := get(tx, string(at))
+			if err == storage.ErrSessionNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			if !between(ses, expiredAtFrom, expiredAtTo) {
+				continue
+			}
+			if err := remove(tx, ses); err != nil {
+				return err
+			}
+			affected++
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return affected, nil
+}
+
+// Refresh implements storage interface.
+// Abandon of the old session, start of the new one and rotation record are written within single transaction.
+// If more than one unexpired session holds given refresh token, only the one that expires last is rotated.
+func (s *Storage) Refresh(ctx context.Context, refreshToken, accessToken, newRefreshToken string) (*mnemosynerpc.Session, *mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "embedded.storage.refresh")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, nil, storage.ErrMissingAccessToken
+	}
+
+	var (
+		old, ses *mnemosynerpc.Session
+		reused   bool
+	)
+	err := s.update("refresh", func(tx *bolt.Tx) error {
+		now := time.Now()
+		if rotated(tx, refreshToken, now) {
+			// Revocation needs to be committed, hence error is returned outside of the transaction.
+			reused = true
+			return revoke(tx, refreshToken)
+		}
+
+		// Index is ordered by access token, so on a tie the first one wins, the same way postgres storage does it.
+		var expireAt time.Time
+		err := scanIndex(tx.Bucket(bucketRefresh), refreshToken, func(at []byte) (bool, error) {
+			ses, err := get(tx, string(at))
+			if err != nil {
+				return false, err
+			}
+			t, err := ptypes.Timestamp(ses.ExpireAt)
+			if err != nil {
+				return false, err
+			}
+			if t.After(now) && (old == nil || t.After(expireAt)) {
+				old, expireAt = ses, t
+			}
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		if old == nil {
+			return storage.ErrSessionNotFound
+		}
+		if tx.Bucket(bucketSessions).Get([]byte(accessToken)) != nil {
+			return errSessionExists
+		}
+		if err = remove(tx, old); err != nil {
+			return err
+		}
+
+		ses = &mnemosynerpc.Session{
+			AccessToken:      accessToken,
+			RefreshToken:     newRefreshToken,
+			SubjectId:        old.SubjectId,
+			SubjectClient:    old.SubjectClient,
+			Bag:              old.Bag,
+			IdleTimeout:      ptypes.DurationProto(s.idleTimeout(old)),
+			AbsoluteExpireAt: old.AbsoluteExpireAt,
+		}
+		if err = setLifetime(ses, now, s.idleTimeout(old), absoluteExpireAt(old)); err != nil {
+			return err
+		}
+		if err = put(tx, ses); err != nil {
+			return err
+		}
+
+		return tx.Bucket(bucketRotated).Put([]byte(refreshToken), append(timeKey(now.Add(s.ttl)), newRefreshToken...))
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	if reused {
+		return nil, nil, storage.ErrRefreshTokenReused
+	}
+
+	return old, ses, nil
+}
+
+// Setup implements storage interface.
+func (s *Storage) Setup() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketSessions, bucketSubject, bucketRefresh, bucketExpire, bucketRotated} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// TearDown implements storage interface.
+func (s *Storage) TearDown() error {
+	return s.db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{bucketSessions, bucketSubject, bucketRefresh, bucketExpire, bucketRotated} {
+			if err := tx.DeleteBucket(name); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Collect implements prometheus Collector interface.
+func (s *Storage) Collect(in chan<- prometheus.Metric) {
+	s.transactions.Set(float64(s.db.Stats().OpenTxN))
+
+	s.transactions.Collect(in)
+	s.queriesTotal.Collect(in)
+	s.queriesDuration.Collect(in)
+	s.errors.Collect(in)
+}
+
+// Describe implements prometheus Collector interface.
+func (s *Storage) Describe(in chan<- *prometheus.Desc) {
+	s.transactions.Describe(in)
+	s.queriesTotal.Describe(in)
+	s.queriesDuration.Describe(in)
+	s.errors.Describe(in)
+}
+
+// idleTimeout returns idle timeout of given session.
+// Sessions created before idle timeout was stored fall back to storage TTL.
+func (s *Storage) idleTimeout(ses *mnemosynerpc.Session) time.Duration {
+	if ses.IdleTimeout == nil {
+		return s.ttl
+	}
+	d, err := ptypes.Duration(ses.IdleTimeout)
+	if err != nil || d <= 0 {
+		return s.ttl
+	}
+	return d
+}
+
+func (s *Storage) update(query string, fn func(*bolt.Tx) error) error {
+	return s.instrument(query, s.db.Update, fn)
+}
+
+func (s *Storage) view(query string, fn func(*bolt.Tx) error) error {
+	return s.instrument(query, s.db.View, fn)
+}
+
+func (s *Storage) instrument(query string, tx func(func(*bolt.Tx) error) error, fn func(*bolt.Tx) error) error {
+	labels := prometheus.Labels{"query": query}
+	start := time.Now()
+	err := tx(fn)
+	s.queriesTotal.With(labels).Inc()
+	s.queriesDuration.With(labels).Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.errors.With(labels).Inc()
+	}
+	return err
+}
+
+func get(tx *bolt.Tx, accessToken string) (*mnemosynerpc.Session, error) {
+	buf := tx.Bucket(bucketSessions).Get([]byte(accessToken))
+	if buf == nil {
+		return nil, storage.ErrSessionNotFound
+	}
+	var ses mnemosynerpc.Session
+	if err := proto.Unmarshal(buf, &ses); err != nil {
+		return nil, err
+	}
+	return &ses, nil
+}
+
+// put stores the session and updates all indexes.
+// Previous expiration time index entry needs to be removed by the caller.
+func put(tx *bolt.Tx, ses *mnemosynerpc.Session) error {
+	buf, err := proto.Marshal(ses)
+	if err != nil {
+		return err
+	}
+	if err = tx.Bucket(bucketSessions).Put([]byte(ses.AccessToken), buf); err != nil {
+		return err
+	}
+	if err = tx.Bucket(bucketSubject).Put(indexKey(ses.SubjectId, ses.AccessToken), nil); err != nil {
+		return err
+	}
+	if ses.RefreshToken != "" {
+		if err = tx.Bucket(bucketRefresh).Put(indexKey(ses.RefreshToken, ses.AccessToken), nil); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(bucketExpire).Put(expireKey(ses), nil)
+}
+
+func remove(tx *bolt.Tx, ses *mnemosynerpc.Session) error {
+	if err := tx.Bucket(bucketSessions).Delete([]byte(ses.AccessToken)); err != nil {
+		return err
+	}
+	if err := tx.Bucket(bucketSubject).Delete(indexKey(ses.SubjectId, ses.AccessToken)); err != nil {
+		return err
+	}
+	if ses.RefreshToken != "" {
+		if err := tx.Bucket(bucketRefresh).Delete(indexKey(ses.RefreshToken, ses.AccessToken)); err != nil {
+			return err
+		}
+	}
+	return tx.Bucket(bucketExpire).Delete(expireKey(ses))
+}
+
+// index returns index bucket and value that can narrow down given query, if any.
+func index(tx *bolt.Tx, query storage.ListQuery) (*bolt.Bucket, string) {
+	switch {
+	case query.SubjectID != "":
+		return tx.Bucket(bucketSubject), query.SubjectID
+	case query.RefreshToken != "":
+		return tx.Bucket(bucketRefresh), query.RefreshToken
+	default:
+		return nil, ""
+	}
+}
+
+// scan calls fn for every session that satisfies the query.
+// Sessions are visited in expiration order, unless the query can be resolved using an index or points at a single session.
+func scan(tx *bolt.Tx, query storage.ListQuery, fn func(*mnemosynerpc.Session) (bool, error)) error {
+	visit := func(accessToken []byte) (bool, error) {
+		ses, err := get(tx, string(accessToken))
+		if err != nil {
+			return false, err
+		}
+		if !query.Match(ses) {
+			return true, nil
+		}
+		return fn(ses)
+	}
+
+	if query.AccessToken != "" {
+		if tx.Bucket(bucketSessions).Get([]byte(query.AccessToken)) == nil {
+			return nil
+		}
+		_, err := visit([]byte(query.AccessToken))
+		return err
+	}
+	if b, value := index(tx, query); b != nil {
+		return scanIndex(b, value, visit)
+	}
+	return scanExpire(tx, query.ExpireAtFrom, query.ExpireAtTo, query.After, visit)
+}
+
+// scanIndex calls fn for every access token indexed under the given value.
+func scanIndex(b *bolt.Bucket, value string, fn func([]byte) (bool, error)) error {
+	prefix := append([]byte(value), separator)
+	c := b.Cursor()
+	for k, _ := c.Seek(prefix); k != nil && bytes.HasPrefix(k, prefix); k, _ = c.Next() {
+		next, err := fn(k[len(prefix):])
+		if err != nil {
+			return err
+		}
+		if !next {
+			break
+		}
+	}
+	return nil
+}
+
+// scanExpire calls fn for every access token that expires within the given (exclusive) range, in expiration order.
+// If cursor is given, iteration starts right after it.
+func scanExpire(tx *bolt.Tx, from, to *time.Time, after *storage.Cursor, fn func([]byte) (bool, error)) error {
+	c := tx.Bucket(bucketExpire).Cursor()
+
+	var seek, skip []byte
+	if from != nil {
+		seek = timeKey(from.Add(1))
+	}
+	if after != nil {
+		skip = append(timeKey(after.ExpireAt), after.AccessToken...)
+		if bytes.Compare(skip, seek) > 0 {
+			seek = skip
+		}
+	}
+
+	var k []byte
+	if seek != nil {
+		k, _ = c.Seek(seek)
+	} else {
+		k, _ = c.First()
+	}
+	if skip != nil && bytes.Equal(k, skip) {
+		k, _ = c.Next()
+	}
+	for ; k != nil; k, _ = c.Next() {
+		if to != nil && bytes.Compare(k[:8], timeKey(*to)) >= 0 {
+			break
+		}
+		next, err := fn(k[8:])
+		if err != nil {
+			return err
+		}
+		if !next {
+			break
+		}
+	}
+	return nil
+}
+
+// rotated returns true if given refresh token was rotated and the record is not expired yet.
+func rotated(tx *bolt.Tx, refreshToken string, now time.Time) bool {
+	v := tx.Bucket(bucketRotated).Get([]byte(refreshToken))
+	return v != nil && bytes.Compare(v[:8], timeKey(now)) > 0
+}
+
+// revoke removes sessions that descend from given refresh token, together with rotation records.
+func revoke(tx *bolt.Tx, refreshToken string) error {
+	family := []string{refreshToken}
+	for rt := refreshToken; ; {
+		v := tx.Bucket(bucketRotated).Get([]byte(rt))
+		if v == nil {
+			break
+		}
+		if err := tx.Bucket(bucketRotated).Delete([]byte(rt)); err != nil {
+			return err
+		}
+		rt = string(v[8:])
+		family = append(family, rt)
+	}
+
+	for _, rt := range family {
+		var sessions []*mnemosynerpc.Session
+		err := scanIndex(tx.Bucket(bucketRefresh), rt, func(at []byte) (bool, error) {
+			ses, err := get(tx, string(at))
+			if err != nil {
+				return false, err
+			}
+			sessions = append(sessions, ses)
+			return true, nil
+		})
+		if err != nil {
+			return err
+		}
+		for _, ses := range sessions {
+			if err = remove(tx, ses); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// purgeRotated removes rotation records that expired before given time.
+func purgeRotated(tx *bolt.Tx, to time.Time) error {
+	var expired [][]byte
+	err := tx.Bucket(bucketRotated).ForEach(func(k, v []byte) error {
+		if bytes.Compare(v[:8], timeKey(to)) < 0 {
+			expired = append(expired, append([]byte(nil), k...))
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for _, k := range expired {
+		if err = tx.Bucket(bucketRotated).Delete(k); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setLifetime sets creation, expiration and absolute expiration time of a session created at given moment.
+func setLifetime(ses *mnemosynerpc.Session, now time.Time, idleTimeout time.Duration, absoluteExpireAt time.Time) (err error) {
+	if ses.CreatedAt, err = ptypes.TimestampProto(now); err != nil {
+		return err
+	}
+	if ses.ExpireAt, err = ptypes.TimestampProto(storage.ExpireAt(now, idleTimeout, absoluteExpireAt)); err != nil {
+		return err
+	}
+	if !absoluteExpireAt.IsZero() {
+		ses.AbsoluteExpireAt, err = ptypes.TimestampProto(absoluteExpireAt)
+	}
+	return err
+}
+
+// absoluteExpireAt returns zero time if session lifetime is not limited.
+func absoluteExpireAt(ses *mnemosynerpc.Session) time.Time {
+	if ses.AbsoluteExpireAt == nil {
+		return time.Time{}
+	}
+	t, err := ptypes.Timestamp(ses.AbsoluteExpireAt)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
+
+func between(ses *mnemosynerpc.Session, from, to *time.Time) bool {
+	expireAt, err := ptypes.Timestamp(ses.ExpireAt)
+	if err != nil {
+		return false
+	}
+	if from != nil && !expireAt.After(*from) {
+		return false
+	}
+	if to != nil && !expireAt.Before(*to) {
+		return false
+	}
+	return true
+}
+
+func indexKey(value, accessToken string) []byte {
+	key := make([]byte, 0, len(value)+1+len(accessToken))
+	key = append(key, value...)
+	key = append(key, separator)
+	return append(key, accessToken...)
+}
+
+// expireKey is composed of big endian encoded expiration time and access token,
+// so that lexicographical order of keys is equal to (expire_at, access_token) order.
+func expireKey(ses *mnemosynerpc.Session) []byte {
+	expireAt, _ := ptypes.Timestamp(ses.ExpireAt)
+	return append(timeKey(expireAt), ses.AccessToken...)
+}
+
+func timeKey(t time.Time) []byte {
+	key := make([]byte, 8)
+	binary.BigEndian.PutUint64(key, uint64(t.UnixNano()))
+	return key
+}
@@ -0,0 +1,96 @@
+package embedded_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage/embedded"
+	bolt "go.etcd.io/bbolt"
+)
+
+func newStorage(t *testing.T) storage.Storage {
+	dir, err := ioutil.TempDir("", "mnemosyne-embedded")
+	if err != nil {
+		t.Fatal(err)
+	}
+	db, err := bolt.Open(filepath.Join(dir, "mnemosyne.db"), 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		db.Close()
+		os.RemoveAll(dir)
+	})
+
+	s, err := storage.Init(embedded.NewStorage(embedded.StorageOpts{
+		DB:  db,
+		TTL: storage.DefaultTTL,
+	}), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestEmbeddedStorage_Start(t *testing.T) {
+	storage.TestStorageStart(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Get(t *testing.T) {
+	storage.TestStorageGet(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_List(t *testing.T) {
+	storage.TestStorageList(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_List_between(t *testing.T) {
+	storage.TestStorageListBetween(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_List_query(t *testing.T) {
+	storage.TestStorageListQuery(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_List_cursor(t *testing.T) {
+	storage.TestStorageListCursor(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Count(t *testing.T) {
+	storage.TestStorageCount(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Exists(t *testing.T) {
+	storage.TestStorageExists(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Abandon(t *testing.T) {
+	storage.TestStorageAbandon(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_SetValue(t *testing.T) {
+	storage.TestStorageSetValue(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Refresh(t *testing.T) {
+	storage.TestStorageRefresh(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Refresh_expired(t *testing.T) {
+	storage.TestStorageRefreshExpired(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Refresh_duplicated(t *testing.T) {
+	storage.TestStorageRefreshDuplicated(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Lifetime(t *testing.T) {
+	storage.TestStorageLifetime(t, newStorage(t))
+}
+
+func TestEmbeddedStorage_Delete(t *testing.T) {
+	storage.TestStorageDelete(t, newStorage(t))
+}
@@ -0,0 +1,739 @@
+package memory
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/opentracing/opentracing-go"
+	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
+	"github.com/piotrkowalczuk/mnemosyne/internal/model"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultShards is a number of shards used if none is provided.
+const DefaultShards = 32
+
+var errSessionExists = errors.New("memory: session with given access token already exists")
+
+var monitoringMemoryLabels = []string{
+	"query",
+}
+
+// Storage keeps sessions within process memory.
+// Sessions are distributed across shards, each of them guarded by its own lock.
+type Storage struct {
+	ttl    time.Duration
+	shards []*shard
+	// rotations maps rotated refresh tokens onto their successors,
+	// the lock serializes refresh calls as well.
+	rotations   map[string]rotation
+	rotationsMu sync.Mutex
+	// monitoring
+	sessions        prometheus.Gauge
+	queriesTotal    *prometheus.CounterVec
+	queriesDuration *prometheus.HistogramVec
+	errors          *prometheus.CounterVec
+}
+
+// StorageOpts is a set of arguments that can be passed to the NewStorage constructor function.
+type StorageOpts struct {
+	Namespace string
+	TTL       time.Duration
+	Shards    int
+}
+
+// NewStorage allocates new in memory storage.
+func NewStorage(opts StorageOpts) storage.Storage {
+	if opts.TTL == 0 {
+		opts.TTL = storage.DefaultTTL
+	}
+	if opts.Shards <= 0 {
+		opts.Shards = DefaultShards
+	}
+
+	s := &Storage{
+		ttl:       opts.TTL,
+		shards:    make([]*shard, opts.Shards),
+		rotations: make(map[string]rotation),
+		queriesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "memory_queries_total",
+				Help:      "Total number of queries made.",
+			},
+			monitoringMemoryLabels,
+		),
+		queriesDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "memory_query_duration_seconds",
+				Help:      "The query latencies in seconds.",
+			},
+			monitoringMemoryLabels,
+		),
+		sessions: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "memory_sessions",
+				Help:      "Number of sessions kept in memory.",
+			},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "memory_errors_total",
+				Help:      "Total number of errors that happen during queries.",
+			},
+			monitoringMemoryLabels,
+		),
+	}
+	for i := range s.shards {
+		s.shards[i] = newShard()
+	}
+
+	return s
+}
+
+// Start implements storage interface.
+func (s *Storage) Start(ctx context.Context, accessToken, refreshToken, sid, sc string, b map[string]string, opts storage.StartOpts) (*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.start")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "save"}
+	defer s.incQueries(labels, start)
+
+	if accessToken == "" {
+		s.incError(labels)
+		return nil, storage.ErrMissingAccessToken
+	}
+
+	ent := &sessionEntity{
+		AccessToken:   accessToken,
+		RefreshToken:  refreshToken,
+		SubjectID:     sid,
+		SubjectClient: sc,
+		Bag:           copyBag(b),
+		CreatedAt:     start,
+		IdleTimeout:   s.ttl,
+	}
+	if !opts.CreatedAt.IsZero() {
+		ent.CreatedAt = opts.CreatedAt
+	}
+	if opts.IdleTimeout > 0 {
+		ent.IdleTimeout = opts.IdleTimeout
+	}
+	if opts.MaxLifetime > 0 {
+		ent.AbsoluteExpireAt = start.Add(opts.MaxLifetime)
+	}
+	ent.ExpireAt = storage.ExpireAt(start, ent.IdleTimeout, ent.AbsoluteExpireAt)
+
+	sh := s.shard(accessToken)
+	sh.Lock()
+	defer sh.Unlock()
+
+	if _, ok := sh.sessions[accessToken]; ok {
+		s.incError(labels)
+		return nil, errSessionExists
+	}
+	sh.add(ent)
+
+	return ent.session()
+}
+
+// Get implements storage interface.
+// Similarly to postgres storage, each successful call extends session expiration time by its idle timeout,
+// but never past its absolute deadline.
+func (s *Storage) Get(ctx context.Context, accessToken string) (*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.get")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "get"}
+	defer s.incQueries(labels, start)
+
+	sh := s.shard(accessToken)
+	sh.Lock()
+	defer sh.Unlock()
+
+	// Expired session is removed by the cleanup routine, until then it cannot be retrieved.
+	now := time.Now()
+	ent, ok := sh.sessions[accessToken]
+	if !ok || !ent.ExpireAt.After(now) {
+		s.incError(labels)
+		return nil, storage.ErrSessionNotFound
+	}
+	ent.ExpireAt = storage.ExpireAt(now, ent.IdleTimeout, ent.AbsoluteExpireAt)
+	heap.Fix(&sh.expiry, ent.index)
+
+	return ent.session()
+}
+
+// List implements storage interface.
+// Sessions are ordered by expiration time and access token.
+func (s *Storage) List(ctx context.Context, offset, limit int64, query storage.ListQuery) ([]*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.list")
+	defer span.Finish()
+
+	if limit == 0 {
+		return nil, errors.New("cannot retrieve list of sessions, limit needs to be higher than 0")
+	}
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "list"}
+	defer s.incQueries(labels, start)
+
+	found, err := s.find(query)
+	if err != nil {
+		s.incError(labels)
+		return nil, err
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		a, b := found[i].ExpireAt, found[j].ExpireAt
+		if a.Seconds != b.Seconds {
+			return a.Seconds < b.Seconds
+		}
+		if a.Nanos != b.Nanos {
+			return a.Nanos < b.Nanos
+		}
+		return found[i].AccessToken < found[j].AccessToken
+	})
+
+	if offset >= int64(len(found)) {
+		return []*mnemosynerpc.Session{}, nil
+	}
+	found = found[offset:]
+	if limit < int64(len(found)) {
+		found = found[:limit]
+	}
+
+	return found, nil
+}
+
+// Count implements storage interface.
+func (s *Storage) Count(ctx context.Context, query storage.ListQuery) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.count")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "count"}
+	defer s.incQueries(labels, start)
+
+	query.After = nil
+	found, err := s.find(query)
+	if err != nil {
+		s.incError(labels)
+		return 0, err
+	}
+
+	return int64(len(found)), nil
+}
+
+func (s *Storage) find(query storage.ListQuery) ([]*mnemosynerpc.Session, error) {
+	var found []*mnemosynerpc.Session
+	shards := s.shards
+	if query.AccessToken != "" {
+		shards = []*shard{s.shard(query.AccessToken)}
+	}
+	for _, sh := range shards {
+		sh.RLock()
+		for _, ent := range sh.sessions {
+			if !ent.between(query.ExpireAtFrom, query.ExpireAtTo) {
+				continue
+			}
+			ses, err := ent.session()
+			if err != nil {
+				sh.RUnlock()
+				return nil, err
+			}
+			if !query.Match(ses) {
+				continue
+			}
+			found = append(found, ses)
+		}
+		sh.RUnlock()
+	}
+	return found, nil
+}
+
+// Exists implements storage interface.
+func (s *Storage) Exists(ctx context.Context, accessToken string) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.exists")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "exists"}
+	defer s.incQueries(labels, start)
+
+	sh := s.shard(accessToken)
+	sh.RLock()
+	ent, ok := sh.sessions[accessToken]
+	ok = ok && ent.ExpireAt.After(time.Now())
+	sh.RUnlock()
+
+	return ok, nil
+}
+
+// Abandon implements storage interface.
+func (s *Storage) Abandon(ctx context.Context, accessToken string) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.abandon")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "abandon"}
+	defer s.incQueries(labels, start)
+
+	sh := s.shard(accessToken)
+	sh.Lock()
+	defer sh.Unlock()
+
+	ent, ok := sh.sessions[accessToken]
+	if !ok {
+		return false, storage.ErrSessionNotFound
+	}
+	sh.remove(ent)
+
+	return true, nil
+}
+
+// SetValue implements storage interface.
+func (s *Storage) SetValue(ctx context.Context, accessToken string, key, value string) (map[string]string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.set-value")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, storage.ErrMissingAccessToken
+	}
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "set_value"}
+	defer s.incQueries(labels, start)
+
+	sh := s.shard(accessToken)
+	sh.Lock()
+	defer sh.Unlock()
+
+	ent, ok := sh.sessions[accessToken]
+	if !ok {
+		s.incError(labels)
+		return nil, storage.ErrSessionNotFound
+	}
+	if ent.Bag == nil {
+		ent.Bag = make(model.Bag, 1)
+	}
+	ent.Bag.Set(key, value)
+
+	return copyBag(ent.Bag), nil
+}
+
+// Delete implements storage interface.
+// Only one of subject id, access token and refresh token is taken into account, in that order.
+func (s *Storage) Delete(ctx context.Context, subjectID, accessToken, refreshToken string, expiredAtFrom, expiredAtTo *time.Time) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.delete")
+	defer span.Finish()
+
+	if subjectID == "" && accessToken == "" && refreshToken == "" && expiredAtFrom == nil && expiredAtTo == nil {
+		return 0, errors.New("session cannot be deleted, no where parameter provided")
+	}
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "delete"}
+	defer s.incQueries(labels, start)
+
+	var affected int64
+	switch {
+	case subjectID == "" && accessToken != "":
+		sh := s.shard(accessToken)
+		sh.Lock()
+		if ent, ok := sh.sessions[accessToken]; ok && ent.between(expiredAtFrom, expiredAtTo) {
+			sh.remove(ent)
+			affected++
+		}
+		sh.Unlock()
+	case subjectID == "" && refreshToken == "" && expiredAtFrom == nil:
+		// Most common case, used by cleanup routine.
+		// Expiry heap allows to remove expired sessions without a full scan.
+		for _, sh := range s.shards {
+			sh.Lock()
+			for sh.expiry.Len() > 0 && sh.expiry[0].ExpireAt.Before(*expiredAtTo) {
+				sh.remove(sh.expiry[0])
+				affected++
+			}
+			sh.Unlock()
+		}
+
+		s.rotationsMu.Lock()
+		for rt, rot := range s.rotations {
+			if rot.expireAt.Before(*expiredAtTo) {
+				delete(s.rotations, rt)
+			}
+		}
+		s.rotationsMu.Unlock()
+	default:
+		for _, sh := range s.shards {
+			sh.Lock()
+			for _, ent := range sh.sessions {
+				switch {
+				case subjectID != "":
+					if ent.SubjectID != subjectID {
+						continue
+					}
+				case refreshToken != "":
+					if ent.RefreshToken != refreshToken {
+						continue
+					}
+				}
+				if !ent.between(expiredAtFrom, expiredAtTo) {
+					continue
+				}
+				sh.remove(ent)
+				affected++
+			}
+			sh.Unlock()
+		}
+	}
+
+	return affected, nil
+}
+
+// Refresh implements storage interface.
+// If more than one unexpired session holds given refresh token, only the one that expires last is rotated.
+func (s *Storage) Refresh(ctx context.Context, refreshToken, accessToken, newRefreshToken string) (*mnemosynerpc.Session, *mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "memory.storage.refresh")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "refresh"}
+	defer s.incQueries(labels, start)
+
+	if accessToken == "" {
+		s.incError(labels)
+		return nil, nil, storage.ErrMissingAccessToken
+	}
+
+	s.rotationsMu.Lock()
+	defer s.rotationsMu.Unlock()
+
+	if rot, ok := s.rotations[refreshToken]; ok && rot.expireAt.After(start) {
+		s.revoke(refreshToken)
+		s.incError(labels)
+		return nil, nil, storage.ErrRefreshTokenReused
+	}
+
+	old := s.take(refreshToken, start)
+	if old == nil {
+		s.incError(labels)
+		return nil, nil, storage.ErrSessionNotFound
+	}
+
+	ent := &sessionEntity{
+		AccessToken:      accessToken,
+		RefreshToken:     newRefreshToken,
+		SubjectID:        old.SubjectID,
+		SubjectClient:    old.SubjectClient,
+		Bag:              old.Bag,
+		CreatedAt:        start,
+		IdleTimeout:      old.IdleTimeout,
+		AbsoluteExpireAt: old.AbsoluteExpireAt,
+		ExpireAt:         storage.ExpireAt(start, old.IdleTimeout, old.AbsoluteExpireAt),
+	}
+
+	sh := s.shard(accessToken)
+	sh.Lock()
+	if _, ok := sh.sessions[accessToken]; ok {
+		sh.Unlock()
+
+		// Rotation failed, previous session is restored.
+		osh := s.shard(old.AccessToken)
+		osh.Lock()
+		osh.add(old)
+		osh.Unlock()
+
+		s.incError(labels)
+		return nil, nil, errSessionExists
+	}
+	sh.add(ent)
+	sh.Unlock()
+
+	s.rotations[refreshToken] = rotation{successor: newRefreshToken, expireAt: start.Add(s.ttl)}
+
+	abandoned, err := old.session()
+	if err != nil {
+		return nil, nil, err
+	}
+	started, err := ent.session()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return abandoned, started, nil
+}
+
+// take removes and returns unexpired session that holds given refresh token.
+// Sessions are ordered the same way postgres storage does it, by expiration time descending and access token.
+func (s *Storage) take(refreshToken string, now time.Time) *sessionEntity {
+	if refreshToken == "" {
+		return nil
+	}
+	for {
+		var (
+			found    *sessionEntity
+			expireAt time.Time
+			in       *shard
+		)
+		for _, sh := range s.shards {
+			sh.RLock()
+			for _, ent := range sh.refresh[refreshToken] {
+				if !ent.ExpireAt.After(now) {
+					continue
+				}
+				if found == nil || ent.ExpireAt.After(expireAt) || (ent.ExpireAt.Equal(expireAt) && ent.AccessToken < found.AccessToken) {
+					found, expireAt, in = ent, ent.ExpireAt, sh
+				}
+			}
+			sh.RUnlock()
+		}
+		if found == nil {
+			return nil
+		}
+
+		in.Lock()
+		// Session could be abandoned or expired in the meantime, then another one is looked up.
+		if ent, ok := in.sessions[found.AccessToken]; ok && ent == found && ent.ExpireAt.After(now) {
+			in.remove(ent)
+			in.Unlock()
+			return ent
+		}
+		in.Unlock()
+	}
+}
+
+// revoke removes sessions that descend from given refresh token.
+// It expects rotations lock to be acquired.
+func (s *Storage) revoke(refreshToken string) {
+	family := map[string]struct{}{}
+	for rt := refreshToken; rt != ""; {
+		family[rt] = struct{}{}
+		rot, ok := s.rotations[rt]
+		if !ok {
+			break
+		}
+		delete(s.rotations, rt)
+		rt = rot.successor
+	}
+
+	for _, sh := range s.shards {
+		sh.Lock()
+		for rt := range family {
+			for _, ent := range sh.refresh[rt] {
+				sh.remove(ent)
+			}
+		}
+		sh.Unlock()
+	}
+}
+
+// Setup implements storage interface.
+func (s *Storage) Setup() error {
+	return nil
+}
+
+// TearDown implements storage interface.
+func (s *Storage) TearDown() error {
+	for _, sh := range s.shards {
+		sh.Lock()
+		sh.sessions = make(map[string]*sessionEntity)
+		sh.refresh = make(map[string]map[string]*sessionEntity)
+		sh.expiry = nil
+		sh.Unlock()
+	}
+
+	s.rotationsMu.Lock()
+	s.rotations = make(map[string]rotation)
+	s.rotationsMu.Unlock()
+
+	return nil
+}
+
+// Collect implements prometheus Collector interface.
+func (s *Storage) Collect(in chan<- prometheus.Metric) {
+	var total int
+	for _, sh := range s.shards {
+		sh.RLock()
+		total += len(sh.sessions)
+		sh.RUnlock()
+	}
+	s.sessions.Set(float64(total))
+
+	s.sessions.Collect(in)
+	s.queriesTotal.Collect(in)
+	s.queriesDuration.Collect(in)
+	s.errors.Collect(in)
+}
+
+// Describe implements prometheus Collector interface.
+func (s *Storage) Describe(in chan<- *prometheus.Desc) {
+	s.sessions.Describe(in)
+	s.queriesTotal.Describe(in)
+	s.queriesDuration.Describe(in)
+	s.errors.Describe(in)
+}
+
+func (s *Storage) shard(accessToken string) *shard {
+	return s.shards[jump.Sum64(accessToken)%uint64(len(s.shards))]
+}
+
+func (s *Storage) incQueries(field prometheus.Labels, start time.Time) {
+	s.queriesTotal.With(field).Inc()
+	s.queriesDuration.With(field).Observe(time.Since(start).Seconds())
+}
+
+func (s *Storage) incError(field prometheus.Labels) {
+	s.errors.With(field).Inc()
+}
+
+type shard struct {
+	sync.RWMutex
+	sessions map[string]*sessionEntity
+	// refresh indexes sessions of the shard by refresh token and access token.
+	refresh map[string]map[string]*sessionEntity
+	expiry  expiryHeap
+}
+
+func newShard() *shard {
+	return &shard{
+		sessions: make(map[string]*sessionEntity),
+		refresh:  make(map[string]map[string]*sessionEntity),
+	}
+}
+
+func (sh *shard) add(ent *sessionEntity) {
+	sh.sessions[ent.AccessToken] = ent
+	if ent.RefreshToken != "" {
+		idx, ok := sh.refresh[ent.RefreshToken]
+		if !ok {
+			idx = make(map[string]*sessionEntity, 1)
+			sh.refresh[ent.RefreshToken] = idx
+		}
+		idx[ent.AccessToken] = ent
+	}
+	heap.Push(&sh.expiry, ent)
+}
+
+func (sh *shard) remove(ent *sessionEntity) {
+	delete(sh.sessions, ent.AccessToken)
+	if idx, ok := sh.refresh[ent.RefreshToken]; ok {
+		delete(idx, ent.AccessToken)
+		if len(idx) == 0 {
+			delete(sh.refresh, ent.RefreshToken)
+		}
+	}
+	heap.Remove(&sh.expiry, ent.index)
+}
+
+// expiryHeap is a min-heap of sessions ordered by expiration time.
+type expiryHeap []*sessionEntity
+
+func (eh expiryHeap) Len() int           { return len(eh) }
+func (eh expiryHeap) Less(i, j int) bool { return eh[i].ExpireAt.Before(eh[j].ExpireAt) }
+
+func (eh expiryHeap) Swap(i, j int) {
+	eh[i], eh[j] = eh[j], eh[i]
+	eh[i].index = i
+	eh[j].index = j
+}
+
+func (eh *expiryHeap) Push(x interface{}) {
+	ent := x.(*sessionEntity)
+	ent.index = len(*eh)
+	*eh = append(*eh, ent)
+}
+
+func (eh *expiryHeap) Pop() interface{} {
+	old := *eh
+	n := len(old)
+	ent := old[n-1]
+	old[n-1] = nil
+	ent.index = -1
+	*eh = old[:n-1]
+	return ent
+}
+
+type rotation struct {
+	successor string
+	expireAt  time.Time
+}
+
+type sessionEntity struct {
+	AccessToken      string
+	RefreshToken     string
+	SubjectID        string
+	SubjectClient    string
+	Bag              model.Bag
+	ExpireAt         time.Time
+	CreatedAt        time.Time
+	AbsoluteExpireAt time.Time
+	IdleTimeout      time.Duration
+
+	index int
+}
+
+func (se *sessionEntity) between(from, to *time.Time) bool {
+	if from != nil && !se.ExpireAt.After(*from) {
+		return false
+	}
+	if to != nil && !se.ExpireAt.Before(*to) {
+		return false
+	}
+	return true
+}
+
+func (se *sessionEntity) session() (*mnemosynerpc.Session, error) {
+	expireAt, err := ptypes.TimestampProto(se.ExpireAt)
+	if err != nil {
+		return nil, err
+	}
+	createdAt, err := ptypes.TimestampProto(se.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	ses := &mnemosynerpc.Session{
+		AccessToken:   se.AccessToken,
+		RefreshToken:  se.RefreshToken,
+		SubjectId:     se.SubjectID,
+		SubjectClient: se.SubjectClient,
+		Bag:           copyBag(se.Bag),
+		ExpireAt:      expireAt,
+		CreatedAt:     createdAt,
+		IdleTimeout:   ptypes.DurationProto(se.IdleTimeout),
+	}
+	if !se.AbsoluteExpireAt.IsZero() {
+		if ses.AbsoluteExpireAt, err = ptypes.TimestampProto(se.AbsoluteExpireAt); err != nil {
+			return nil, err
+		}
+	}
+	return ses, nil
+}
+
+func copyBag(b map[string]string) model.Bag {
+	if b == nil {
+		return nil
+	}
+	cp := make(model.Bag, len(b))
+	for k, v := range b {
+		cp[k] = v
+	}
+	return cp
+}
@@ -0,0 +1,78 @@
+package memory_test
+
+import (
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage/memory"
+)
+
+func newStorage(t *testing.T) storage.Storage {
+	s, err := storage.Init(memory.NewStorage(memory.StorageOpts{
+		TTL: storage.DefaultTTL,
+	}), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestMemoryStorage_Start(t *testing.T) {
+	storage.TestStorageStart(t, newStorage(t))
+}
+
+func TestMemoryStorage_Get(t *testing.T) {
+	storage.TestStorageGet(t, newStorage(t))
+}
+
+func TestMemoryStorage_List(t *testing.T) {
+	storage.TestStorageList(t, newStorage(t))
+}
+
+func TestMemoryStorage_List_between(t *testing.T) {
+	storage.TestStorageListBetween(t, newStorage(t))
+}
+
+func TestMemoryStorage_List_query(t *testing.T) {
+	storage.TestStorageListQuery(t, newStorage(t))
+}
+
+func TestMemoryStorage_List_cursor(t *testing.T) {
+	storage.TestStorageListCursor(t, newStorage(t))
+}
+
+func TestMemoryStorage_Count(t *testing.T) {
+	storage.TestStorageCount(t, newStorage(t))
+}
+
+func TestMemoryStorage_Exists(t *testing.T) {
+	storage.TestStorageExists(t, newStorage(t))
+}
+
+func TestMemoryStorage_Abandon(t *testing.T) {
+	storage.TestStorageAbandon(t, newStorage(t))
+}
+
+func TestMemoryStorage_SetValue(t *testing.T) {
+	storage.TestStorageSetValue(t, newStorage(t))
+}
+
+func TestMemoryStorage_Refresh(t *testing.T) {
+	storage.TestStorageRefresh(t, newStorage(t))
+}
+
+func TestMemoryStorage_Refresh_expired(t *testing.T) {
+	storage.TestStorageRefreshExpired(t, newStorage(t))
+}
+
+func TestMemoryStorage_Refresh_duplicated(t *testing.T) {
+	storage.TestStorageRefreshDuplicated(t, newStorage(t))
+}
+
+func TestMemoryStorage_Lifetime(t *testing.T) {
+	storage.TestStorageLifetime(t, newStorage(t))
+}
+
+func TestMemoryStorage_Delete(t *testing.T) {
+	storage.TestStorageDelete(t, newStorage(t))
+}
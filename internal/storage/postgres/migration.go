@@ -0,0 +1,418 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+)
+
+// migration is a single, versioned change of the database schema.
+// Statements can refer to {schema}, {table} and {ttl} placeholders.
+type migration struct {
+	version  int64
+	name     string
+	up, down string
+}
+
+// migrations are applied in order, once applied they must not be changed.
+// Every statement has to be safe to run against a database that was set up before migrations were introduced.
+var migrations = []migration{
+	{
+		version: 1,
+		name:    "initial",
+		up: `
+			CREATE TABLE IF NOT EXISTS {schema}.{table} (
+				access_token BYTEA PRIMARY KEY,
+				refresh_token BYTEA,
+				subject_id TEXT NOT NULL,
+				subject_client TEXT,
+				bag bytea NOT NULL,
+				expire_at TIMESTAMPTZ NOT NULL,
+				created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+				absolute_expire_at TIMESTAMPTZ,
+				idle_timeout BIGINT NOT NULL
+			);
+			ALTER TABLE {schema}.{table} ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+			ALTER TABLE {schema}.{table} ADD COLUMN IF NOT EXISTS absolute_expire_at TIMESTAMPTZ;
+			ALTER TABLE {schema}.{table} ADD COLUMN IF NOT EXISTS idle_timeout BIGINT NOT NULL DEFAULT {ttl};
+			CREATE INDEX IF NOT EXISTS {table}_refresh_token_idx ON {schema}.{table} (refresh_token);
+			CREATE INDEX IF NOT EXISTS {table}_subject_id_idx ON {schema}.{table} (subject_id);
+			CREATE INDEX IF NOT EXISTS {table}_expire_at_idx ON {schema}.{table} (expire_at DESC);
+			CREATE INDEX IF NOT EXISTS {table}_subject_client_idx ON {schema}.{table} (subject_client);
+			CREATE INDEX IF NOT EXISTS {table}_expire_at_access_token_idx ON {schema}.{table} (expire_at, access_token);
+			CREATE TABLE IF NOT EXISTS {schema}.{table}_rotation (
+				refresh_token BYTEA PRIMARY KEY,
+				successor BYTEA NOT NULL,
+				expire_at TIMESTAMPTZ NOT NULL
+			);
+			CREATE INDEX IF NOT EXISTS {table}_rotation_expire_at_idx ON {schema}.{table}_rotation (expire_at);`,
+		down: `
+			DROP TABLE IF EXISTS {schema}.{table}_rotation;
+			DROP TABLE IF EXISTS {schema}.{table};`,
+	},
+	{
+		// Before migrations were introduced, every start created another copy of unnamed indexes.
+		// Postgres named them {table}_{column}_idx, {table}_{column}_idx1 and so on, only the first one is kept.
+		version: 2,
+		name:    "drop_duplicated_indexes",
+		up: `
+			DO $$
+			DECLARE
+				idx RECORD;
+			BEGIN
+				FOR idx IN SELECT indexname FROM pg_indexes
+					WHERE schemaname = lower('{schema}')
+					AND tablename = lower('{table}')
+					AND indexname ~ ('^' || lower('{table}') || '_(refresh_token|subject_id|expire_at)_idx[0-9]+$')
+				LOOP
+					EXECUTE 'DROP INDEX ' || lower('{schema}') || '.' || quote_ident(idx.indexname);
+				END LOOP;
+			END $$;`,
+	},
+	{
+		// Gob encoded bags are kept aside until they are converted, see Storage.ConvertBags.
+		version: 3,
+		name:    "jsonb_bag",
+		up: `
+			ALTER TABLE {schema}.{table} RENAME COLUMN bag TO bag_gob;
+			ALTER TABLE {schema}.{table} ALTER COLUMN bag_gob DROP NOT NULL;
+			ALTER TABLE {schema}.{table} ADD COLUMN bag JSONB NOT NULL DEFAULT '{}';
+			CREATE INDEX IF NOT EXISTS {table}_bag_idx ON {schema}.{table} USING GIN (bag jsonb_path_ops);`,
+		// Bags of sessions created afterwards exist only as JSON, they cannot be reverted without data loss.
+		down: `
+			DO $$
+			BEGIN
+				IF EXISTS (SELECT 1 FROM {schema}.{table} WHERE bag_gob IS NULL) THEN
+					RAISE EXCEPTION 'sessions with bags stored only as JSON exist';
+				END IF;
+			END $$;
+			DROP INDEX IF EXISTS {schema}.{table}_bag_idx;
+			ALTER TABLE {schema}.{table} DROP COLUMN bag;
+			ALTER TABLE {schema}.{table} ALTER COLUMN bag_gob SET NOT NULL;
+			ALTER TABLE {schema}.{table} RENAME COLUMN bag_gob TO bag;`,
+	},
+	{
+		// Tokens are hashed by Migrator.Up, token_key is NULL until then.
+		// Route of a hashed access token is kept, so that the session can still be routed within the cluster.
+		version: 4,
+		name:    "token_key",
+		up: `
+			ALTER TABLE {schema}.{table} ADD COLUMN IF NOT EXISTS token_key TEXT;
+			ALTER TABLE {schema}.{table} ADD COLUMN IF NOT EXISTS route TEXT;
+			ALTER TABLE {schema}.{table}_rotation ADD COLUMN IF NOT EXISTS token_key TEXT;`,
+		// Hashes cannot be turned back into tokens.
+		down: `
+			DO $$
+			BEGIN
+				IF EXISTS (SELECT 1 FROM {schema}.{table} WHERE token_key IS NOT NULL)
+				OR EXISTS (SELECT 1 FROM {schema}.{table}_rotation WHERE token_key IS NOT NULL) THEN
+					RAISE EXCEPTION 'sessions with hashed tokens exist';
+				END IF;
+			END $$;
+			ALTER TABLE {schema}.{table}_rotation DROP COLUMN token_key;
+			ALTER TABLE {schema}.{table} DROP COLUMN route;
+			ALTER TABLE {schema}.{table} DROP COLUMN token_key;`,
+	},
+}
+
+// MigratorOpts holds options of a Migrator.
+type MigratorOpts struct {
+	Conn          *sql.DB
+	Schema, Table string
+	// TTL is a default idle timeout of sessions created before the column was introduced.
+	TTL time.Duration
+	// TokenSecret if set, tokens stored in plaintext are hashed, see StorageOpts.
+	TokenSecret          []byte
+	PreviousTokenSecrets [][]byte
+}
+
+// Migrator applies and reverts schema migrations.
+// Applied versions are recorded in the schema_migrations table, per session table.
+// A session-level advisory lock is held for the whole operation, so concurrently starting daemons do not race.
+type Migrator struct {
+	db            *sql.DB
+	schema, table string
+	ttl           time.Duration
+	tokens        *tokenHasher
+}
+
+// NewMigrator allocates new Migrator instance.
+func NewMigrator(opts MigratorOpts) *Migrator {
+	return &Migrator{
+		db:     opts.Conn,
+		schema: opts.Schema,
+		table:  opts.Table,
+		ttl:    opts.TTL,
+		tokens: newTokenHasher(opts.TokenSecret, opts.PreviousTokenSecrets),
+	}
+}
+
+// Latest returns version of the most recent migration.
+func (m *Migrator) Latest() int64 {
+	return migrations[len(migrations)-1].version
+}
+
+// Version returns version of the most recently applied migration, or zero if none was applied.
+func (m *Migrator) Version(ctx context.Context) (version int64, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for v := range applied {
+			if v > version {
+				version = v
+			}
+		}
+		return nil
+	})
+	return
+}
+
+// Up applies all pending migrations and returns how many were applied.
+// If token secret is set, tokens stored in plaintext are hashed afterwards.
+// Otherwise, it fails if any token is hashed already, such sessions could not be found.
+func (m *Migrator) Up(ctx context.Context) (n int, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, mig := range migrations {
+			if applied[mig.version] {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig.up, `INSERT INTO `+m.schema+`.schema_migrations (table_name, version, name) VALUES ($1, $2, $3)`, m.table, mig.version, mig.name); err != nil {
+				return fmt.Errorf("postgres: migration %d (%s) failure: %s", mig.version, mig.name, err.Error())
+			}
+			n++
+		}
+		if m.tokens == nil {
+			return m.checkPlaintext(ctx, conn)
+		}
+		return m.hashTokens(ctx, conn)
+	})
+	return
+}
+
+// Down reverts given number of the most recently applied migrations and returns how many were reverted.
+func (m *Migrator) Down(ctx context.Context, steps int) (n int, err error) {
+	err = m.locked(ctx, func(conn *sql.Conn) error {
+		applied, err := m.applied(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && n < steps; i-- {
+			mig := migrations[i]
+			if !applied[mig.version] {
+				continue
+			}
+			if err := m.apply(ctx, conn, mig.down, `DELETE FROM `+m.schema+`.schema_migrations WHERE table_name = $1 AND version = $2`, m.table, mig.version); err != nil {
+				return fmt.Errorf("postgres: migration %d (%s) revert failure: %s", mig.version, mig.name, err.Error())
+			}
+			n++
+		}
+		return nil
+	})
+	return
+}
+
+// TokenKeys returns number of sessions per key their tokens are hashed with.
+// Keys are described as current, previous, unknown or plaintext if tokens are not hashed.
+func (m *Migrator) TokenKeys(ctx context.Context) (map[string]int64, error) {
+	keys := make(map[string]int64)
+	err := m.locked(ctx, func(conn *sql.Conn) error {
+		rows, err := conn.QueryContext(ctx, `SELECT token_key, COUNT(*) FROM `+m.schema+`.`+m.table+` GROUP BY token_key`)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var (
+				id    sql.NullString
+				count int64
+			)
+			if err := rows.Scan(&id, &count); err != nil {
+				return err
+			}
+			name := m.tokens.status(id)
+			if id.Valid {
+				name += " (" + id.String + ")"
+			}
+			keys[name] = count
+		}
+		return rows.Err()
+	})
+	return keys, err
+}
+
+func (m *Migrator) checkPlaintext(ctx context.Context, conn *sql.Conn) error {
+	var hashed bool
+	if err := conn.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM `+m.schema+`.`+m.table+` WHERE token_key IS NOT NULL)`).Scan(&hashed); err != nil {
+		return err
+	}
+	if hashed {
+		return errors.New("postgres: sessions with hashed tokens exist, token secret is required")
+	}
+	return nil
+}
+
+// hashTokens replaces tokens stored in plaintext with their hashes, in batches.
+func (m *Migrator) hashTokens(ctx context.Context, conn *sql.Conn) error {
+	for _, table := range []struct {
+		name, first, second string
+		routed              bool
+	}{
+		{name: m.schema + "." + m.table, first: "access_token", second: "refresh_token", routed: true},
+		{name: m.schema + "." + m.table + "_rotation", first: "refresh_token", second: "successor"},
+	} {
+		for {
+			n, err := m.hashTokensBatch(ctx, conn, table.name, table.first, table.second, table.routed)
+			if err != nil {
+				return fmt.Errorf("postgres: tokens of %s cannot be hashed: %s", table.name, err.Error())
+			}
+			if n < hashTokensBatchSize {
+				break
+			}
+		}
+	}
+	return nil
+}
+
+const hashTokensBatchSize = 1000
+
+// hashTokensBatch hashes tokens of up to hashTokensBatchSize rows.
+// If routed, route of the first token is stored as well.
+func (m *Migrator) hashTokensBatch(ctx context.Context, conn *sql.Conn, table, first, second string, routed bool) (int, error) {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	rows, err := tx.QueryContext(ctx, `SELECT `+first+`, `+second+` FROM `+table+` WHERE token_key IS NULL LIMIT $1 FOR UPDATE`, hashTokensBatchSize)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	var tokens [][2]string
+	for rows.Next() {
+		var t [2]sql.NullString
+		if err := rows.Scan(&t[0], &t[1]); err != nil {
+			rows.Close()
+			tx.Rollback()
+			return 0, err
+		}
+		tokens = append(tokens, [2]string{t[0].String, t[1].String})
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	query := `UPDATE ` + table + ` SET ` + first + ` = $2, ` + second + ` = $3, token_key = $4 WHERE ` + first + ` = $1`
+	if routed {
+		query = `UPDATE ` + table + ` SET ` + first + ` = $2, ` + second + ` = $3, token_key = $4, route = $5 WHERE ` + first + ` = $1`
+	}
+	for _, t := range tokens {
+		args := []interface{}{t[0], m.tokens.hash(t[0]), m.tokens.hash(t[1]), m.tokens.key()}
+		if routed {
+			args = append(args, mnemosyne.TokenRoute(t[0]))
+		}
+		if _, err := tx.ExecContext(ctx, query, args...); err != nil {
+			tx.Rollback()
+			return 0, err
+		}
+	}
+	return len(tokens), tx.Commit()
+}
+
+// apply executes statements of a migration and updates its record in a single transaction.
+func (m *Migrator) apply(ctx context.Context, conn *sql.Conn, statements, record string, args ...interface{}) error {
+	tx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if statements = strings.TrimSpace(statements); statements != "" {
+		if _, err := tx.ExecContext(ctx, m.expand(statements)); err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+func (m *Migrator) applied(ctx context.Context, conn *sql.Conn) (map[int64]bool, error) {
+	rows, err := conn.QueryContext(ctx, `SELECT version FROM `+m.schema+`.schema_migrations WHERE table_name = $1`, m.table)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int64]bool)
+	for rows.Next() {
+		var version int64
+		if err := rows.Scan(&version); err != nil {
+			return nil, err
+		}
+		applied[version] = true
+	}
+	return applied, rows.Err()
+}
+
+// locked runs given function on a single connection that holds the advisory lock.
+func (m *Migrator) locked(ctx context.Context, fn func(*sql.Conn) error) error {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_lock($1)`, m.lockID()); err != nil {
+		return fmt.Errorf("postgres: migration lock cannot be acquired: %s", err.Error())
+	}
+	// Lock is released even if the context is already done, otherwise it would outlive the operation on a pooled connection.
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, m.lockID())
+
+	if _, err := conn.ExecContext(ctx, `
+		CREATE SCHEMA IF NOT EXISTS `+m.schema+`;
+		CREATE TABLE IF NOT EXISTS `+m.schema+`.schema_migrations (
+			table_name TEXT NOT NULL,
+			version BIGINT NOT NULL,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+			PRIMARY KEY (table_name, version)
+		);`,
+	); err != nil {
+		return err
+	}
+
+	return fn(conn)
+}
+
+func (m *Migrator) lockID() int64 {
+	h := fnv.New64a()
+	// Tables that share a schema share the lock as well, schema_migrations table is common to them.
+	h.Write([]byte("mnemosyne:" + m.schema))
+	return int64(h.Sum64())
+}
+
+func (m *Migrator) expand(statements string) string {
+	return strings.NewReplacer(
+		"{schema}", m.schema,
+		"{table}", m.table,
+		"{ttl}", strconv.FormatInt(microseconds(m.ttl), 10),
+	).Replace(statements)
+}
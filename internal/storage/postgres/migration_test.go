@@ -0,0 +1,298 @@
+package postgres_test
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
+	"github.com/piotrkowalczuk/mnemosyne/internal/model"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	storagepq "github.com/piotrkowalczuk/mnemosyne/internal/storage/postgres"
+)
+
+const migrationTestSchema = "mnemosyne_migration_test"
+
+// legacySetup is what Setup used to run on every start, before migrations were introduced.
+const legacySetup = `
+	CREATE SCHEMA IF NOT EXISTS ` + migrationTestSchema + `;
+	CREATE TABLE IF NOT EXISTS ` + migrationTestSchema + `.session (
+		access_token BYTEA PRIMARY KEY,
+		refresh_token BYTEA,
+		subject_id TEXT NOT NULL,
+		subject_client TEXT,
+		bag bytea NOT NULL,
+		expire_at TIMESTAMPTZ NOT NULL
+	);
+	CREATE INDEX ON ` + migrationTestSchema + `.session (refresh_token);
+	CREATE INDEX ON ` + migrationTestSchema + `.session (subject_id);
+	CREATE INDEX ON ` + migrationTestSchema + `.session (expire_at DESC);
+`
+
+func newMigrationSuite(t *testing.T) (*postgresSuite, *storagepq.Migrator) {
+	s := &postgresSuite{}
+	s.setup(t)
+	t.Cleanup(func() {
+		if _, err := s.db.Exec(`DROP SCHEMA IF EXISTS ` + migrationTestSchema + ` CASCADE`); err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+		s.teardown(t)
+	})
+
+	if _, err := s.db.Exec(`DROP SCHEMA IF EXISTS ` + migrationTestSchema + ` CASCADE`); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	return s, storagepq.NewMigrator(storagepq.MigratorOpts{
+		Conn:   s.db,
+		Schema: migrationTestSchema,
+		Table:  "session",
+		TTL:    storage.DefaultTTL,
+	})
+}
+
+func TestMigrator_Up_legacy(t *testing.T) {
+	s, m := newMigrationSuite(t)
+	ctx := context.Background()
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.db.Exec(legacySetup); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+	for _, token := range []string{"first", "second"} {
+		if _, err := s.db.Exec(
+			`INSERT INTO `+migrationTestSchema+`.session (access_token, subject_id, bag, expire_at) VALUES ($1, 'subject', $2, NOW() + INTERVAL '1 hour')`,
+			token, model.GobBag{"key": "value"},
+		); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	n, err := m.Up(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n != int(m.Latest()) {
+		t.Errorf("all migrations should be applied, got %d", n)
+	}
+	if n, err = m.Up(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n != 0 {
+		t.Errorf("migrations should be applied only once, got %d", n)
+	}
+
+	var indexes int
+	if err := s.db.QueryRow(`SELECT COUNT(*) FROM pg_indexes WHERE schemaname = $1 AND tablename = 'session'`, migrationTestSchema).Scan(&indexes); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	// Primary key and six named indexes.
+	if indexes != 7 {
+		t.Errorf("duplicated indexes should be dropped, got %d indexes", indexes)
+	}
+
+	store := storagepq.NewStorage(storagepq.StorageOpts{
+		Conn:   s.db,
+		Schema: migrationTestSchema,
+		Table:  "session",
+		TTL:    storage.DefaultTTL,
+	})
+
+	ses, err := store.Get(ctx, "first")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if ses.Bag["key"] != "value" {
+		t.Errorf("gob encoded bag should be decoded, got %v", ses.Bag)
+	}
+	if ses.IdleTimeout.Seconds != int64(storage.DefaultTTL.Seconds()) {
+		t.Errorf("wrong idle timeout: %v", ses.IdleTimeout)
+	}
+	bag, err := store.SetValue(ctx, "first", "other", "value")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(bag) != 2 || bag["key"] != "value" {
+		t.Errorf("gob encoded bag should be converted before it is modified, got %v", bag)
+	}
+
+	converted, err := store.(*storagepq.Storage).ConvertBags(ctx, 10)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if converted != 1 {
+		t.Errorf("single bag should be left to convert, got %d", converted)
+	}
+	if count, err := store.Count(ctx, storage.ListQuery{Bag: map[string]string{"key": "value"}}); err != nil || count != 2 {
+		t.Errorf("converted bags should be queryable, got %d and %v", count, err)
+	}
+}
+
+func TestMigrator_Down(t *testing.T) {
+	_, m := newMigrationSuite(t)
+	ctx := context.Background()
+
+	if _, err := m.Up(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if n, err := m.Down(ctx, 1); err != nil || n != 1 {
+		t.Fatalf("single migration should be reverted, got %d and %v", n, err)
+	}
+	if version, err := m.Version(ctx); err != nil || version != m.Latest()-1 {
+		t.Fatalf("wrong version, got %d and %v", version, err)
+	}
+	if n, err := m.Down(ctx, 100); err != nil || n != int(m.Latest())-1 {
+		t.Fatalf("remaining migrations should be reverted, got %d and %v", n, err)
+	}
+	if version, err := m.Version(ctx); err != nil || version != 0 {
+		t.Fatalf("wrong version, got %d and %v", version, err)
+	}
+	if n, err := m.Up(ctx); err != nil || n != int(m.Latest()) {
+		t.Fatalf("all migrations should be applied again, got %d and %v", n, err)
+	}
+}
+
+func TestMigrator_Up_concurrent(t *testing.T) {
+	_, m := newMigrationSuite(t)
+
+	var (
+		wg    sync.WaitGroup
+		mu    sync.Mutex
+		total int
+	)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			n, err := m.Up(context.Background())
+			if err != nil {
+				t.Errorf("unexpected error: %s", err.Error())
+			}
+			mu.Lock()
+			total += n
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	if total != int(m.Latest()) {
+		t.Errorf("every migration should be applied exactly once, got %d", total)
+	}
+}
+
+func TestMigrator_Up_tokens(t *testing.T) {
+	s, m := newMigrationSuite(t)
+	ctx := context.Background()
+
+	plain := storagepq.NewStorage(storagepq.StorageOpts{
+		Conn:   s.db,
+		Schema: migrationTestSchema,
+		Table:  "session",
+		TTL:    storage.DefaultTTL,
+	})
+	if err := plain.Setup(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, err := plain.Start(ctx, "access", "refresh", "subject", "client", nil, storage.StartOpts{}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	hashed := storagepq.NewMigrator(storagepq.MigratorOpts{
+		Conn:        s.db,
+		Schema:      migrationTestSchema,
+		Table:       "session",
+		TTL:         storage.DefaultTTL,
+		TokenSecret: []byte("secret"),
+	})
+	if _, err := hashed.Up(ctx); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	var stored string
+	if err := s.db.QueryRow(`SELECT access_token FROM ` + migrationTestSchema + `.session`).Scan(&stored); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if stored == "access" {
+		t.Fatal("access token should be hashed")
+	}
+	if _, err := m.Up(ctx); err == nil {
+		t.Fatal("migration without a secret should fail if tokens are hashed")
+	}
+
+	// Secret rotation: the new one is current, the old one is still used for lookups.
+	rotated := storagepq.NewStorage(storagepq.StorageOpts{
+		Conn:                 s.db,
+		Schema:               migrationTestSchema,
+		Table:                "session",
+		TTL:                  storage.DefaultTTL,
+		TokenSecret:          []byte("new-secret"),
+		PreviousTokenSecrets: [][]byte{[]byte("secret")},
+	})
+	ses, err := rotated.Get(ctx, "access")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if ses.AccessToken != "access" {
+		t.Errorf("access token should be returned as it is, got %s", ses.AccessToken)
+	}
+	if _, started, err := rotated.Refresh(ctx, "refresh", "new-access", "new-refresh"); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	} else if started.AccessToken != "new-access" {
+		t.Errorf("wrong access token: %s", started.AccessToken)
+	}
+	if _, _, err := rotated.Refresh(ctx, "refresh", "other-access", "other-refresh"); err != storage.ErrRefreshTokenReused {
+		t.Errorf("reuse of rotated refresh token should be detected, got %v", err)
+	}
+
+	list, err := rotated.List(ctx, 0, 10, storage.ListQuery{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, ses := range list {
+		if ses.AccessToken == "new-access" || ses.RefreshToken == "new-refresh" {
+			t.Errorf("list should return fingerprints, got %v", ses)
+		}
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("refreshed session should be the only one, got %v", list)
+	}
+	if mnemosyne.AccessTokenSum64(list[0].AccessToken) != jump.Sum64("new-access") {
+		t.Error("fingerprint should be routed the same way as the access token")
+	}
+	// Copy sent by another node carries fingerprints, they are stored as they are.
+	copied := list[0]
+	if _, err := rotated.Abandon(ctx, copied.AccessToken); err != nil {
+		t.Fatalf("session should be abandoned using its fingerprint, got %s", err.Error())
+	}
+	if _, err := rotated.Start(ctx, copied.AccessToken, copied.RefreshToken, copied.SubjectId, copied.SubjectClient, copied.Bag, storage.StartOpts{}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if ses, err := rotated.Get(ctx, "new-access"); err != nil {
+		t.Fatalf("copy should be found using the token, got %s", err.Error())
+	} else if ses.RefreshToken != copied.RefreshToken {
+		t.Errorf("refresh token of the copy should not be hashed again, got %s", ses.RefreshToken)
+	}
+
+	keys, err := storagepq.NewMigrator(storagepq.MigratorOpts{
+		Conn:                 s.db,
+		Schema:               migrationTestSchema,
+		Table:                "session",
+		TokenSecret:          []byte("new-secret"),
+		PreviousTokenSecrets: [][]byte{[]byte("secret")},
+	}).TokenKeys(ctx)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(keys) != 1 {
+		t.Fatalf("refreshed session should be the only one, got %v", keys)
+	}
+	for name, count := range keys {
+		if !strings.HasPrefix(name, "current") || count != 1 {
+			t.Errorf("session should be hashed using the current key, got %s: %d", name, count)
+		}
+	}
+}
@@ -6,11 +6,13 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"strings"
 	"time"
 
 	"github.com/opentracing/opentracing-go"
 
 	"github.com/golang/protobuf/ptypes"
+	"github.com/lib/pq"
 	"github.com/piotrkowalczuk/mnemosyne/internal/model"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
@@ -26,6 +28,7 @@ type Storage struct {
 	schema                                         string
 	table                                          string
 	ttl                                            time.Duration
+	tokens                                         *tokenHasher
 	querySave, queryGet, queryExists, queryAbandon string
 	// monitoring
 	connections     prometheus.Gauge
@@ -39,6 +42,11 @@ type StorageOpts struct {
 	Schema, Table string
 	Namespace     string
 	TTL           time.Duration
+	// TokenSecret if set, only keyed hashes of access and refresh tokens are stored.
+	// Sessions returned by List and rotated sessions returned by Refresh carry hashes (fingerprints) instead of tokens.
+	TokenSecret []byte
+	// PreviousTokenSecrets are used only to find sessions that were stored before the secret was rotated.
+	PreviousTokenSecrets [][]byte
 }
 
 func NewStorage(opts StorageOpts) storage.Storage {
@@ -47,15 +55,16 @@ func NewStorage(opts StorageOpts) storage.Storage {
 		table:  opts.Table,
 		schema: opts.Schema,
 		ttl:    opts.TTL,
-		querySave: `INSERT INTO ` + opts.Schema + ` .` + opts.Table + ` (access_token, refresh_token, subject_id, subject_client, bag)
-			VALUES ($1, $2, $3, $4, $5)
-			RETURNING expire_at`,
-		queryGet: fmt.Sprintf(`UPDATE `+opts.Schema+` .`+opts.Table+`
-			SET expire_at = (NOW() + '%d seconds')
-			WHERE access_token = $1
-			RETURNING refresh_token, subject_id, subject_client, bag, expire_at`, int64(opts.TTL.Seconds())),
-		queryExists:  `SELECT EXISTS(SELECT 1 FROM ` + opts.Schema + ` .` + opts.Table + ` WHERE access_token = $1)`,
-		queryAbandon: `DELETE FROM ` + opts.Schema + ` .` + opts.Table + ` WHERE access_token = $1`,
+		tokens: newTokenHasher(opts.TokenSecret, opts.PreviousTokenSecrets),
+		querySave: `INSERT INTO ` + opts.Schema + ` .` + opts.Table + ` (access_token, refresh_token, subject_id, subject_client, bag, idle_timeout, absolute_expire_at, expire_at, token_key, created_at, route)
+			VALUES ($1, $2, $3, $4, $5, $6, NOW() + $7::BIGINT * INTERVAL '1 microsecond', LEAST(NOW() + $6::BIGINT * INTERVAL '1 microsecond', NOW() + $7::BIGINT * INTERVAL '1 microsecond'), $8, COALESCE($9::TIMESTAMPTZ, NOW()), $10)
+			RETURNING expire_at, created_at, absolute_expire_at`,
+		queryGet: `UPDATE ` + opts.Schema + ` .` + opts.Table + `
+			SET expire_at = LEAST(NOW() + idle_timeout * INTERVAL '1 microsecond', absolute_expire_at)
+			WHERE access_token = ANY($1::BYTEA[]) AND expire_at > NOW()
+			RETURNING refresh_token, subject_id, subject_client, bag, bag_gob, expire_at, created_at, absolute_expire_at, idle_timeout, token_key`,
+		queryExists:  `SELECT EXISTS(SELECT 1 FROM ` + opts.Schema + ` .` + opts.Table + ` WHERE access_token = ANY($1::BYTEA[]) AND expire_at > NOW())`,
+		queryAbandon: `DELETE FROM ` + opts.Schema + ` .` + opts.Table + ` WHERE access_token = ANY($1::BYTEA[])`,
 		queriesTotal: prometheus.NewCounterVec(
 			prometheus.CounterOpts{
 				Namespace: opts.Namespace,
@@ -95,7 +104,7 @@ func NewStorage(opts StorageOpts) storage.Storage {
 }
 
 // Start implements storage interface.
-func (s *Storage) Start(ctx context.Context, accessToken, refreshToken, sid, sc string, b map[string]string) (*mnemosynerpc.Session, error) {
+func (s *Storage) Start(ctx context.Context, accessToken, refreshToken, sid, sc string, b map[string]string, opts storage.StartOpts) (*mnemosynerpc.Session, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.start")
 	defer span.Finish()
 
@@ -105,28 +114,55 @@ func (s *Storage) Start(ctx context.Context, accessToken, refreshToken, sid, sc
 		SubjectID:     sid,
 		SubjectClient: sc,
 		Bag:           model.Bag(b),
+		IdleTimeout:   microseconds(s.ttl),
+	}
+	if opts.IdleTimeout > 0 {
+		ent.IdleTimeout = microseconds(opts.IdleTimeout)
+	}
+	// Lifetime is not limited if max lifetime is NULL.
+	var lifetime *int64
+	if opts.MaxLifetime > 0 {
+		lt := microseconds(opts.MaxLifetime)
+		lifetime = &lt
+	}
+	// Creation time is set by the database, unless the session is a copy.
+	var createdAt *time.Time
+	if !opts.CreatedAt.IsZero() {
+		createdAt = &opts.CreatedAt
 	}
 
-	if err := s.save(ctx, ent); err != nil {
+	if err := s.save(ctx, ent, lifetime, createdAt); err != nil {
 		return nil, err
 	}
 
 	return ent.session()
 }
 
-func (s *Storage) save(ctx context.Context, ent *sessionEntity) (err error) {
+func (s *Storage) save(ctx context.Context, ent *sessionEntity, lifetime *int64, createdAt *time.Time) (err error) {
+	tokens, err := s.tokens.store(ent.AccessToken, ent.RefreshToken)
+	if err != nil {
+		return err
+	}
+
 	start := time.Now()
 	labels := prometheus.Labels{"query": "save"}
 	err = s.db.QueryRowContext(
 		ctx,
 		s.querySave,
-		ent.AccessToken,
-		ent.RefreshToken,
+		tokens.access,
+		tokens.refresh,
 		ent.SubjectID,
 		ent.SubjectClient,
 		ent.Bag,
+		ent.IdleTimeout,
+		lifetime,
+		tokens.key,
+		createdAt,
+		tokens.route,
 	).Scan(
 		&ent.ExpireAt,
+		&ent.CreatedAt,
+		&ent.AbsoluteExpireAt,
 	)
 	s.incQueries(labels, start)
 	if err != nil {
@@ -140,16 +176,24 @@ func (s *Storage) Get(ctx context.Context, accessToken string) (*mnemosynerpc.Se
 	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.get")
 	defer span.Finish()
 
-	var entity sessionEntity
+	var (
+		entity = sessionEntity{AccessToken: accessToken}
+		key    sql.NullString
+	)
 	start := time.Now()
 	labels := prometheus.Labels{"query": "get"}
 
-	err := s.db.QueryRowContext(ctx, s.queryGet, accessToken).Scan(
+	err := s.db.QueryRowContext(ctx, s.queryGet, pq.Array(s.tokens.candidates(accessToken))).Scan(
 		&entity.RefreshToken,
 		&entity.SubjectID,
 		&entity.SubjectClient,
 		&entity.Bag,
+		&entity.GobBag,
 		&entity.ExpireAt,
+		&entity.CreatedAt,
+		&entity.AbsoluteExpireAt,
+		&entity.IdleTimeout,
+		&key,
 	)
 	s.incQueries(labels, start)
 	if err != nil {
@@ -159,23 +203,13 @@ func (s *Storage) Get(ctx context.Context, accessToken string) (*mnemosynerpc.Se
 		}
 		return nil, err
 	}
+	entity.RefreshToken = fingerprint(entity.RefreshToken, key, sql.NullString{})
 
-	expireAt, err := ptypes.TimestampProto(entity.ExpireAt)
-	if err != nil {
-		return nil, err
-	}
-	return &mnemosynerpc.Session{
-		AccessToken:   accessToken,
-		RefreshToken:  entity.RefreshToken,
-		SubjectId:     entity.SubjectID,
-		SubjectClient: entity.SubjectClient,
-		Bag:           entity.Bag,
-		ExpireAt:      expireAt,
-	}, nil
+	return entity.session()
 }
 
 // List implements storage interface.
-func (s *Storage) List(ctx context.Context, offset, limit int64, expiredAtFrom, expiredAtTo *time.Time) ([]*mnemosynerpc.Session, error) {
+func (s *Storage) List(ctx context.Context, offset, limit int64, query storage.ListQuery) ([]*mnemosynerpc.Session, error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.list")
 	defer span.Finish()
 
@@ -183,28 +217,21 @@ func (s *Storage) List(ctx context.Context, offset, limit int64, expiredAtFrom,
 		return nil, errors.New("cannot retrieve list of sessions, limit needs to be higher than 0")
 	}
 
-	args := []interface{}{offset, limit}
-	query := "SELECT access_token, refresh_token, subject_id, subject_client, bag, expire_at FROM " + s.schema + "." + s.table + " "
-	if expiredAtFrom != nil || expiredAtTo != nil {
-		query += " WHERE "
+	where, args := s.listWhere(query)
+	q := "SELECT access_token, refresh_token, subject_id, subject_client, bag, bag_gob, expire_at, created_at, absolute_expire_at, idle_timeout, token_key, route FROM " + s.schema + "." + s.table + " "
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
 	}
-	switch {
-	case expiredAtFrom != nil && expiredAtTo == nil:
-		query += "expire_at > $3"
-		args = append(args, expiredAtFrom)
-	case expiredAtFrom == nil && expiredAtTo != nil:
-		query += "expire_at < $3"
-		args = append(args, expiredAtTo)
-	case expiredAtFrom != nil && expiredAtTo != nil:
-		query += "expire_at > $3 AND expire_at < $4"
-		args = append(args, expiredAtFrom, expiredAtTo)
+	q += " ORDER BY expire_at, access_token"
+	// Bags that are not converted yet can be matched only after decoding, so does pagination.
+	if len(query.Bag) == 0 {
+		args = append(args, offset, limit)
+		q += fmt.Sprintf(" OFFSET $%d LIMIT $%d", len(args)-1, len(args))
 	}
-
-	query += " OFFSET $1 LIMIT $2"
 	labels := prometheus.Labels{"query": "list"}
 
 	start := time.Now()
-	rows, err := s.db.QueryContext(ctx, query, args...)
+	rows, err := s.db.QueryContext(ctx, q, args...)
 	s.incQueries(labels, start)
 	if err != nil {
 		s.incError(labels)
@@ -214,7 +241,10 @@ func (s *Storage) List(ctx context.Context, offset, limit int64, expiredAtFrom,
 
 	sessions := make([]*mnemosynerpc.Session, 0, limit)
 	for rows.Next() {
-		var ent sessionEntity
+		var (
+			ent        sessionEntity
+			key, route sql.NullString
+		)
 
 		err = rows.Scan(
 			&ent.AccessToken,
@@ -222,25 +252,38 @@ func (s *Storage) List(ctx context.Context, offset, limit int64, expiredAtFrom,
 			&ent.SubjectID,
 			&ent.SubjectClient,
 			&ent.Bag,
+			&ent.GobBag,
 			&ent.ExpireAt,
+			&ent.CreatedAt,
+			&ent.AbsoluteExpireAt,
+			&ent.IdleTimeout,
+			&key,
+			&route,
 		)
 		if err != nil {
 			s.incError(labels)
 			return nil, err
 		}
+		ent.AccessToken = fingerprint(ent.AccessToken, key, route)
+		ent.RefreshToken = fingerprint(ent.RefreshToken, key, sql.NullString{})
 
-		expireAt, err := ptypes.TimestampProto(ent.ExpireAt)
+		ses, err := ent.session()
 		if err != nil {
 			return nil, err
 		}
-		sessions = append(sessions, &mnemosynerpc.Session{
-			AccessToken:   ent.AccessToken,
-			RefreshToken:  ent.RefreshToken,
-			SubjectId:     ent.SubjectID,
-			SubjectClient: ent.SubjectClient,
-			Bag:           ent.Bag,
-			ExpireAt:      expireAt,
-		})
+		if len(query.Bag) > 0 {
+			if !query.Match(ses) {
+				continue
+			}
+			if offset > 0 {
+				offset--
+				continue
+			}
+		}
+		sessions = append(sessions, ses)
+		if int64(len(sessions)) == limit {
+			break
+		}
 	}
 	if rows.Err() != nil {
 		s.incError(labels)
@@ -250,6 +293,55 @@ func (s *Storage) List(ctx context.Context, offset, limit int64, expiredAtFrom,
 	return sessions, nil
 }
 
+// Count implements storage interface.
+func (s *Storage) Count(ctx context.Context, query storage.ListQuery) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.count")
+	defer span.Finish()
+
+	query.After = nil
+	where, args := s.listWhere(query)
+	q := "SELECT COUNT(*) FROM " + s.schema + "." + s.table + " "
+	// Bags that are not converted yet can be matched only after decoding.
+	if len(query.Bag) > 0 {
+		q = "SELECT bag, bag_gob FROM " + s.schema + "." + s.table + " "
+	}
+	if len(where) > 0 {
+		q += " WHERE " + strings.Join(where, " AND ")
+	}
+	labels := prometheus.Labels{"query": "count"}
+
+	start := time.Now()
+	rows, err := s.db.QueryContext(ctx, q, args...)
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+		return 0, err
+	}
+	defer rows.Close()
+
+	var count int64
+	for rows.Next() {
+		if len(query.Bag) == 0 {
+			err = rows.Scan(&count)
+		} else {
+			var ent sessionEntity
+			if err = rows.Scan(&ent.Bag, &ent.GobBag); err == nil && (storage.ListQuery{Bag: query.Bag}).Match(&mnemosynerpc.Session{Bag: ent.bag()}) {
+				count++
+			}
+		}
+		if err != nil {
+			s.incError(labels)
+			return 0, err
+		}
+	}
+	if rows.Err() != nil {
+		s.incError(labels)
+		return 0, rows.Err()
+	}
+
+	return count, nil
+}
+
 // Exists implements storage interface.
 func (s *Storage) Exists(ctx context.Context, accessToken string) (exists bool, err error) {
 	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.exists")
@@ -258,7 +350,7 @@ func (s *Storage) Exists(ctx context.Context, accessToken string) (exists bool,
 	start := time.Now()
 	labels := prometheus.Labels{"query": "exists"}
 
-	err = s.db.QueryRowContext(ctx, s.queryExists, accessToken).Scan(
+	err = s.db.QueryRowContext(ctx, s.queryExists, pq.Array(s.tokens.candidates(accessToken))).Scan(
 		&exists,
 	)
 	s.incQueries(labels, start)
@@ -277,7 +369,7 @@ func (s *Storage) Abandon(ctx context.Context, accessToken string) (bool, error)
 	start := time.Now()
 	labels := prometheus.Labels{"query": "abandon"}
 
-	result, err := s.db.ExecContext(ctx, s.queryAbandon, accessToken)
+	result, err := s.db.ExecContext(ctx, s.queryAbandon, pq.Array(s.tokens.candidates(accessToken)))
 	s.incQueries(labels, start)
 	if err != nil {
 		s.incError(labels)
@@ -300,61 +392,118 @@ func (s *Storage) SetValue(ctx context.Context, accessToken string, key, value s
 	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.set-value")
 	defer span.Finish()
 
-	var err error
 	if accessToken == "" {
 		return nil, storage.ErrMissingAccessToken
 	}
 
-	entity := &sessionEntity{
-		AccessToken: accessToken,
-	}
-	selectQuery := `
-		SELECT bag
-		FROM ` + s.schema + `.` + s.table + `
-		WHERE access_token = $1
-		FOR UPDATE
-	`
-	updateQuery := `
+	query := `
 		UPDATE ` + s.schema + `.` + s.table + `
-		SET
-			bag = $2
-		WHERE access_token = $1
+		SET bag = jsonb_set(bag, ARRAY[$2::TEXT], to_jsonb($3::TEXT))
+		WHERE access_token = ANY($1::BYTEA[]) AND bag_gob IS NULL
+		RETURNING bag
 	`
+	labels := prometheus.Labels{"query": "set_value"}
+
+	var bag model.Bag
+	for converted := false; ; converted = true {
+		start := time.Now()
+		err := s.db.QueryRowContext(ctx, query, pq.Array(s.tokens.candidates(accessToken)), key, value).Scan(&bag)
+		s.incQueries(labels, start)
+		switch {
+		case err == nil:
+			return bag, nil
+		case err != sql.ErrNoRows:
+			s.incError(labels)
+			return nil, err
+		case converted:
+			return nil, storage.ErrSessionNotFound
+		}
 
-	tx, err := s.db.BeginTx(ctx, nil)
-	if err != nil {
-		tx.Rollback()
-		return nil, err
+		// Session does not exist, or its bag is not converted yet.
+		found, err := s.convertBag(ctx, accessToken)
+		if err != nil {
+			return nil, err
+		}
+		if !found {
+			return nil, storage.ErrSessionNotFound
+		}
 	}
+}
 
-	startSelect := time.Now()
-	err = tx.QueryRowContext(ctx, selectQuery, accessToken).Scan(
-		&entity.Bag,
-	)
-	s.incQueries(prometheus.Labels{"query": "set_value_select"}, startSelect)
+// ConvertBags converts up to limit bags, that are stored in the gob format, to JSON.
+// It returns number of converted bags, zero means that there is nothing left to convert.
+func (s *Storage) ConvertBags(ctx context.Context, limit int) (int, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.convert-bags")
+	defer span.Finish()
+
+	labels := prometheus.Labels{"query": "convert_bags_select"}
+	start := time.Now()
+	rows, err := s.db.QueryContext(ctx, "SELECT access_token, bag_gob FROM "+s.schema+"."+s.table+" WHERE bag_gob IS NOT NULL LIMIT $1", limit)
+	s.incQueries(labels, start)
 	if err != nil {
-		s.incError(prometheus.Labels{"query": "set_value_select"})
-		tx.Rollback()
-		if err == sql.ErrNoRows {
-			return nil, storage.ErrSessionNotFound
+		s.incError(labels)
+		return 0, err
+	}
+
+	var entities []sessionEntity
+	for rows.Next() {
+		var ent sessionEntity
+		if err := rows.Scan(&ent.AccessToken, &ent.GobBag); err != nil {
+			s.incError(labels)
+			rows.Close()
+			return 0, err
 		}
-		return nil, err
+		entities = append(entities, ent)
+	}
+	rows.Close()
+	if rows.Err() != nil {
+		s.incError(labels)
+		return 0, rows.Err()
 	}
 
-	entity.Bag.Set(key, value)
+	for _, ent := range entities {
+		// Access token is already stored the way it is, it cannot be hashed again.
+		if err := s.updateBag(ctx, [][]byte{[]byte(ent.AccessToken)}, ent.bag()); err != nil {
+			return 0, err
+		}
+	}
+	return len(entities), nil
+}
 
-	startUpdate := time.Now()
-	_, err = tx.ExecContext(ctx, updateQuery, accessToken, entity.Bag)
-	s.incQueries(prometheus.Labels{"query": "set_value_update"}, startUpdate)
-	if err != nil {
-		s.incError(prometheus.Labels{"query": "set_value_update"})
-		tx.Rollback()
-		return nil, err
+// convertBag converts bag of a single session, if needed. It returns false if session does not exist.
+func (s *Storage) convertBag(ctx context.Context, accessToken string) (bool, error) {
+	labels := prometheus.Labels{"query": "convert_bag_select"}
+	start := time.Now()
+
+	var ent sessionEntity
+	candidates := s.tokens.candidates(accessToken)
+	err := s.db.QueryRowContext(ctx, "SELECT bag_gob FROM "+s.schema+"."+s.table+" WHERE access_token = ANY($1::BYTEA[])", pq.Array(candidates)).Scan(&ent.GobBag)
+	s.incQueries(labels, start)
+	switch {
+	case err == sql.ErrNoRows:
+		return false, nil
+	case err != nil:
+		s.incError(labels)
+		return false, err
+	case ent.GobBag == nil:
+		return true, nil
 	}
 
-	tx.Commit()
+	return true, s.updateBag(ctx, candidates, ent.bag())
+}
+
+// updateBag replaces gob encoded bag with its JSON equivalent.
+// Bag is written only if it was not converted in the meantime, JSON bag could be modified since then.
+func (s *Storage) updateBag(ctx context.Context, accessTokens [][]byte, bag model.Bag) error {
+	labels := prometheus.Labels{"query": "convert_bag_update"}
+	start := time.Now()
 
-	return entity.Bag, nil
+	_, err := s.db.ExecContext(ctx, "UPDATE "+s.schema+"."+s.table+" SET bag = $2, bag_gob = NULL WHERE access_token = ANY($1::BYTEA[]) AND bag_gob IS NOT NULL", pq.Array(accessTokens), bag)
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+	}
+	return err
 }
 
 // Delete implements storage interface.
@@ -377,31 +526,208 @@ func (s *Storage) Delete(ctx context.Context, subjectID, accessToken, refreshTok
 		return 0, err
 	}
 
+	// Cleanup of expired sessions takes care of expired rotations as well.
+	if subjectID == "" && accessToken == "" && refreshToken == "" && expiredAtTo != nil {
+		labels := prometheus.Labels{"query": "delete_rotation"}
+		start := time.Now()
+
+		_, err = s.db.ExecContext(ctx, "DELETE FROM "+s.schema+"."+s.table+"_rotation WHERE expire_at < $1", expiredAtTo)
+		s.incQueries(labels, start)
+		if err != nil {
+			s.incError(labels)
+			return 0, err
+		}
+	}
+
 	return result.RowsAffected()
 }
 
+// Refresh implements storage interface.
+func (s *Storage) Refresh(ctx context.Context, refreshToken, accessToken, newRefreshToken string) (*mnemosynerpc.Session, *mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "postgres.storage.refresh")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, nil, storage.ErrMissingAccessToken
+	}
+
+	rotationTable := s.schema + "." + s.table + "_rotation"
+	// Only a single session can be refreshed, if more than one share the token, the one that expires last is picked.
+	abandonQuery := `
+		DELETE FROM ` + s.schema + `.` + s.table + `
+		WHERE access_token = (
+			SELECT access_token FROM ` + s.schema + `.` + s.table + `
+			WHERE refresh_token = ANY($1::BYTEA[]) AND expire_at > NOW()
+			ORDER BY expire_at DESC, access_token
+			LIMIT 1
+			FOR UPDATE
+		)
+		RETURNING access_token, refresh_token, subject_id, subject_client, bag, bag_gob, expire_at, created_at, absolute_expire_at, idle_timeout, token_key, route
+	`
+	saveQuery := `
+		INSERT INTO ` + s.schema + `.` + s.table + ` (access_token, refresh_token, subject_id, subject_client, bag, idle_timeout, absolute_expire_at, expire_at, token_key, route)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, LEAST(NOW() + $6::BIGINT * INTERVAL '1 microsecond', $7), $8, $9)
+		RETURNING expire_at, created_at
+	`
+	rotatedQuery := `
+		SELECT EXISTS(SELECT 1 FROM ` + rotationTable + ` WHERE refresh_token = ANY($1::BYTEA[]) AND expire_at > NOW())
+	`
+	revokeQuery := `
+		WITH RECURSIVE family (refresh_token) AS (
+			SELECT unnest($1::BYTEA[])
+			UNION
+			SELECT r.successor FROM ` + rotationTable + ` r JOIN family f ON r.refresh_token = f.refresh_token
+		), revoked AS (
+			DELETE FROM ` + rotationTable + ` WHERE refresh_token IN (SELECT refresh_token FROM family)
+		)
+		DELETE FROM ` + s.schema + `.` + s.table + ` WHERE refresh_token IN (SELECT refresh_token FROM family)
+	`
+	rotateQuery := fmt.Sprintf(`
+		INSERT INTO `+rotationTable+` (refresh_token, successor, expire_at, token_key)
+		VALUES ($1, $2, NOW() + '%d seconds', $3)
+		ON CONFLICT (refresh_token) DO UPDATE SET successor = EXCLUDED.successor, expire_at = EXCLUDED.expire_at, token_key = EXCLUDED.token_key
+	`, int64(s.ttl.Seconds()))
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	candidates := pq.Array(s.tokens.candidates(refreshToken))
+
+	var (
+		old              sessionEntity
+		oldKey, oldRoute sql.NullString
+	)
+	startAbandon := time.Now()
+	err = tx.QueryRowContext(ctx, abandonQuery, candidates).Scan(
+		&old.AccessToken,
+		&old.RefreshToken,
+		&old.SubjectID,
+		&old.SubjectClient,
+		&old.Bag,
+		&old.GobBag,
+		&old.ExpireAt,
+		&old.CreatedAt,
+		&old.AbsoluteExpireAt,
+		&old.IdleTimeout,
+		&oldKey,
+		&oldRoute,
+	)
+	s.incQueries(prometheus.Labels{"query": "refresh_abandon"}, startAbandon)
+	switch {
+	case err == sql.ErrNoRows:
+		// Session could be gone because the token was already rotated, which is a sign of theft.
+		var rotated bool
+		startRotated := time.Now()
+		err = tx.QueryRowContext(ctx, rotatedQuery, candidates).Scan(&rotated)
+		s.incQueries(prometheus.Labels{"query": "refresh_rotated"}, startRotated)
+		if err != nil {
+			s.incError(prometheus.Labels{"query": "refresh_rotated"})
+			tx.Rollback()
+			return nil, nil, err
+		}
+		if !rotated {
+			tx.Rollback()
+			return nil, nil, storage.ErrSessionNotFound
+		}
+
+		startRevoke := time.Now()
+		_, err = tx.ExecContext(ctx, revokeQuery, candidates)
+		s.incQueries(prometheus.Labels{"query": "refresh_revoke"}, startRevoke)
+		if err != nil {
+			s.incError(prometheus.Labels{"query": "refresh_revoke"})
+			tx.Rollback()
+			return nil, nil, err
+		}
+		if err = tx.Commit(); err != nil {
+			return nil, nil, err
+		}
+		return nil, nil, storage.ErrRefreshTokenReused
+	case err != nil:
+		s.incError(prometheus.Labels{"query": "refresh_abandon"})
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	old.AccessToken = fingerprint(old.AccessToken, oldKey, oldRoute)
+	old.RefreshToken = fingerprint(old.RefreshToken, oldKey, sql.NullString{})
+
+	ent := &sessionEntity{
+		AccessToken:      accessToken,
+		RefreshToken:     newRefreshToken,
+		SubjectID:        old.SubjectID,
+		SubjectClient:    old.SubjectClient,
+		Bag:              old.bag(),
+		IdleTimeout:      old.IdleTimeout,
+		AbsoluteExpireAt: old.AbsoluteExpireAt,
+	}
+	tokens, err := s.tokens.store(ent.AccessToken, ent.RefreshToken)
+	if err != nil {
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	startSave := time.Now()
+	err = tx.QueryRowContext(
+		ctx,
+		saveQuery,
+		tokens.access,
+		tokens.refresh,
+		ent.SubjectID,
+		ent.SubjectClient,
+		ent.Bag,
+		ent.IdleTimeout,
+		ent.AbsoluteExpireAt,
+		tokens.key,
+		tokens.route,
+	).Scan(
+		&ent.ExpireAt,
+		&ent.CreatedAt,
+	)
+	s.incQueries(prometheus.Labels{"query": "refresh_save"}, startSave)
+	if err != nil {
+		s.incError(prometheus.Labels{"query": "refresh_save"})
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	startRotate := time.Now()
+	_, err = tx.ExecContext(ctx, rotateQuery, s.tokens.hash(refreshToken), s.tokens.hash(newRefreshToken), s.tokens.key())
+	s.incQueries(prometheus.Labels{"query": "refresh_rotate"}, startRotate)
+	if err != nil {
+		s.incError(prometheus.Labels{"query": "refresh_rotate"})
+		tx.Rollback()
+		return nil, nil, err
+	}
+
+	if err = tx.Commit(); err != nil {
+		return nil, nil, err
+	}
+
+	abandoned, err := old.session()
+	if err != nil {
+		return nil, nil, err
+	}
+	started, err := ent.session()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return abandoned, started, nil
+}
+
 // Setup implements storage interface.
+// It applies pending schema migrations.
 func (s *Storage) Setup() error {
-	query := fmt.Sprintf(`
-		CREATE SCHEMA IF NOT EXISTS %s;
-		CREATE TABLE IF NOT EXISTS %s.%s (
-			access_token BYTEA PRIMARY KEY,
-			refresh_token BYTEA,
-			subject_id TEXT NOT NULL,
-			subject_client TEXT,
-			bag bytea NOT NULL,
-			expire_at TIMESTAMPTZ NOT NULL DEFAULT (NOW() + '%d seconds')
-
-		);
-		CREATE INDEX ON %s.%s (refresh_token);
-		CREATE INDEX ON %s.%s (subject_id);
-		CREATE INDEX ON %s.%s (expire_at DESC);
-	`, s.schema, s.schema, s.table, int64(s.ttl.Seconds()),
-		s.schema, s.table,
-		s.schema, s.table,
-		s.schema, s.table,
-	)
-	_, err := s.db.Exec(query)
+	m := NewMigrator(MigratorOpts{
+		Conn:   s.db,
+		Schema: s.schema,
+		Table:  s.table,
+		TTL:    s.ttl,
+	})
+	m.tokens = s.tokens
+	_, err := m.Up(context.Background())
 
 	return err
 }
@@ -422,6 +748,45 @@ func (s *Storage) incError(field prometheus.Labels) {
 	s.errors.With(field).Inc()
 }
 
+func (s *Storage) listWhere(query storage.ListQuery) ([]string, []interface{}) {
+	var (
+		args  []interface{}
+		where []string
+	)
+	cond := func(expr string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(expr, len(args)))
+	}
+	if query.ExpireAtFrom != nil {
+		cond("expire_at > $%d", query.ExpireAtFrom)
+	}
+	if query.ExpireAtTo != nil {
+		cond("expire_at < $%d", query.ExpireAtTo)
+	}
+	if query.AccessToken != "" {
+		cond("access_token = ANY($%d::BYTEA[])", pq.Array(s.tokens.candidates(query.AccessToken)))
+	}
+	if query.RefreshToken != "" {
+		cond("refresh_token = ANY($%d::BYTEA[])", pq.Array(s.tokens.candidates(query.RefreshToken)))
+	}
+	if query.SubjectID != "" {
+		cond("subject_id = $%d", query.SubjectID)
+	}
+	if query.SubjectClient != "" {
+		cond("subject_client = $%d", query.SubjectClient)
+	}
+	if len(query.Bag) > 0 {
+		cond("(bag @> $%d::JSONB OR bag_gob IS NOT NULL)", model.Bag(query.Bag))
+	}
+	// Cursor is made of values returned by List, access token is stored the way it is.
+	if query.After != nil {
+		args = append(args, query.After.ExpireAt, unfingerprint(query.After.AccessToken))
+		where = append(where, fmt.Sprintf("(expire_at, access_token) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+
+	return where, args
+}
+
 func (s *Storage) where(subjectID, accessToken, refreshToken string, expiredAtFrom, expiredAtTo *time.Time) (*bytes.Buffer, []interface{}) {
 	var count int
 	buf := bytes.NewBuffer(nil)
@@ -434,12 +799,12 @@ func (s *Storage) where(subjectID, accessToken, refreshToken string, expiredAtFr
 		args = append(args, subjectID)
 	case accessToken != "":
 		count++
-		fmt.Fprintf(buf, " access_token = $%d", count)
-		args = append(args, accessToken)
+		fmt.Fprintf(buf, " access_token = ANY($%d::BYTEA[])", count)
+		args = append(args, pq.Array(s.tokens.candidates(accessToken)))
 	case refreshToken != "":
 		count++
-		fmt.Fprintf(buf, " refresh_token = $%d", count)
-		args = append(args, refreshToken)
+		fmt.Fprintf(buf, " refresh_token = ANY($%d::BYTEA[])", count)
+		args = append(args, pq.Array(s.tokens.candidates(refreshToken)))
 	}
 	if expiredAtFrom != nil {
 		if buf.Len() > 0 {
@@ -480,12 +845,18 @@ func (s *Storage) Describe(in chan<- *prometheus.Desc) {
 }
 
 type sessionEntity struct {
-	AccessToken   string    `json:"accessToken"`
-	RefreshToken  string    `json:"refreshToken"`
-	SubjectID     string    `json:"subjectId"`
-	SubjectClient string    `json:"subjectClient"`
-	Bag           model.Bag `json:"bag"`
-	ExpireAt      time.Time `json:"expireAt"`
+	AccessToken      string     `json:"accessToken"`
+	RefreshToken     string     `json:"refreshToken"`
+	SubjectID        string     `json:"subjectId"`
+	SubjectClient    string     `json:"subjectClient"`
+	Bag              model.Bag  `json:"bag"`
+	ExpireAt         time.Time  `json:"expireAt"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	AbsoluteExpireAt *time.Time `json:"absoluteExpireAt"`
+	// IdleTimeout is expressed in microseconds, which is the precision of postgres intervals.
+	IdleTimeout int64 `json:"idleTimeout"`
+	// GobBag is set if the bag is not converted to JSON yet, it takes precedence over Bag.
+	GobBag model.GobBag `json:"-"`
 }
 
 func (se *sessionEntity) session() (*mnemosynerpc.Session, error) {
@@ -493,12 +864,35 @@ func (se *sessionEntity) session() (*mnemosynerpc.Session, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &mnemosynerpc.Session{
+	createdAt, err := ptypes.TimestampProto(se.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	ses := &mnemosynerpc.Session{
 		AccessToken:   se.AccessToken,
 		RefreshToken:  se.RefreshToken,
 		SubjectId:     se.SubjectID,
 		SubjectClient: se.SubjectClient,
-		Bag:           se.Bag,
+		Bag:           se.bag(),
 		ExpireAt:      expireAt,
-	}, nil
+		CreatedAt:     createdAt,
+		IdleTimeout:   ptypes.DurationProto(time.Duration(se.IdleTimeout) * time.Microsecond),
+	}
+	if se.AbsoluteExpireAt != nil {
+		if ses.AbsoluteExpireAt, err = ptypes.TimestampProto(*se.AbsoluteExpireAt); err != nil {
+			return nil, err
+		}
+	}
+	return ses, nil
+}
+
+func (se *sessionEntity) bag() model.Bag {
+	if se.GobBag != nil {
+		return model.Bag(se.GobBag)
+	}
+	return se.Bag
+}
+
+func microseconds(d time.Duration) int64 {
+	return d.Nanoseconds() / int64(time.Microsecond)
 }
@@ -42,6 +42,33 @@ func TestPostgresStorage_List_between(t *testing.T) {
 	s.teardown(t)
 }
 
+func TestPostgresStorage_List_query(t *testing.T) {
+	s := &postgresSuite{}
+	s.setup(t)
+
+	storage.TestStorageListQuery(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestPostgresStorage_List_cursor(t *testing.T) {
+	s := &postgresSuite{}
+	s.setup(t)
+
+	storage.TestStorageListCursor(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestPostgresStorage_Count(t *testing.T) {
+	s := &postgresSuite{}
+	s.setup(t)
+
+	storage.TestStorageCount(t, s.store)
+
+	s.teardown(t)
+}
+
 func TestPostgresStorage_Exists(t *testing.T) {
 	s := &postgresSuite{}
 	s.setup(t)
@@ -69,6 +96,42 @@ func TestPostgresStorage_SetValue(t *testing.T) {
 	s.teardown(t)
 }
 
+func TestPostgresStorage_Refresh(t *testing.T) {
+	s := &postgresSuite{}
+	s.setup(t)
+
+	storage.TestStorageRefresh(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestPostgresStorage_Refresh_expired(t *testing.T) {
+	s := &postgresSuite{}
+	s.setup(t)
+
+	storage.TestStorageRefreshExpired(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestPostgresStorage_Refresh_duplicated(t *testing.T) {
+	s := &postgresSuite{}
+	s.setup(t)
+
+	storage.TestStorageRefreshDuplicated(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestPostgresStorage_Lifetime(t *testing.T) {
+	s := &postgresSuite{}
+	s.setup(t)
+
+	storage.TestStorageLifetime(t, s.store)
+
+	s.teardown(t)
+}
+
 func TestPostgresStorage_Delete(t *testing.T) {
 	s := &postgresSuite{}
 	s.setup(t)
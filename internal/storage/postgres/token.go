@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+)
+
+// tokenKey is a secret used to hash tokens, identified by a short id that is stored next to the hashes.
+type tokenKey struct {
+	id     string
+	secret []byte
+}
+
+func newTokenKey(secret []byte) tokenKey {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte("mnemosyne-token-key"))
+
+	return tokenKey{
+		id:     hex.EncodeToString(mac.Sum(nil)[:4]),
+		secret: secret,
+	}
+}
+
+func (k tokenKey) hash(token string) string {
+	mac := hmac.New(sha256.New, k.secret)
+	mac.Write([]byte(token))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// store returns a value under which given token is stored.
+// Fingerprint is already hashed, empty token stays empty.
+func (k tokenKey) store(token string) string {
+	if token == "" {
+		return token
+	}
+	if fp, ok := mnemosyne.ParseTokenFingerprint(token); ok {
+		return fp.Hash
+	}
+	return k.hash(token)
+}
+
+// tokenHasher replaces tokens with their keyed hashes (HMAC-SHA256), so that a leaked database does not expose live sessions.
+// New tokens are hashed using the current key, lookups try previous keys as well.
+// Hashes are returned as token fingerprints, which can be used in place of tokens, e.g. to copy a session to another node.
+// Nil tokenHasher keeps tokens as they are.
+type tokenHasher struct {
+	current  tokenKey
+	previous []tokenKey
+}
+
+func newTokenHasher(secret []byte, previous [][]byte) *tokenHasher {
+	if len(secret) == 0 {
+		return nil
+	}
+
+	h := &tokenHasher{current: newTokenKey(secret)}
+	for _, p := range previous {
+		if len(p) > 0 {
+			h.previous = append(h.previous, newTokenKey(p))
+		}
+	}
+	return h
+}
+
+// hash returns a value under which given token is stored.
+// Empty token stays empty, it is not a secret.
+func (h *tokenHasher) hash(token string) string {
+	if h == nil {
+		return token
+	}
+	return h.current.store(token)
+}
+
+// storedTokens holds values under which tokens of a single session are stored.
+type storedTokens struct {
+	access, refresh string
+	// key is id of the key both tokens are hashed with.
+	key sql.NullString
+	// route is carried by the fingerprint of the access token.
+	route sql.NullString
+}
+
+// store returns values under which given tokens of a session are stored.
+// If any of them is a fingerprint, e.g. the session is a copy, both are hashed using its key, otherwise the current one is used.
+func (h *tokenHasher) store(accessToken, refreshToken string) (*storedTokens, error) {
+	if h == nil {
+		return &storedTokens{access: accessToken, refresh: refreshToken}, nil
+	}
+
+	key, route := h.current, mnemosyne.TokenRoute(accessToken)
+	fixed := false
+	for i, token := range []string{accessToken, refreshToken} {
+		fp, ok := mnemosyne.ParseTokenFingerprint(token)
+		if !ok {
+			continue
+		}
+		k, ok := h.find(fp.KeyID)
+		if !ok {
+			return nil, fmt.Errorf("postgres: token fingerprint is hashed with unknown key: %s", fp.KeyID)
+		}
+		if fixed && k.id != key.id {
+			return nil, fmt.Errorf("postgres: tokens of a session are hashed with different keys: %s and %s", key.id, k.id)
+		}
+		key, fixed = k, true
+		if i == 0 {
+			route = fp.Route
+		}
+	}
+
+	return &storedTokens{
+		access:  key.store(accessToken),
+		refresh: key.store(refreshToken),
+		key:     sql.NullString{String: key.id, Valid: true},
+		route:   sql.NullString{String: route, Valid: route != ""},
+	}, nil
+}
+
+// find returns a key with given id, if the hasher knows it.
+func (h *tokenHasher) find(id string) (tokenKey, bool) {
+	if id == h.current.id {
+		return h.current, true
+	}
+	for _, k := range h.previous {
+		if id == k.id {
+			return k, true
+		}
+	}
+	return tokenKey{}, false
+}
+
+// candidates returns every value under which given token can be stored.
+// Fingerprint can be stored only under the hash it carries.
+func (h *tokenHasher) candidates(token string) [][]byte {
+	if h == nil {
+		return [][]byte{[]byte(token)}
+	}
+	if fp, ok := mnemosyne.ParseTokenFingerprint(token); ok {
+		return [][]byte{[]byte(fp.Hash)}
+	}
+
+	candidates := make([][]byte, 0, 1+len(h.previous))
+	candidates = append(candidates, []byte(h.current.hash(token)))
+	for _, k := range h.previous {
+		candidates = append(candidates, []byte(k.hash(token)))
+	}
+	return candidates
+}
+
+// fingerprint returns what a token stored under given value is returned as.
+// Hashed token is replaced by its fingerprint, route is set only for access tokens.
+func fingerprint(stored string, key, route sql.NullString) string {
+	if !key.Valid || stored == "" {
+		return stored
+	}
+	return mnemosyne.TokenFingerprint{KeyID: key.String, Route: route.String, Hash: stored}.String()
+}
+
+// unfingerprint returns a value under which token with given fingerprint is stored, e.g. to compare it with others.
+func unfingerprint(token string) string {
+	if fp, ok := mnemosyne.ParseTokenFingerprint(token); ok {
+		return fp.Hash
+	}
+	return token
+}
+
+// key returns id of the current key, or NULL if tokens are not hashed.
+func (h *tokenHasher) key() sql.NullString {
+	if h == nil {
+		return sql.NullString{}
+	}
+	return sql.NullString{String: h.current.id, Valid: true}
+}
+
+// status describes given key id relatively to the keys the hasher knows.
+func (h *tokenHasher) status(id sql.NullString) string {
+	switch {
+	case !id.Valid:
+		return "plaintext"
+	case h == nil:
+		return "unknown"
+	case id.String == h.current.id:
+		return "current"
+	}
+	for _, k := range h.previous {
+		if id.String == k.id {
+			return "previous"
+		}
+	}
+	return "unknown"
+}
@@ -0,0 +1,111 @@
+package postgres
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+)
+
+func TestTokenHasher(t *testing.T) {
+	old := newTokenHasher([]byte("old"), nil)
+	h := newTokenHasher([]byte("new"), [][]byte{[]byte("old")})
+
+	if h.hash("token") == "token" {
+		t.Fatal("token should be hashed")
+	}
+	if h.hash("token") != h.hash("token") {
+		t.Fatal("hash should be deterministic")
+	}
+	if h.hash("token") == old.hash("token") {
+		t.Fatal("hash should depend on the secret")
+	}
+	if h.hash("") != "" {
+		t.Fatal("empty token should stay empty")
+	}
+
+	candidates := h.candidates("token")
+	if len(candidates) != 2 {
+		t.Fatalf("wrong number of candidates: %d", len(candidates))
+	}
+	if string(candidates[0]) != h.hash("token") || string(candidates[1]) != old.hash("token") {
+		t.Fatalf("current key should be tried first, then previous one, got %s", candidates)
+	}
+
+	for id, exp := range map[sql.NullString]string{
+		{}:                           "plaintext",
+		h.key():                      "current",
+		old.key():                    "previous",
+		{String: "abc", Valid: true}: "unknown",
+	} {
+		if got := h.status(id); got != exp {
+			t.Errorf("wrong status of %v, expected %s but got %s", id, exp, got)
+		}
+	}
+}
+
+func TestTokenHasher_nil(t *testing.T) {
+	h := newTokenHasher(nil, [][]byte{[]byte("old")})
+	if h != nil {
+		t.Fatal("hasher without secret should be nil")
+	}
+	if h.hash("token") != "token" {
+		t.Fatal("token should not be hashed")
+	}
+	if candidates := h.candidates("token"); len(candidates) != 1 || string(candidates[0]) != "token" {
+		t.Fatalf("token itself should be the only candidate, got %s", candidates)
+	}
+	if h.key().Valid {
+		t.Fatal("key should be NULL")
+	}
+	if got := h.status(sql.NullString{String: "abc", Valid: true}); got != "unknown" {
+		t.Fatalf("hashed token should be unknown, got %s", got)
+	}
+}
+
+func TestTokenHasher_store(t *testing.T) {
+	old := newTokenHasher([]byte("old"), nil)
+	h := newTokenHasher([]byte("new"), [][]byte{[]byte("old")})
+
+	stored, err := h.store("access", "refresh")
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if stored.access != h.hash("access") || stored.refresh != h.hash("refresh") {
+		t.Errorf("tokens should be hashed using the current key, got %v", stored)
+	}
+	if stored.key != h.key() {
+		t.Errorf("wrong key: %v", stored.key)
+	}
+	if stored.route.String != mnemosyne.TokenRoute("access") {
+		t.Errorf("wrong route: %v", stored.route)
+	}
+
+	// Copy of a session hashed using the previous key.
+	access := fingerprint(old.hash("access"), old.key(), sql.NullString{String: mnemosyne.TokenRoute("access"), Valid: true})
+	refresh := fingerprint(old.hash("refresh"), old.key(), sql.NullString{})
+	copied, err := h.store(access, refresh)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if copied.access != old.hash("access") || copied.refresh != old.hash("refresh") {
+		t.Errorf("fingerprints should be stored as they are, got %v", copied)
+	}
+	if copied.key != old.key() || copied.route != stored.route {
+		t.Errorf("key and route should be taken from the fingerprint, got %v", copied)
+	}
+	if candidates := h.candidates(access); len(candidates) != 1 || string(candidates[0]) != old.hash("access") {
+		t.Errorf("fingerprint should be the only candidate, got %s", candidates)
+	}
+	if unfingerprint(access) != old.hash("access") || unfingerprint("access") != "access" {
+		t.Error("fingerprint should be replaced by its hash")
+	}
+
+	unknown := newTokenHasher([]byte("unknown"), nil)
+	if _, err := h.store(fingerprint(unknown.hash("access"), unknown.key(), sql.NullString{}), "refresh"); err == nil {
+		t.Error("fingerprint hashed using unknown key should be rejected")
+	}
+	if _, err := h.store(access, fingerprint(h.hash("refresh"), h.key(), sql.NullString{})); err == nil {
+		t.Error("fingerprints hashed using different keys should be rejected")
+	}
+}
@@ -0,0 +1,925 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	goredis "github.com/go-redis/redis"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
+	"github.com/opentracing/opentracing-go"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	fieldRefreshToken  = "refresh_token"
+	fieldSubjectID     = "subject_id"
+	fieldSubjectClient = "subject_client"
+	fieldExpireAt      = "expire_at"
+	fieldCreatedAt     = "created_at"
+	// fieldAbsoluteExpireAt is empty if session lifetime is not limited.
+	fieldAbsoluteExpireAt = "absolute_expire_at"
+	// fieldIdleTimeout is expressed in milliseconds.
+	fieldIdleTimeout = "idle_timeout"
+	// prefixBag is prepended to each bag key, so that bag entries can live next to session fields.
+	prefixBag = "bag:"
+)
+
+var errSessionExists = errors.New("redis: session with given access token already exists")
+
+var monitoringRedisLabels = []string{
+	"query",
+}
+
+// Scripts below assume that all keys live on a single redis instance.
+// Keys of secondary indexes are derived from session hash fields,
+// hence prefix is passed as an argument.
+var (
+	// KEYS: session, expire
+	// ARGV: prefix, access token, refresh token, subject id, subject client, expire at, ttl, created at, idle timeout, absolute expire at, bag...
+	scriptStart = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 1 then
+	return redis.error_reply("session exists")
+end
+redis.call("HMSET", KEYS[1], "refresh_token", ARGV[3], "subject_id", ARGV[4], "subject_client", ARGV[5], "expire_at", ARGV[6],
+	"created_at", ARGV[8], "idle_timeout", ARGV[9], "absolute_expire_at", ARGV[10])
+for i = 11, #ARGV, 2 do
+	redis.call("HSET", KEYS[1], ARGV[i], ARGV[i+1])
+end
+redis.call("PEXPIRE", KEYS[1], ARGV[7])
+redis.call("ZADD", KEYS[2], ARGV[6], ARGV[2])
+
+local idx = {ARGV[1] .. ":subject:" .. ARGV[4]}
+if ARGV[3] ~= "" then
+	table.insert(idx, ARGV[1] .. ":refresh:" .. ARGV[3])
+end
+for _, k in ipairs(idx) do
+	redis.call("SADD", k, ARGV[2])
+	if redis.call("PTTL", k) < tonumber(ARGV[7]) then
+		redis.call("PEXPIRE", k, ARGV[7])
+	end
+end
+return redis.call("HGETALL", KEYS[1])
+`)
+	// KEYS: session, expire
+	// ARGV: prefix, access token, now, default idle timeout
+	scriptGet = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return nil
+end
+local ses = redis.call("HMGET", KEYS[1], "subject_id", "refresh_token", "idle_timeout", "absolute_expire_at", "expire_at")
+local now = tonumber(ARGV[3])
+-- Key expires natively, but it can outlive expiration time by the rounding of its ttl.
+if tonumber(ses[5]) and tonumber(ses[5]) <= now then
+	return nil
+end
+local exp = now + (tonumber(ses[3]) or tonumber(ARGV[4])) * 1000
+local abs = tonumber(ses[4])
+if abs and abs < exp then
+	exp = abs
+end
+local ttl = string.format("%d", math.max(math.floor((exp - now) / 1000), 1))
+exp = string.format("%d", exp)
+
+redis.call("HSET", KEYS[1], "expire_at", exp)
+redis.call("PEXPIRE", KEYS[1], ttl)
+redis.call("ZADD", KEYS[2], exp, ARGV[2])
+
+local idx = {ARGV[1] .. ":subject:" .. ses[1]}
+if ses[2] ~= "" then
+	table.insert(idx, ARGV[1] .. ":refresh:" .. ses[2])
+end
+for _, k in ipairs(idx) do
+	if redis.call("PTTL", k) < tonumber(ttl) then
+		redis.call("PEXPIRE", k, ttl)
+	end
+end
+return redis.call("HGETALL", KEYS[1])
+`)
+	// KEYS: session
+	// ARGV: bag key, bag value
+	scriptSetValue = goredis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return nil
+end
+redis.call("HSET", KEYS[1], ARGV[1], ARGV[2])
+return redis.call("HGETALL", KEYS[1])
+`)
+	// KEYS: session, expire
+	// ARGV: prefix, access token, expire at from (exclusive, optional), expire at to (exclusive, optional)
+	scriptDelete = goredis.NewScript(`
+local ses = redis.call("HMGET", KEYS[1], "subject_id", "refresh_token", "expire_at")
+if not ses[3] then
+	redis.call("ZREM", KEYS[2], ARGV[2])
+	return 0
+end
+local exp = tonumber(ses[3])
+if ARGV[3] ~= "" and exp <= tonumber(ARGV[3]) then
+	return 0
+end
+if ARGV[4] ~= "" and exp >= tonumber(ARGV[4]) then
+	return 0
+end
+redis.call("DEL", KEYS[1])
+redis.call("ZREM", KEYS[2], ARGV[2])
+redis.call("SREM", ARGV[1] .. ":subject:" .. ses[1], ARGV[2])
+if ses[2] ~= "" then
+	redis.call("SREM", ARGV[1] .. ":refresh:" .. ses[2], ARGV[2])
+end
+return 1
+`)
+	// KEYS: -
+	// ARGV: prefix, refresh token, access token, new refresh token, now, default idle timeout, bag prefix
+	scriptRefresh = goredis.NewScript(`
+local p = ARGV[1]
+local function remove(at)
+	local key = p .. ":session:" .. at
+	local ses = redis.call("HMGET", key, "subject_id", "refresh_token")
+	redis.call("DEL", key)
+	redis.call("ZREM", p .. ":expire", at)
+	if ses[1] then
+		redis.call("SREM", p .. ":subject:" .. ses[1], at)
+	end
+	if ses[2] and ses[2] ~= "" then
+		redis.call("SREM", p .. ":refresh:" .. ses[2], at)
+	end
+end
+
+if redis.call("EXISTS", p .. ":rotated:" .. ARGV[2]) == 1 then
+	local rt = ARGV[2]
+	while rt do
+		for _, at in ipairs(redis.call("SMEMBERS", p .. ":refresh:" .. rt)) do
+			remove(at)
+		end
+		local successor = redis.call("GET", p .. ":rotated:" .. rt)
+		redis.call("DEL", p .. ":rotated:" .. rt)
+		rt = successor
+	end
+	return redis.error_reply("refresh token reused")
+end
+
+-- Only unexpired session that expires last is rotated, on a tie the one with lowest access token.
+local old, oldExp
+for _, at in ipairs(redis.call("SMEMBERS", p .. ":refresh:" .. ARGV[2])) do
+	local exp = tonumber(redis.call("ZSCORE", p .. ":expire", at))
+	if exp and exp > tonumber(ARGV[5]) and redis.call("EXISTS", p .. ":session:" .. at) == 1 then
+		if not old or exp > oldExp or (exp == oldExp and at < old) then
+			old, oldExp = at, exp
+		end
+	end
+end
+if not old then
+	return nil
+end
+local key = p .. ":session:" .. ARGV[3]
+if redis.call("EXISTS", key) == 1 then
+	return redis.error_reply("session exists")
+end
+
+local fields = redis.call("HGETALL", p .. ":session:" .. old)
+remove(old)
+local sid, idle, abs = "", tonumber(ARGV[6]), nil
+for i = 1, #fields, 2 do
+	local k = fields[i]
+	if k == "subject_id" then
+		sid = fields[i+1]
+	elseif k == "idle_timeout" then
+		idle = tonumber(fields[i+1]) or idle
+	elseif k == "absolute_expire_at" then
+		abs = tonumber(fields[i+1])
+	end
+	if k == "subject_id" or k == "subject_client" or k == "absolute_expire_at" or string.sub(k, 1, #ARGV[7]) == ARGV[7] then
+		redis.call("HSET", key, k, fields[i+1])
+	end
+end
+local now = tonumber(ARGV[5])
+local exp = now + idle * 1000
+if abs and abs < exp then
+	exp = abs
+end
+local ttl = string.format("%d", math.max(math.floor((exp - now) / 1000), 1))
+exp = string.format("%d", exp)
+
+redis.call("HMSET", key, "refresh_token", ARGV[4], "expire_at", exp, "created_at", ARGV[5], "idle_timeout", string.format("%d", idle))
+redis.call("PEXPIRE", key, ttl)
+redis.call("ZADD", p .. ":expire", exp, ARGV[3])
+
+local idx = {p .. ":subject:" .. sid}
+if ARGV[4] ~= "" then
+	table.insert(idx, p .. ":refresh:" .. ARGV[4])
+end
+for _, k in ipairs(idx) do
+	redis.call("SADD", k, ARGV[3])
+	if redis.call("PTTL", k) < tonumber(ttl) then
+		redis.call("PEXPIRE", k, ttl)
+	end
+end
+redis.call("SET", p .. ":rotated:" .. ARGV[2], ARGV[4], "PX", ARGV[6])
+return {old, fields, redis.call("HGETALL", key)}
+`)
+)
+
+// Storage keeps sessions within redis.
+// Each session is stored as a hash that expires natively.
+// Sets keyed by subject id and refresh token, and a sorted set ordered by expiration time,
+// serve as secondary indexes. Rotated refresh tokens point at their successors.
+type Storage struct {
+	client *goredis.Client
+	prefix string
+	ttl    time.Duration
+	// monitoring
+	connections     prometheus.Gauge
+	queriesTotal    *prometheus.CounterVec
+	queriesDuration *prometheus.HistogramVec
+	errors          *prometheus.CounterVec
+}
+
+// StorageOpts is a set of arguments that can be passed to the NewStorage constructor function.
+type StorageOpts struct {
+	Client    *goredis.Client
+	Prefix    string
+	Namespace string
+	TTL       time.Duration
+}
+
+// NewStorage allocates new redis storage.
+func NewStorage(opts StorageOpts) storage.Storage {
+	return &Storage{
+		client: opts.Client,
+		prefix: opts.Prefix,
+		ttl:    opts.TTL,
+		queriesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "redis_queries_total",
+				Help:      "Total number of redis queries made.",
+			},
+			monitoringRedisLabels,
+		),
+		queriesDuration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "redis_query_duration_seconds",
+				Help:      "The redis query latencies in seconds on the client side.",
+			},
+			monitoringRedisLabels,
+		),
+		connections: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "redis_connections",
+				Help:      "Number of opened connections.",
+			},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: opts.Namespace,
+				Subsystem: "storage",
+				Name:      "redis_errors_total",
+				Help:      "Total number of errors that happen during redis queries.",
+			},
+			monitoringRedisLabels,
+		),
+	}
+}
+
+// Start implements storage interface.
+func (s *Storage) Start(ctx context.Context, accessToken, refreshToken, sid, sc string, b map[string]string, opts storage.StartOpts) (*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.start")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, storage.ErrMissingAccessToken
+	}
+
+	now := time.Now()
+	idleTimeout := opts.IdleTimeout
+	if idleTimeout <= 0 {
+		idleTimeout = s.ttl
+	}
+	var absoluteExpireAt time.Time
+	if opts.MaxLifetime > 0 {
+		absoluteExpireAt = now.Add(opts.MaxLifetime)
+	}
+	expireAt := storage.ExpireAt(now, idleTimeout, absoluteExpireAt)
+
+	createdAt := opts.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = now
+	}
+
+	args := make([]interface{}, 0, 10+2*len(b))
+	args = append(args, s.prefix, accessToken, refreshToken, sid, sc, score(expireAt), milliseconds(expireAt.Sub(now)))
+	if absoluteExpireAt.IsZero() {
+		args = append(args, score(createdAt), milliseconds(idleTimeout), "")
+	} else {
+		args = append(args, score(createdAt), milliseconds(idleTimeout), score(absoluteExpireAt))
+	}
+	for k, v := range b {
+		args = append(args, prefixBag+k, v)
+	}
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "save"}
+	res, err := scriptStart.Run(s.client.WithContext(ctx), s.keys(accessToken), args...).Result()
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+		if strings.Contains(err.Error(), "session exists") {
+			return nil, errSessionExists
+		}
+		return nil, err
+	}
+
+	return decode(accessToken, res)
+}
+
+// Get implements storage interface.
+// Each successful call extends session expiration time by its idle timeout, but never past its absolute deadline.
+func (s *Storage) Get(ctx context.Context, accessToken string) (*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.get")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "get"}
+	res, err := scriptGet.Run(s.client.WithContext(ctx), s.keys(accessToken),
+		s.prefix,
+		accessToken,
+		score(time.Now()),
+		milliseconds(s.ttl),
+	).Result()
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+		if err == goredis.Nil {
+			return nil, storage.ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	return decode(accessToken, res)
+}
+
+// List implements storage interface.
+// Sessions are ordered by expiration time and access token.
+// Subject id and refresh token conditions are resolved using secondary indexes,
+// remaining conditions are evaluated on the client side.
+func (s *Storage) List(ctx context.Context, offset, limit int64, query storage.ListQuery) ([]*mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.list")
+	defer span.Finish()
+
+	if limit == 0 {
+		return nil, errors.New("cannot retrieve list of sessions, limit needs to be higher than 0")
+	}
+
+	client := s.client.WithContext(ctx)
+	labels := prometheus.Labels{"query": "list"}
+
+	if !filtered(query) {
+		tokens, err := s.page(client, offset, limit, query)
+		if err != nil {
+			s.incError(labels)
+			return nil, err
+		}
+		return s.fetch(client, labels, tokens, query)
+	}
+
+	tokens, err := s.candidates(client, query)
+	if err != nil {
+		s.incError(labels)
+		return nil, err
+	}
+	sessions, err := s.fetch(client, labels, tokens, query)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		a, b := sessions[i].ExpireAt, sessions[j].ExpireAt
+		if a.Seconds != b.Seconds {
+			return a.Seconds < b.Seconds
+		}
+		if a.Nanos != b.Nanos {
+			return a.Nanos < b.Nanos
+		}
+		return sessions[i].AccessToken < sessions[j].AccessToken
+	})
+	if offset >= int64(len(sessions)) {
+		return []*mnemosynerpc.Session{}, nil
+	}
+	sessions = sessions[offset:]
+	if limit < int64(len(sessions)) {
+		sessions = sessions[:limit]
+	}
+
+	return sessions, nil
+}
+
+// Count implements storage interface.
+func (s *Storage) Count(ctx context.Context, query storage.ListQuery) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.count")
+	defer span.Finish()
+
+	query.After = nil
+
+	client := s.client.WithContext(ctx)
+	labels := prometheus.Labels{"query": "count"}
+
+	if !filtered(query) {
+		start := time.Now()
+		count, err := client.ZCount(s.keyExpire(), "("+score(minExpireAt(query.ExpireAtFrom)), maxScore(query.ExpireAtTo)).Result()
+		s.incQueries(labels, start)
+		if err != nil {
+			s.incError(labels)
+			return 0, err
+		}
+		return count, nil
+	}
+
+	tokens, err := s.candidates(client, query)
+	if err != nil {
+		s.incError(labels)
+		return 0, err
+	}
+	sessions, err := s.fetch(client, labels, tokens, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(len(sessions)), nil
+}
+
+// page returns access tokens of a single page of sessions, using expiration time index only.
+func (s *Storage) page(client *goredis.Client, offset, limit int64, query storage.ListQuery) ([]string, error) {
+	labels := prometheus.Labels{"query": "list"}
+	expiredAtFrom := minExpireAt(query.ExpireAtFrom)
+	min := "(" + score(expiredAtFrom)
+
+	var tokens []string
+	if after := query.After; after != nil && after.ExpireAt.After(expiredAtFrom) {
+		// Members that share a score are ordered lexicographically,
+		// those that share it with the cursor need to be compared with its access token.
+		if query.ExpireAtTo == nil || after.ExpireAt.Before(*query.ExpireAtTo) {
+			start := time.Now()
+			same, err := client.ZRangeByScore(s.keyExpire(), goredis.ZRangeBy{
+				Min: score(after.ExpireAt),
+				Max: score(after.ExpireAt),
+			}).Result()
+			s.incQueries(labels, start)
+			if err != nil {
+				return nil, err
+			}
+			for _, at := range same {
+				if at > after.AccessToken {
+					tokens = append(tokens, at)
+				}
+			}
+		}
+		min = "(" + score(after.ExpireAt)
+	}
+	if int64(len(tokens)) > offset {
+		tokens = tokens[offset:]
+		offset = 0
+	} else {
+		offset -= int64(len(tokens))
+		tokens = tokens[:0]
+	}
+	if int64(len(tokens)) >= limit {
+		return tokens[:limit], nil
+	}
+
+	start := time.Now()
+	rest, err := client.ZRangeByScore(s.keyExpire(), goredis.ZRangeBy{
+		Min:    min,
+		Max:    maxScore(query.ExpireAtTo),
+		Offset: offset,
+		Count:  limit - int64(len(tokens)),
+	}).Result()
+	s.incQueries(labels, start)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(tokens, rest...), nil
+}
+
+// candidates returns access tokens of sessions that can satisfy the query, using the most selective index available.
+func (s *Storage) candidates(client *goredis.Client, query storage.ListQuery) (tokens []string, err error) {
+	labels := prometheus.Labels{"query": "list"}
+	start := time.Now()
+	switch {
+	case query.AccessToken != "":
+		return []string{query.AccessToken}, nil
+	case query.SubjectID != "":
+		tokens, err = client.SMembers(s.keySubject(query.SubjectID)).Result()
+	case query.RefreshToken != "":
+		tokens, err = client.SMembers(s.keyRefresh(query.RefreshToken)).Result()
+	default:
+		tokens, err = client.ZRangeByScore(s.keyExpire(), goredis.ZRangeBy{
+			Min: "(" + score(minExpireAt(query.ExpireAtFrom)),
+			Max: maxScore(query.ExpireAtTo),
+		}).Result()
+	}
+	s.incQueries(labels, start)
+	return
+}
+
+// fetch retrieves sessions for given access tokens, those that do not satisfy the query are skipped.
+func (s *Storage) fetch(client *goredis.Client, labels prometheus.Labels, tokens []string, query storage.ListQuery) ([]*mnemosynerpc.Session, error) {
+	pipe := client.Pipeline()
+	cmds := make([]*goredis.StringStringMapCmd, 0, len(tokens))
+	for _, at := range tokens {
+		cmds = append(cmds, pipe.HGetAll(s.keySession(at)))
+	}
+	start := time.Now()
+	_, err := pipe.Exec()
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+		return nil, err
+	}
+
+	sessions := make([]*mnemosynerpc.Session, 0, len(tokens))
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			// Session expired in the meantime.
+			continue
+		}
+		ses, err := decodeMap(tokens[i], fields)
+		if err != nil {
+			return nil, err
+		}
+		if !query.Match(ses) {
+			continue
+		}
+		sessions = append(sessions, ses)
+	}
+
+	return sessions, nil
+}
+
+// Exists implements storage interface.
+func (s *Storage) Exists(ctx context.Context, accessToken string) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.exists")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "exists"}
+	// Key expires natively, but it can outlive expiration time by the rounding of its ttl.
+	expireAt, err := s.client.WithContext(ctx).HGet(s.keySession(accessToken), "expire_at").Int64()
+	s.incQueries(labels, start)
+	switch {
+	case err == goredis.Nil:
+		return false, nil
+	case err != nil:
+		s.incError(labels)
+		return false, err
+	}
+
+	return expireAt > time.Now().UnixNano()/int64(time.Microsecond), nil
+}
+
+// Abandon implements storage interface.
+func (s *Storage) Abandon(ctx context.Context, accessToken string) (bool, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.abandon")
+	defer span.Finish()
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "abandon"}
+	affected, err := s.delete(ctx, accessToken, nil, nil)
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+		return false, err
+	}
+	if !affected {
+		return false, storage.ErrSessionNotFound
+	}
+
+	return true, nil
+}
+
+// SetValue implements storage interface.
+// Value is set atomically, by a single script.
+func (s *Storage) SetValue(ctx context.Context, accessToken string, key, value string) (map[string]string, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.set-value")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, storage.ErrMissingAccessToken
+	}
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "set_value"}
+	res, err := scriptSetValue.Run(s.client.WithContext(ctx), []string{s.keySession(accessToken)}, prefixBag+key, value).Result()
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+		if err == goredis.Nil {
+			return nil, storage.ErrSessionNotFound
+		}
+		return nil, err
+	}
+
+	ses, err := decode(accessToken, res)
+	if err != nil {
+		return nil, err
+	}
+	return ses.Bag, nil
+}
+
+// Delete implements storage interface.
+// Only one of subject id, access token and refresh token is taken into account, in that order.
+func (s *Storage) Delete(ctx context.Context, subjectID, accessToken, refreshToken string, expiredAtFrom, expiredAtTo *time.Time) (int64, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.delete")
+	defer span.Finish()
+
+	if subjectID == "" && accessToken == "" && refreshToken == "" && expiredAtFrom == nil && expiredAtTo == nil {
+		return 0, errors.New("session cannot be deleted, no where parameter provided")
+	}
+
+	client := s.client.WithContext(ctx)
+	labels := prometheus.Labels{"query": "delete"}
+	start := time.Now()
+	defer s.incQueries(labels, start)
+
+	var (
+		tokens []string
+		err    error
+	)
+	switch {
+	case subjectID != "":
+		tokens, err = client.SMembers(s.keySubject(subjectID)).Result()
+	case accessToken != "":
+		tokens = []string{accessToken}
+	case refreshToken != "":
+		tokens, err = client.SMembers(s.keyRefresh(refreshToken)).Result()
+	default:
+		min := "-inf"
+		if expiredAtFrom != nil {
+			min = "(" + score(*expiredAtFrom)
+		}
+		tokens, err = client.ZRangeByScore(s.keyExpire(), goredis.ZRangeBy{
+			Min: min,
+			Max: maxScore(expiredAtTo),
+		}).Result()
+	}
+	if err != nil {
+		s.incError(labels)
+		return 0, err
+	}
+
+	var affected int64
+	for _, at := range tokens {
+		ok, err := s.delete(ctx, at, expiredAtFrom, expiredAtTo)
+		if err != nil {
+			s.incError(labels)
+			return affected, err
+		}
+		if ok {
+			affected++
+		}
+	}
+
+	return affected, nil
+}
+
+func (s *Storage) delete(ctx context.Context, accessToken string, expiredAtFrom, expiredAtTo *time.Time) (bool, error) {
+	var from, to string
+	if expiredAtFrom != nil {
+		from = score(*expiredAtFrom)
+	}
+	if expiredAtTo != nil {
+		to = score(*expiredAtTo)
+	}
+	n, err := scriptDelete.Run(s.client.WithContext(ctx), s.keys(accessToken), s.prefix, accessToken, from, to).Int64()
+	if err != nil {
+		return false, err
+	}
+	return n == 1, nil
+}
+
+// Refresh implements storage interface.
+// Rotation is performed atomically, by a single script.
+// Rotated refresh tokens are kept as keys that expire natively.
+func (s *Storage) Refresh(ctx context.Context, refreshToken, accessToken, newRefreshToken string) (*mnemosynerpc.Session, *mnemosynerpc.Session, error) {
+	span, ctx := opentracing.StartSpanFromContext(ctx, "redis.storage.refresh")
+	defer span.Finish()
+
+	if accessToken == "" {
+		return nil, nil, storage.ErrMissingAccessToken
+	}
+
+	start := time.Now()
+	labels := prometheus.Labels{"query": "refresh"}
+	res, err := scriptRefresh.Run(s.client.WithContext(ctx), nil,
+		s.prefix,
+		refreshToken,
+		accessToken,
+		newRefreshToken,
+		score(start),
+		milliseconds(s.ttl),
+		prefixBag,
+	).Result()
+	s.incQueries(labels, start)
+	if err != nil {
+		s.incError(labels)
+		switch {
+		case err == goredis.Nil:
+			return nil, nil, storage.ErrSessionNotFound
+		case strings.Contains(err.Error(), "refresh token reused"):
+			return nil, nil, storage.ErrRefreshTokenReused
+		case strings.Contains(err.Error(), "session exists"):
+			return nil, nil, errSessionExists
+		}
+		return nil, nil, err
+	}
+
+	values, ok := res.([]interface{})
+	if !ok || len(values) != 3 {
+		return nil, nil, errors.New("redis: unexpected script result")
+	}
+	oldAccessToken, _ := values[0].(string)
+	abandoned, err := decode(oldAccessToken, values[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	started, err := decode(accessToken, values[2])
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return abandoned, started, nil
+}
+
+// Setup implements storage interface.
+func (s *Storage) Setup() error {
+	return s.client.Ping().Err()
+}
+
+// TearDown implements storage interface.
+// It removes every key that starts with the storage prefix.
+func (s *Storage) TearDown() error {
+	iter := s.client.Scan(0, s.prefix+":*", 100).Iterator()
+	for iter.Next() {
+		if err := s.client.Del(iter.Val()).Err(); err != nil {
+			return err
+		}
+	}
+	return iter.Err()
+}
+
+// Collect implements prometheus Collector interface.
+func (s *Storage) Collect(in chan<- prometheus.Metric) {
+	s.connections.Set(float64(s.client.PoolStats().TotalConns))
+
+	s.connections.Collect(in)
+	s.queriesTotal.Collect(in)
+	s.queriesDuration.Collect(in)
+	s.errors.Collect(in)
+}
+
+// Describe implements prometheus Collector interface.
+func (s *Storage) Describe(in chan<- *prometheus.Desc) {
+	s.connections.Describe(in)
+	s.queriesTotal.Describe(in)
+	s.queriesDuration.Describe(in)
+	s.errors.Describe(in)
+}
+
+func (s *Storage) incQueries(field prometheus.Labels, start time.Time) {
+	s.queriesTotal.With(field).Inc()
+	s.queriesDuration.With(field).Observe(time.Since(start).Seconds())
+}
+
+func (s *Storage) incError(field prometheus.Labels) {
+	s.errors.With(field).Inc()
+}
+
+func (s *Storage) keys(accessToken string) []string {
+	return []string{s.keySession(accessToken), s.keyExpire()}
+}
+
+func (s *Storage) keySession(accessToken string) string {
+	return s.prefix + ":session:" + accessToken
+}
+
+func (s *Storage) keySubject(subjectID string) string {
+	return s.prefix + ":subject:" + subjectID
+}
+
+func (s *Storage) keyRefresh(refreshToken string) string {
+	return s.prefix + ":refresh:" + refreshToken
+}
+
+func (s *Storage) keyExpire() string {
+	return s.prefix + ":expire"
+}
+
+// score converts time into sorted set score.
+// Microseconds precision allows to keep the value within float64 integer range.
+func score(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Microsecond), 10)
+}
+
+func milliseconds(d time.Duration) int64 {
+	return d.Nanoseconds() / int64(time.Millisecond)
+}
+
+// minExpireAt returns lower bound of expiration time.
+// Expired sessions are removed by redis itself, there is no point to look for them.
+func minExpireAt(from *time.Time) time.Time {
+	now := time.Now()
+	if from == nil || from.Before(now) {
+		return now
+	}
+	return *from
+}
+
+// filtered returns true if query contains conditions that cannot be resolved using expiration time index alone.
+func filtered(query storage.ListQuery) bool {
+	return query.AccessToken != "" || query.RefreshToken != "" || query.SubjectID != "" || query.SubjectClient != "" || len(query.Bag) > 0
+}
+
+func maxScore(t *time.Time) string {
+	if t == nil {
+		return "+inf"
+	}
+	return "(" + score(*t)
+}
+
+func decode(accessToken string, res interface{}) (*mnemosynerpc.Session, error) {
+	values, ok := res.([]interface{})
+	if !ok || len(values)%2 != 0 {
+		return nil, errors.New("redis: unexpected script result")
+	}
+	fields := make(map[string]string, len(values)/2)
+	for i := 0; i < len(values); i += 2 {
+		k, _ := values[i].(string)
+		v, _ := values[i+1].(string)
+		fields[k] = v
+	}
+	return decodeMap(accessToken, fields)
+}
+
+func decodeMap(accessToken string, fields map[string]string) (*mnemosynerpc.Session, error) {
+	expireAt, err := decodeTime(fields[fieldExpireAt])
+	if err != nil {
+		return nil, err
+	}
+
+	ses := &mnemosynerpc.Session{
+		AccessToken:   accessToken,
+		RefreshToken:  fields[fieldRefreshToken],
+		SubjectId:     fields[fieldSubjectID],
+		SubjectClient: fields[fieldSubjectClient],
+		ExpireAt:      expireAt,
+	}
+	// Sessions started before lifetime fields were introduced do not have them.
+	if v := fields[fieldCreatedAt]; v != "" {
+		if ses.CreatedAt, err = decodeTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := fields[fieldAbsoluteExpireAt]; v != "" {
+		if ses.AbsoluteExpireAt, err = decodeTime(v); err != nil {
+			return nil, err
+		}
+	}
+	if v := fields[fieldIdleTimeout]; v != "" {
+		ms, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		ses.IdleTimeout = ptypes.DurationProto(time.Duration(ms) * time.Millisecond)
+	}
+	for k, v := range fields {
+		if !strings.HasPrefix(k, prefixBag) {
+			continue
+		}
+		if ses.Bag == nil {
+			ses.Bag = make(map[string]string)
+		}
+		ses.Bag[strings.TrimPrefix(k, prefixBag)] = v
+	}
+	return ses, nil
+}
+
+// decodeTime parses time stored with microseconds precision, the same way as sorted set scores.
+func decodeTime(v string) (*timestamp.Timestamp, error) {
+	micro, err := strconv.ParseInt(v, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return ptypes.TimestampProto(time.Unix(0, micro*int64(time.Microsecond)))
+}
@@ -0,0 +1,175 @@
+package redis_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+)
+
+func TestRedisStorage_Start(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageStart(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Get(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageGet(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_List(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageList(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_List_between(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageListBetween(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_List_query(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageListQuery(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_List_cursor(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageListCursor(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Count(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageCount(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Exists(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageExists(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Abandon(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageAbandon(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_SetValue(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageSetValue(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Refresh(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageRefresh(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Refresh_expired(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageRefreshExpired(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Refresh_duplicated(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageRefreshDuplicated(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Lifetime(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageLifetime(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_Delete(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+
+	storage.TestStorageDelete(t, s.store)
+
+	s.teardown(t)
+}
+
+func TestRedisStorage_expire(t *testing.T) {
+	s := &redisSuite{}
+	s.setup(t)
+	defer s.teardown(t)
+
+	if s.server == nil {
+		t.Skip("native expiry can be simulated only using in process redis")
+	}
+
+	ses, err := s.store.Start(context.Background(), "access-token", "refresh-token", "subject-id", "subject-client", nil, storage.StartOpts{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	s.server.FastForward(storage.DefaultTTL / 2)
+	if _, err = s.store.Get(context.Background(), ses.AccessToken); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	s.server.FastForward(storage.DefaultTTL / 2)
+	if _, err = s.store.Get(context.Background(), ses.AccessToken); err != nil {
+		t.Fatalf("session should be still available after get, but got error: %s", err.Error())
+	}
+	s.server.FastForward(storage.DefaultTTL + time.Second)
+	if _, err = s.store.Get(context.Background(), ses.AccessToken); err != storage.ErrSessionNotFound {
+		t.Fatalf("wrong error, expected %s but got %v", storage.ErrSessionNotFound, err)
+	}
+	if s.server.Exists("mnemosyne:subject:subject-id") {
+		t.Error("subject index should expire together with its sessions")
+	}
+}
@@ -0,0 +1,76 @@
+package redis_test
+
+import (
+	"flag"
+	"os"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	goredis "github.com/go-redis/redis"
+	"github.com/piotrkowalczuk/mnemosyne/internal/service/redis"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	storageredis "github.com/piotrkowalczuk/mnemosyne/internal/storage/redis"
+	"go.uber.org/zap"
+)
+
+var testRedisAddress string
+
+func TestMain(m *testing.M) {
+	// If address is not provided, in process redis stand-in is used.
+	flag.StringVar(&testRedisAddress, "redis.address", getStringEnvOr("MNEMOSYNED_REDIS_ADDRESS", ""), "")
+	flag.Parse()
+
+	os.Exit(m.Run())
+}
+
+func getStringEnvOr(env, or string) string {
+	if v := os.Getenv(env); v != "" {
+		return v
+	}
+	return or
+}
+
+type redisSuite struct {
+	server *miniredis.Miniredis
+	client *goredis.Client
+	store  storage.Storage
+}
+
+func (rs *redisSuite) setup(t *testing.T) {
+	var err error
+
+	address := testRedisAddress
+	if address == "" {
+		if rs.server, err = miniredis.Run(); err != nil {
+			t.Fatal(err)
+		}
+		address = rs.server.Addr()
+	}
+
+	rs.client, err = redis.Init(address, redis.Opts{
+		Logger: zap.L(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rs.store, err = storage.Init(storageredis.NewStorage(storageredis.StorageOpts{
+		Client: rs.client,
+		Prefix: "mnemosyne",
+		TTL:    storage.DefaultTTL,
+	}), true); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func (rs *redisSuite) teardown(t *testing.T) {
+	if err := rs.store.TearDown(); err != nil {
+		t.Fatal(err)
+	}
+	if err := rs.client.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if rs.server != nil {
+		rs.server.Close()
+	}
+}
@@ -6,6 +6,7 @@ import (
 
 	"context"
 
+	"github.com/golang/protobuf/ptypes"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -22,28 +23,132 @@ var (
 	ErrMissingAccessToken = errors.New("storage: missing access token")
 	ErrMissingSubjectID   = errors.New("storage: missing subject accessToken")
 	ErrMissingSession     = errors.New("storage: missing session")
+	// ErrRefreshTokenReused is returned if refresh token that was already rotated is presented again.
+	ErrRefreshTokenReused = errors.New("storage: refresh token reused")
 )
 
 const (
-	// EngineInMemory is not implemented yet.
+	// EngineInMemory keeps sessions within process memory, they do not survive a restart.
 	EngineInMemory = "in_memory"
 	// EnginePostgres keeps session within postgres database.
 	EnginePostgres = "postgres"
-	// EngineRedis is not implemented yet.
+	// EngineRedis keeps sessions within redis, as hashes that expire natively.
 	EngineRedis = "redis"
+	// EngineEmbedded keeps sessions within a local file, they survive a restart but are not shared between nodes.
+	EngineEmbedded = "embedded"
 )
 
 // Storage combines API that needs to be implemented by any storage to be replaceable.
 type Storage interface {
 	Setup() error
 	TearDown() error
-	Start(context.Context, string, string, string, string, map[string]string) (*mnemosynerpc.Session, error)
+	// Start persists a new session, see StartOpts for its optional parameters.
+	Start(ctx context.Context, accessToken, refreshToken, subjectID, subjectClient string, bag map[string]string, opts StartOpts) (*mnemosynerpc.Session, error)
 	Abandon(context.Context, string) (bool, error)
 	Get(context.Context, string) (*mnemosynerpc.Session, error)
-	List(context.Context, int64, int64, *time.Time, *time.Time) ([]*mnemosynerpc.Session, error)
+	List(context.Context, int64, int64, ListQuery) ([]*mnemosynerpc.Session, error)
+	Count(context.Context, ListQuery) (int64, error)
 	Exists(context.Context, string) (bool, error)
 	Delete(context.Context, string, string, string, *time.Time, *time.Time) (int64, error)
 	SetValue(context.Context, string, string, string) (map[string]string, error)
+	// Refresh atomically abandons session that holds given refresh token
+	// and starts a new one, with the same subject, bag, idle timeout and absolute deadline,
+	// under given access and refresh token.
+	// Both abandoned and started sessions are returned.
+	// Rotated refresh tokens are remembered for TTL. If such token is presented again,
+	// sessions that descend from it are removed and ErrRefreshTokenReused is returned.
+	Refresh(ctx context.Context, refreshToken, accessToken, newRefreshToken string) (abandoned, started *mnemosynerpc.Session, err error)
+}
+
+// ListQuery narrows down list of sessions returned by storage.
+// Zero value fields are ignored, non-empty ones need to be satisfied all at once.
+type ListQuery struct {
+	ExpireAtFrom  *time.Time
+	ExpireAtTo    *time.Time
+	RefreshToken  string
+	SubjectID     string
+	SubjectClient string
+	// AccessToken narrows down the result to a single session.
+	// Unlike Get, listing does not extend expiration time of the session.
+	AccessToken string
+	// Bag holds key/value pairs that need to be present in session bag.
+	Bag map[string]string
+	// After if set, only sessions ordered after the cursor are returned.
+	// It is ignored by Count.
+	After *Cursor
+}
+
+// Cursor points at a position within the list of sessions ordered by expiration time and access token.
+type Cursor struct {
+	ExpireAt    time.Time
+	AccessToken string
+}
+
+// Before returns true if the cursor is ordered before given position.
+func (c Cursor) Before(expireAt time.Time, accessToken string) bool {
+	if !expireAt.Equal(c.ExpireAt) {
+		return c.ExpireAt.Before(expireAt)
+	}
+	return c.AccessToken < accessToken
+}
+
+// Match returns true if given session satisfies the query.
+// It can be used by engines that cannot express some of the conditions natively.
+func (q ListQuery) Match(ses *mnemosynerpc.Session) bool {
+	if q.AccessToken != "" && ses.AccessToken != q.AccessToken {
+		return false
+	}
+	if q.RefreshToken != "" && ses.RefreshToken != q.RefreshToken {
+		return false
+	}
+	if q.SubjectID != "" && ses.SubjectId != q.SubjectID {
+		return false
+	}
+	if q.SubjectClient != "" && ses.SubjectClient != q.SubjectClient {
+		return false
+	}
+	for k, v := range q.Bag {
+		if got, ok := ses.Bag[k]; !ok || got != v {
+			return false
+		}
+	}
+	if q.ExpireAtFrom != nil || q.ExpireAtTo != nil || q.After != nil {
+		expireAt, err := ptypes.Timestamp(ses.ExpireAt)
+		if err != nil {
+			return false
+		}
+		if q.ExpireAtFrom != nil && !expireAt.After(*q.ExpireAtFrom) {
+			return false
+		}
+		if q.ExpireAtTo != nil && !expireAt.Before(*q.ExpireAtTo) {
+			return false
+		}
+		if q.After != nil && !q.After.Before(expireAt, ses.AccessToken) {
+			return false
+		}
+	}
+	return true
+}
+
+// ExpireAt returns expiration time of a session that was active at given moment.
+// Expiration time never goes past absolute deadline, unless it is zero.
+func ExpireAt(now time.Time, idleTimeout time.Duration, absoluteExpireAt time.Time) time.Time {
+	expireAt := now.Add(idleTimeout)
+	if !absoluteExpireAt.IsZero() && absoluteExpireAt.Before(expireAt) {
+		return absoluteExpireAt
+	}
+	return expireAt
+}
+
+// StartOpts holds optional parameters of a started session, zero value fields are ignored.
+type StartOpts struct {
+	// IdleTimeout overrides storage TTL.
+	IdleTimeout time.Duration
+	// MaxLifetime sets an absolute deadline, expiration time is never extended past it.
+	MaxLifetime time.Duration
+	// CreatedAt is kept as creation time instead of the current one.
+	// It is meant for copies of sessions that were started elsewhere, e.g. replicas, so that their age stays the same.
+	CreatedAt time.Time
 }
 
 // InstrumentedStorage combines Storage and prometheus Collector interface.
@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/timestamp"
 	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -21,7 +22,7 @@ func TestStorageStart(t *testing.T, s Storage) {
 	bag := map[string]string{
 		"username": "test",
 	}
-	session, err := s.Start(context.Background(), randomToken(t), "", subjectID, subjectClient, bag)
+	session, err := s.Start(context.Background(), randomToken(t), "", subjectID, subjectClient, bag, StartOpts{})
 
 	if assert.NoError(t, err) {
 		assert.Len(t, session.AccessToken, 128)
@@ -35,7 +36,7 @@ func TestStorageGet(t *testing.T, s Storage) {
 
 	ses, err := s.Start(context.Background(), randomToken(t), randomToken(t), "subjectID", "subjectClient", map[string]string{
 		"username": "test",
-	})
+	}, StartOpts{})
 	require.NoError(t, err)
 
 	// Check for existing Token
@@ -62,18 +63,18 @@ func TestStorageList(t *testing.T, s Storage) {
 	sc := "subjectClient"
 
 	for i := 1; i <= nb; i++ {
-		_, err := s.Start(context.Background(), randomToken(t), randomToken(t), sid, sc, map[string]string{key: strconv.FormatInt(int64(i), 10)})
+		_, err := s.Start(context.Background(), randomToken(t), randomToken(t), sid, sc, map[string]string{key: strconv.FormatInt(int64(i), 10)}, StartOpts{})
 		if err != nil {
 			t.Fatalf("unexpected error on session start: %s", err.Error())
 		}
 	}
 
-	sessions, err := s.List(context.Background(), 2, int64(nb), nil, nil)
+	sessions, err := s.List(context.Background(), 2, int64(nb), ListQuery{})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err.Error())
 	}
 
-	_, err = s.List(context.Background(), 2, 0, nil, nil)
+	_, err = s.List(context.Background(), 2, 0, ListQuery{})
 	if err == nil {
 		t.Fatal("expected error")
 	}
@@ -102,7 +103,7 @@ func TestStorageListBetween(t *testing.T, s Storage) {
 	)
 
 	for i := 1; i <= nb; i++ {
-		res, err := s.Start(context.Background(), randomToken(t), "", sid, sc, map[string]string{key: strconv.FormatInt(int64(i), 10)})
+		res, err := s.Start(context.Background(), randomToken(t), "", sid, sc, map[string]string{key: strconv.FormatInt(int64(i), 10)}, StartOpts{})
 		if err != nil {
 			t.Fatalf("unexpected error on session start: %s", err.Error())
 		}
@@ -120,7 +121,7 @@ func TestStorageListBetween(t *testing.T, s Storage) {
 		}
 	}
 
-	sessions, err := s.List(context.Background(), 0, int64(nb), &from, &to)
+	sessions, err := s.List(context.Background(), 0, int64(nb), ListQuery{ExpireAtFrom: &from, ExpireAtTo: &to})
 	if err != nil {
 		t.Fatalf("unexpected error: %s", err.Error())
 	}
@@ -129,10 +130,238 @@ func TestStorageListBetween(t *testing.T, s Storage) {
 	}
 }
 
+func TestStorageListQuery(t *testing.T, s Storage) {
+	type given struct {
+		refreshToken, subjectID, subjectClient string
+		bag                                    map[string]string
+	}
+	data := []given{
+		{refreshToken: "rt-1", subjectID: "sid-1", subjectClient: "web", bag: map[string]string{"tenant": "a", "role": "admin"}},
+		{refreshToken: "rt-2", subjectID: "sid-1", subjectClient: "mobile", bag: map[string]string{"tenant": "a", "role": "user"}},
+		{refreshToken: "rt-3", subjectID: "sid-2", subjectClient: "web", bag: map[string]string{"tenant": "b", "role": "user"}},
+		{refreshToken: "", subjectID: "sid-3", subjectClient: "web", bag: map[string]string{"tenant": "a"}},
+	}
+	tokens := make([]string, 0, len(data))
+	for _, d := range data {
+		ses, err := s.Start(context.Background(), randomToken(t), d.refreshToken, d.subjectID, d.subjectClient, d.bag, StartOpts{})
+		if err != nil {
+			t.Fatalf("unexpected error on session start: %s", err.Error())
+		}
+		tokens = append(tokens, ses.AccessToken)
+	}
+
+	cases := map[string]struct {
+		query    ListQuery
+		expected []string
+	}{
+		"none": {
+			query:    ListQuery{},
+			expected: []string{"sid-1", "sid-1", "sid-2", "sid-3"},
+		},
+		"access-token": {
+			query:    ListQuery{AccessToken: tokens[2]},
+			expected: []string{"sid-2"},
+		},
+		"access-token-and-subject-id": {
+			query:    ListQuery{AccessToken: tokens[2], SubjectID: "sid-1"},
+			expected: []string{},
+		},
+		"access-token-not-found": {
+			query:    ListQuery{AccessToken: randomToken(t)},
+			expected: []string{},
+		},
+		"refresh-token": {
+			query:    ListQuery{RefreshToken: "rt-2"},
+			expected: []string{"sid-1"},
+		},
+		"subject-id": {
+			query:    ListQuery{SubjectID: "sid-1"},
+			expected: []string{"sid-1", "sid-1"},
+		},
+		"subject-client": {
+			query:    ListQuery{SubjectClient: "web"},
+			expected: []string{"sid-1", "sid-2", "sid-3"},
+		},
+		"subject-id-and-client": {
+			query:    ListQuery{SubjectID: "sid-1", SubjectClient: "web"},
+			expected: []string{"sid-1"},
+		},
+		"bag": {
+			query:    ListQuery{Bag: map[string]string{"tenant": "a"}},
+			expected: []string{"sid-1", "sid-1", "sid-3"},
+		},
+		"bag-multiple-pairs": {
+			query:    ListQuery{Bag: map[string]string{"tenant": "a", "role": "user"}},
+			expected: []string{"sid-1"},
+		},
+		"bag-and-subject-client": {
+			query:    ListQuery{SubjectClient: "web", Bag: map[string]string{"role": "user"}},
+			expected: []string{"sid-2"},
+		},
+		"not-found": {
+			query:    ListQuery{SubjectID: "sid-1", Bag: map[string]string{"tenant": "b"}},
+			expected: []string{},
+		},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			sessions, err := s.List(context.Background(), 0, 10, c.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			got := make([]string, 0, len(sessions))
+			for _, ses := range sessions {
+				if !c.query.Match(ses) {
+					t.Errorf("session does not match the query: %v", ses)
+				}
+				got = append(got, ses.SubjectId)
+			}
+			assert.ElementsMatch(t, c.expected, got)
+		})
+	}
+
+	sessions, err := s.List(context.Background(), 1, 1, ListQuery{Bag: map[string]string{"tenant": "a"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(sessions) != 1 {
+		t.Fatalf("wrong number of sessions returned: expected %d but got %d", 1, len(sessions))
+	}
+}
+
+func TestStorageListCursor(t *testing.T, s Storage) {
+	nb := 11
+	for i := 0; i < nb; i++ {
+		sid := "odd"
+		if i%2 == 0 {
+			sid = "even"
+		}
+		_, err := s.Start(context.Background(), randomToken(t), randomToken(t), sid, "subjectClient", map[string]string{
+			"index": strconv.Itoa(i),
+		}, StartOpts{})
+		if err != nil {
+			t.Fatalf("unexpected error on session start: %s", err.Error())
+		}
+	}
+
+	paginate := func(t *testing.T, query ListQuery, size int64) []string {
+		var got []string
+		for {
+			sessions, err := s.List(context.Background(), 0, size, query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			for _, ses := range sessions {
+				got = append(got, ses.AccessToken)
+			}
+			if int64(len(sessions)) < size {
+				return got
+			}
+			last := sessions[len(sessions)-1]
+			expireAt, err := ptypes.Timestamp(last.ExpireAt)
+			if err != nil {
+				t.Fatalf("timestamp conversion unexpected error: %s", err.Error())
+			}
+			query.After = &Cursor{ExpireAt: expireAt, AccessToken: last.AccessToken}
+		}
+	}
+	expected := func(t *testing.T, query ListQuery) []string {
+		sessions, err := s.List(context.Background(), 0, int64(nb), query)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		tokens := make([]string, 0, len(sessions))
+		for _, ses := range sessions {
+			tokens = append(tokens, ses.AccessToken)
+		}
+		return tokens
+	}
+
+	t.Run("all", func(t *testing.T) {
+		exp := expected(t, ListQuery{})
+		if len(exp) != nb {
+			t.Fatalf("wrong number of sessions returned: expected %d but got %d", nb, len(exp))
+		}
+		assert.Equal(t, exp, paginate(t, ListQuery{}, 3))
+	})
+	t.Run("filtered", func(t *testing.T) {
+		query := ListQuery{SubjectID: "even"}
+		exp := expected(t, query)
+		if len(exp) != nb/2+1 {
+			t.Fatalf("wrong number of sessions returned: expected %d but got %d", nb/2+1, len(exp))
+		}
+		assert.Equal(t, exp, paginate(t, query, 2))
+	})
+}
+
+func TestStorageCount(t *testing.T, s Storage) {
+	for i := 0; i < 8; i++ {
+		sid := "odd"
+		if i%2 == 0 {
+			sid = "even"
+		}
+		_, err := s.Start(context.Background(), randomToken(t), randomToken(t), sid, "subjectClient", map[string]string{
+			"divisible-by-four": strconv.FormatBool(i%4 == 0),
+		}, StartOpts{})
+		if err != nil {
+			t.Fatalf("unexpected error on session start: %s", err.Error())
+		}
+	}
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	cases := map[string]struct {
+		query    ListQuery
+		expected int64
+	}{
+		"none": {
+			query:    ListQuery{},
+			expected: 8,
+		},
+		"subject-id": {
+			query:    ListQuery{SubjectID: "even"},
+			expected: 4,
+		},
+		"bag": {
+			query:    ListQuery{Bag: map[string]string{"divisible-by-four": "true"}},
+			expected: 2,
+		},
+		"subject-id-and-bag": {
+			query:    ListQuery{SubjectID: "odd", Bag: map[string]string{"divisible-by-four": "true"}},
+			expected: 0,
+		},
+		"expire-at-from-in-future": {
+			query:    ListQuery{ExpireAtFrom: &future},
+			expected: 0,
+		},
+		"cursor-ignored": {
+			query:    ListQuery{After: &Cursor{ExpireAt: future}},
+			expected: 8,
+		},
+		"expire-at-range": {
+			query:    ListQuery{ExpireAtFrom: &past, ExpireAtTo: &future},
+			expected: 8,
+		},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			got, err := s.Count(context.Background(), c.query)
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			if got != c.expected {
+				t.Errorf("wrong number of sessions: expected %d but got %d", c.expected, got)
+			}
+		})
+	}
+}
+
 func TestStorageExists(t *testing.T, s Storage) {
 	ses, err := s.Start(context.Background(), randomToken(t), "", "subjectID", "subjectClient", map[string]string{
 		"username": "test",
-	})
+	}, StartOpts{})
 	require.NoError(t, err)
 
 	// Check for existing Token
@@ -150,7 +379,7 @@ func TestStorageExists(t *testing.T, s Storage) {
 func TestStorageAbandon(t *testing.T, s Storage) {
 	ses, err := s.Start(context.Background(), randomToken(t), "", "subjectID", "subjectClient", map[string]string{
 		"username": "test",
-	})
+	}, StartOpts{})
 	require.NoError(t, err)
 
 	// Check for existing Token
@@ -172,7 +401,7 @@ func TestStorageAbandon(t *testing.T, s Storage) {
 func TestStorageSetValue(t *testing.T, s Storage) {
 	ses, err := s.Start(context.Background(), randomToken(t), "", "subjectID", "subjectClient", map[string]string{
 		"username": "test",
-	})
+	}, StartOpts{})
 	if err != nil {
 		t.Fatalf("unexpected error on session start: %s", err.Error())
 	}
@@ -241,6 +470,141 @@ func TestStorageSetValue(t *testing.T, s Storage) {
 	}
 }
 
+func TestStorageRefresh(t *testing.T, s Storage) {
+	ctx := context.Background()
+	rt1 := randomToken(t)
+	ses1, err := s.Start(ctx, randomToken(t), rt1, "subjectID", "subjectClient", map[string]string{
+		"username": "test",
+	}, StartOpts{})
+	require.NoError(t, err)
+
+	// Check rotation
+	rt2 := randomToken(t)
+	abandoned, ses2, err := s.Refresh(ctx, rt1, randomToken(t), rt2)
+	require.NoError(t, err)
+	assert.Equal(t, ses1.AccessToken, abandoned.AccessToken)
+	assert.Equal(t, rt1, abandoned.RefreshToken)
+	assert.Equal(t, rt2, ses2.RefreshToken)
+	assert.Equal(t, ses1.SubjectId, ses2.SubjectId)
+	assert.Equal(t, ses1.SubjectClient, ses2.SubjectClient)
+	assert.Equal(t, "test", ses2.Bag["username"])
+	_, err = s.Get(ctx, ses1.AccessToken)
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	// Check next rotation within the same family
+	rt3 := randomToken(t)
+	_, ses3, err := s.Refresh(ctx, rt2, randomToken(t), rt3)
+	require.NoError(t, err)
+
+	// Check reuse of already rotated token, whole family should be revoked
+	_, _, err = s.Refresh(ctx, rt1, randomToken(t), randomToken(t))
+	assert.Equal(t, ErrRefreshTokenReused, err)
+	_, err = s.Get(ctx, ses3.AccessToken)
+	assert.Equal(t, ErrSessionNotFound, err)
+	_, _, err = s.Refresh(ctx, rt3, randomToken(t), randomToken(t))
+	assert.Equal(t, ErrSessionNotFound, err)
+
+	// Check for refresh token that never exists
+	_, _, err = s.Refresh(ctx, "keyhash", randomToken(t), randomToken(t))
+	assert.Equal(t, ErrSessionNotFound, err)
+}
+
+func TestStorageRefreshExpired(t *testing.T, s Storage) {
+	ctx := context.Background()
+	rt := randomToken(t)
+	_, err := s.Start(ctx, randomToken(t), rt, "subjectID", "subjectClient", nil, StartOpts{IdleTimeout: time.Millisecond})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	_, _, err = s.Refresh(ctx, rt, randomToken(t), randomToken(t))
+	assert.Equal(t, ErrSessionNotFound, err, "expired session should not be refreshed")
+}
+
+func TestStorageRefreshDuplicated(t *testing.T, s Storage) {
+	ctx := context.Background()
+	rt := randomToken(t)
+	short, err := s.Start(ctx, randomToken(t), rt, "subjectID", "subjectClient", nil, StartOpts{IdleTimeout: time.Minute})
+	require.NoError(t, err)
+	long, err := s.Start(ctx, randomToken(t), rt, "subjectID", "subjectClient", nil, StartOpts{IdleTimeout: time.Hour})
+	require.NoError(t, err)
+
+	// Only the session that expires last is rotated
+	abandoned, _, err := s.Refresh(ctx, rt, randomToken(t), randomToken(t))
+	require.NoError(t, err)
+	assert.Equal(t, long.AccessToken, abandoned.AccessToken)
+	_, err = s.Get(ctx, long.AccessToken)
+	assert.Equal(t, ErrSessionNotFound, err)
+	exists, err := s.Exists(ctx, short.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
+
+func TestStorageLifetime(t *testing.T, s Storage) {
+	ctx := context.Background()
+	timestamp := func(ts *timestamp.Timestamp) time.Time {
+		t.Helper()
+		res, err := ptypes.Timestamp(ts)
+		require.NoError(t, err)
+		return res
+	}
+
+	// Check absolute deadline
+	rt := randomToken(t)
+	ses, err := s.Start(ctx, randomToken(t), rt, "subjectID", "subjectClient", nil, StartOpts{IdleTimeout: time.Hour, MaxLifetime: time.Minute})
+	require.NoError(t, err)
+	require.NotNil(t, ses.CreatedAt)
+	require.NotNil(t, ses.AbsoluteExpireAt)
+	idleTimeout, err := ptypes.Duration(ses.IdleTimeout)
+	require.NoError(t, err)
+	assert.Equal(t, time.Hour, idleTimeout)
+	absoluteExpireAt := timestamp(ses.AbsoluteExpireAt)
+	assert.WithinDuration(t, timestamp(ses.CreatedAt).Add(time.Minute), absoluteExpireAt, time.Millisecond)
+	assert.True(t, timestamp(ses.ExpireAt).Equal(absoluteExpireAt), "expiration time should not exceed absolute deadline")
+
+	got, err := s.Get(ctx, ses.AccessToken)
+	require.NoError(t, err)
+	assert.True(t, timestamp(got.ExpireAt).Equal(absoluteExpireAt), "expiration time should not be extended past absolute deadline")
+
+	// Check that refresh does not extend absolute deadline
+	_, refreshed, err := s.Refresh(ctx, rt, randomToken(t), randomToken(t))
+	require.NoError(t, err)
+	require.NotNil(t, refreshed.AbsoluteExpireAt)
+	assert.True(t, timestamp(refreshed.AbsoluteExpireAt).Equal(absoluteExpireAt))
+	assert.True(t, timestamp(refreshed.ExpireAt).Equal(absoluteExpireAt))
+
+	// Check idle timeout without absolute deadline
+	ses, err = s.Start(ctx, randomToken(t), "", "subjectID", "subjectClient", nil, StartOpts{IdleTimeout: time.Minute})
+	require.NoError(t, err)
+	assert.Nil(t, ses.AbsoluteExpireAt)
+	assert.WithinDuration(t, timestamp(ses.CreatedAt).Add(time.Minute), timestamp(ses.ExpireAt), time.Millisecond)
+
+	got, err = s.Get(ctx, ses.AccessToken)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), timestamp(got.ExpireAt), 5*time.Second)
+
+	// Check that copy keeps creation time of the original
+	createdAt := time.Now().Add(-time.Hour).Truncate(time.Millisecond)
+	ses, err = s.Start(ctx, randomToken(t), "", "subjectID", "subjectClient", nil, StartOpts{IdleTimeout: time.Minute, CreatedAt: createdAt})
+	require.NoError(t, err)
+	assert.WithinDuration(t, createdAt, timestamp(ses.CreatedAt), time.Millisecond)
+	assert.WithinDuration(t, time.Now().Add(time.Minute), timestamp(ses.ExpireAt), 5*time.Second)
+
+	got, err = s.Get(ctx, ses.AccessToken)
+	require.NoError(t, err)
+	assert.WithinDuration(t, createdAt, timestamp(got.CreatedAt), time.Millisecond)
+
+	// Check that expired session cannot be retrieved, even before it is removed
+	ses, err = s.Start(ctx, randomToken(t), "", "subjectID", "subjectClient", nil, StartOpts{IdleTimeout: time.Hour, MaxLifetime: time.Millisecond})
+	require.NoError(t, err)
+	time.Sleep(10 * time.Millisecond)
+
+	_, err = s.Get(ctx, ses.AccessToken)
+	assert.Equal(t, ErrSessionNotFound, err)
+	exists, err := s.Exists(ctx, ses.AccessToken)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
 func TestStorageDelete(t *testing.T, s Storage) {
 	nb := int64(10)
 	key := "index"
@@ -248,7 +612,7 @@ func TestStorageDelete(t *testing.T, s Storage) {
 	sc := "subjectClient"
 
 	for i := int64(1); i <= nb; i++ {
-		_, err := s.Start(context.Background(), randomToken(t), "", sid, sc, map[string]string{key: strconv.FormatInt(i, 10)})
+		_, err := s.Start(context.Background(), randomToken(t), "", sid, sc, map[string]string{key: strconv.FormatInt(i, 10)}, StartOpts{})
 		if err != nil {
 			t.Fatalf("unexpected error on session start: %s", err.Error())
 		}
@@ -334,7 +698,7 @@ func TestStorageDelete(t *testing.T, s Storage) {
 
 DataLoop:
 	for _, args := range data {
-		ses, err := s.Start(context.Background(), randomToken(t), randomToken(t), "subjectID", "subjectID", nil)
+		ses, err := s.Start(context.Background(), randomToken(t), randomToken(t), "subjectID", "subjectID", nil, StartOpts{})
 		require.NoError(t, err)
 
 		if !assert.NoError(t, err) {
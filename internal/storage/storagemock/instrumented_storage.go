@@ -5,6 +5,7 @@ package storagemock
 import context "context"
 import mnemosynerpc "github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 import mock "github.com/stretchr/testify/mock"
+import storage "github.com/piotrkowalczuk/mnemosyne/internal/storage"
 import prometheus "github.com/prometheus/client_golang/prometheus"
 
 import time "time"
@@ -40,6 +41,27 @@ func (_m *InstrumentedStorage) Collect(_a0 chan<- prometheus.Metric) {
 	_m.Called(_a0)
 }
 
+// Count provides a mock function with given fields: _a0, _a1
+func (_m *InstrumentedStorage) Count(_a0 context.Context, _a1 storage.ListQuery) (int64, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ListQuery) int64); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, storage.ListQuery) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4, _a5
 func (_m *InstrumentedStorage) Delete(_a0 context.Context, _a1 string, _a2 string, _a3 string, _a4 *time.Time, _a5 *time.Time) (int64, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3, _a4, _a5)
@@ -110,13 +132,13 @@ func (_m *InstrumentedStorage) Get(_a0 context.Context, _a1 string) (*mnemosyner
 	return r0, r1
 }
 
-// List provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4
-func (_m *InstrumentedStorage) List(_a0 context.Context, _a1 int64, _a2 int64, _a3 *time.Time, _a4 *time.Time) ([]*mnemosynerpc.Session, error) {
-	ret := _m.Called(_a0, _a1, _a2, _a3, _a4)
+// List provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *InstrumentedStorage) List(_a0 context.Context, _a1 int64, _a2 int64, _a3 storage.ListQuery) ([]*mnemosynerpc.Session, error) {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
 
 	var r0 []*mnemosynerpc.Session
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, *time.Time, *time.Time) []*mnemosynerpc.Session); ok {
-		r0 = rf(_a0, _a1, _a2, _a3, _a4)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, storage.ListQuery) []*mnemosynerpc.Session); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*mnemosynerpc.Session)
@@ -124,8 +146,8 @@ func (_m *InstrumentedStorage) List(_a0 context.Context, _a1 int64, _a2 int64, _
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, *time.Time, *time.Time) error); ok {
-		r1 = rf(_a0, _a1, _a2, _a3, _a4)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, storage.ListQuery) error); ok {
+		r1 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -133,6 +155,38 @@ func (_m *InstrumentedStorage) List(_a0 context.Context, _a1 int64, _a2 int64, _
 	return r0, r1
 }
 
+// Refresh provides a mock function with given fields: ctx, refreshToken, accessToken, newRefreshToken
+func (_m *InstrumentedStorage) Refresh(ctx context.Context, refreshToken string, accessToken string, newRefreshToken string) (*mnemosynerpc.Session, *mnemosynerpc.Session, error) {
+	ret := _m.Called(ctx, refreshToken, accessToken, newRefreshToken)
+
+	var r0 *mnemosynerpc.Session
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *mnemosynerpc.Session); ok {
+		r0 = rf(ctx, refreshToken, accessToken, newRefreshToken)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mnemosynerpc.Session)
+		}
+	}
+
+	var r1 *mnemosynerpc.Session
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) *mnemosynerpc.Session); ok {
+		r1 = rf(ctx, refreshToken, accessToken, newRefreshToken)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*mnemosynerpc.Session)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, string) error); ok {
+		r2 = rf(ctx, refreshToken, accessToken, newRefreshToken)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // SetValue provides a mock function with given fields: _a0, _a1, _a2, _a3
 func (_m *InstrumentedStorage) SetValue(_a0 context.Context, _a1 string, _a2 string, _a3 string) (map[string]string, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3)
@@ -170,13 +224,13 @@ func (_m *InstrumentedStorage) Setup() error {
 	return r0
 }
 
-// Start provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4, _a5
-func (_m *InstrumentedStorage) Start(_a0 context.Context, _a1 string, _a2 string, _a3 string, _a4 string, _a5 map[string]string) (*mnemosynerpc.Session, error) {
-	ret := _m.Called(_a0, _a1, _a2, _a3, _a4, _a5)
+// Start provides a mock function with given fields: ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts
+func (_m *InstrumentedStorage) Start(ctx context.Context, accessToken string, refreshToken string, subjectID string, subjectClient string, bag map[string]string, opts storage.StartOpts) (*mnemosynerpc.Session, error) {
+	ret := _m.Called(ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts)
 
 	var r0 *mnemosynerpc.Session
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, map[string]string) *mnemosynerpc.Session); ok {
-		r0 = rf(_a0, _a1, _a2, _a3, _a4, _a5)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, map[string]string, storage.StartOpts) *mnemosynerpc.Session); ok {
+		r0 = rf(ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*mnemosynerpc.Session)
@@ -184,8 +238,8 @@ func (_m *InstrumentedStorage) Start(_a0 context.Context, _a1 string, _a2 string
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string, map[string]string) error); ok {
-		r1 = rf(_a0, _a1, _a2, _a3, _a4, _a5)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string, map[string]string, storage.StartOpts) error); ok {
+		r1 = rf(ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts)
 	} else {
 		r1 = ret.Error(1)
 	}
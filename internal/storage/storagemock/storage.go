@@ -5,6 +5,7 @@ package storagemock
 import context "context"
 import mnemosynerpc "github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 import mock "github.com/stretchr/testify/mock"
+import storage "github.com/piotrkowalczuk/mnemosyne/internal/storage"
 
 import time "time"
 
@@ -34,6 +35,27 @@ func (_m *Storage) Abandon(_a0 context.Context, _a1 string) (bool, error) {
 	return r0, r1
 }
 
+// Count provides a mock function with given fields: _a0, _a1
+func (_m *Storage) Count(_a0 context.Context, _a1 storage.ListQuery) (int64, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 int64
+	if rf, ok := ret.Get(0).(func(context.Context, storage.ListQuery) int64); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Get(0).(int64)
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, storage.ListQuery) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // Delete provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4, _a5
 func (_m *Storage) Delete(_a0 context.Context, _a1 string, _a2 string, _a3 string, _a4 *time.Time, _a5 *time.Time) (int64, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3, _a4, _a5)
@@ -99,13 +121,13 @@ func (_m *Storage) Get(_a0 context.Context, _a1 string) (*mnemosynerpc.Session,
 	return r0, r1
 }
 
-// List provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4
-func (_m *Storage) List(_a0 context.Context, _a1 int64, _a2 int64, _a3 *time.Time, _a4 *time.Time) ([]*mnemosynerpc.Session, error) {
-	ret := _m.Called(_a0, _a1, _a2, _a3, _a4)
+// List provides a mock function with given fields: _a0, _a1, _a2, _a3
+func (_m *Storage) List(_a0 context.Context, _a1 int64, _a2 int64, _a3 storage.ListQuery) ([]*mnemosynerpc.Session, error) {
+	ret := _m.Called(_a0, _a1, _a2, _a3)
 
 	var r0 []*mnemosynerpc.Session
-	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, *time.Time, *time.Time) []*mnemosynerpc.Session); ok {
-		r0 = rf(_a0, _a1, _a2, _a3, _a4)
+	if rf, ok := ret.Get(0).(func(context.Context, int64, int64, storage.ListQuery) []*mnemosynerpc.Session); ok {
+		r0 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).([]*mnemosynerpc.Session)
@@ -113,8 +135,8 @@ func (_m *Storage) List(_a0 context.Context, _a1 int64, _a2 int64, _a3 *time.Tim
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, *time.Time, *time.Time) error); ok {
-		r1 = rf(_a0, _a1, _a2, _a3, _a4)
+	if rf, ok := ret.Get(1).(func(context.Context, int64, int64, storage.ListQuery) error); ok {
+		r1 = rf(_a0, _a1, _a2, _a3)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -122,6 +144,38 @@ func (_m *Storage) List(_a0 context.Context, _a1 int64, _a2 int64, _a3 *time.Tim
 	return r0, r1
 }
 
+// Refresh provides a mock function with given fields: ctx, refreshToken, accessToken, newRefreshToken
+func (_m *Storage) Refresh(ctx context.Context, refreshToken string, accessToken string, newRefreshToken string) (*mnemosynerpc.Session, *mnemosynerpc.Session, error) {
+	ret := _m.Called(ctx, refreshToken, accessToken, newRefreshToken)
+
+	var r0 *mnemosynerpc.Session
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string) *mnemosynerpc.Session); ok {
+		r0 = rf(ctx, refreshToken, accessToken, newRefreshToken)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mnemosynerpc.Session)
+		}
+	}
+
+	var r1 *mnemosynerpc.Session
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string) *mnemosynerpc.Session); ok {
+		r1 = rf(ctx, refreshToken, accessToken, newRefreshToken)
+	} else {
+		if ret.Get(1) != nil {
+			r1 = ret.Get(1).(*mnemosynerpc.Session)
+		}
+	}
+
+	var r2 error
+	if rf, ok := ret.Get(2).(func(context.Context, string, string, string) error); ok {
+		r2 = rf(ctx, refreshToken, accessToken, newRefreshToken)
+	} else {
+		r2 = ret.Error(2)
+	}
+
+	return r0, r1, r2
+}
+
 // SetValue provides a mock function with given fields: _a0, _a1, _a2, _a3
 func (_m *Storage) SetValue(_a0 context.Context, _a1 string, _a2 string, _a3 string) (map[string]string, error) {
 	ret := _m.Called(_a0, _a1, _a2, _a3)
@@ -159,13 +213,13 @@ func (_m *Storage) Setup() error {
 	return r0
 }
 
-// Start provides a mock function with given fields: _a0, _a1, _a2, _a3, _a4, _a5
-func (_m *Storage) Start(_a0 context.Context, _a1 string, _a2 string, _a3 string, _a4 string, _a5 map[string]string) (*mnemosynerpc.Session, error) {
-	ret := _m.Called(_a0, _a1, _a2, _a3, _a4, _a5)
+// Start provides a mock function with given fields: ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts
+func (_m *Storage) Start(ctx context.Context, accessToken string, refreshToken string, subjectID string, subjectClient string, bag map[string]string, opts storage.StartOpts) (*mnemosynerpc.Session, error) {
+	ret := _m.Called(ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts)
 
 	var r0 *mnemosynerpc.Session
-	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, map[string]string) *mnemosynerpc.Session); ok {
-		r0 = rf(_a0, _a1, _a2, _a3, _a4, _a5)
+	if rf, ok := ret.Get(0).(func(context.Context, string, string, string, string, map[string]string, storage.StartOpts) *mnemosynerpc.Session); ok {
+		r0 = rf(ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts)
 	} else {
 		if ret.Get(0) != nil {
 			r0 = ret.Get(0).(*mnemosynerpc.Session)
@@ -173,8 +227,8 @@ func (_m *Storage) Start(_a0 context.Context, _a1 string, _a2 string, _a3 string
 	}
 
 	var r1 error
-	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string, map[string]string) error); ok {
-		r1 = rf(_a0, _a1, _a2, _a3, _a4, _a5)
+	if rf, ok := ret.Get(1).(func(context.Context, string, string, string, string, map[string]string, storage.StartOpts) error); ok {
+		r1 = rf(ctx, accessToken, refreshToken, subjectID, subjectClient, bag, opts)
 	} else {
 		r1 = ret.Error(1)
 	}
@@ -0,0 +1,94 @@
+package mnemosyned
+
+import (
+	"errors"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errInvalidAccessToken  = status.Errorf(codes.Unauthenticated, "mnemosyned: invalid access token")
+	errInvalidRefreshToken = status.Errorf(codes.Unauthenticated, "mnemosyned: invalid refresh token")
+)
+
+// accessTokens generates access tokens and verifies the ones presented by clients.
+// Without keys, or if nil, tokens are random and any token is accepted.
+type accessTokens struct {
+	// keys are all active keys, the first one signs new tokens.
+	keys []mnemosyne.AccessTokenKey
+	// unsigned if true, tokens that are not signed at all are accepted as well.
+	unsigned bool
+}
+
+func newAccessTokens(keys []mnemosyne.AccessTokenKey, unsigned bool) (*accessTokens, error) {
+	ids := make(map[string]bool, len(keys))
+	for _, k := range keys {
+		if err := k.Validate(); err != nil {
+			return nil, err
+		}
+		if ids[k.ID] {
+			return nil, errors.New("mnemosyned: duplicated access token key id: " + k.ID)
+		}
+		ids[k.ID] = true
+	}
+	return &accessTokens{keys: keys, unsigned: unsigned}, nil
+}
+
+// random returns a new access token, signed with the first key if any.
+// If partitioned, the token carries given partition, see cluster.Partition.
+func (at *accessTokens) random(partition uint16, partitioned bool) (string, error) {
+	switch {
+	case (at == nil || len(at.keys) == 0) && partitioned:
+		return mnemosyne.RandomAccessTokenInPartition(partition)
+	case at == nil || len(at.keys) == 0:
+		return mnemosyne.RandomAccessToken()
+	case partitioned:
+		return mnemosyne.RandomSignedAccessTokenInPartition(at.keys[0], partition)
+	}
+	return mnemosyne.RandomSignedAccessToken(at.keys[0])
+}
+
+// verify returns Unauthenticated error if given token could not be generated by random.
+// It is cheap, so it is done before the token is routed, looked up in the cache or the storage.
+// Token fingerprint is accepted instead, but only if it comes from the cluster itself, see untrustedFingerprint.
+func (at *accessTokens) verify(ctx context.Context, token string) error {
+	if _, ok := mnemosyne.ParseTokenFingerprint(token); ok {
+		if untrustedFingerprint(ctx, token) {
+			return errInvalidAccessToken
+		}
+		return nil
+	}
+	if at == nil || len(at.keys) == 0 {
+		return nil
+	}
+	switch _, err := mnemosyne.ParseSignedAccessToken(token, at.keys...); {
+	case err == mnemosyne.ErrUnsignedAccessToken && at.unsigned:
+		return nil
+	case err != nil:
+		return errInvalidAccessToken
+	}
+	return nil
+}
+
+// trustedKey is a context key of requests made by the daemon itself, see withTrusted.
+type trustedKey struct{}
+
+// withTrusted marks given context as used by the daemon itself, e.g. to evict a session it got from the storage.
+func withTrusted(ctx context.Context) context.Context {
+	return context.WithValue(ctx, trustedKey{}, true)
+}
+
+// untrustedFingerprint returns true if given token is a fingerprint that a client tries to use.
+// Fingerprints are returned in place of hashed tokens, so that other nodes can route and copy such sessions.
+// They are not secret, e.g. they can leak along with the database, so only the cluster itself can refer to sessions using them.
+func untrustedFingerprint(ctx context.Context, token string) bool {
+	if _, ok := mnemosyne.ParseTokenFingerprint(token); !ok {
+		return false
+	}
+	trusted, _ := ctx.Value(trustedKey{}).(bool)
+	return !trusted && !cluster.IsInternalRequest(ctx)
+}
@@ -0,0 +1,30 @@
+package mnemosyned
+
+import (
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+	"golang.org/x/net/context"
+)
+
+func TestAccessTokens_verify_fingerprint(t *testing.T) {
+	at, err := newAccessTokens([]mnemosyne.AccessTokenKey{{ID: "current", Secret: []byte("secret")}}, false)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	fp := mnemosyne.TokenFingerprint{KeyID: "k", Route: mnemosyne.TokenRoute("token"), Hash: "abc"}.String()
+
+	for hint, tokens := range map[string]*accessTokens{"signed": at, "random": nil} {
+		t.Run(hint, func(t *testing.T) {
+			if err := tokens.verify(context.Background(), fp); err != errInvalidAccessToken {
+				t.Errorf("client should not be able to use a fingerprint, got %v", err)
+			}
+			if err := tokens.verify(withTrusted(context.Background()), fp); err != nil {
+				t.Errorf("daemon should be able to use a fingerprint, got %s", err.Error())
+			}
+		})
+	}
+	if untrustedFingerprint(context.Background(), "token") {
+		t.Error("token should not be taken for a fingerprint")
+	}
+}
@@ -0,0 +1,194 @@
+package mnemosyned
+
+import (
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/piotrkowalczuk/mnemosyne/internal/constant"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// subscriptionBuffer is a number of events that can wait for delivery,
+// subscribers that fall behind are disconnected.
+const subscriptionBuffer = 1024
+
+type subscription struct {
+	events chan *mnemosynerpc.Event
+	req    *mnemosynerpc.WatchRequest
+	// local subscriptions receive only events that originate from the current node.
+	local bool
+	// lagging is set if subscription got closed because it was not able to keep up.
+	lagging bool
+}
+
+func (s *subscription) match(ev *mnemosynerpc.Event) bool {
+	if s.req.SubjectId != "" && ev.GetSession().GetSubjectId() != s.req.SubjectId {
+		return false
+	}
+	if s.req.SubjectClient != "" && ev.GetSession().GetSubjectClient() != s.req.SubjectClient {
+		return false
+	}
+	if len(s.req.Types) == 0 {
+		return true
+	}
+	for _, t := range s.req.Types {
+		if t == ev.Type {
+			return true
+		}
+	}
+	return false
+}
+
+// broker fans out session lifecycle events to all subscribers.
+type broker struct {
+	addr   string
+	mu     sync.RWMutex
+	subs   map[*subscription]struct{}
+	closed bool
+	// monitoring
+	eventsTotal       *prometheus.CounterVec
+	subscribersActive prometheus.Gauge
+}
+
+func newBroker(addr string) *broker {
+	return &broker{
+		addr: addr,
+		subs: make(map[*subscription]struct{}),
+		eventsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "watch",
+				Name:      "events_total",
+				Help:      "Total number of published session events.",
+			},
+			[]string{"type", "origin"},
+		),
+		subscribersActive: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "watch",
+				Name:      "subscribers",
+				Help:      "Number of active watch subscribers.",
+			},
+		),
+	}
+}
+
+// subscribe registers new subscription, it returns false if broker is already closed.
+func (b *broker) subscribe(req *mnemosynerpc.WatchRequest, local bool) (*subscription, bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return nil, false
+	}
+
+	sub := &subscription{
+		events: make(chan *mnemosynerpc.Event, subscriptionBuffer),
+		req:    req,
+		local:  local,
+	}
+	b.subs[sub] = struct{}{}
+	b.subscribersActive.Inc()
+
+	return sub, true
+}
+
+func (b *broker) unsubscribe(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.remove(sub)
+}
+
+// remove expects lock to be acquired.
+func (b *broker) remove(sub *subscription) {
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.events)
+		b.subscribersActive.Dec()
+	}
+}
+
+// watched returns true if there is at least one subscriber.
+// It allows to avoid unnecessary work if nobody is interested in events.
+// Other nodes subscribe only while a client watches them, see sessionManagerWatch.relay.
+func (b *broker) watched() bool {
+	if b == nil {
+		return false
+	}
+
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	return len(b.subs) > 0
+}
+
+// emit publishes event that originates from the current node.
+func (b *broker) emit(typ mnemosynerpc.EventType, sessions ...*mnemosynerpc.Session) {
+	if !b.watched() {
+		return
+	}
+
+	now, _ := ptypes.TimestampProto(time.Now())
+	for _, ses := range sessions {
+		b.publish(&mnemosynerpc.Event{
+			Type:       typ,
+			Session:    ses,
+			OccurredAt: now,
+			Node:       b.addr,
+		}, true)
+	}
+}
+
+// publish delivers event to all matching subscribers without blocking.
+func (b *broker) publish(ev *mnemosynerpc.Event, local bool) {
+	origin := "local"
+	if !local {
+		origin = "remote"
+	}
+	b.eventsTotal.WithLabelValues(ev.Type.String(), origin).Inc()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for sub := range b.subs {
+		if sub.local && !local {
+			continue
+		}
+		if !sub.match(ev) {
+			continue
+		}
+		select {
+		case sub.events <- ev:
+		default:
+			sub.lagging = true
+			b.remove(sub)
+		}
+	}
+}
+
+// close disconnects all subscribers and rejects new ones.
+func (b *broker) close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		b.remove(sub)
+	}
+}
+
+// Collect implements prometheus Collector interface.
+func (b *broker) Collect(in chan<- prometheus.Metric) {
+	b.eventsTotal.Collect(in)
+	b.subscribersActive.Collect(in)
+}
+
+// Describe implements prometheus Collector interface.
+func (b *broker) Describe(in chan<- *prometheus.Desc) {
+	b.eventsTotal.Describe(in)
+	b.subscribersActive.Describe(in)
+}
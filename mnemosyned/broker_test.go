@@ -0,0 +1,67 @@
+package mnemosyned
+
+import (
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+)
+
+func TestBroker_publish(t *testing.T) {
+	b := newBroker("127.0.0.1:8080")
+
+	all, _ := b.subscribe(&mnemosynerpc.WatchRequest{}, false)
+	subject, _ := b.subscribe(&mnemosynerpc.WatchRequest{SubjectId: "subject-1"}, false)
+	typed, _ := b.subscribe(&mnemosynerpc.WatchRequest{Types: []mnemosynerpc.EventType{mnemosynerpc.EventType_SESSION_DELETED}}, false)
+	local, _ := b.subscribe(&mnemosynerpc.WatchRequest{}, true)
+
+	b.emit(mnemosynerpc.EventType_SESSION_STARTED, &mnemosynerpc.Session{SubjectId: "subject-1"})
+	b.emit(mnemosynerpc.EventType_SESSION_DELETED, &mnemosynerpc.Session{SubjectId: "subject-2"})
+	b.publish(&mnemosynerpc.Event{Type: mnemosynerpc.EventType_SESSION_STARTED, Session: &mnemosynerpc.Session{SubjectId: "subject-1"}}, false)
+
+	cases := map[string]struct {
+		sub *subscription
+		exp int
+	}{
+		"all":     {sub: all, exp: 3},
+		"subject": {sub: subject, exp: 2},
+		"typed":   {sub: typed, exp: 1},
+		"local":   {sub: local, exp: 2},
+	}
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			if len(c.sub.events) != c.exp {
+				t.Errorf("wrong number of events, expected %d but got %d", c.exp, len(c.sub.events))
+			}
+		})
+	}
+}
+
+func TestBroker_publish_lagging(t *testing.T) {
+	b := newBroker("127.0.0.1:8080")
+
+	sub, _ := b.subscribe(&mnemosynerpc.WatchRequest{}, false)
+	for i := 0; i <= subscriptionBuffer; i++ {
+		b.emit(mnemosynerpc.EventType_SESSION_STARTED, &mnemosynerpc.Session{})
+	}
+
+	if !sub.lagging {
+		t.Error("subscription should be marked as lagging")
+	}
+	if b.watched() {
+		t.Error("lagging subscription should be removed")
+	}
+}
+
+func TestBroker_close(t *testing.T) {
+	b := newBroker("127.0.0.1:8080")
+
+	sub, _ := b.subscribe(&mnemosynerpc.WatchRequest{}, false)
+	b.close()
+
+	if _, ok := <-sub.events; ok {
+		t.Error("events channel should be closed")
+	}
+	if _, ok := b.subscribe(&mnemosynerpc.WatchRequest{}, false); ok {
+		t.Error("closed broker should reject new subscriptions")
+	}
+}
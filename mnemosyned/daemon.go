@@ -2,6 +2,8 @@ package mnemosyned
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/tls"
 	"database/sql"
 	"errors"
 	"fmt"
@@ -11,21 +13,31 @@ import (
 	"net/http/pprof"
 	"net/url"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	goredis "github.com/go-redis/redis"
 	otgrpc "github.com/opentracing-contrib/go-grpc"
 	"github.com/opentracing/opentracing-go"
+	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
+	"github.com/piotrkowalczuk/mnemosyne/internal/certificate"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
 	"github.com/piotrkowalczuk/mnemosyne/internal/constant"
+	"github.com/piotrkowalczuk/mnemosyne/internal/discovery"
 	"github.com/piotrkowalczuk/mnemosyne/internal/service/postgres"
+	"github.com/piotrkowalczuk/mnemosyne/internal/service/redis"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	storageembedded "github.com/piotrkowalczuk/mnemosyne/internal/storage/embedded"
+	storagemem "github.com/piotrkowalczuk/mnemosyne/internal/storage/memory"
 	storagepq "github.com/piotrkowalczuk/mnemosyne/internal/storage/postgres"
+	storageredis "github.com/piotrkowalczuk/mnemosyne/internal/storage/redis"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 	"github.com/piotrkowalczuk/promgrpc/v3"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	bolt "go.etcd.io/bbolt"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
@@ -33,47 +45,130 @@ import (
 	"google.golang.org/grpc/health/grpc_health_v1"
 )
 
+// DefaultShutdownTimeout is how long in-flight requests are drained during shutdown if not specified otherwise.
+// It is shorter than the default grace period of Kubernetes, so the process can exit cleanly.
+const DefaultShutdownTimeout = 25 * time.Second
+
+const (
+	convertBagsBatchSize     = 500
+	convertBagsRetryInterval = time.Minute
+)
+
 // DaemonOpts it is constructor argument that can be passed to
 // the NewDaemon constructor function.
 type DaemonOpts struct {
-	Version             string
-	IsTest              bool
-	SessionTTL          time.Duration
-	SessionTTC          time.Duration
-	TLS                 bool
-	TLSCertFile         string
-	TLSKeyFile          string
-	Storage             string
-	PostgresAddress     string
-	PostgresTable       string
-	PostgresSchema      string
-	Logger              *zap.Logger
-	RPCOptions          []grpc.ServerOption
-	RPCListener         net.Listener
-	DebugListener       net.Listener
-	ClusterListenAddr   string
-	ClusterSeeds        []string
+	Version     string
+	IsTest      bool
+	SessionTTL  time.Duration
+	SessionTTC  time.Duration
+	CacheTTL    time.Duration
+	CacheSize   int
+	TLS         bool
+	TLSCertFile string
+	TLSKeyFile  string
+	// TLSCAFile holds certificate authorities that client and peer certificates are verified against.
+	TLSCAFile string
+	// TLSClientAuth is one of none, request or require.
+	TLSClientAuth string
+	// TLSPeerCertFile and TLSPeerKeyFile hold the certificate presented to other nodes of the cluster.
+	// If not set, the server certificate is used.
+	TLSPeerCertFile string
+	TLSPeerKeyFile  string
+	// DebugTLS if true, debug server is served over TLS, using the same certificates as rpc server.
+	// Client certificates are not asked for, so that probes and metric scrapers can reach it.
+	DebugTLS          bool
+	Storage           string
+	PostgresAddress   string
+	PostgresTable     string
+	PostgresSchema    string
+	RedisAddress      string
+	RedisPassword     string
+	RedisDB           int
+	RedisPrefix       string
+	EmbeddedPath      string
+	Logger            *zap.Logger
+	RPCOptions        []grpc.ServerOption
+	RPCListener       net.Listener
+	DebugListener     net.Listener
+	ClusterListenAddr string
+	ClusterSeeds      []string
+	// ClusterSecret is shared by all nodes of the cluster, it is used to authenticate requests they send to each other.
+	// It is required if the cluster has more than one member.
+	ClusterSecret string
+	// ClusterDiscoveryHTTP if set, cluster members are periodically resolved using service catalog HTTP API.
+	ClusterDiscoveryHTTP string
+	// ClusterDiscoveryDNS if set, cluster members are periodically resolved using SRV records.
+	ClusterDiscoveryDNS      string
+	ClusterDiscoveryInterval time.Duration
+	// ClusterPartitioned if true, access tokens generated by Start carry a partition that routes them to the node that started them,
+	// regardless of how many nodes join the cluster. All nodes of the cluster need to agree on it.
+	ClusterPartitioned bool
+	// ReplicationFactor is a number of nodes that hold a copy of each session, owner included.
+	ReplicationFactor int
+	// ReplicationQuorum is a number of copies that have to be written for a write to succeed.
+	// If not set, majority of the replication factor is used.
+	ReplicationQuorum   int
 	TracingAgentAddress string
+	// GatewayListener if set, SessionManager is additionally exposed as HTTP/JSON API.
+	// It is served over TLS if rpc server is.
+	GatewayListener net.Listener
+	// PostgresTokenSecret if set, postgres storage keeps only keyed hashes of tokens.
+	// Storage returns token fingerprints instead, every node of the cluster has to use the same secrets.
+	PostgresTokenSecret string
+	// PostgresPreviousTokenSecrets are the secrets that PostgresTokenSecret replaced, see README.
+	PostgresPreviousTokenSecrets []string
+	// AccessTokenKeys if set, access tokens are signed using the first key and verified using any of them.
+	// Tokens that do not verify are rejected before the cache or the storage is queried.
+	// All nodes of the cluster have to share the same keys.
+	AccessTokenKeys []mnemosyne.AccessTokenKey
+	// AccessTokenUnsigned if true, tokens that are not signed at all are still accepted,
+	// e.g. until sessions started before the keys were set expire.
+	AccessTokenUnsigned bool
+	// SessionLimit if greater than zero, is a maximum number of active sessions a subject can have across the cluster.
+	SessionLimit int
+	// SessionLimitPolicy decides what happens to a start request that would exceed the limit.
+	// It is one of reject (default), evict_oldest or evict_lru.
+	SessionLimitPolicy string
+	// SessionLimitPerClient if true, sessions of a subject are counted separately for each subject client.
+	SessionLimitPerClient bool
+	// SessionLimitFailOpen if true, sessions held by nodes that cannot be reached are not counted.
+	// Otherwise, start requests of limited subjects fail with Unavailable until all nodes respond.
+	SessionLimitFailOpen bool
+	// SessionLimits override SessionLimit for given subject clients, sessions are counted per subject client then.
+	// Zero means no limit.
+	SessionLimits map[string]int
 }
 
 // TestDaemonOpts set of options that are used with TestDaemon instance.
+// If storage engine is not provided, in memory storage is used, unless postgres address is given.
 type TestDaemonOpts struct {
+	Storage                string
 	StoragePostgresAddress string
 }
 
 // Daemon represents single daemon instance that can be run.
 type Daemon struct {
-	opts          *DaemonOpts
-	done          chan struct{}
-	serverOptions []grpc.ServerOption
-	clientOptions []grpc.DialOption
-	postgres      *sql.DB
-	logger        *zap.Logger
-	server        *grpc.Server
-	storage       storage.Storage
-	rpcListener   net.Listener
-	debugListener net.Listener
-	tracerCloser  io.Closer
+	opts           *DaemonOpts
+	done           chan struct{}
+	shutdownOnce   sync.Once
+	background     sync.WaitGroup
+	serverOptions  []grpc.ServerOption
+	clientOptions  []grpc.DialOption
+	postgres       *sql.DB
+	redis          *goredis.Client
+	embedded       *bolt.DB
+	logger         *zap.Logger
+	server         *grpc.Server
+	health         *health.Server
+	storage        storage.Storage
+	rpcListener    net.Listener
+	debugListener  net.Listener
+	gateway        *gateway
+	gatewayServer  *http.Server
+	tracerCloser   io.Closer
+	broker         *broker
+	certificates   *certificate.Reloader
+	stopBackground context.CancelFunc
 }
 
 // NewDaemon allocates new daemon instance using given options.
@@ -96,6 +191,33 @@ func NewDaemon(opts *DaemonOpts) (*Daemon, error) {
 	if d.opts.SessionTTC == 0 {
 		d.opts.SessionTTC = storage.DefaultTTC
 	}
+	if d.opts.CacheTTL == 0 {
+		d.opts.CacheTTL = cache.DefaultTTL
+	}
+	if d.opts.CacheSize == 0 {
+		d.opts.CacheSize = cache.DefaultSize
+	}
+	if d.opts.ClusterDiscoveryInterval == 0 {
+		d.opts.ClusterDiscoveryInterval = DefaultDiscoveryInterval
+	}
+	if d.opts.ReplicationFactor < 0 {
+		return nil, fmt.Errorf("replication factor cannot be negative: %d", d.opts.ReplicationFactor)
+	}
+	if d.opts.ReplicationFactor == 0 {
+		d.opts.ReplicationFactor = 1
+	}
+	if d.opts.ReplicationQuorum == 0 {
+		d.opts.ReplicationQuorum = d.opts.ReplicationFactor/2 + 1
+	}
+	if d.opts.ReplicationQuorum > d.opts.ReplicationFactor {
+		return nil, fmt.Errorf("replication quorum (%d) cannot be greater than replication factor (%d)", d.opts.ReplicationQuorum, d.opts.ReplicationFactor)
+	}
+	if _, err := certificate.ParseClientAuth(d.opts.TLSClientAuth); err != nil {
+		return nil, err
+	}
+	if d.opts.DebugTLS && !d.opts.TLS {
+		return nil, errors.New("debug server tls requires tls to be enabled")
+	}
 	if d.opts.Storage == "" {
 		d.opts.Storage = storage.EnginePostgres
 	}
@@ -105,6 +227,12 @@ func NewDaemon(opts *DaemonOpts) (*Daemon, error) {
 	if d.opts.PostgresSchema == "" {
 		d.opts.PostgresSchema = "mnemosyne"
 	}
+	if d.opts.RedisPrefix == "" {
+		d.opts.RedisPrefix = "mnemosyne"
+	}
+	if d.opts.EmbeddedPath == "" {
+		d.opts.EmbeddedPath = "mnemosyne.db"
+	}
 
 	return d, nil
 }
@@ -116,8 +244,17 @@ func TestDaemon(t *testing.T, opts TestDaemonOpts) (net.Addr, io.Closer) {
 		t.Fatalf("mnemosyne daemon tcp listener setup error: %s", err.Error())
 	}
 
+	if opts.Storage == "" {
+		if opts.StoragePostgresAddress != "" {
+			opts.Storage = storage.EnginePostgres
+		} else {
+			opts.Storage = storage.EngineInMemory
+		}
+	}
+
 	d, err := NewDaemon(&DaemonOpts{
 		IsTest:            true,
+		Storage:           opts.Storage,
 		ClusterListenAddr: l.Addr().String(),
 		Logger:            zap.L(),
 		PostgresAddress:   opts.StoragePostgresAddress,
@@ -141,9 +278,13 @@ func (d *Daemon) Run() (err error) {
 		cl     *cluster.Cluster
 		tracer opentracing.Tracer
 	)
-	if cl, err = initCluster(d.logger, d.opts.ClusterListenAddr, d.opts.ClusterSeeds...); err != nil {
+	if cl, err = initCluster(d.logger, d.opts.ClusterListenAddr, d.opts.ClusterPartitioned, d.opts.ClusterSeeds...); err != nil {
 		return
 	}
+	auth, err := d.authenticator(cl)
+	if err != nil {
+		return err
+	}
 	if err = d.initStorage(d.logger, d.opts.PostgresTable, d.opts.PostgresSchema); err != nil {
 		return
 	}
@@ -165,7 +306,6 @@ func (d *Daemon) Run() (err error) {
 	}
 
 	d.clientOptions = []grpc.DialOption{
-		// User agent is required for example to determine if incoming request is internal.
 		grpc.WithUserAgent(fmt.Sprintf("%s:%s", constant.Subsystem, d.opts.Version)),
 		grpc.WithStatsHandler(interceptor),
 		grpc.WithDialer(interceptor.Dialer(func(addr string, timeout time.Duration) (net.Conn, error) {
@@ -173,52 +313,84 @@ func (d *Daemon) Run() (err error) {
 		})),
 		grpc.WithUnaryInterceptor(unaryClientInterceptors(
 			interceptor.UnaryClient(),
-			otgrpc.OpenTracingClientInterceptor(tracer)),
-		),
-		grpc.WithStreamInterceptor(interceptor.StreamClient()),
+			otgrpc.OpenTracingClientInterceptor(tracer),
+			// Signature is required to determine if incoming request is internal.
+			auth.UnaryClientInterceptor(),
+		)),
+		grpc.WithStreamInterceptor(streamClientInterceptors(
+			interceptor.StreamClient(),
+			auth.StreamClientInterceptor(),
+		)),
 	}
 	d.serverOptions = []grpc.ServerOption{
 		grpc.StatsHandler(interceptor),
 		grpc.UnaryInterceptor(unaryServerInterceptors(
+			auth.UnaryServerInterceptor(),
 			otgrpc.OpenTracingServerInterceptor(tracer),
 			errorInterceptor(d.logger),
 			interceptor.UnaryServer(),
 		)),
+		grpc.StreamInterceptor(auth.StreamServerInterceptor()),
 	}
 	if d.opts.TLS {
-		servCreds, err := credentials.NewServerTLSFromFile(d.opts.TLSCertFile, d.opts.TLSKeyFile)
+		clientAuth, err := certificate.ParseClientAuth(d.opts.TLSClientAuth)
 		if err != nil {
 			return err
 		}
-		d.serverOptions = append(d.serverOptions, grpc.Creds(servCreds))
-
-		clientCreds, err := credentials.NewClientTLSFromFile(d.opts.TLSCertFile, "")
-		if err != nil {
+		if d.certificates, err = certificate.NewReloader(certificate.Opts{
+			CertFile:     d.opts.TLSCertFile,
+			KeyFile:      d.opts.TLSKeyFile,
+			PeerCertFile: d.opts.TLSPeerCertFile,
+			PeerKeyFile:  d.opts.TLSPeerKeyFile,
+			CAFile:       d.opts.TLSCAFile,
+			ClientAuth:   clientAuth,
+			Logger:       d.logger.Named("certificate"),
+		}); err != nil {
 			return err
 		}
-		d.clientOptions = append(d.clientOptions, grpc.WithTransportCredentials(clientCreds))
+		d.serverOptions = append(d.serverOptions, grpc.Creds(credentials.NewTLS(d.certificates.ServerConfig("h2"))))
+		d.clientOptions = append(d.clientOptions, grpc.WithTransportCredentials(credentials.NewTLS(d.certificates.ClientConfig())))
 	} else {
 		d.clientOptions = append(d.clientOptions, grpc.WithInsecure())
 	}
 
 	d.server = grpc.NewServer(d.serverOptions...)
 
-	cache := cache.New(5*time.Second, constant.Subsystem)
+	cache := cache.New(cache.Opts{
+		TTL:       d.opts.CacheTTL,
+		Size:      d.opts.CacheSize,
+		Namespace: constant.Subsystem,
+	})
+	tokens, err := newAccessTokens(d.opts.AccessTokenKeys, d.opts.AccessTokenUnsigned)
+	if err != nil {
+		return err
+	}
 	mnemosyneServer, err := newSessionManager(sessionManagerOpts{
-		addr:    d.opts.ClusterListenAddr,
-		cluster: cl,
-		logger:  d.logger,
-		storage: d.storage,
-		ttc:     d.opts.SessionTTC,
-		cache:   cache,
-		tracer:  tracer,
+		addr:              d.opts.ClusterListenAddr,
+		cluster:           cl,
+		logger:            d.logger,
+		storage:           d.storage,
+		ttc:               d.opts.SessionTTC,
+		cache:             cache,
+		tracer:            tracer,
+		replicationFactor: d.opts.ReplicationFactor,
+		replicationQuorum: d.opts.ReplicationQuorum,
+		tokens:            tokens,
+		limiter: sessionLimiterOpts{
+			limit:     d.opts.SessionLimit,
+			policy:    d.opts.SessionLimitPolicy,
+			perClient: d.opts.SessionLimitPerClient,
+			clients:   d.opts.SessionLimits,
+			failOpen:  d.opts.SessionLimitFailOpen,
+		},
 	})
 	if err != nil {
 		return err
 	}
 
 	mnemosynerpc.RegisterSessionManagerServer(d.server, mnemosyneServer)
-	grpc_health_v1.RegisterHealthServer(d.server, health.NewServer())
+	d.health = health.NewServer()
+	grpc_health_v1.RegisterHealthServer(d.server, d.health)
 
 	if !d.opts.IsTest {
 		prometheus.DefaultRegisterer.Register(d.storage.(storage.InstrumentedStorage))
@@ -250,7 +422,17 @@ func (d *Daemon) Run() (err error) {
 		}
 	}()
 
+	if d.opts.GatewayListener != nil {
+		if err = d.runGateway(ctx); err != nil {
+			return err
+		}
+	}
+
 	if d.debugListener != nil {
+		if d.opts.DebugTLS {
+			// Probes and metric scrapers do not present client certificates.
+			d.debugListener = tls.NewListener(d.debugListener, d.certificates.ServerConfigWithoutClientAuth())
+		}
 		go func() {
 			d.logger.Info("debug server is running", zap.String("address", d.debugListener.Addr().String()))
 
@@ -273,6 +455,7 @@ func (d *Daemon) Run() (err error) {
 				},
 				logger:   d.logger,
 				postgres: d.postgres,
+				redis:    d.redis,
 				cluster:  cl,
 			})
 			if err := http.Serve(d.debugListener, mux); err != nil {
@@ -281,20 +464,131 @@ func (d *Daemon) Run() (err error) {
 		}()
 	}
 
-	go mnemosyneServer.cleanup(d.done)
+	d.background.Add(1)
+	go func() {
+		defer d.background.Done()
+
+		mnemosyneServer.cleanup(d.done)
+	}()
+
+	var bgCtx context.Context
+	bgCtx, d.stopBackground = context.WithCancel(context.Background())
+	d.broker = mnemosyneServer.broker
+	mnemosyneServer.relay(bgCtx)
+	go cache.Sweep(bgCtx)
+	if d.certificates != nil {
+		go d.certificates.Watch(bgCtx, certificate.DefaultReloadInterval)
+	}
+	if pq, ok := d.storage.(*storagepq.Storage); ok {
+		d.background.Add(1)
+		go func() {
+			defer d.background.Done()
+
+			convertBags(bgCtx, pq, d.logger.Named("convert_bags"))
+		}()
+	}
+
+	if discoverer := d.discoverer(); discoverer != nil {
+		m := newMembership(cl, discoverer, d.opts.ClusterDiscoveryInterval, d.logger.Named("membership"))
+		m.onChange = func(joined, left []*cluster.Node) {
+			mnemosyneServer.rebalance(bgCtx, joined)
+			for _, n := range left {
+				mnemosyneServer.leave(n)
+			}
+			for _, n := range joined {
+				if n.Addr != cl.Listen() {
+					mnemosyneServer.join(n)
+				}
+			}
+		}
+		if !d.opts.IsTest {
+			prometheus.DefaultRegisterer.Register(m)
+		}
+		go m.run(bgCtx)
+	}
 
 	return
 }
 
+// Reload loads TLS certificates from disk again, it is a no-op if TLS is disabled.
+// Certificates are also reloaded automatically, once any of the files changes.
+func (d *Daemon) Reload() error {
+	if d.certificates == nil {
+		return nil
+	}
+	return d.certificates.Reload()
+}
+
 // Close implements io.Closer interface.
-func (d *Daemon) Close() (err error) {
-	d.done <- struct{}{}
-	d.server.GracefulStop()
+// It waits for all in-flight requests to finish, see Shutdown for a version with a deadline.
+func (d *Daemon) Close() error {
+	return d.Shutdown(context.Background())
+}
+
+// Shutdown stops the daemon gracefully.
+// Health service reports NOT_SERVING first, so load balancers can stop sending new requests.
+// In-flight requests are drained until given context is done, remaining connections are closed afterwards.
+// Calling it more than once is a no-op.
+func (d *Daemon) Shutdown(ctx context.Context) (err error) {
+	d.shutdownOnce.Do(func() {
+		err = d.shutdown(ctx)
+	})
+	return
+}
+
+func (d *Daemon) shutdown(ctx context.Context) (err error) {
+	if d.health != nil {
+		d.health.Shutdown()
+	}
+	close(d.done)
+	if d.stopBackground != nil {
+		d.stopBackground()
+	}
+	if d.broker != nil {
+		// Watch streams would block graceful stop forever.
+		d.broker.close()
+	}
+	if d.gatewayServer != nil {
+		// Gateway is a client of the rpc server, it has to drain first.
+		if err := d.gatewayServer.Shutdown(ctx); err != nil {
+			d.logger.Warn("gateway graceful shutdown failure, remaining connections are closed", zap.Error(err))
+			d.gatewayServer.Close()
+		}
+		d.gateway.Close()
+	}
+	if d.server != nil {
+		stopped := make(chan struct{})
+		go func() {
+			d.server.GracefulStop()
+			close(stopped)
+		}()
+
+		select {
+		case <-stopped:
+		case <-ctx.Done():
+			d.logger.Warn("graceful stop deadline exceeded, remaining connections are closed", zap.Error(ctx.Err()))
+			d.server.Stop()
+			<-stopped
+		}
+	}
+	// Cleanup cannot run against closed storage.
+	d.background.Wait()
+
 	if d.postgres != nil {
 		if err = d.postgres.Close(); err != nil {
 			return
 		}
 	}
+	if d.redis != nil {
+		if err = d.redis.Close(); err != nil {
+			return
+		}
+	}
+	if d.embedded != nil {
+		if err = d.embedded.Close(); err != nil {
+			return
+		}
+	}
 	if d.debugListener != nil {
 		if err = d.debugListener.Close(); err != nil {
 			return
@@ -308,15 +602,97 @@ func (d *Daemon) Close() (err error) {
 	return nil
 }
 
+// runGateway starts HTTP/JSON gateway that forwards requests to the rpc server.
+// It does not use cluster client options, requests coming from the gateway cannot be recognized as internal.
+func (d *Daemon) runGateway(ctx context.Context) error {
+	opts := []grpc.DialOption{
+		grpc.WithUserAgent(fmt.Sprintf("%s-gateway:%s", constant.Subsystem, d.opts.Version)),
+	}
+	listener := d.opts.GatewayListener
+	if d.opts.TLS {
+		// Connection is made to the very same process over a loopback address,
+		// so the server is expected to present a certificate valid for the name its own one holds.
+		config := d.certificates.ClientConfig()
+		serverName, err := d.certificates.ServerName()
+		if err != nil {
+			return err
+		}
+		config.ServerName = serverName
+		opts = append(opts, grpc.WithTransportCredentials(credentials.NewTLS(config)))
+		listener = tls.NewListener(listener, d.certificates.ServerConfig())
+	} else {
+		opts = append(opts, grpc.WithInsecure())
+	}
+
+	gw, err := newGateway(ctx, loopback(d.rpcListener.Addr()), opts...)
+	if err != nil {
+		return err
+	}
+	d.gateway = gw
+	d.gatewayServer = &http.Server{Handler: gw}
+
+	go func() {
+		d.logger.Info("gateway is running", zap.String("address", listener.Addr().String()))
+
+		if err := d.gatewayServer.Serve(listener); err != nil && err != http.ErrServerClosed {
+			d.logger.Error("gateway failure", zap.Error(err))
+		}
+	}()
+	return nil
+}
+
 // Addr returns net.Addr that rpc service is listening on.
 func (d *Daemon) Addr() net.Addr {
 	return d.rpcListener.Addr()
 }
 
+// authenticator returns authenticator of requests sent between nodes of the cluster.
+// Standalone node does not need a secret, random one is generated.
+func (d *Daemon) authenticator(cl *cluster.Cluster) (*cluster.Authenticator, error) {
+	secret := []byte(d.opts.ClusterSecret)
+	if len(secret) == 0 {
+		if len(cl.ExternalNodes()) > 0 || d.discoverer() != nil {
+			return nil, errors.New("cluster secret is required if cluster has more than one member")
+		}
+		secret = make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			return nil, err
+		}
+	}
+	return cluster.NewAuthenticator(d.opts.ClusterListenAddr, secret)
+}
+
+// discoverer returns source of cluster members, or nil if membership is static.
+func (d *Daemon) discoverer() discovery.Discoverer {
+	switch {
+	case d.opts.ClusterDiscoveryHTTP != "":
+		return &discovery.HTTP{Endpoint: d.opts.ClusterDiscoveryHTTP}
+	case d.opts.ClusterDiscoveryDNS != "":
+		return &discovery.DNS{Name: d.opts.ClusterDiscoveryDNS}
+	}
+	return nil
+}
+
+func secrets(in []string) [][]byte {
+	out := make([][]byte, 0, len(in))
+	for _, s := range in {
+		out = append(out, []byte(s))
+	}
+	return out
+}
+
 func (d *Daemon) initStorage(l *zap.Logger, table, schema string) (err error) {
 	switch d.opts.Storage {
 	case storage.EngineInMemory:
-		return errors.New("in memory storage is not implemented yet")
+		if d.storage, err = storage.Init(storagemem.NewStorage(storagemem.StorageOpts{
+			Namespace: constant.Subsystem,
+			TTL:       d.opts.SessionTTL,
+		}), d.opts.IsTest); err != nil {
+			return
+		}
+
+		l.Info("in memory storage initialized")
+		return
 	case storage.EnginePostgres:
 		d.postgres, err = postgres.Init(
 			d.opts.PostgresAddress,
@@ -328,11 +704,13 @@ func (d *Daemon) initStorage(l *zap.Logger, table, schema string) (err error) {
 			return
 		}
 		if d.storage, err = storage.Init(storagepq.NewStorage(storagepq.StorageOpts{
-			Namespace: constant.Subsystem,
-			Schema:    schema,
-			Table:     table,
-			Conn:      d.postgres,
-			TTL:       d.opts.SessionTTL,
+			Namespace:            constant.Subsystem,
+			Schema:               schema,
+			Table:                table,
+			Conn:                 d.postgres,
+			TTL:                  d.opts.SessionTTL,
+			TokenSecret:          []byte(d.opts.PostgresTokenSecret),
+			PreviousTokenSecrets: secrets(d.opts.PostgresPreviousTokenSecrets),
 		}), d.opts.IsTest); err != nil {
 			return
 		}
@@ -340,7 +718,45 @@ func (d *Daemon) initStorage(l *zap.Logger, table, schema string) (err error) {
 		l.Info("postgres storage initialized", zap.String("schema", schema), zap.String("table", table))
 		return
 	case storage.EngineRedis:
-		return errors.New("redis storage is not implemented yet")
+		d.redis, err = redis.Init(
+			d.opts.RedisAddress,
+			redis.Opts{
+				Logger:   d.logger,
+				Password: d.opts.RedisPassword,
+				DB:       d.opts.RedisDB,
+			},
+		)
+		if err != nil {
+			return
+		}
+		if d.storage, err = storage.Init(storageredis.NewStorage(storageredis.StorageOpts{
+			Namespace: constant.Subsystem,
+			Prefix:    d.opts.RedisPrefix,
+			Client:    d.redis,
+			TTL:       d.opts.SessionTTL,
+		}), d.opts.IsTest); err != nil {
+			return
+		}
+
+		l.Info("redis storage initialized", zap.String("prefix", d.opts.RedisPrefix), zap.Int("db", d.opts.RedisDB))
+		return
+	case storage.EngineEmbedded:
+		d.embedded, err = bolt.Open(d.opts.EmbeddedPath, 0600, &bolt.Options{
+			Timeout: 5 * time.Second,
+		})
+		if err != nil {
+			return
+		}
+		if d.storage, err = storage.Init(storageembedded.NewStorage(storageembedded.StorageOpts{
+			Namespace: constant.Subsystem,
+			DB:        d.embedded,
+			TTL:       d.opts.SessionTTL,
+		}), d.opts.IsTest); err != nil {
+			return
+		}
+
+		l.Info("embedded storage initialized", zap.String("path", d.opts.EmbeddedPath))
+		return
 	default:
 		return errors.New("unknown storage engine")
 	}
@@ -357,3 +773,32 @@ func (d *Daemon) setPostgresConnectionParameters() error {
 	d.opts.PostgresAddress = u.String()
 	return nil
 }
+
+// convertBags converts session bags, stored by previous versions in the gob format, to JSON.
+// It returns once there is nothing left to convert or given context is done.
+func convertBags(ctx context.Context, s *storagepq.Storage, logger *zap.Logger) {
+	var total int
+	for {
+		n, err := s.ConvertBags(ctx, convertBagsBatchSize)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Error("bags conversion failure", zap.Error(err))
+
+			select {
+			case <-time.After(convertBagsRetryInterval):
+				continue
+			case <-ctx.Done():
+				return
+			}
+		}
+		if n == 0 {
+			if total > 0 {
+				logger.Info("bags conversion finished", zap.Int("count", total))
+			}
+			return
+		}
+		total += n
+	}
+}
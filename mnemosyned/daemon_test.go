@@ -6,11 +6,14 @@ import (
 	"testing"
 	"time"
 
+	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 	"go.uber.org/zap"
 	"golang.org/x/net/context"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/status"
 )
 
@@ -108,6 +111,40 @@ func TestTestDaemon(t *testing.T) {
 	}
 }
 
+func TestTestDaemon_inMemory(t *testing.T) {
+	addr, closer := TestDaemon(t, TestDaemonOpts{
+		Storage: storage.EngineInMemory,
+	})
+	defer closer.Close()
+
+	conn, err := grpc.DialContext(context.TODO(), addr.String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	m := mnemosynerpc.NewSessionManagerClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	res, err := m.Start(ctx, &mnemosynerpc.StartRequest{
+		Session: &mnemosynerpc.Session{
+			SubjectId: "1",
+		},
+	})
+	if err != nil {
+		t.Fatalf("session could not be started: %s", err.Error())
+	}
+	got, err := m.Get(ctx, &mnemosynerpc.GetRequest{AccessToken: res.Session.AccessToken})
+	if err != nil {
+		t.Fatalf("session could not be retrieved: %s", err.Error())
+	}
+	if got.Session.SubjectId != "1" {
+		t.Errorf("wrong subject id, expected %s but got %s", "1", got.Session.SubjectId)
+	}
+}
+
 func TestDaemon_Cluster(t *testing.T) {
 	cfg := zap.NewDevelopmentConfig()
 	cfg.Level.SetLevel(zap.WarnLevel)
@@ -123,6 +160,7 @@ func TestDaemon_Cluster(t *testing.T) {
 		Logger:            l,
 		PostgresAddress:   testPostgresAddress,
 		ClusterListenAddr: l1.Addr().String(),
+		ClusterSecret:     testClusterSecret,
 		ClusterSeeds: []string{
 			l1.Addr().String(),
 			l2.Addr().String(),
@@ -143,6 +181,7 @@ func TestDaemon_Cluster(t *testing.T) {
 		Logger:            l,
 		PostgresAddress:   testPostgresAddress,
 		ClusterListenAddr: l2.Addr().String(),
+		ClusterSecret:     testClusterSecret,
 		ClusterSeeds: []string{
 			l1.Addr().String(),
 			l2.Addr().String(),
@@ -163,6 +202,7 @@ func TestDaemon_Cluster(t *testing.T) {
 		Logger:            l,
 		PostgresAddress:   testPostgresAddress,
 		ClusterListenAddr: l3.Addr().String(),
+		ClusterSecret:     testClusterSecret,
 		ClusterSeeds: []string{
 			l1.Addr().String(),
 			l2.Addr().String(),
@@ -311,6 +351,426 @@ func TestDaemon_Cluster(t *testing.T) {
 	})
 }
 
+func TestDaemon_Shutdown(t *testing.T) {
+	d, err := NewDaemon(&DaemonOpts{
+		IsTest:      true,
+		Storage:     storage.EngineInMemory,
+		RPCListener: listener(t),
+		Logger:      zap.L(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	conn, err := grpc.DialContext(context.TODO(), d.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defer conn.Close()
+
+	// Open stream keeps graceful stop from finishing, until the deadline is exceeded.
+	watch, err := grpc_health_v1.NewHealthClient(conn).Watch(context.Background(), &grpc_health_v1.HealthCheckRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	res, err := watch.Recv()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if res.Status != grpc_health_v1.HealthCheckResponse_SERVING {
+		t.Fatalf("wrong status, expected %s but got %s", grpc_health_v1.HealthCheckResponse_SERVING, res.Status)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- d.Shutdown(ctx)
+	}()
+
+	res, err = watch.Recv()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if res.Status != grpc_health_v1.HealthCheckResponse_NOT_SERVING {
+		t.Errorf("wrong status, expected %s but got %s", grpc_health_v1.HealthCheckResponse_NOT_SERVING, res.Status)
+	}
+
+	select {
+	case err := <-shutdown:
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("shutdown should not take longer than the deadline")
+	}
+
+	done := make(chan error, 1)
+	go func() {
+		done <- d.Close()
+	}()
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Errorf("unexpected error: %s", err.Error())
+		}
+	case <-time.After(time.Second):
+		t.Error("second close should not block")
+	}
+}
+
+func TestDaemon_AccessTokenKeys(t *testing.T) {
+	key := mnemosyne.AccessTokenKey{ID: "current", Secret: []byte("secret")}
+	d, err := NewDaemon(&DaemonOpts{
+		IsTest:          true,
+		Storage:         storage.EngineInMemory,
+		RPCListener:     listener(t),
+		Logger:          zap.L(),
+		AccessTokenKeys: []mnemosyne.AccessTokenKey{key, {ID: "previous", Secret: []byte("previous-secret")}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	conn, err := grpc.DialContext(context.TODO(), d.Addr().String(), grpc.WithInsecure())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	defer conn.Close()
+	m := mnemosynerpc.NewSessionManagerClient(conn)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	res, err := m.Start(ctx, &mnemosynerpc.StartRequest{Session: &mnemosynerpc.Session{SubjectId: "1"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if at, err := mnemosyne.ParseSignedAccessToken(res.Session.AccessToken, key); err != nil || at.KeyID != key.ID {
+		t.Fatalf("access token should be signed using the first key, got %v and %v", at, err)
+	}
+	if _, err := m.Get(ctx, &mnemosynerpc.GetRequest{AccessToken: res.Session.AccessToken}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	unsigned, err := mnemosyne.RandomAccessToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	forged, err := mnemosyne.RandomSignedAccessToken(mnemosyne.AccessTokenKey{ID: key.ID, Secret: []byte("forged")})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	for _, token := range []string{unsigned, forged} {
+		if _, err := m.Get(ctx, &mnemosynerpc.GetRequest{AccessToken: token}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("get: wrong error, expected %s but got %v", codes.Unauthenticated, err)
+		}
+		if _, err := m.Exists(ctx, &mnemosynerpc.ExistsRequest{AccessToken: token}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("exists: wrong error, expected %s but got %v", codes.Unauthenticated, err)
+		}
+		if _, err := m.Start(ctx, &mnemosynerpc.StartRequest{Session: &mnemosynerpc.Session{AccessToken: token, SubjectId: "1"}}); status.Code(err) != codes.Unauthenticated {
+			t.Errorf("start: wrong error, expected %s but got %v", codes.Unauthenticated, err)
+		}
+	}
+}
+
+func TestDaemon_ClusterPartitioned(t *testing.T) {
+	rl := listener(t)
+	d, err := NewDaemon(&DaemonOpts{
+		IsTest:             true,
+		Storage:            storage.EngineInMemory,
+		RPCListener:        rl,
+		Logger:             zap.L(),
+		ClusterListenAddr:  rl.Addr().String(),
+		ClusterPartitioned: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = d.Run(); err != nil {
+		t.Fatal(err)
+	}
+	defer d.Close()
+
+	conn, m := connect(t, rl)
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	res, err := m.Start(ctx, &mnemosynerpc.StartRequest{Session: &mnemosynerpc.Session{SubjectId: "1", RefreshToken: "refresh"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if p, ok := mnemosyne.AccessTokenPartition(res.Session.AccessToken); !ok || p != mnemosyne.HomePartition(rl.Addr().String()) {
+		t.Fatalf("access token should carry home partition of the node, got %d (%t)", p, ok)
+	}
+	refreshed, err := m.Refresh(ctx, &mnemosynerpc.RefreshRequest{RefreshToken: res.Session.RefreshToken})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, ok := mnemosyne.AccessTokenPartition(refreshed.Session.AccessToken); !ok {
+		t.Error("refreshed access token should carry partition as well")
+	}
+}
+
+func TestDaemon_Watch_relay(t *testing.T) {
+	l1, l2 := listener(t), listener(t)
+	seeds := []string{l1.Addr().String(), l2.Addr().String()}
+
+	var daemons []*Daemon
+	for _, l := range []net.Listener{l1, l2} {
+		d, err := NewDaemon(&DaemonOpts{
+			IsTest:            true,
+			Storage:           storage.EngineInMemory,
+			RPCListener:       l,
+			Logger:            zap.L(),
+			ClusterListenAddr: l.Addr().String(),
+			ClusterSecret:     testClusterSecret,
+			ClusterSeeds:      seeds,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if err := d.Run(); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		defer d.Close()
+		daemons = append(daemons, d)
+	}
+
+	// Nodes should not watch each other unless somebody watches them.
+	time.Sleep(2 * relayRetryInterval)
+	for _, d := range daemons {
+		if d.broker.watched() {
+			t.Fatalf("%s should not be watched", d.Addr())
+		}
+	}
+
+	conn, m := connect(t, l1)
+	defer conn.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	stream, err := m.Watch(ctx, &mnemosynerpc.WatchRequest{})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, err := stream.Header(); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if !daemons[1].broker.watched() {
+		t.Fatal("events of other nodes should be relayed once the subscription is established")
+	}
+
+	cancel()
+	deadline := time.Now().Add(2 * time.Second)
+	for daemons[1].broker.watched() {
+		if time.Now().After(deadline) {
+			t.Fatal("relay should stop once the last client stops watching")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestDaemon_List_replication(t *testing.T) {
+	listeners := []net.Listener{listener(t), listener(t), listener(t)}
+	seeds := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		seeds = append(seeds, l.Addr().String())
+	}
+
+	for _, l := range listeners {
+		d, err := NewDaemon(&DaemonOpts{
+			IsTest:            true,
+			Storage:           storage.EngineInMemory,
+			RPCListener:       l,
+			Logger:            zap.L(),
+			ClusterListenAddr: l.Addr().String(),
+			ClusterSecret:     testClusterSecret,
+			ClusterSeeds:      seeds,
+			ReplicationFactor: 2,
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if err := d.Run(); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		defer d.Close()
+	}
+
+	conn, m := connect(t, listeners[0])
+	defer conn.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	nb := 20
+	for i := 0; i < nb; i++ {
+		if _, err := m.Start(ctx, &mnemosynerpc.StartRequest{Session: &mnemosynerpc.Session{SubjectId: "1"}}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+
+	res, err := m.List(ctx, &mnemosynerpc.ListRequest{Limit: int64(nb), IncludeTotalCount: true})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if len(res.Sessions) != nb {
+		t.Errorf("wrong number of sessions, expected %d but got %d", nb, len(res.Sessions))
+	}
+	if got := res.GetTotalCount().GetValue(); got != int64(nb) {
+		t.Errorf("copies held by replicas should not be counted, expected total count %d but got %d", nb, got)
+	}
+}
+
+func TestDaemon_SessionLimit(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	start := func(t *testing.T, m mnemosynerpc.SessionManagerClient, subjectClient string) (string, error) {
+		res, err := m.Start(ctx, &mnemosynerpc.StartRequest{Session: &mnemosynerpc.Session{SubjectId: "1", SubjectClient: subjectClient}})
+		if err != nil {
+			return "", err
+		}
+		// Ordering of the sessions needs to be deterministic.
+		time.Sleep(10 * time.Millisecond)
+		return res.Session.AccessToken, nil
+	}
+	exists := func(t *testing.T, m mnemosynerpc.SessionManagerClient, at string) bool {
+		res, err := m.Exists(ctx, &mnemosynerpc.ExistsRequest{AccessToken: at})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		return res.Value
+	}
+
+	t.Run("reject", func(t *testing.T) {
+		m, closer := limitedCluster(t, 2, SessionLimitPolicyReject)
+		defer closer()
+
+		for _, c := range m[:2] {
+			if _, err := start(t, c, "web"); err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+		}
+		// Sessions are held by different nodes, the limit applies to all of them.
+		for _, c := range m {
+			if _, err := start(t, c, "web"); status.Code(err) != codes.ResourceExhausted {
+				t.Errorf("wrong error, expected %s but got %v", codes.ResourceExhausted, err)
+			}
+		}
+		if _, err := start(t, m[2], "unlimited"); err != nil {
+			t.Fatalf("session of a client without limit should be started: %s", err.Error())
+		}
+		if _, err := start(t, m[2], "mobile"); err != nil {
+			t.Fatalf("sessions of a client with its own limit should be counted separately: %s", err.Error())
+		}
+		if _, err := start(t, m[0], "mobile"); status.Code(err) != codes.ResourceExhausted {
+			t.Errorf("wrong error, expected %s but got %v", codes.ResourceExhausted, err)
+		}
+	})
+	t.Run("evict_oldest", func(t *testing.T) {
+		m, closer := limitedCluster(t, 2, SessionLimitPolicyEvictOldest)
+		defer closer()
+
+		var tokens []string
+		for _, c := range m {
+			at, err := start(t, c, "web")
+			if err != nil {
+				t.Fatalf("unexpected error: %s", err.Error())
+			}
+			tokens = append(tokens, at)
+		}
+		for i, at := range tokens {
+			if got := exists(t, m[0], at); got != (i > 0) {
+				t.Errorf("session %d: wrong existence, got %t", i, got)
+			}
+		}
+	})
+	t.Run("evict_lru", func(t *testing.T) {
+		m, closer := limitedCluster(t, 2, SessionLimitPolicyEvictLRU)
+		defer closer()
+
+		first, err := start(t, m[0], "web")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		second, err := start(t, m[1], "web")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if _, err := m[2].Get(ctx, &mnemosynerpc.GetRequest{AccessToken: first}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		time.Sleep(10 * time.Millisecond)
+		third, err := start(t, m[2], "web")
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+
+		if !exists(t, m[0], first) || !exists(t, m[0], third) {
+			t.Error("recently used sessions should be kept")
+		}
+		if exists(t, m[0], second) {
+			t.Error("least recently used session should be evicted")
+		}
+	})
+}
+
+// limitedCluster runs three in memory nodes that limit sessions of each subject to given number.
+// Sessions of "unlimited" client are not limited, those of "mobile" one are limited to a single session.
+func limitedCluster(t *testing.T, limit int, policy string) ([]mnemosynerpc.SessionManagerClient, func()) {
+	t.Helper()
+
+	listeners := []net.Listener{listener(t), listener(t), listener(t)}
+	seeds := make([]string, 0, len(listeners))
+	for _, l := range listeners {
+		seeds = append(seeds, l.Addr().String())
+	}
+
+	var (
+		closers []func() error
+		clients []mnemosynerpc.SessionManagerClient
+	)
+	for _, l := range listeners {
+		d, err := NewDaemon(&DaemonOpts{
+			IsTest:             true,
+			Storage:            storage.EngineInMemory,
+			RPCListener:        l,
+			Logger:             zap.L(),
+			ClusterListenAddr:  l.Addr().String(),
+			ClusterSecret:      testClusterSecret,
+			ClusterSeeds:       seeds,
+			SessionLimit:       limit,
+			SessionLimitPolicy: policy,
+			SessionLimits:      map[string]int{"unlimited": 0, "mobile": 1},
+		})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if err := d.Run(); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		conn, m := connect(t, l)
+		closers = append(closers, conn.Close, d.Close)
+		clients = append(clients, m)
+	}
+
+	return clients, func() {
+		for _, c := range closers {
+			c()
+		}
+	}
+}
+
 func listener(t testing.TB) net.Listener {
 	t.Helper()
 
@@ -0,0 +1,62 @@
+package mnemosyned
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/grpc-ecosystem/grpc-gateway/runtime"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"google.golang.org/grpc"
+)
+
+// gateway translates HTTP/JSON requests into calls to the rpc server of the same daemon.
+// Because it connects over the network, requests go through exactly the same interceptors as any other gRPC call.
+type gateway struct {
+	conn    *grpc.ClientConn
+	handler http.Handler
+}
+
+func newGateway(ctx context.Context, endpoint string, opts ...grpc.DialOption) (*gateway, error) {
+	conn, err := grpc.DialContext(ctx, endpoint, opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	mux := runtime.NewServeMux(
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{OrigName: true, EmitDefaults: true}),
+	)
+	if err := mnemosynerpc.RegisterSessionManagerHandler(ctx, mux, conn); err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	return &gateway{
+		conn:    conn,
+		handler: mux,
+	}, nil
+}
+
+// ServeHTTP implements http Handler interface.
+func (g *gateway) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
+	g.handler.ServeHTTP(rw, r)
+}
+
+// Close implements io.Closer interface.
+func (g *gateway) Close() error {
+	return g.conn.Close()
+}
+
+// loopback returns address under which the listener is reachable from the same host.
+// Wildcard addresses, like 0.0.0.0, are replaced by the loopback interface.
+func loopback(addr net.Addr) string {
+	tcp, ok := addr.(*net.TCPAddr)
+	if !ok || !tcp.IP.IsUnspecified() {
+		return addr.String()
+	}
+	if tcp.IP.To4() != nil {
+		return net.JoinHostPort("127.0.0.1", strconv.Itoa(tcp.Port))
+	}
+	return net.JoinHostPort("::1", strconv.Itoa(tcp.Port))
+}
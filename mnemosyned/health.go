@@ -11,6 +11,7 @@ import (
 
 	"sync"
 
+	goredis "github.com/go-redis/redis"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
 	"go.uber.org/zap"
 	"google.golang.org/grpc/health/grpc_health_v1"
@@ -43,6 +44,7 @@ type readinessResponse struct {
 
 	Probes struct {
 		Postgres probeStatus            `json:"postgres"`
+		Redis    *probeStatus           `json:"redis,omitempty"`
 		Cluster  map[string]probeStatus `json:"cluster"`
 	} `json:"probes"`
 }
@@ -52,6 +54,7 @@ type readinessHandler struct {
 
 	logger   *zap.Logger
 	postgres *sql.DB
+	redis    *goredis.Client
 	cluster  *cluster.Cluster
 }
 
@@ -78,6 +81,19 @@ func (rh *readinessHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 		}
 	}()
 
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		if rh.redis != nil {
+			var ps probeStatus
+			if err := rh.redis.WithContext(ctx).Ping().Err(); err != nil {
+				ps = probeStatus(err.Error())
+			}
+			status.Probes.Redis = &ps
+		}
+	}()
+
 	for _, n := range rh.cluster.ExternalNodes() {
 		wg.Add(1)
 
@@ -99,7 +115,7 @@ func (rh *readinessHandler) ServeHTTP(rw http.ResponseWriter, r *http.Request) {
 
 	wg.Wait()
 
-	if err := json.NewEncoder(rw).Encode(status); err != nil {
+	if err := json.NewEncoder(rw).Encode(&status); err != nil {
 		http.Error(rw, fmt.Sprintf("readiness check response encode failure: %s", err.Error()), http.StatusInternalServerError)
 		return
 	}
@@ -0,0 +1,139 @@
+package mnemosyned
+
+import (
+	"time"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/constant"
+	"github.com/piotrkowalczuk/mnemosyne/internal/discovery"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+// DefaultDiscoveryInterval is how often cluster membership is resolved if not specified otherwise.
+const DefaultDiscoveryInterval = 30 * time.Second
+
+// membership keeps cluster members in sync with a service discovery.
+type membership struct {
+	cluster    *cluster.Cluster
+	discoverer discovery.Discoverer
+	interval   time.Duration
+	logger     *zap.Logger
+	// onChange is called after the ring is rebuilt, with nodes that joined and left the cluster.
+	onChange func(joined, left []*cluster.Node)
+	// monitoring
+	members             prometheus.Gauge
+	changesTotal        *prometheus.CounterVec
+	discoveryErrorTotal prometheus.Counter
+}
+
+func newMembership(csr *cluster.Cluster, discoverer discovery.Discoverer, interval time.Duration, logger *zap.Logger) *membership {
+	m := &membership{
+		cluster:    csr,
+		discoverer: discoverer,
+		interval:   interval,
+		logger:     logger,
+		onChange:   func(_, _ []*cluster.Node) {},
+		members: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "cluster",
+				Name:      "members",
+				Help:      "Number of cluster members, including current node.",
+			},
+		),
+		changesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "cluster",
+				Name:      "membership_changes_total",
+				Help:      "Total number of nodes that joined or left the cluster.",
+			},
+			[]string{"change"},
+		),
+		discoveryErrorTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "cluster",
+				Name:      "discovery_errors_total",
+				Help:      "Total number of failed cluster membership resolutions.",
+			},
+		),
+	}
+	m.members.Set(float64(csr.Len()))
+	return m
+}
+
+// run resolves membership immediately and then periodically, until given context is canceled.
+func (m *membership) run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.resolve(ctx)
+
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func (m *membership) resolve(ctx context.Context) {
+	addrs, err := m.discoverer.Discover(ctx)
+	if err != nil {
+		m.discoveryErrorTotal.Inc()
+		m.logger.Warn("cluster membership discovery failure", zap.Error(err))
+		return
+	}
+	if len(addrs) == 0 {
+		// Most likely catalog is not populated yet, it is safer to keep the current members.
+		m.logger.Warn("cluster membership discovery returned no members, current members are kept")
+		return
+	}
+
+	joined, left, err := m.cluster.Update(ctx, addrs)
+	if err != nil {
+		m.discoveryErrorTotal.Inc()
+		m.logger.Error("cluster membership update failure", zap.Strings("members", addrs), zap.Error(err))
+		return
+	}
+	if len(joined) == 0 && len(left) == 0 {
+		return
+	}
+
+	m.members.Set(float64(m.cluster.Len()))
+	m.changesTotal.WithLabelValues("joined").Add(float64(len(joined)))
+	m.changesTotal.WithLabelValues("left").Add(float64(len(left)))
+	m.logger.Info("cluster topology changed",
+		zap.Strings("joined", addresses(joined)),
+		zap.Strings("left", addresses(left)),
+		zap.Int("members", m.cluster.Len()),
+	)
+
+	m.onChange(joined, left)
+}
+
+func addresses(nodes []*cluster.Node) []string {
+	res := make([]string, 0, len(nodes))
+	for _, n := range nodes {
+		res = append(res, n.Addr)
+	}
+	return res
+}
+
+// Collect implements prometheus Collector interface.
+func (m *membership) Collect(in chan<- prometheus.Metric) {
+	m.members.Collect(in)
+	m.changesTotal.Collect(in)
+	m.discoveryErrorTotal.Collect(in)
+}
+
+// Describe implements prometheus Collector interface.
+func (m *membership) Describe(in chan<- *prometheus.Desc) {
+	m.members.Describe(in)
+	m.changesTotal.Describe(in)
+	m.discoveryErrorTotal.Describe(in)
+}
@@ -0,0 +1,97 @@
+package mnemosyned
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/discovery"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+)
+
+type discovererFunc func(context.Context) ([]string, error)
+
+func (fn discovererFunc) Discover(ctx context.Context) ([]string, error) {
+	return fn(ctx)
+}
+
+func TestMembership_resolve(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		members = []string{"127.0.0.1:9001", "127.0.0.1:9002"}
+	)
+	catalog := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		fmt.Fprint(rw, "[")
+		for i, m := range members {
+			if i > 0 {
+				fmt.Fprint(rw, ",")
+			}
+			fmt.Fprintf(rw, `{"ServiceAddress": "127.0.0.1", "ServicePort": %s}`, m[len("127.0.0.1:"):])
+		}
+		fmt.Fprint(rw, "]")
+	}))
+	defer catalog.Close()
+
+	csr, err := cluster.New(cluster.Opts{Listen: "127.0.0.1:9001"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var joined, left []string
+	m := newMembership(csr, &discovery.HTTP{Endpoint: catalog.URL}, DefaultDiscoveryInterval, zap.L())
+	m.onChange = func(j, l []*cluster.Node) {
+		joined, left = addresses(j), addresses(l)
+	}
+
+	m.resolve(context.Background())
+	if csr.Len() != 2 {
+		t.Fatalf("wrong number of members, expected 2 but got %d", csr.Len())
+	}
+	if len(joined) != 1 || joined[0] != "127.0.0.1:9002" || len(left) != 0 {
+		t.Errorf("wrong topology change, joined %v and left %v", joined, left)
+	}
+
+	mu.Lock()
+	members = []string{"127.0.0.1:9001", "127.0.0.1:9003"}
+	mu.Unlock()
+
+	m.resolve(context.Background())
+	if !csr.Member("127.0.0.1:9003") || csr.Member("127.0.0.1:9002") {
+		t.Errorf("cluster should be rebuilt: %#v", csr)
+	}
+	if len(joined) != 1 || joined[0] != "127.0.0.1:9003" || len(left) != 1 || left[0] != "127.0.0.1:9002" {
+		t.Errorf("wrong topology change, joined %v and left %v", joined, left)
+	}
+}
+
+func TestMembership_resolve_failure(t *testing.T) {
+	csr, err := cluster.New(cluster.Opts{Listen: "127.0.0.1:9001", Seeds: []string{"127.0.0.1:9002"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	for name, fn := range map[string]discovererFunc{
+		"error": func(context.Context) ([]string, error) { return nil, errors.New("catalog is down") },
+		"empty": func(context.Context) ([]string, error) { return nil, nil },
+	} {
+		t.Run(name, func(t *testing.T) {
+			m := newMembership(csr, fn, DefaultDiscoveryInterval, zap.L())
+			m.onChange = func(_, _ []*cluster.Node) {
+				t.Error("topology should not change")
+			}
+			m.resolve(context.Background())
+
+			if csr.Len() != 2 {
+				t.Errorf("members should be kept, expected 2 but got %d", csr.Len())
+			}
+		})
+	}
+}
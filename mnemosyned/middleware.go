@@ -47,6 +47,21 @@ func unaryClientInterceptors(interceptors ...grpc.UnaryClientInterceptor) grpc.U
 	}
 }
 
+func streamClientInterceptors(interceptors ...grpc.StreamClientInterceptor) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		buildChain := func(current grpc.StreamClientInterceptor, next grpc.Streamer) grpc.Streamer {
+			return func(currentCtx context.Context, currentDesc *grpc.StreamDesc, currentCC *grpc.ClientConn, currentMethod string, currentOpts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return current(currentCtx, currentDesc, currentCC, currentMethod, next, currentOpts...)
+			}
+		}
+		chain := streamer
+		for _, i := range interceptors {
+			chain = buildChain(i, chain)
+		}
+		return chain(ctx, desc, cc, method, opts...)
+	}
+}
+
 func errorInterceptor(log *zap.Logger) func(context.Context, interface{}, *grpc.UnaryServerInfo, grpc.UnaryHandler) (interface{}, error) {
 	{
 		return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
@@ -84,10 +99,12 @@ func errorInterceptor(log *zap.Logger) func(context.Context, interface{}, *grpc.
 				)
 
 				switch err {
-				case errMissingAccessToken, errMissingSession, errMissingSubjectID:
+				case errMissingAccessToken, errMissingSession, errMissingSubjectID, errMissingRefreshToken:
 					return nil, err
 				case storage.ErrSessionNotFound:
 					return nil, status.Errorf(codes.NotFound, "mnemosyned: %s", err.Error())
+				case storage.ErrRefreshTokenReused:
+					return nil, status.Errorf(codes.Unauthenticated, "mnemosyned: %s", err.Error())
 				case storage.ErrMissingAccessToken, storage.ErrMissingSession, storage.ErrMissingSubjectID:
 					return nil, status.Errorf(codes.InvalidArgument, "mnemosyned: %s", err.Error())
 				default:
@@ -0,0 +1,386 @@
+package mnemosyned
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/constant"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// healthCheckTimeout is how long the primary has to respond to the health check, before reads fail over.
+	healthCheckTimeout = time.Second
+	// repairTimeout is how long read repair of a single session can take.
+	repairTimeout = 5 * time.Second
+	// repairConcurrency is how many sessions can be repaired at once, read repairs above that are skipped.
+	repairConcurrency = 4
+	// repairInterval is minimal time between two read repairs started by the same node.
+	repairInterval = 10 * time.Millisecond
+)
+
+// peekMetadataKey marks get request that should not extend expiration time of the session, e.g. the one sent by read repair.
+const peekMetadataKey = "mnemosyne-peek"
+
+// replicator copies writes to successors of the owner and fails reads over to them.
+// Successors are determined by the position of the owner in the ring.
+type replicator struct {
+	cluster *cluster.Cluster
+	factor  int
+	quorum  int
+	logger  *zap.Logger
+	// repairs limits number of read repairs in progress.
+	repairs chan struct{}
+	// nextRepair is the earliest moment next read repair can start.
+	nextRepair time.Time
+	mu         sync.Mutex
+	// monitoring
+	writesTotal    *prometheus.CounterVec
+	failoversTotal prometheus.Counter
+	repairsTotal   prometheus.Counter
+}
+
+func newReplicator(csr *cluster.Cluster, factor, quorum int, logger *zap.Logger) *replicator {
+	if factor < 1 {
+		factor = 1
+	}
+	if quorum < 1 {
+		quorum = factor/2 + 1
+	}
+	if quorum > factor {
+		quorum = factor
+	}
+
+	return &replicator{
+		cluster: csr,
+		factor:  factor,
+		quorum:  quorum,
+		logger:  logger,
+		repairs: make(chan struct{}, repairConcurrency),
+		writesTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "replication",
+				Name:      "writes_total",
+				Help:      "Total number of writes sent to replicas.",
+			},
+			[]string{"result"},
+		),
+		failoversTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "replication",
+				Name:      "failovers_total",
+				Help:      "Total number of reads that failed over to a replica.",
+			},
+		),
+		repairsTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "replication",
+				Name:      "repairs_total",
+				Help:      "Total number of replicas fixed by read repair.",
+			},
+		),
+	}
+}
+
+// enabled returns true if sessions are copied to more than one node.
+func (r *replicator) enabled() bool {
+	return r != nil && r.factor > 1
+}
+
+// holders returns all nodes that hold given session, the owner first.
+func (r *replicator) holders(accessToken string) []*cluster.Node {
+	if r == nil {
+		return nil
+	}
+	return r.cluster.Replicas(accessToken, r.factor)
+}
+
+// previousHolders returns addresses of nodes that held given session before the last membership change.
+func (r *replicator) previousHolders(accessToken string) []string {
+	if r == nil {
+		return nil
+	}
+	return r.cluster.PreviousReplicas(accessToken, r.factor)
+}
+
+// owner returns true if replication is enabled and the current node owns given session.
+func (r *replicator) owner(accessToken string) bool {
+	if !r.enabled() {
+		return false
+	}
+	holders := r.holders(accessToken)
+	return len(holders) > 0 && holders[0].Addr == r.cluster.Listen()
+}
+
+// owned returns sessions owned by the current node, copies are filtered out.
+// All sessions are returned if replication is disabled.
+func (r *replicator) owned(sessions []*mnemosynerpc.Session) []*mnemosynerpc.Session {
+	if !r.enabled() {
+		return sessions
+	}
+	res := make([]*mnemosynerpc.Session, 0, len(sessions))
+	for _, ses := range sessions {
+		if r.owner(ses.AccessToken) {
+			res = append(res, ses)
+		}
+	}
+	return res
+}
+
+// replicas returns connected nodes, other than the current one, that hold copies of given session.
+func (r *replicator) replicas(accessToken string) (res []*cluster.Node) {
+	if !r.enabled() {
+		return nil
+	}
+	for _, n := range r.holders(accessToken) {
+		if n.Addr != r.cluster.Listen() && n.Client != nil {
+			res = append(res, n)
+		}
+	}
+	return res
+}
+
+// write calls given function concurrently for every replica of a session.
+// Write to the current node is expected to be done already, it counts towards the quorum.
+// It is a no-op for requests that are replicated already.
+func (r *replicator) write(ctx context.Context, accessToken string, fn func(context.Context, *cluster.Node) error) error {
+	if cluster.IsLocalRequest(ctx) {
+		return nil
+	}
+	nodes := r.replicas(accessToken)
+	if len(nodes) == 0 {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		acks     = 1
+		failures nodeFailures
+	)
+	ctx = cluster.WithLocal(ctx)
+	for _, n := range nodes {
+		wg.Add(1)
+
+		go func(n *cluster.Node) {
+			defer wg.Done()
+
+			err := fn(ctx, n)
+
+			mu.Lock()
+			defer mu.Unlock()
+
+			if err != nil {
+				r.writesTotal.WithLabelValues("failure").Inc()
+				failures = append(failures, nodeFailure{addr: n.Addr, err: err})
+				return
+			}
+			r.writesTotal.WithLabelValues("success").Inc()
+			acks++
+		}(n)
+	}
+	wg.Wait()
+
+	// Cluster can be smaller than the replication factor.
+	quorum := r.quorum
+	if quorum > len(nodes)+1 {
+		quorum = len(nodes) + 1
+	}
+	if acks < quorum {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].addr < failures[j].addr })
+		return status.Errorf(codes.Unavailable, "replication quorum not reached, %d of %d writes acknowledged: %s", acks, quorum, failures.Error())
+	}
+	if len(failures) > 0 {
+		r.logger.Warn("replication partially failed", zap.String("access_token", accessToken), zap.Error(failures))
+	}
+	return nil
+}
+
+// healthy returns false if given node does not respond to the health check or is not serving.
+func (r *replicator) healthy(ctx context.Context, node *cluster.Node) bool {
+	if node.Health == nil {
+		return false
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+	defer cancel()
+
+	res, err := node.Health.Check(ctx, &grpc_health_v1.HealthCheckRequest{})
+	return err == nil && res.Status == grpc_health_v1.HealthCheckResponse_SERVING
+}
+
+// failover calls given function for every replica of a session, until one of them succeeds.
+// It returns false if there is no replica at all.
+func (r *replicator) failover(ctx context.Context, accessToken string, fn func(context.Context, *cluster.Node) error) (bool, error) {
+	holders := r.holders(accessToken)
+	if len(holders) <= 1 {
+		return false, nil
+	}
+
+	r.failoversTotal.Inc()
+
+	var err error
+	for _, n := range holders[1:] {
+		if n.Addr != r.cluster.Listen() && n.Client == nil {
+			continue
+		}
+		if err = fn(cluster.WithLocal(ctx), n); err == nil {
+			return true, nil
+		}
+		r.logger.Debug("replica read failure", zap.String("remote_addr", n.Addr), zap.Error(err))
+	}
+	return true, err
+}
+
+// tryRepair starts read repair of given session in the background.
+// Repair is skipped if too many are in progress already or the previous one started too recently,
+// so that a burst of cache misses does not turn into a burst of requests to replicas.
+func (r *replicator) tryRepair(ses *mnemosynerpc.Session) bool {
+	if len(r.replicas(ses.AccessToken)) == 0 {
+		return false
+	}
+
+	r.mu.Lock()
+	now := time.Now()
+	if now.Before(r.nextRepair) {
+		r.mu.Unlock()
+		return false
+	}
+	select {
+	case r.repairs <- struct{}{}:
+	default:
+		r.mu.Unlock()
+		return false
+	}
+	r.nextRepair = now.Add(repairInterval)
+	r.mu.Unlock()
+
+	go func() {
+		defer func() { <-r.repairs }()
+
+		r.repair(ses)
+	}()
+	return true
+}
+
+// repair overwrites replicas of given session that diverge from the copy held by the current node.
+// Replicas are read without extending expiration time of their copies.
+func (r *replicator) repair(ses *mnemosynerpc.Session) {
+	nodes := r.replicas(ses.AccessToken)
+	if len(nodes) == 0 {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), repairTimeout)
+	defer cancel()
+	ctx = cluster.WithLocal(ctx)
+
+	for _, n := range nodes {
+		res, err := n.Client.Get(withPeek(ctx), &mnemosynerpc.GetRequest{AccessToken: ses.AccessToken})
+		switch status.Code(err) {
+		case codes.OK:
+			if !diverged(ses, res.Session) {
+				continue
+			}
+			if _, err := n.Client.Abandon(ctx, &mnemosynerpc.AbandonRequest{AccessToken: ses.AccessToken}); err != nil {
+				r.logger.Error("read repair failure, diverged replica cannot be abandoned", zap.String("remote_addr", n.Addr), zap.Error(err))
+				continue
+			}
+		case codes.NotFound:
+		default:
+			r.logger.Debug("read repair skipped, replica is not available", zap.String("remote_addr", n.Addr), zap.Error(err))
+			continue
+		}
+
+		if _, err := n.Client.Start(ctx, replicaStartRequest(ses)); err != nil {
+			r.logger.Error("read repair failure", zap.String("remote_addr", n.Addr), zap.Error(err))
+			continue
+		}
+		r.repairsTotal.Inc()
+		r.logger.Debug("replica repaired", zap.String("remote_addr", n.Addr), zap.String("access_token", ses.AccessToken))
+	}
+}
+
+// diverged returns true if replica differs from the original in anything but expiration time.
+func diverged(original, replica *mnemosynerpc.Session) bool {
+	if original.RefreshToken != replica.RefreshToken ||
+		original.SubjectId != replica.SubjectId ||
+		original.SubjectClient != replica.SubjectClient ||
+		len(original.Bag) != len(replica.Bag) {
+		return true
+	}
+	for k, v := range original.Bag {
+		if got, ok := replica.Bag[k]; !ok || got != v {
+			return true
+		}
+	}
+	return false
+}
+
+// replicaStartRequest returns request that starts a copy of given session.
+// Copy keeps the same tokens, subject, bag, creation time and lifetime limits.
+func replicaStartRequest(ses *mnemosynerpc.Session) *mnemosynerpc.StartRequest {
+	req := &mnemosynerpc.StartRequest{
+		Session: &mnemosynerpc.Session{
+			AccessToken:   ses.AccessToken,
+			RefreshToken:  ses.RefreshToken,
+			SubjectId:     ses.SubjectId,
+			SubjectClient: ses.SubjectClient,
+			Bag:           ses.Bag,
+			CreatedAt:     ses.CreatedAt,
+		},
+		IdleTimeout: ses.IdleTimeout,
+	}
+	if ses.AbsoluteExpireAt != nil {
+		if absoluteExpireAt, err := ptypes.Timestamp(ses.AbsoluteExpireAt); err == nil {
+			// Session that is about to expire gets the shortest possible lifetime.
+			if lifetime := time.Until(absoluteExpireAt); lifetime > 0 {
+				req.MaxLifetime = ptypes.DurationProto(lifetime)
+			} else {
+				req.MaxLifetime = ptypes.DurationProto(time.Nanosecond)
+			}
+		}
+	}
+	return req
+}
+
+// withPeek marks outgoing get request, so that the session is read without extending its expiration time.
+func withPeek(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, peekMetadataKey, "true")
+}
+
+// isPeekRequest returns true if request was sent by another node using context created by withPeek.
+// Clients cannot skip extension of expiration time, the mark is ignored unless the request is internal.
+func isPeekRequest(ctx context.Context) bool {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		return len(md[peekMetadataKey]) > 0 && cluster.IsInternalRequest(ctx)
+	}
+	return false
+}
+
+// Collect implements prometheus Collector interface.
+func (r *replicator) Collect(in chan<- prometheus.Metric) {
+	r.writesTotal.Collect(in)
+	r.failoversTotal.Collect(in)
+	r.repairsTotal.Collect(in)
+}
+
+// Describe implements prometheus Collector interface.
+func (r *replicator) Describe(in chan<- *prometheus.Desc) {
+	r.writesTotal.Describe(in)
+	r.failoversTotal.Describe(in)
+	r.repairsTotal.Describe(in)
+}
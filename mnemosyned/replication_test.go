@@ -0,0 +1,200 @@
+package mnemosyned
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/protobuf/ptypes"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+)
+
+func TestNewReplicator(t *testing.T) {
+	cases := map[string]struct {
+		factor, quorum       int
+		expFactor, expQuorum int
+	}{
+		"default":   {expFactor: 1, expQuorum: 1},
+		"majority":  {factor: 3, expFactor: 3, expQuorum: 2},
+		"even":      {factor: 2, expFactor: 2, expQuorum: 2},
+		"explicit":  {factor: 3, quorum: 1, expFactor: 3, expQuorum: 1},
+		"too-large": {factor: 2, quorum: 3, expFactor: 2, expQuorum: 2},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			r := newReplicator(nil, c.factor, c.quorum, zap.L())
+			if r.factor != c.expFactor {
+				t.Errorf("wrong factor, expected %d but got %d", c.expFactor, r.factor)
+			}
+			if r.quorum != c.expQuorum {
+				t.Errorf("wrong quorum, expected %d but got %d", c.expQuorum, r.quorum)
+			}
+		})
+	}
+}
+
+func TestReplicator_owned(t *testing.T) {
+	listeners := []net.Listener{listener(t), listener(t), listener(t)}
+	for _, l := range listeners {
+		defer l.Close()
+	}
+	csr, err := cluster.New(cluster.Opts{
+		Listen: listeners[0].Addr().String(),
+		Seeds:  []string{listeners[1].Addr().String(), listeners[2].Addr().String()},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	var sessions []*mnemosynerpc.Session
+	for _, at := range []string{"a", "b", "c", "d", "e", "f", "g", "h"} {
+		sessions = append(sessions, &mnemosynerpc.Session{AccessToken: at})
+	}
+
+	if got := newReplicator(csr, 1, 0, zap.L()).owned(sessions); len(got) != len(sessions) {
+		t.Errorf("without replication every session should be returned, got %d of %d", len(got), len(sessions))
+	}
+
+	got := newReplicator(csr, 2, 0, zap.L()).owned(sessions)
+	owned := make(map[string]bool)
+	for _, ses := range got {
+		owned[ses.AccessToken] = true
+	}
+	for _, ses := range sessions {
+		exp := csr.Replicas(ses.AccessToken, 1)[0].Addr == csr.Listen()
+		if owned[ses.AccessToken] != exp {
+			t.Errorf("session %s expected to be owned: %t", ses.AccessToken, exp)
+		}
+	}
+	if len(got) == 0 || len(got) == len(sessions) {
+		t.Errorf("only part of the sessions should be owned, got %d of %d", len(got), len(sessions))
+	}
+}
+
+func TestReplicator_tryRepair(t *testing.T) {
+	l1, l2 := listener(t), listener(t)
+	defer l1.Close()
+	// Replica does not implement any service, repair fails fast.
+	srv := grpc.NewServer()
+	go srv.Serve(l2)
+	defer srv.Stop()
+
+	csr, err := cluster.New(cluster.Opts{Listen: l1.Addr().String(), Seeds: []string{l2.Addr().String()}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := csr.Connect(context.Background(), grpc.WithInsecure()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	r := newReplicator(csr, 2, 0, zap.L())
+	ses := &mnemosynerpc.Session{AccessToken: "access-token"}
+
+	if !r.tryRepair(ses) {
+		t.Fatal("first repair should start")
+	}
+	if r.tryRepair(ses) {
+		t.Error("repair started right after the previous one should be skipped")
+	}
+	waitForRepairs(t, r)
+
+	r.mu.Lock()
+	r.nextRepair = time.Time{}
+	r.mu.Unlock()
+	for len(r.repairs) < cap(r.repairs) {
+		r.repairs <- struct{}{}
+	}
+	if r.tryRepair(ses) {
+		t.Error("repair should be skipped if too many are in progress")
+	}
+}
+
+// waitForRepairs blocks until repairs that run in the background are finished.
+func waitForRepairs(t *testing.T, r *replicator) {
+	t.Helper()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(r.repairs) > 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("repair is still in progress")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestDiverged(t *testing.T) {
+	original := &mnemosynerpc.Session{
+		AccessToken:  "access-token",
+		RefreshToken: "refresh-token",
+		SubjectId:    "subject-id",
+		Bag:          map[string]string{"key": "value"},
+		ExpireAt:     ptypes.TimestampNow(),
+	}
+
+	cases := map[string]struct {
+		replica  mnemosynerpc.Session
+		diverged bool
+	}{
+		"same":          {replica: mnemosynerpc.Session{RefreshToken: "refresh-token", SubjectId: "subject-id", Bag: map[string]string{"key": "value"}}},
+		"refresh-token": {replica: mnemosynerpc.Session{RefreshToken: "other", SubjectId: "subject-id", Bag: map[string]string{"key": "value"}}, diverged: true},
+		"subject-id":    {replica: mnemosynerpc.Session{RefreshToken: "refresh-token", SubjectId: "other", Bag: map[string]string{"key": "value"}}, diverged: true},
+		"bag-value":     {replica: mnemosynerpc.Session{RefreshToken: "refresh-token", SubjectId: "subject-id", Bag: map[string]string{"key": "other"}}, diverged: true},
+		"bag-key":       {replica: mnemosynerpc.Session{RefreshToken: "refresh-token", SubjectId: "subject-id", Bag: map[string]string{"other": "value"}}, diverged: true},
+		"bag-empty":     {replica: mnemosynerpc.Session{RefreshToken: "refresh-token", SubjectId: "subject-id"}, diverged: true},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			if got := diverged(original, &c.replica); got != c.diverged {
+				t.Errorf("wrong result, expected %t but got %t", c.diverged, got)
+			}
+		})
+	}
+}
+
+func TestReplicaStartRequest(t *testing.T) {
+	absoluteExpireAt, err := ptypes.TimestampProto(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	createdAt, err := ptypes.TimestampProto(time.Now().Add(-time.Hour))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	req := replicaStartRequest(&mnemosynerpc.Session{
+		AccessToken:      "access-token",
+		RefreshToken:     "refresh-token",
+		SubjectId:        "subject-id",
+		SubjectClient:    "subject-client",
+		Bag:              map[string]string{"key": "value"},
+		IdleTimeout:      ptypes.DurationProto(time.Minute),
+		AbsoluteExpireAt: absoluteExpireAt,
+		CreatedAt:        createdAt,
+	})
+	if req.Session.AccessToken != "access-token" || req.Session.RefreshToken != "refresh-token" {
+		t.Errorf("tokens should be preserved, got %s and %s", req.Session.AccessToken, req.Session.RefreshToken)
+	}
+	if req.Session.SubjectId != "subject-id" || req.Session.SubjectClient != "subject-client" || req.Session.Bag["key"] != "value" {
+		t.Errorf("subject and bag should be preserved, got %v", req.Session)
+	}
+	if !proto.Equal(req.Session.CreatedAt, createdAt) {
+		t.Errorf("creation time should be preserved, got %v", req.Session.CreatedAt)
+	}
+	if idleTimeout, err := ptypes.Duration(req.IdleTimeout); err != nil || idleTimeout != time.Minute {
+		t.Errorf("wrong idle timeout: %v", req.IdleTimeout)
+	}
+	maxLifetime, err := ptypes.Duration(req.MaxLifetime)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if maxLifetime <= 59*time.Minute || maxLifetime > time.Hour {
+		t.Errorf("max lifetime should be close to an hour, got %s", maxLifetime)
+	}
+}
@@ -0,0 +1,80 @@
+package mnemosyned
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// nodeFailure describes single node that failed to handle scattered request.
+type nodeFailure struct {
+	addr string
+	err  error
+}
+
+// nodeFailures is returned if at least one of the external nodes failed.
+type nodeFailures []nodeFailure
+
+func (nf nodeFailures) Error() string {
+	msgs := make([]string, 0, len(nf))
+	for _, f := range nf {
+		msgs = append(msgs, fmt.Sprintf("%s: %s", f.addr, status.Convert(f.err).Message()))
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// scatter calls given function concurrently for each external node of the cluster.
+// It is a no-op for internal requests, so the call is never propagated further than one hop.
+func scatter(ctx context.Context, csr *cluster.Cluster, fn func(context.Context, *cluster.Node) error) error {
+	if csr == nil || cluster.IsInternalRequest(ctx) {
+		return nil
+	}
+	return broadcast(ctx, csr, fn)
+}
+
+// broadcast is like scatter, but it calls external nodes for internal requests as well.
+// Nodes receive the call as an internal request, so they do not propagate it any further.
+func broadcast(ctx context.Context, csr *cluster.Cluster, fn func(context.Context, *cluster.Node) error) error {
+	if csr == nil {
+		return nil
+	}
+
+	var (
+		wg       sync.WaitGroup
+		mu       sync.Mutex
+		failures nodeFailures
+	)
+	for _, n := range csr.ExternalNodes() {
+		wg.Add(1)
+
+		go func(n *cluster.Node) {
+			defer wg.Done()
+
+			var err error
+			if n.Client == nil {
+				err = status.Errorf(codes.Unavailable, "node is not connected")
+			} else {
+				err = fn(ctx, n)
+			}
+			if err != nil {
+				mu.Lock()
+				failures = append(failures, nodeFailure{addr: n.Addr, err: err})
+				mu.Unlock()
+			}
+		}(n)
+	}
+
+	wg.Wait()
+
+	if len(failures) > 0 {
+		sort.Slice(failures, func(i, j int) bool { return failures[i].addr < failures[j].addr })
+		return failures
+	}
+	return nil
+}
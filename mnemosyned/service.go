@@ -11,11 +11,12 @@ import (
 	"go.uber.org/zap"
 )
 
-func initCluster(l *zap.Logger, addr string, seeds ...string) (*cluster.Cluster, error) {
+func initCluster(l *zap.Logger, addr string, partitioned bool, seeds ...string) (*cluster.Cluster, error) {
 	csr, err := cluster.New(cluster.Opts{
-		Listen: addr,
-		Seeds:  seeds,
-		Logger: l,
+		Listen:      addr,
+		Seeds:       seeds,
+		Logger:      l,
+		Partitioned: partitioned,
 	})
 	if err != nil {
 		return nil, err
@@ -0,0 +1,432 @@
+package mnemosyned
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// SessionLimitPolicyReject rejects Start request that would exceed the limit with ResourceExhausted error.
+	SessionLimitPolicyReject = "reject"
+	// SessionLimitPolicyEvictOldest abandons sessions that were started first to make room for a new one.
+	SessionLimitPolicyEvictOldest = "evict_oldest"
+	// SessionLimitPolicyEvictLRU abandons sessions that were used least recently to make room for a new one.
+	SessionLimitPolicyEvictLRU = "evict_lru"
+)
+
+// limitedMetadataKey marks start request that was already checked against the session limit by the coordinator.
+const limitedMetadataKey = "mnemosyne-limited"
+
+const (
+	// sessionLimiterLocks is a number of locks that subjects are spread among.
+	sessionLimiterLocks = 256
+	// sessionLimiterPage is how many sessions are retrieved at once while they are counted.
+	sessionLimiterPage = 100
+)
+
+type sessionLimiterOpts struct {
+	limit     int
+	policy    string
+	perClient bool
+	clients   map[string]int
+	failOpen  bool
+	storage   storage.Storage
+	cluster   *cluster.Cluster
+	logger    *zap.Logger
+}
+
+// sessionLimiter enforces maximum number of active sessions per subject.
+// Sessions of a subject are spread among the nodes of the cluster, so each subject has a coordinator,
+// that counts its sessions held by any node and keeps track of start requests that passed the check, but did not finish yet.
+// If nil, there is no limit.
+type sessionLimiter struct {
+	limit     int
+	policy    string
+	perClient bool
+	clients   map[string]int
+	// failOpen if true, sessions held by nodes that cannot be reached are not counted,
+	// otherwise start requests are rejected until all nodes respond.
+	failOpen bool
+	storage  storage.Storage
+	cluster  *cluster.Cluster
+	logger   *zap.Logger
+	// abandon is used to evict sessions, so that the cache, replicas and watchers are taken care of.
+	abandon func(context.Context, *mnemosynerpc.AbandonRequest) (*wrappers.BoolValue, error)
+	locks   [sessionLimiterLocks]sessionLimiterLock
+}
+
+// sessionLimiterLock guards reservations of the subjects spread to it.
+// Lock is never held while sessions are counted or evicted, so that a slow node does not block other subjects.
+type sessionLimiterLock struct {
+	sync.Mutex
+	// generation changes every time a start request finishes, counts taken before that could miss its session.
+	generation uint64
+	// changed if not nil, is closed once generation changes.
+	changed      chan struct{}
+	reservations map[string]*sessionReservation
+}
+
+// sessionReservation holds slots of a subject taken by start requests that are in progress.
+type sessionReservation struct {
+	starts int
+	// evicting are sessions that are being abandoned, they neither take a slot nor can be evicted again.
+	evicting map[string]struct{}
+}
+
+func newSessionLimiter(opts sessionLimiterOpts) (*sessionLimiter, error) {
+	if opts.limit < 0 {
+		return nil, fmt.Errorf("mnemosyned: session limit cannot be negative: %d", opts.limit)
+	}
+	for client, limit := range opts.clients {
+		if limit < 0 {
+			return nil, fmt.Errorf("mnemosyned: session limit of %s subject client cannot be negative: %d", client, limit)
+		}
+	}
+	switch opts.policy {
+	case "":
+		opts.policy = SessionLimitPolicyReject
+	case SessionLimitPolicyReject, SessionLimitPolicyEvictOldest, SessionLimitPolicyEvictLRU:
+	default:
+		return nil, fmt.Errorf("mnemosyned: unknown session limit policy: %s", opts.policy)
+	}
+	if opts.limit == 0 && len(opts.clients) == 0 {
+		return nil, nil
+	}
+
+	return &sessionLimiter{
+		limit:     opts.limit,
+		policy:    opts.policy,
+		perClient: opts.perClient,
+		clients:   opts.clients,
+		failOpen:  opts.failOpen,
+		storage:   opts.storage,
+		cluster:   opts.cluster,
+		logger:    opts.logger,
+	}, nil
+}
+
+// applies returns true if given start request needs to be checked against the limit on the way to its owner.
+// Replica writes and requests already checked by the coordinator are not.
+func (sl *sessionLimiter) applies(ctx context.Context, ses *mnemosynerpc.Session) bool {
+	if sl == nil || ses.SubjectId == "" || cluster.IsLocalRequest(ctx) || isLimitedRequest(ctx) {
+		return false
+	}
+	limit, _ := sl.of(ses)
+	return limit > 0
+}
+
+// coordinator returns node that checks start requests of given subject, if it is not the current one.
+// Requests that come from other nodes are checked where they arrive, so the path to the owner is at most two hops long.
+func (sl *sessionLimiter) coordinator(ctx context.Context, subjectID string) (*cluster.Node, bool) {
+	if cluster.IsInternalRequest(ctx) {
+		return nil, false
+	}
+	// Prefix keeps subjects apart from access tokens, e.g. partitioned ones.
+	return sl.cluster.GetOther("subject:" + subjectID)
+}
+
+// of returns limit that applies to given session and the subject client its sessions are counted for, if any.
+func (sl *sessionLimiter) of(ses *mnemosynerpc.Session) (int, *string) {
+	if limit, ok := sl.clients[ses.SubjectClient]; ok {
+		return limit, &ses.SubjectClient
+	}
+	if sl.perClient {
+		return sl.limit, &ses.SubjectClient
+	}
+	return sl.limit, nil
+}
+
+// acquire makes sure that given session can be started without exceeding the limit, either by rejecting it or by evicting others.
+// Slot is reserved until returned function is called, so concurrent start requests cannot both take the last one.
+func (sl *sessionLimiter) acquire(ctx context.Context, ses *mnemosynerpc.Session) (func(), error) {
+	limit, client := sl.of(ses)
+
+	key := ses.SubjectId
+	if client != nil {
+		key += "\x00" + *client
+	}
+	lock := &sl.locks[jump.Sum64(ses.SubjectId)%sessionLimiterLocks]
+
+	for {
+		lock.Lock()
+		generation := lock.generation
+		lock.Unlock()
+
+		active, err := sl.active(ctx, ses.SubjectId, client)
+		if err != nil {
+			return nil, err
+		}
+
+		lock.Lock()
+		// Start request finished while sessions were counted, its session could have been missed.
+		if lock.generation != generation {
+			lock.Unlock()
+			continue
+		}
+		res := lock.reservation(key)
+		candidates := active[:0]
+		for _, ses := range active {
+			if _, ok := res.evicting[ses.AccessToken]; !ok {
+				candidates = append(candidates, ses)
+			}
+		}
+		taken := len(candidates) + res.starts
+		if taken < limit {
+			res.starts++
+			lock.Unlock()
+			return lock.release(key, nil), nil
+		}
+		if sl.policy == SessionLimitPolicyReject {
+			lock.prune(key)
+			lock.Unlock()
+			return nil, status.Errorf(codes.ResourceExhausted, "mnemosyned: subject %s reached the limit of %d active sessions", ses.SubjectId, limit)
+		}
+		// Slots taken by start requests in progress cannot be freed, wait until they finish.
+		if len(candidates) < taken-limit+1 {
+			if lock.changed == nil {
+				lock.changed = make(chan struct{})
+			}
+			changed := lock.changed
+			lock.prune(key)
+			lock.Unlock()
+
+			select {
+			case <-changed:
+				continue
+			case <-ctx.Done():
+				return nil, status.FromContextError(ctx.Err()).Err()
+			}
+		}
+
+		victims, err := sl.victims(candidates, taken-limit+1)
+		if err != nil {
+			lock.prune(key)
+			lock.Unlock()
+			return nil, err
+		}
+		res.starts++
+		for _, v := range victims {
+			res.evicting[v.AccessToken] = struct{}{}
+		}
+		lock.Unlock()
+
+		release := lock.release(key, victims)
+		for _, v := range victims {
+			// Session that expired or was abandoned in the meantime does not take a slot anyway.
+			// Its access token can be a fingerprint, if the storage hashes tokens.
+			if _, err := sl.abandon(withTrusted(ctx), &mnemosynerpc.AbandonRequest{AccessToken: v.AccessToken}); err != nil && status.Code(err) != codes.NotFound {
+				release()
+				return nil, err
+			}
+			sl.logger.Debug("session evicted", zap.String("subject_id", ses.SubjectId), zap.String("policy", sl.policy))
+		}
+		return release, nil
+	}
+}
+
+// reservation returns reservation of given key, it has to be called under the lock.
+func (l *sessionLimiterLock) reservation(key string) *sessionReservation {
+	if l.reservations == nil {
+		l.reservations = make(map[string]*sessionReservation)
+	}
+	res, ok := l.reservations[key]
+	if !ok {
+		res = &sessionReservation{evicting: make(map[string]struct{})}
+		l.reservations[key] = res
+	}
+	return res
+}
+
+// prune removes reservation of given key if it does not hold anything, it has to be called under the lock.
+func (l *sessionLimiterLock) prune(key string) {
+	if res, ok := l.reservations[key]; ok && res.starts == 0 && len(res.evicting) == 0 {
+		delete(l.reservations, key)
+	}
+}
+
+// release returns function that gives back the slot reserved for given key and forgets about evicted sessions.
+// Counts that are in progress are invalidated, since they could miss the session that was just started.
+func (l *sessionLimiterLock) release(key string, evicted []*mnemosynerpc.Session) func() {
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			l.Lock()
+			defer l.Unlock()
+
+			res := l.reservation(key)
+			res.starts--
+			for _, ses := range evicted {
+				delete(res.evicting, ses.AccessToken)
+			}
+			l.prune(key)
+
+			l.generation++
+			if l.changed != nil {
+				close(l.changed)
+				l.changed = nil
+			}
+		})
+	}
+}
+
+// active returns sessions of given subject that did not expire yet, held by any node of the cluster.
+// Copies held by replicas are counted once.
+func (sl *sessionLimiter) active(ctx context.Context, subjectID string, client *string) ([]*mnemosynerpc.Session, error) {
+	now := time.Now()
+	query := storage.ListQuery{SubjectID: subjectID, ExpireAtFrom: &now}
+	if client != nil {
+		query.SubjectClient = *client
+	}
+
+	var (
+		mu       sync.Mutex
+		sessions []*mnemosynerpc.Session
+	)
+	for {
+		page, err := sl.storage.List(ctx, 0, sessionLimiterPage, query)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, page...)
+		if len(page) < sessionLimiterPage {
+			break
+		}
+		last := page[len(page)-1]
+		expireAt, err := ptypes.Timestamp(last.ExpireAt)
+		if err != nil {
+			return nil, err
+		}
+		query.After = &storage.Cursor{ExpireAt: expireAt, AccessToken: last.AccessToken}
+	}
+
+	expireAtFrom, err := ptypes.TimestampProto(now)
+	if err != nil {
+		return nil, err
+	}
+	// Coordinator can receive the request from another node, scatter would not reach anybody then.
+	err = broadcast(ctx, sl.cluster, func(ctx context.Context, node *cluster.Node) error {
+		req := &mnemosynerpc.ListRequest{
+			Limit: sessionLimiterPage,
+			Query: &mnemosynerpc.Query{
+				SubjectId:     query.SubjectID,
+				SubjectClient: query.SubjectClient,
+				ExpireAtFrom:  expireAtFrom,
+			},
+		}
+		for {
+			res, err := node.Client.List(ctx, req)
+			if err != nil {
+				return err
+			}
+
+			mu.Lock()
+			sessions = append(sessions, res.Sessions...)
+			mu.Unlock()
+
+			if res.NextPageToken == "" {
+				return nil
+			}
+			req.PageToken = res.NextPageToken
+		}
+	})
+	if err != nil {
+		if !sl.failOpen {
+			sl.logger.Error("session limit check partially failed", zap.Error(err))
+			return nil, status.Errorf(codes.Unavailable, "session limit cannot be checked, unavailable nodes: %s", err.Error())
+		}
+		sl.logger.Warn("session limit checked without sessions of unavailable nodes", zap.Error(err))
+	}
+
+	seen := make(map[string]struct{}, len(sessions))
+	active := sessions[:0]
+	for _, ses := range sessions {
+		if _, ok := seen[ses.AccessToken]; ok {
+			continue
+		}
+		// Storage treats empty subject client as no filter at all.
+		if client != nil && ses.SubjectClient != *client {
+			continue
+		}
+		seen[ses.AccessToken] = struct{}{}
+		active = append(active, ses)
+	}
+	return active, nil
+}
+
+// victims returns n sessions that should be evicted first according to the policy.
+func (sl *sessionLimiter) victims(sessions []*mnemosynerpc.Session, n int) ([]*mnemosynerpc.Session, error) {
+	keys := make(map[string]time.Time, len(sessions))
+	for _, ses := range sessions {
+		var (
+			key time.Time
+			err error
+		)
+		switch sl.policy {
+		case SessionLimitPolicyEvictOldest:
+			key, err = ptypes.Timestamp(ses.CreatedAt)
+		case SessionLimitPolicyEvictLRU:
+			key, err = lastUsedAt(ses)
+		}
+		if err != nil {
+			return nil, err
+		}
+		keys[ses.AccessToken] = key
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		ki, kj := keys[sessions[i].AccessToken], keys[sessions[j].AccessToken]
+		if !ki.Equal(kj) {
+			return ki.Before(kj)
+		}
+		return sessions[i].AccessToken < sessions[j].AccessToken
+	})
+	if n > len(sessions) {
+		n = len(sessions)
+	}
+	return sessions[:n], nil
+}
+
+// lastUsedAt returns when the session was used for the last time.
+// Every use moves expiration time by the idle timeout, see storage.ExpireAt.
+func lastUsedAt(ses *mnemosynerpc.Session) (time.Time, error) {
+	expireAt, err := ptypes.Timestamp(ses.ExpireAt)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ses.IdleTimeout == nil {
+		return expireAt, nil
+	}
+	idleTimeout, err := ptypes.Duration(ses.IdleTimeout)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return expireAt.Add(-idleTimeout), nil
+}
+
+// withLimited marks outgoing start request as already checked against the session limit.
+func withLimited(ctx context.Context) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, limitedMetadataKey, "true")
+}
+
+// isLimitedRequest returns true if request was sent by another node using context created by withLimited.
+// Clients cannot skip the check, the mark is ignored unless the request is internal.
+func isLimitedRequest(ctx context.Context) bool {
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		return len(md[limitedMetadataKey]) > 0 && cluster.IsInternalRequest(ctx)
+	}
+	return false
+}
@@ -0,0 +1,236 @@
+package mnemosyned
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage/memory"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestNewSessionLimiter(t *testing.T) {
+	cases := map[string]struct {
+		opts sessionLimiterOpts
+		nil  bool
+		err  bool
+	}{
+		"disabled":        {nil: true},
+		"global":          {opts: sessionLimiterOpts{limit: 1}},
+		"client":          {opts: sessionLimiterOpts{clients: map[string]int{"web": 1}}},
+		"negative":        {opts: sessionLimiterOpts{limit: -1}, err: true},
+		"negative-client": {opts: sessionLimiterOpts{clients: map[string]int{"web": -1}}, err: true},
+		"unknown-policy":  {opts: sessionLimiterOpts{limit: 1, policy: "evict_newest"}, err: true},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			sl, err := newSessionLimiter(c.opts)
+			if c.err != (err != nil) {
+				t.Fatalf("wrong error: %v", err)
+			}
+			if c.err {
+				return
+			}
+			if c.nil != (sl == nil) {
+				t.Fatalf("wrong limiter: %v", sl)
+			}
+			if sl != nil && sl.policy != SessionLimitPolicyReject {
+				t.Errorf("reject policy should be used by default, got %s", sl.policy)
+			}
+		})
+	}
+}
+
+func TestSessionLimiter_of(t *testing.T) {
+	sl := &sessionLimiter{limit: 3, clients: map[string]int{"web": 1, "service": 0}}
+
+	for client, exp := range map[string]int{"web": 1, "service": 0, "mobile": 3} {
+		limit, perClient := sl.of(&mnemosynerpc.Session{SubjectClient: client})
+		if limit != exp {
+			t.Errorf("%s: wrong limit, expected %d but got %d", client, exp, limit)
+		}
+		if _, ok := sl.clients[client]; ok != (perClient != nil) {
+			t.Errorf("%s: only overridden clients should be counted separately", client)
+		}
+	}
+
+	sl.perClient = true
+	if _, client := sl.of(&mnemosynerpc.Session{SubjectClient: "mobile"}); client == nil || *client != "mobile" {
+		t.Error("sessions should be counted per client")
+	}
+}
+
+func TestSessionLimiter_victims(t *testing.T) {
+	now := time.Now()
+	session := func(at string, createdAt, expireAt time.Time) *mnemosynerpc.Session {
+		ca, _ := ptypes.TimestampProto(createdAt)
+		ea, _ := ptypes.TimestampProto(expireAt)
+		return &mnemosynerpc.Session{AccessToken: at, CreatedAt: ca, ExpireAt: ea, IdleTimeout: ptypes.DurationProto(time.Hour)}
+	}
+	sessions := func() []*mnemosynerpc.Session {
+		return []*mnemosynerpc.Session{
+			// Started first, but used most recently.
+			session("a", now.Add(-3*time.Hour), now.Add(time.Hour)),
+			session("b", now.Add(-2*time.Hour), now.Add(30*time.Minute)),
+			session("c", now.Add(-time.Hour), now.Add(45*time.Minute)),
+		}
+	}
+
+	for policy, exp := range map[string][]string{
+		SessionLimitPolicyEvictOldest: {"a", "b"},
+		SessionLimitPolicyEvictLRU:    {"b", "c"},
+	} {
+		victims, err := (&sessionLimiter{policy: policy}).victims(sessions(), 2)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if len(victims) != len(exp) || victims[0].AccessToken != exp[0] || victims[1].AccessToken != exp[1] {
+			t.Errorf("%s: wrong victims, expected %v but got %v", policy, exp, victims)
+		}
+	}
+}
+
+func testSessionLimiter(t *testing.T, opts sessionLimiterOpts) *sessionLimiter {
+	t.Helper()
+
+	opts.storage = memory.NewStorage(memory.StorageOpts{})
+	opts.logger = zap.NewNop()
+	sl, err := newSessionLimiter(opts)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	sl.abandon = func(ctx context.Context, req *mnemosynerpc.AbandonRequest) (*wrappers.BoolValue, error) {
+		ok, err := sl.storage.Abandon(ctx, req.AccessToken)
+		return &wrappers.BoolValue{Value: ok}, err
+	}
+	return sl
+}
+
+func TestSessionLimiter_acquire_unavailable(t *testing.T) {
+	l1, l2 := listener(t), listener(t)
+	l1.Close()
+	// Second member never comes up.
+	l2.Close()
+
+	csr, err := cluster.New(cluster.Opts{Listen: l1.Addr().String(), Seeds: []string{l2.Addr().String()}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cases := map[string]struct {
+		failOpen bool
+		active   int
+		exp      codes.Code
+	}{
+		"fail-closed":           {exp: codes.Unavailable},
+		"fail-open":             {failOpen: true, exp: codes.OK},
+		"fail-open-local-limit": {failOpen: true, active: 1, exp: codes.ResourceExhausted},
+	}
+
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			sl := testSessionLimiter(t, sessionLimiterOpts{limit: 1, failOpen: c.failOpen, cluster: csr})
+			for i := 0; i < c.active; i++ {
+				if _, err := sl.storage.Start(ctx, "active", "", "subject", "", nil, storage.StartOpts{}); err != nil {
+					t.Fatalf("unexpected error: %s", err.Error())
+				}
+			}
+
+			release, err := sl.acquire(ctx, &mnemosynerpc.Session{SubjectId: "subject"})
+			if status.Code(err) != c.exp {
+				t.Fatalf("wrong error code, expected %s but got: %v", c.exp, err)
+			}
+			if err == nil {
+				release()
+			}
+		})
+	}
+}
+
+func TestSessionLimiter_acquire_reserved(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	t.Run("reject", func(t *testing.T) {
+		sl := testSessionLimiter(t, sessionLimiterOpts{limit: 1})
+
+		release, err := sl.acquire(ctx, &mnemosynerpc.Session{SubjectId: "subject"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		// Session of the first request is not stored yet, but its slot is taken.
+		if _, err := sl.acquire(ctx, &mnemosynerpc.Session{SubjectId: "subject"}); status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("slot should be reserved, got: %v", err)
+		}
+		// Other subjects are not affected.
+		if _, err := sl.acquire(ctx, &mnemosynerpc.Session{SubjectId: "other"}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+
+		release()
+		if _, ok := sl.locks[jump.Sum64("subject")%sessionLimiterLocks].reservations["subject"]; ok {
+			t.Error("released reservation should be removed")
+		}
+	})
+	t.Run("evict", func(t *testing.T) {
+		sl := testSessionLimiter(t, sessionLimiterOpts{limit: 1, policy: SessionLimitPolicyEvictOldest})
+		if _, err := sl.storage.Start(ctx, "first", "", "subject", "", nil, storage.StartOpts{}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+
+		release, err := sl.acquire(ctx, &mnemosynerpc.Session{SubjectId: "subject"})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if ok, err := sl.storage.Exists(ctx, "first"); err != nil || ok {
+			t.Fatalf("oldest session should be evicted: %v %v", ok, err)
+		}
+
+		done := make(chan error, 1)
+		go func() {
+			release, err := sl.acquire(ctx, &mnemosynerpc.Session{SubjectId: "subject"})
+			if err == nil {
+				release()
+			}
+			done <- err
+		}()
+
+		select {
+		case err := <-done:
+			t.Fatalf("request should wait until the reserved slot is released, got: %v", err)
+		case <-time.After(100 * time.Millisecond):
+		}
+
+		if _, err := sl.storage.Start(ctx, "second", "", "subject", "", nil, storage.StartOpts{}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		release()
+
+		if err := <-done; err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if ok, err := sl.storage.Exists(ctx, "second"); err != nil || ok {
+			t.Fatalf("session started in the meantime should be evicted: %v %v", ok, err)
+		}
+	})
+}
+
+func TestIsLimitedRequest(t *testing.T) {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(limitedMetadataKey, "true"))
+	if isLimitedRequest(ctx) {
+		t.Fatal("client should not be able to skip the session limit")
+	}
+}
@@ -1,12 +1,14 @@
 package mnemosyned
 
 import (
+	"strings"
 	"time"
 
 	"github.com/opentracing/opentracing-go/log"
 
 	"github.com/opentracing/opentracing-go"
 
+	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
@@ -23,26 +25,40 @@ import (
 )
 
 var (
-	errMissingAccessToken = status.Errorf(codes.InvalidArgument, "mnemosyned: missing access token")
-	errMissingSubjectID   = status.Errorf(codes.InvalidArgument, "mnemosyned: missing subject accessToken")
-	errMissingSession     = status.Errorf(codes.InvalidArgument, "mnemosyned: missing session")
+	errMissingAccessToken  = status.Errorf(codes.InvalidArgument, "mnemosyned: missing access token")
+	errMissingSubjectID    = status.Errorf(codes.InvalidArgument, "mnemosyned: missing subject accessToken")
+	errMissingSession      = status.Errorf(codes.InvalidArgument, "mnemosyned: missing session")
+	errMissingRefreshToken = status.Errorf(codes.InvalidArgument, "mnemosyned: missing refresh token")
 )
 
+// maxHops is how many times a request can be forwarded between nodes of the cluster.
+// Nodes can briefly disagree about the topology while membership changes, more hops mean a routing loop.
+const maxHops = 2
+
+// bearer is the authorization scheme accepted in front of an access token.
+const bearer = "Bearer "
+
 type sessionManagerOpts struct {
-	addr    string
-	cluster *cluster.Cluster
-	cache   *cache.Cache
-	ttc     time.Duration
-	logger  *zap.Logger
-	storage storage.Storage
-	tracer  opentracing.Tracer
+	addr              string
+	cluster           *cluster.Cluster
+	cache             *cache.Cache
+	ttc               time.Duration
+	logger            *zap.Logger
+	storage           storage.Storage
+	tracer            opentracing.Tracer
+	replicationFactor int
+	replicationQuorum int
+	tokens            *accessTokens
+	limiter           sessionLimiterOpts
 }
 
 type sessionManager struct {
-	ttc     time.Duration
-	logger  *zap.Logger
-	storage storage.Storage
-	tracer  opentracing.Tracer
+	ttc        time.Duration
+	logger     *zap.Logger
+	storage    storage.Storage
+	tracer     opentracing.Tracer
+	broker     *broker
+	replicator *replicator
 	// monitoring
 	cleanupErrorsTotal prometheus.Counter
 
@@ -53,16 +69,30 @@ type sessionManager struct {
 	sessionManagerExists
 	sessionManagerDelete
 	sessionManagerSetValue
+	sessionManagerWatch
+	sessionManagerRefresh
+	*sessionManagerHandoff
 }
 
 func newSessionManager(opts sessionManagerOpts) (*sessionManager, error) {
 	spanner := spanner{tracer: opts.tracer}
+	broker := newBroker(opts.addr)
+	replicator := newReplicator(opts.cluster, opts.replicationFactor, opts.replicationQuorum, opts.logger)
+	handoff := newSessionManagerHandoff(spanner, opts.storage, opts.cache, opts.cluster, replicator, opts.logger)
 
-	return &sessionManager{
-		ttc:     opts.ttc,
-		logger:  opts.logger,
-		storage: opts.storage,
-		tracer:  opts.tracer,
+	opts.limiter.storage, opts.limiter.cluster, opts.limiter.logger = opts.storage, opts.cluster, opts.logger
+	limiter, err := newSessionLimiter(opts.limiter)
+	if err != nil {
+		return nil, err
+	}
+
+	sm := &sessionManager{
+		ttc:        opts.ttc,
+		logger:     opts.logger,
+		storage:    opts.storage,
+		tracer:     opts.tracer,
+		broker:     broker,
+		replicator: replicator,
 		cleanupErrorsTotal: prometheus.NewCounter(
 			prometheus.CounterOpts{
 				Namespace: constant.Subsystem,
@@ -72,51 +102,96 @@ func newSessionManager(opts sessionManagerOpts) (*sessionManager, error) {
 			},
 		),
 		sessionManagerList: sessionManagerList{
-			spanner: spanner,
-			storage: opts.storage,
+			spanner:    spanner,
+			storage:    opts.storage,
+			cluster:    opts.cluster,
+			replicator: replicator,
+			logger:     opts.logger,
 		},
 		sessionManagerGet: sessionManagerGet{
-			spanner: spanner,
-			storage: opts.storage,
-			cache:   opts.cache,
-			cluster: opts.cluster,
-			logger:  opts.logger,
+			spanner:    spanner,
+			storage:    opts.storage,
+			cache:      opts.cache,
+			cluster:    opts.cluster,
+			handoff:    handoff,
+			replicator: replicator,
+			tokens:     opts.tokens,
+			logger:     opts.logger,
 		},
 		sessionManagerStart: sessionManagerStart{
-			spanner: spanner,
-			storage: opts.storage,
-			cache:   opts.cache,
-			cluster: opts.cluster,
-			logger:  opts.logger,
+			spanner:    spanner,
+			storage:    opts.storage,
+			cache:      opts.cache,
+			cluster:    opts.cluster,
+			broker:     broker,
+			replicator: replicator,
+			tokens:     opts.tokens,
+			limiter:    limiter,
+			logger:     opts.logger,
 		},
 		sessionManagerAbandon: sessionManagerAbandon{
-			spanner: spanner,
-			storage: opts.storage,
-			cache:   opts.cache,
-			cluster: opts.cluster,
-			logger:  opts.logger,
+			spanner:    spanner,
+			storage:    opts.storage,
+			cache:      opts.cache,
+			cluster:    opts.cluster,
+			broker:     broker,
+			handoff:    handoff,
+			replicator: replicator,
+			tokens:     opts.tokens,
+			logger:     opts.logger,
 		},
 		sessionManagerExists: sessionManagerExists{
 			spanner: spanner,
 			storage: opts.storage,
 			cache:   opts.cache,
 			cluster: opts.cluster,
+			handoff: handoff,
+			tokens:  opts.tokens,
 			logger:  opts.logger,
 		},
 		sessionManagerSetValue: sessionManagerSetValue{
-			spanner: spanner,
-			storage: opts.storage,
-			cache:   opts.cache,
-			cluster: opts.cluster,
-			logger:  opts.logger,
+			spanner:    spanner,
+			storage:    opts.storage,
+			cache:      opts.cache,
+			cluster:    opts.cluster,
+			broker:     broker,
+			handoff:    handoff,
+			replicator: replicator,
+			tokens:     opts.tokens,
+			logger:     opts.logger,
 		},
 		sessionManagerDelete: sessionManagerDelete{
-			storage: opts.storage,
-			cache:   opts.cache,
+			spanner:    spanner,
+			storage:    opts.storage,
+			cache:      opts.cache,
+			cluster:    opts.cluster,
+			broker:     broker,
+			replicator: replicator,
+			logger:     opts.logger,
+		},
+		sessionManagerWatch: sessionManagerWatch{
+			spanner: spanner,
+			broker:  broker,
 			cluster: opts.cluster,
 			logger:  opts.logger,
 		},
-	}, nil
+		sessionManagerRefresh: sessionManagerRefresh{
+			spanner:    spanner,
+			storage:    opts.storage,
+			cache:      opts.cache,
+			cluster:    opts.cluster,
+			broker:     broker,
+			replicator: replicator,
+			tokens:     opts.tokens,
+			logger:     opts.logger,
+		},
+		sessionManagerHandoff: handoff,
+	}
+	if limiter != nil {
+		limiter.abandon = sm.Abandon
+	}
+
+	return sm, nil
 }
 
 // Context gets implements RPCServer interface.
@@ -131,6 +206,10 @@ func (sm *sessionManager) Context(ctx context.Context, req *empty.Empty) (*mnemo
 	}
 
 	at := md[mnemosyne.AccessTokenMetadataKey][0]
+	// HTTP gateway passes Authorization header as it is, the scheme is optional.
+	if len(at) > len(bearer) && strings.EqualFold(at[:len(bearer)], bearer) {
+		at = at[len(bearer):]
+	}
 
 	res, err := sm.Get(ctx, &mnemosynerpc.GetRequest{AccessToken: at})
 	if err != nil {
@@ -153,16 +232,17 @@ InfLoop:
 		case <-time.After(sm.ttc):
 			t := time.Now()
 			logger.Debug("session cleanup start", zap.Time("start_at", t))
-			affected, err := sm.storage.Delete(opentracing.ContextWithSpan(context.Background(), span), "", "", "", nil, &t)
+			ctx := opentracing.ContextWithSpan(context.Background(), span)
+
+			removed, err := sm.expire(ctx, t)
 			if err != nil {
 				sm.cleanupErrorsTotal.Inc()
-				logger.Error("session cleanup failure", zap.Error(err), zap.Time("expire_at_to", t))
+				logger.Error("session cleanup failure", zap.Error(err), zap.Int64("count", removed), zap.Time("expire_at_to", t))
 				span.LogFields(log.String("event", err.Error()))
-				span.Finish()
-				return
+				break
 			}
 
-			logger.Debug("session cleanup success", zap.Int64("count", affected), zap.Duration("elapsed", time.Since(t)))
+			logger.Debug("session cleanup success", zap.Int64("count", removed), zap.Duration("elapsed", time.Since(t)))
 		case <-done:
 			logger.Info("cleanup routing terminated")
 			span.Finish()
@@ -172,14 +252,67 @@ InfLoop:
 	}
 }
 
+// cleanupPageSize is a number of expired sessions listed and removed at once.
+const cleanupPageSize = 1000
+
+// expire removes sessions that expired before given moment and returns how many of them were removed.
+// If anybody watches, expired sessions are listed, removed and announced page by page.
+// Expired sessions are not extended anymore, so none of them can be removed without being listed first.
+func (sm *sessionManager) expire(ctx context.Context, to time.Time) (int64, error) {
+	var (
+		removed int64
+		expired []*mnemosynerpc.Session
+	)
+	if sm.broker.watched() {
+		query := storage.ListQuery{ExpireAtTo: &to}
+		for {
+			var err error
+			if expired, err = sm.storage.List(ctx, 0, cleanupPageSize, query); err != nil {
+				return removed, err
+			}
+			if len(expired) < cleanupPageSize {
+				break
+			}
+
+			last := expired[len(expired)-1]
+			expireAt, err := ptypes.Timestamp(last.ExpireAt)
+			if err != nil {
+				return removed, err
+			}
+			// Sessions that expire at the same time as the last one can be listed on the next page, they are kept until then.
+			n, err := sm.storage.Delete(ctx, "", "", "", nil, &expireAt)
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+			sm.broker.emit(mnemosynerpc.EventType_SESSION_EXPIRED, sm.replicator.owned(expired)...)
+			query.After = &storage.Cursor{ExpireAt: expireAt, AccessToken: last.AccessToken}
+		}
+	}
+
+	n, err := sm.storage.Delete(ctx, "", "", "", nil, &to)
+	if err != nil {
+		return removed, err
+	}
+	sm.broker.emit(mnemosynerpc.EventType_SESSION_EXPIRED, sm.replicator.owned(expired)...)
+
+	return removed + n, nil
+}
+
 // Collect implements prometheus Collector interface.
 func (sm *sessionManager) Collect(in chan<- prometheus.Metric) {
 	sm.cleanupErrorsTotal.Collect(in)
+	sm.broker.Collect(in)
+	sm.replicator.Collect(in)
+	sm.sessionManagerHandoff.Collect(in)
 }
 
 // Describe implements prometheus Collector interface.
 func (sm *sessionManager) Describe(in chan<- *prometheus.Desc) {
 	sm.cleanupErrorsTotal.Describe(in)
+	sm.broker.Describe(in)
+	sm.replicator.Describe(in)
+	sm.sessionManagerHandoff.Describe(in)
 }
 
 type spanner struct {
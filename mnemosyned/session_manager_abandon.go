@@ -2,9 +2,9 @@ package mnemosyned
 
 import (
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
-	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 	"go.uber.org/zap"
@@ -16,10 +16,14 @@ import (
 type sessionManagerAbandon struct {
 	spanner
 
-	storage storage.Storage
-	cache   *cache.Cache
-	cluster *cluster.Cluster
-	logger  *zap.Logger
+	storage    storage.Storage
+	cache      *cache.Cache
+	cluster    *cluster.Cluster
+	broker     *broker
+	handoff    *sessionManagerHandoff
+	replicator *replicator
+	tokens     *accessTokens
+	logger     *zap.Logger
 }
 
 func (sma *sessionManagerAbandon) Abandon(ctx context.Context, req *mnemosynerpc.AbandonRequest) (*wrappers.BoolValue, error) {
@@ -29,9 +33,12 @@ func (sma *sessionManagerAbandon) Abandon(ctx context.Context, req *mnemosynerpc
 	if req.AccessToken == "" {
 		return nil, errMissingAccessToken
 	}
+	if err := sma.tokens.verify(ctx, req.AccessToken); err != nil {
+		return nil, err
+	}
 
-	if node, ok := sma.cluster.GetOther(req.AccessToken); ok {
-		if cluster.IsInternalRequest(ctx) {
+	if node, ok := sma.cluster.GetOther(req.AccessToken); ok && !cluster.IsLocalRequest(ctx) {
+		if cluster.Hops(ctx) >= maxHops {
 			return nil, status.Errorf(codes.FailedPrecondition,
 				"it should be final destination of abandon request (%s), but found another node for it: %s",
 				req.GetAccessToken(),
@@ -39,14 +46,61 @@ func (sma *sessionManagerAbandon) Abandon(ctx context.Context, req *mnemosynerpc
 			)
 		}
 		sma.logger.Debug("abandon request forwarded", zap.String("remote_addr", node.Addr), zap.String("access_token", req.AccessToken))
+		// Owner invalidates its own cache, local copy can exist only if ownership has changed.
+		defer sma.cache.Del(mnemosyne.AccessTokenSum64(req.AccessToken))
 		return node.Client.Abandon(ctx, req)
 	}
 
-	sma.cache.Del(jump.Sum64(req.AccessToken))
+	var ses *mnemosynerpc.Session
+	if sma.broker.watched() && !cluster.IsLocalRequest(ctx) {
+		// Once abandoned, session cannot be retrieved anymore.
+		var err error
+		// Get would extend the session, watchers should not affect its lifetime.
+		if ses, err = peek(ctx, sma.storage, req.AccessToken); err != nil && err != storage.ErrSessionNotFound {
+			return nil, err
+		}
+	}
+
 	abandoned, err := sma.storage.Abandon(ctx, req.AccessToken)
+	if err != nil && err != storage.ErrSessionNotFound {
+		return nil, err
+	}
+	// Previous owner can still hold the session, or be about to hand it off.
+	if node, ok := sma.handoff.fallback(ctx, req.AccessToken); ok {
+		sma.handoff.bury(req.AccessToken)
+		if sma.broker.watched() && ses == nil {
+			res, err := node.Client.Get(withPeek(cluster.WithLocal(ctx)), &mnemosynerpc.GetRequest{AccessToken: req.AccessToken})
+			if err != nil && status.Code(err) != codes.NotFound {
+				return nil, err
+			}
+			ses = res.GetSession()
+		}
+		sma.logger.Debug("abandon request forwarded to previous owner", zap.String("remote_addr", node.Addr), zap.String("access_token", req.AccessToken))
+		switch res, ferr := node.Client.Abandon(cluster.WithLocal(ctx), req); {
+		case ferr == nil:
+			abandoned, err = abandoned || res.Value, nil
+		case status.Code(ferr) != codes.NotFound:
+			return nil, ferr
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	// Cache is invalidated after the storage, otherwise concurrent Get could bring the session back.
+	sma.cache.Del(mnemosyne.AccessTokenSum64(req.AccessToken))
+	if err := sma.replicator.write(ctx, req.AccessToken, func(ctx context.Context, node *cluster.Node) error {
+		_, err := node.Client.Abandon(ctx, req)
+		// Replica that does not have the session is already in the desired state.
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	if abandoned && ses != nil {
+		sma.broker.emit(mnemosynerpc.EventType_SESSION_ABANDONED, ses)
+	}
 
 	return &wrappers.BoolValue{Value: abandoned}, nil
 }
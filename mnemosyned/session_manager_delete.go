@@ -1,10 +1,12 @@
 package mnemosyned
 
 import (
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
 	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
@@ -18,19 +20,27 @@ import (
 type sessionManagerDelete struct {
 	spanner
 
-	storage storage.Storage
-	cache   *cache.Cache
-	cluster *cluster.Cluster
-	logger  *zap.Logger
+	storage    storage.Storage
+	cache      *cache.Cache
+	cluster    *cluster.Cluster
+	broker     *broker
+	replicator *replicator
+	logger     *zap.Logger
 }
 
 func (smd *sessionManagerDelete) Delete(ctx context.Context, req *mnemosynerpc.DeleteRequest) (*wrappers.Int64Value, error) {
 	span, ctx := smd.span(ctx, "session-manager.delete")
 	defer span.Finish()
 
-	if req.AccessToken == "" && req.RefreshToken == "" && req.ExpireAtFrom == nil && req.ExpireAtTo == nil {
+	if req.AccessToken == "" && req.RefreshToken == "" && req.SubjectId == "" && req.ExpireAtFrom == nil && req.ExpireAtTo == nil {
 		return nil, status.Errorf(codes.InvalidArgument, "none of expected arguments was provided")
 	}
+	if untrustedFingerprint(ctx, req.AccessToken) {
+		return nil, errInvalidAccessToken
+	}
+	if untrustedFingerprint(ctx, req.RefreshToken) {
+		return nil, errInvalidRefreshToken
+	}
 
 	var expireAtFrom, expireAtTo *time.Time
 
@@ -49,10 +59,114 @@ func (smd *sessionManagerDelete) Delete(ctx context.Context, req *mnemosynerpc.D
 		expireAtTo = &eat
 	}
 
+	var deleted []*mnemosynerpc.Session
+	if smd.broker.watched() || smd.replicator.enabled() {
+		var err error
+		if deleted, err = affected(ctx, smd.storage, req.SubjectId, req.AccessToken, req.RefreshToken, expireAtFrom, expireAtTo); err != nil {
+			return nil, err
+		}
+	}
+
 	aff, err := smd.storage.Delete(ctx, req.SubjectId, req.AccessToken, req.RefreshToken, expireAtFrom, expireAtTo)
 	if err != nil {
 		return nil, err
 	}
+	smd.invalidate(req)
+	if smd.replicator.enabled() {
+		// Copies are neither counted nor announced, only the owner does it.
+		// Count returned by the storage is kept, listed copies are only subtracted from it,
+		// so that sessions started or removed in the meantime are accounted for.
+		owned := smd.replicator.owned(deleted)
+		if aff -= int64(len(deleted) - len(owned)); aff < 0 {
+			aff = 0
+		}
+		deleted = owned
+	}
+	smd.broker.emit(mnemosynerpc.EventType_SESSION_DELETED, deleted...)
+
+	var mu sync.Mutex
+	err = scatter(ctx, smd.cluster, func(ctx context.Context, node *cluster.Node) error {
+		res, err := node.Client.Delete(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		aff += res.Value
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		smd.logger.Error("delete request partially failed", zap.Int64("affected", aff), zap.Error(err))
+		return nil, status.Errorf(codes.Unavailable, "delete partially failed, %d session(s) deleted, unavailable nodes: %s", aff, err.Error())
+	}
 
 	return &wrappers.Int64Value{Value: aff}, nil
 }
+
+// invalidate removes cached sessions that could be affected by given delete request.
+// Each node of the cluster receives the request, so each of them invalidates its own cache.
+// Expiration time of a cached session can be outdated, so expiration bounds are not taken into account.
+func (smd *sessionManagerDelete) invalidate(req *mnemosynerpc.DeleteRequest) {
+	if req.AccessToken != "" {
+		smd.cache.Del(mnemosyne.AccessTokenSum64(req.AccessToken))
+		return
+	}
+
+	query := storage.ListQuery{
+		SubjectID:    req.SubjectId,
+		RefreshToken: req.RefreshToken,
+	}
+	n := smd.cache.DelFunc(func(ent *cache.Entry) bool {
+		return query.Match(&ent.Ses)
+	})
+	smd.logger.Debug("cache invalidated", zap.Int("entries", n))
+}
+
+// affectedPageSize is a number of sessions retrieved at once by affected function.
+const affectedPageSize = 1000
+
+// affected returns sessions that match given delete criteria.
+// It is used to find out which sessions are about to be deleted before it happens.
+func affected(ctx context.Context, s storage.Storage, subjectID, accessToken, refreshToken string, expireAtFrom, expireAtTo *time.Time) ([]*mnemosynerpc.Session, error) {
+	query := storage.ListQuery{
+		SubjectID:    subjectID,
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+		ExpireAtFrom: expireAtFrom,
+		ExpireAtTo:   expireAtTo,
+	}
+
+	var res []*mnemosynerpc.Session
+	for {
+		sessions, err := s.List(ctx, 0, affectedPageSize, query)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, sessions...)
+		if len(sessions) < affectedPageSize {
+			return res, nil
+		}
+
+		last := sessions[len(sessions)-1]
+		expireAt, err := ptypes.Timestamp(last.ExpireAt)
+		if err != nil {
+			return nil, err
+		}
+		query.After = &storage.Cursor{ExpireAt: expireAt, AccessToken: last.AccessToken}
+	}
+}
+
+// peek returns the session without extending its expiration time, unlike storage Get.
+func peek(ctx context.Context, s storage.Storage, accessToken string) (*mnemosynerpc.Session, error) {
+	sessions, err := s.List(ctx, 0, 1, storage.ListQuery{AccessToken: accessToken})
+	if err != nil {
+		return nil, err
+	}
+	if len(sessions) == 0 {
+		return nil, storage.ErrSessionNotFound
+	}
+	// Storage can list sessions by hashes of their tokens.
+	sessions[0].AccessToken = accessToken
+	return sessions[0], nil
+}
@@ -18,6 +18,8 @@ type sessionManagerExists struct {
 	storage storage.Storage
 	cache   *cache.Cache
 	cluster *cluster.Cluster
+	handoff *sessionManagerHandoff
+	tokens  *accessTokens
 	logger  *zap.Logger
 }
 
@@ -28,8 +30,11 @@ func (sme *sessionManagerExists) Exists(ctx context.Context, req *mnemosynerpc.E
 	if req.AccessToken == "" {
 		return nil, errMissingAccessToken
 	}
-	if node, ok := sme.cluster.GetOther(req.AccessToken); ok {
-		if cluster.IsInternalRequest(ctx) {
+	if err := sme.tokens.verify(ctx, req.AccessToken); err != nil {
+		return nil, err
+	}
+	if node, ok := sme.cluster.GetOther(req.AccessToken); ok && !cluster.IsLocalRequest(ctx) {
+		if cluster.Hops(ctx) >= maxHops {
 			return nil, status.Errorf(codes.FailedPrecondition,
 				"it should be final destination of exists request (%s), but found another node for it: %s",
 				req.GetAccessToken(),
@@ -44,6 +49,12 @@ func (sme *sessionManagerExists) Exists(ctx context.Context, req *mnemosynerpc.E
 	if err != nil {
 		return nil, err
 	}
+	if !exists {
+		if node, ok := sme.handoff.fallback(ctx, req.AccessToken); ok {
+			sme.logger.Debug("exists request forwarded to previous owner", zap.String("remote_addr", node.Addr), zap.String("access_token", req.AccessToken))
+			return node.Client.Exists(cluster.WithLocal(ctx), req)
+		}
+	}
 
 	return &wrappers.BoolValue{Value: exists}, nil
 }
@@ -3,9 +3,9 @@ package mnemosyned
 import (
 	"time"
 
+	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
-	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 	"go.uber.org/zap"
@@ -17,10 +17,13 @@ import (
 type sessionManagerGet struct {
 	spanner
 
-	storage storage.Storage
-	cache   *cache.Cache
-	cluster *cluster.Cluster
-	logger  *zap.Logger
+	storage    storage.Storage
+	cache      *cache.Cache
+	cluster    *cluster.Cluster
+	handoff    *sessionManagerHandoff
+	replicator *replicator
+	tokens     *accessTokens
+	logger     *zap.Logger
 }
 
 func (smg *sessionManagerGet) Get(ctx context.Context, req *mnemosynerpc.GetRequest) (*mnemosynerpc.GetResponse, error) {
@@ -30,8 +33,11 @@ func (smg *sessionManagerGet) Get(ctx context.Context, req *mnemosynerpc.GetRequ
 	if req.AccessToken == "" {
 		return nil, errMissingAccessToken
 	}
-	if node, ok := smg.cluster.GetOther(req.AccessToken); ok {
-		if cluster.IsInternalRequest(ctx) {
+	if err := smg.tokens.verify(ctx, req.AccessToken); err != nil {
+		return nil, err
+	}
+	if node, ok := smg.cluster.GetOther(req.AccessToken); ok && !cluster.IsLocalRequest(ctx) {
+		if cluster.Hops(ctx) >= maxHops {
 			return nil, status.Errorf(codes.FailedPrecondition,
 				"it should be final destination of get request (%s), but found another node for it: %s",
 				req.GetAccessToken(),
@@ -39,14 +45,34 @@ func (smg *sessionManagerGet) Get(ctx context.Context, req *mnemosynerpc.GetRequ
 			)
 		}
 		smg.logger.Debug("get request forwarded", zap.String("remote_addr", node.Addr), zap.String("access_token", req.AccessToken))
-		return node.Client.Get(ctx, req)
+		res, err := node.Client.Get(ctx, req)
+		if err != nil {
+			return smg.failover(ctx, req, node, err)
+		}
+		return res, nil
 	}
+
+	return smg.local(ctx, req)
+}
+
+// local reads the session from the cache or the storage of the current node.
+func (smg *sessionManagerGet) local(ctx context.Context, req *mnemosynerpc.GetRequest) (*mnemosynerpc.GetResponse, error) {
 	var (
 		ses *mnemosynerpc.Session
 		err error
 	)
 
-	hs := jump.Sum64(req.AccessToken)
+	// Read repair compares copies, it should not keep them alive.
+	if isPeekRequest(ctx) {
+		if ses, err = peek(ctx, smg.storage, req.AccessToken); err != nil {
+			return nil, err
+		}
+		return &mnemosynerpc.GetResponse{
+			Session: ses,
+		}, nil
+	}
+
+	hs := mnemosyne.AccessTokenSum64(req.AccessToken)
 	entry, ok := smg.cache.Read(hs)
 	if !ok || (!entry.Refresh && time.Since(entry.Exp) > smg.cache.TTL) {
 		if ok {
@@ -54,12 +80,22 @@ func (smg *sessionManagerGet) Get(ctx context.Context, req *mnemosynerpc.GetRequ
 		}
 		ses, err = smg.storage.Get(ctx, req.AccessToken)
 		if err != nil {
-			if err == storage.ErrSessionNotFound && ok {
-				smg.cache.Del(hs)
+			if err == storage.ErrSessionNotFound {
+				if ok {
+					smg.cache.Del(hs)
+				}
+				if node, ok := smg.handoff.fallback(ctx, req.AccessToken); ok {
+					smg.logger.Debug("get request forwarded to previous owner", zap.String("remote_addr", node.Addr), zap.String("access_token", req.AccessToken))
+					return node.Client.Get(cluster.WithLocal(ctx), req)
+				}
 			}
 			return nil, err
 		}
 		smg.cache.Put(hs, *ses)
+		// Only the owner repairs, copy held by a replica or the previous owner can be outdated.
+		if smg.replicator.owner(req.AccessToken) {
+			smg.replicator.tryRepair(ses)
+		}
 	} else {
 		ses = &entry.Ses
 	}
@@ -68,3 +104,26 @@ func (smg *sessionManagerGet) Get(ctx context.Context, req *mnemosynerpc.GetRequ
 		Session: ses,
 	}, nil
 }
+
+// failover reads the session from its replicas, if the owner is not healthy.
+// Otherwise, the original error is returned.
+func (smg *sessionManagerGet) failover(ctx context.Context, req *mnemosynerpc.GetRequest, owner *cluster.Node, cause error) (*mnemosynerpc.GetResponse, error) {
+	if !smg.replicator.enabled() || status.Code(cause) == codes.NotFound || smg.replicator.healthy(ctx, owner) {
+		return nil, cause
+	}
+	smg.logger.Warn("owner is not healthy, get request failed over to replicas", zap.String("remote_addr", owner.Addr), zap.Error(cause))
+
+	var res *mnemosynerpc.GetResponse
+	ok, err := smg.replicator.failover(ctx, req.AccessToken, func(ctx context.Context, node *cluster.Node) (err error) {
+		if node.Addr == smg.cluster.Listen() {
+			res, err = smg.local(ctx, req)
+		} else {
+			res, err = node.Client.Get(ctx, req)
+		}
+		return err
+	})
+	if !ok {
+		return nil, cause
+	}
+	return res, err
+}
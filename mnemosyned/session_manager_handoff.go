@@ -0,0 +1,485 @@
+package mnemosyned
+
+import (
+	"io"
+	"sync"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/constant"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// handoffBatchSize is a number of sessions retrieved from the storage and sent to another node at once.
+const handoffBatchSize = 1000
+
+type sessionManagerHandoff struct {
+	spanner
+
+	storage    storage.Storage
+	cache      *cache.Cache
+	cluster    *cluster.Cluster
+	replicator *replicator
+	logger     *zap.Logger
+
+	// mu guards the state of rebalancing.
+	mu sync.Mutex
+	// ring is a checksum of cluster members the pending set was computed for.
+	ring uint64
+	// pending holds addresses of nodes that may still hold sessions owned by the current node.
+	pending map[string]struct{}
+	// completed holds ring checksums for which given node finished its handoff.
+	completed map[string]uint64
+	// tombstones holds access tokens of sessions abandoned while previous owners were pending,
+	// so that copies that are still being handed off are not brought back.
+	tombstones map[string]struct{}
+	cancel     context.CancelFunc
+	// monitoring
+	sessionsTotal  *prometheus.CounterVec
+	failuresTotal  prometheus.Counter
+	fallbacksTotal prometheus.Counter
+	inProgress     prometheus.Gauge
+	pendingNodes   prometheus.Gauge
+}
+
+func newSessionManagerHandoff(spanner spanner, s storage.Storage, c *cache.Cache, csr *cluster.Cluster, r *replicator, logger *zap.Logger) *sessionManagerHandoff {
+	return &sessionManagerHandoff{
+		spanner:    spanner,
+		storage:    s,
+		cache:      c,
+		cluster:    csr,
+		replicator: r,
+		logger:     logger,
+		pending:    make(map[string]struct{}),
+		completed:  make(map[string]uint64),
+		tombstones: make(map[string]struct{}),
+		sessionsTotal: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "handoff",
+				Name:      "sessions_total",
+				Help:      "Total number of sessions transferred between nodes due to topology change.",
+			},
+			[]string{"direction"},
+		),
+		failuresTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "handoff",
+				Name:      "failures_total",
+				Help:      "Total number of handoffs to another node that failed.",
+			},
+		),
+		fallbacksTotal: prometheus.NewCounter(
+			prometheus.CounterOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "handoff",
+				Name:      "fallbacks_total",
+				Help:      "Total number of requests forwarded to the previous owner of a session.",
+			},
+		),
+		inProgress: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "handoff",
+				Name:      "in_progress",
+				Help:      "Equals 1 if the node is transferring sessions it no longer owns.",
+			},
+		),
+		pendingNodes: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Namespace: constant.Subsystem,
+				Subsystem: "handoff",
+				Name:      "pending_nodes",
+				Help:      "Number of nodes that have not finished transferring sessions to the current node yet.",
+			},
+		),
+	}
+}
+
+// Handoff implements RPCServer interface.
+// It stores sessions that the sender no longer owns.
+// Sessions that already exist are skipped, so the transfer can be safely repeated.
+func (smh *sessionManagerHandoff) Handoff(stream mnemosynerpc.SessionManager_HandoffServer) error {
+	ctx := stream.Context()
+	span, ctx := smh.span(ctx, "session-manager.handoff")
+	defer span.Finish()
+
+	if !cluster.IsInternalRequest(ctx) {
+		return status.Errorf(codes.PermissionDenied, "handoff is allowed only between cluster nodes")
+	}
+
+	var (
+		node     string
+		ring     uint64
+		accepted int64
+	)
+	for {
+		req, err := stream.Recv()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if req.Node != "" {
+			node, ring = req.Node, req.Ring
+		}
+		for _, ses := range req.Sessions {
+			ok, err := smh.accept(ctx, ses)
+			if err != nil {
+				return err
+			}
+			if ok {
+				accepted++
+			}
+		}
+	}
+
+	smh.sessionsTotal.WithLabelValues("received").Add(float64(accepted))
+	smh.complete(node, ring)
+	smh.logger.Debug("handoff received", zap.String("remote_addr", node), zap.Int64("accepted", accepted))
+
+	return stream.SendAndClose(&mnemosynerpc.HandoffResponse{Accepted: accepted})
+}
+
+// accept stores given session with its tokens, subject, bag, creation time and lifetime limits preserved.
+// Expired, abandoned and already existing sessions are ignored.
+func (smh *sessionManagerHandoff) accept(ctx context.Context, ses *mnemosynerpc.Session) (bool, error) {
+	if smh.buried(ses.AccessToken) {
+		return false, nil
+	}
+
+	now := time.Now()
+	if ses.ExpireAt != nil {
+		expireAt, err := ptypes.Timestamp(ses.ExpireAt)
+		if err != nil {
+			return false, status.Errorf(codes.InvalidArgument, "invalid expire at: %s", err.Error())
+		}
+		if !expireAt.After(now) {
+			return false, nil
+		}
+	}
+
+	var (
+		opts storage.StartOpts
+		err  error
+	)
+	if ses.IdleTimeout != nil {
+		if opts.IdleTimeout, err = ptypes.Duration(ses.IdleTimeout); err != nil {
+			return false, status.Errorf(codes.InvalidArgument, "invalid idle timeout: %s", err.Error())
+		}
+	}
+	if ses.AbsoluteExpireAt != nil {
+		absoluteExpireAt, err := ptypes.Timestamp(ses.AbsoluteExpireAt)
+		if err != nil {
+			return false, status.Errorf(codes.InvalidArgument, "invalid absolute expire at: %s", err.Error())
+		}
+		if opts.MaxLifetime = absoluteExpireAt.Sub(now); opts.MaxLifetime <= 0 {
+			return false, nil
+		}
+	}
+	if ses.CreatedAt != nil {
+		if opts.CreatedAt, err = ptypes.Timestamp(ses.CreatedAt); err != nil {
+			return false, status.Errorf(codes.InvalidArgument, "invalid created at: %s", err.Error())
+		}
+	}
+
+	exists, err := smh.storage.Exists(ctx, ses.AccessToken)
+	if err != nil {
+		return false, err
+	}
+	if exists {
+		return false, nil
+	}
+
+	if _, err = smh.storage.Start(ctx, ses.AccessToken, ses.RefreshToken, ses.SubjectId, ses.SubjectClient, ses.Bag, opts); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// complete marks handoff from given node as finished.
+func (smh *sessionManagerHandoff) complete(node string, ring uint64) {
+	if node == "" {
+		return
+	}
+
+	smh.mu.Lock()
+	defer smh.mu.Unlock()
+
+	// Sender can notice topology change before the current node does.
+	smh.completed[node] = ring
+	if ring == smh.ring {
+		delete(smh.pending, node)
+		smh.pendingNodes.Set(float64(len(smh.pending)))
+	}
+	smh.forget()
+}
+
+// forget drops tombstones once no previous owner can hand off a session anymore.
+// It has to be called under the lock.
+func (smh *sessionManagerHandoff) forget() {
+	if len(smh.pending) == 0 && len(smh.tombstones) > 0 {
+		smh.tombstones = make(map[string]struct{})
+	}
+}
+
+// bury marks given session as abandoned, so that its copy handed off by a previous owner is refused.
+func (smh *sessionManagerHandoff) bury(accessToken string) {
+	smh.mu.Lock()
+	defer smh.mu.Unlock()
+
+	if len(smh.pending) > 0 {
+		smh.tombstones[accessToken] = struct{}{}
+	}
+}
+
+// buried returns true if given session was abandoned while previous owners were pending.
+func (smh *sessionManagerHandoff) buried(accessToken string) bool {
+	smh.mu.Lock()
+	defer smh.mu.Unlock()
+
+	_, ok := smh.tombstones[accessToken]
+	return ok
+}
+
+// adopt copies the session from its previous owner, so that a write is applied to the copy that is kept.
+// Copy handed off later is skipped, since the session exists already.
+func (smh *sessionManagerHandoff) adopt(ctx context.Context, node *cluster.Node, accessToken string) error {
+	// Copy should not keep the session alive, nor fall back any further.
+	res, err := node.Client.Get(withPeek(cluster.WithLocal(ctx)), &mnemosynerpc.GetRequest{AccessToken: accessToken})
+	if err != nil {
+		if status.Code(err) == codes.NotFound {
+			return storage.ErrSessionNotFound
+		}
+		return err
+	}
+	if _, err := smh.accept(ctx, res.Session); err != nil {
+		return err
+	}
+	smh.logger.Debug("session adopted from previous owner", zap.String("remote_addr", node.Addr), zap.String("access_token", accessToken))
+	return nil
+}
+
+// fallback returns previous owner of a session, if it may still hold it.
+func (smh *sessionManagerHandoff) fallback(ctx context.Context, accessToken string) (*cluster.Node, bool) {
+	// Previous owner handles fallback request locally, it is never forwarded further.
+	if cluster.IsLocalRequest(ctx) {
+		return nil, false
+	}
+	node, ok := smh.cluster.GetPrevious(accessToken)
+	if !ok {
+		return nil, false
+	}
+
+	smh.mu.Lock()
+	_, ok = smh.pending[node.Addr]
+	smh.mu.Unlock()
+
+	if ok {
+		smh.fallbacksTotal.Inc()
+	}
+	return node, ok
+}
+
+// rebalance starts transferring sessions that the current node no longer owns, due to topology change.
+// Rebalancing that is already in progress is canceled.
+// It returns immediately, rebalancing stops once given context is canceled.
+func (smh *sessionManagerHandoff) rebalance(ctx context.Context, joined []*cluster.Node) {
+	ring := smh.cluster.Checksum()
+
+	smh.mu.Lock()
+	defer smh.mu.Unlock()
+
+	smh.ring = ring
+	smh.pending = make(map[string]struct{})
+NodesLoop:
+	for _, n := range smh.cluster.ExternalNodes() {
+		// Nodes that just joined do not hold any sessions of the current one.
+		for _, j := range joined {
+			if j.Addr == n.Addr {
+				continue NodesLoop
+			}
+		}
+		if smh.completed[n.Addr] != ring {
+			smh.pending[n.Addr] = struct{}{}
+		}
+	}
+	smh.pendingNodes.Set(float64(len(smh.pending)))
+	smh.forget()
+
+	if smh.cancel != nil {
+		smh.cancel()
+	}
+	ctx, smh.cancel = context.WithCancel(ctx)
+
+	go smh.run(ctx, ring)
+}
+
+// handoffStream is an outgoing stream of sessions to a single node.
+type handoffStream struct {
+	node   *cluster.Node
+	stream mnemosynerpc.SessionManager_HandoffClient
+	batch  []*mnemosynerpc.Session
+	sent   int
+	err    error
+}
+
+// add queues given session, it is a no-op once the stream failed.
+func (hs *handoffStream) add(ses *mnemosynerpc.Session) {
+	if hs.err != nil {
+		return
+	}
+	if hs.batch = append(hs.batch, ses); len(hs.batch) >= handoffBatchSize {
+		hs.flush()
+	}
+}
+
+func (hs *handoffStream) flush() {
+	if hs.err != nil {
+		hs.batch = nil
+		return
+	}
+	if len(hs.batch) == 0 {
+		return
+	}
+	if hs.err = hs.stream.Send(&mnemosynerpc.HandoffRequest{Sessions: hs.batch}); hs.err != nil {
+		return
+	}
+	hs.sent += len(hs.batch)
+	hs.batch = hs.batch[:0]
+}
+
+func (smh *sessionManagerHandoff) run(ctx context.Context, ring uint64) {
+	smh.inProgress.Set(1)
+	defer smh.inProgress.Set(0)
+
+	streams := make(map[string]*handoffStream)
+	open := func(node *cluster.Node) *handoffStream {
+		if hs, ok := streams[node.Addr]; ok {
+			return hs
+		}
+		hs := &handoffStream{node: node}
+		streams[node.Addr] = hs
+
+		if hs.stream, hs.err = node.Client.Handoff(ctx); hs.err != nil {
+			return hs
+		}
+		// Receiver needs to know who is the sender, even if there is nothing to transfer.
+		hs.err = hs.stream.Send(&mnemosynerpc.HandoffRequest{Node: smh.cluster.Listen(), Ring: ring})
+		return hs
+	}
+
+	// moved holds access tokens of sessions that the current node no longer holds, grouped by their new owner.
+	moved := make(map[string][]string)
+	query := storage.ListQuery{}
+	for {
+		sessions, err := smh.storage.List(ctx, 0, handoffBatchSize, query)
+		if err != nil {
+			smh.failuresTotal.Inc()
+			smh.logger.Error("handoff failure, sessions cannot be listed", zap.Error(err))
+			return
+		}
+		for _, ses := range sessions {
+			holders := smh.replicator.holders(ses.AccessToken)
+			if len(holders) == 0 {
+				continue
+			}
+
+			previous := smh.replicator.previousHolders(ses.AccessToken)
+			kept := false
+			for _, n := range holders {
+				if n.Addr == smh.cluster.Listen() {
+					kept = true
+					continue
+				}
+				// Node that held the session before the change has it already.
+				if n.Client == nil || held(previous, n.Addr) {
+					continue
+				}
+				open(n).add(ses)
+			}
+			if !kept {
+				moved[holders[0].Addr] = append(moved[holders[0].Addr], ses.AccessToken)
+			}
+		}
+		if len(sessions) < handoffBatchSize {
+			break
+		}
+
+		last := sessions[len(sessions)-1]
+		expireAt, err := ptypes.Timestamp(last.ExpireAt)
+		if err != nil {
+			smh.failuresTotal.Inc()
+			smh.logger.Error("handoff failure, invalid expire at", zap.Error(err))
+			return
+		}
+		query.After = &storage.Cursor{ExpireAt: expireAt, AccessToken: last.AccessToken}
+	}
+
+	for _, n := range smh.cluster.ExternalNodes() {
+		if n.Client == nil {
+			continue
+		}
+		hs := open(n)
+		hs.flush()
+		if hs.err == nil {
+			_, hs.err = hs.stream.CloseAndRecv()
+		}
+		if hs.err != nil {
+			// Sessions stay where they are, the receiver will keep falling back to the current node.
+			smh.failuresTotal.Inc()
+			smh.logger.Error("handoff failure", zap.String("remote_addr", n.Addr), zap.Int("sent", hs.sent), zap.Error(hs.err))
+			continue
+		}
+
+		// Session is removed only once its new owner has it, replicas are repaired on read if needed.
+		for _, at := range moved[n.Addr] {
+			if _, err := smh.storage.Abandon(ctx, at); err != nil && err != storage.ErrSessionNotFound {
+				smh.logger.Error("handed off session cannot be abandoned", zap.String("remote_addr", n.Addr), zap.Error(err))
+			}
+			smh.cache.Del(mnemosyne.AccessTokenSum64(at))
+		}
+		smh.sessionsTotal.WithLabelValues("sent").Add(float64(hs.sent))
+		smh.logger.Info("handoff finished", zap.String("remote_addr", n.Addr), zap.Int("sent", hs.sent))
+	}
+}
+
+// held returns true if given address is one of the previous holders.
+// If membership has never changed, there are no previous holders, so sessions are sent to all current ones.
+func held(previous []string, addr string) bool {
+	for _, p := range previous {
+		if p == addr {
+			return true
+		}
+	}
+	return false
+}
+
+// Collect implements prometheus Collector interface.
+func (smh *sessionManagerHandoff) Collect(in chan<- prometheus.Metric) {
+	smh.sessionsTotal.Collect(in)
+	smh.failuresTotal.Collect(in)
+	smh.fallbacksTotal.Collect(in)
+	smh.inProgress.Collect(in)
+	smh.pendingNodes.Collect(in)
+}
+
+// Describe implements prometheus Collector interface.
+func (smh *sessionManagerHandoff) Describe(in chan<- *prometheus.Desc) {
+	smh.sessionsTotal.Describe(in)
+	smh.failuresTotal.Describe(in)
+	smh.fallbacksTotal.Describe(in)
+	smh.inProgress.Describe(in)
+	smh.pendingNodes.Describe(in)
+}
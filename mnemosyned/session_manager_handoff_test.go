@@ -0,0 +1,219 @@
+package mnemosyned
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/opentracing/opentracing-go"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	storagemem "github.com/piotrkowalczuk/mnemosyne/internal/storage/memory"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestSessionManagerHandoff_fallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	csr, err := cluster.New(cluster.Opts{Listen: "127.0.0.1:9001", Seeds: []string{"127.0.0.1:9002"}})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if err := csr.Connect(ctx, grpc.WithInsecure()); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	smh := newSessionManagerHandoff(
+		spanner{tracer: opentracing.NoopTracer{}},
+		storagemem.NewStorage(storagemem.StorageOpts{}),
+		cache.New(cache.Opts{}),
+		csr,
+		newReplicator(csr, 1, 0, zap.L()),
+		zap.L(),
+	)
+
+	// Access token that belonged to the other node before the topology change.
+	var accessToken string
+	for i := 0; accessToken == ""; i++ {
+		at := fmt.Sprintf("access-token-%d", i)
+		if _, ok := csr.GetOther(at); ok {
+			accessToken = at
+		}
+	}
+
+	joined, _, err := csr.Update(ctx, []string{"127.0.0.1:9002", "127.0.0.1:9003"})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	smh.rebalance(ctx, joined)
+
+	node, ok := smh.fallback(ctx, accessToken)
+	if !ok {
+		t.Fatal("read should fall back to the previous owner")
+	}
+	if node.Addr != "127.0.0.1:9002" {
+		t.Errorf("wrong previous owner: %s", node.Addr)
+	}
+
+	smh.complete(node.Addr, 0)
+	if _, ok := smh.fallback(ctx, accessToken); !ok {
+		t.Error("handoff completed for a different topology should be ignored")
+	}
+
+	smh.complete(node.Addr, csr.Checksum())
+	if _, ok := smh.fallback(ctx, accessToken); ok {
+		t.Error("read should not fall back once previous owner completed the handoff")
+	}
+}
+
+func TestHandoffStream_add(t *testing.T) {
+	hs := &handoffStream{err: errors.New("stream broken")}
+	for i := 0; i < 2*handoffBatchSize; i++ {
+		hs.add(&mnemosynerpc.Session{AccessToken: fmt.Sprintf("access-token-%d", i)})
+	}
+	if len(hs.batch) != 0 {
+		t.Fatalf("failed stream should not queue sessions, got %d", len(hs.batch))
+	}
+}
+
+// handoffNode starts session manager backed by in memory storage, that serves requests of other nodes.
+func handoffNode(t *testing.T, ctx context.Context, l net.Listener, seeds ...string) (*sessionManager, *cluster.Cluster) {
+	t.Helper()
+
+	csr, err := cluster.New(cluster.Opts{Listen: l.Addr().String(), Seeds: seeds})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	auth, err := cluster.NewAuthenticator(l.Addr().String(), []byte(testClusterSecret))
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	sm, err := newSessionManager(sessionManagerOpts{
+		addr:    l.Addr().String(),
+		cluster: csr,
+		cache:   cache.New(cache.Opts{}),
+		ttc:     time.Minute,
+		logger:  zap.L(),
+		storage: storagemem.NewStorage(storagemem.StorageOpts{}),
+		tracer:  opentracing.NoopTracer{},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(unaryServerInterceptors(auth.UnaryServerInterceptor(), errorInterceptor(zap.L()))),
+		grpc.StreamInterceptor(auth.StreamServerInterceptor()),
+	)
+	mnemosynerpc.RegisterSessionManagerServer(srv, sm)
+	go srv.Serve(l)
+	go func() {
+		<-ctx.Done()
+		srv.Stop()
+	}()
+
+	if err := csr.Connect(ctx,
+		grpc.WithInsecure(),
+		grpc.WithUnaryInterceptor(auth.UnaryClientInterceptor()),
+		grpc.WithStreamInterceptor(auth.StreamClientInterceptor()),
+	); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	return sm, csr
+}
+
+func TestSessionManagerHandoff_pending(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	ls := []net.Listener{listener(t), listener(t), listener(t)}
+	sort.Slice(ls, func(i, j int) bool { return ls[i].Addr().String() < ls[j].Addr().String() })
+	// Node that joins in the middle takes over sessions of the last one, which in turn takes over some of the first one.
+	first, joined, last := ls[0], ls[1], ls[2]
+	joined.Close()
+
+	previous, _ := handoffNode(t, ctx, first, last.Addr().String())
+	current, csr := handoffNode(t, ctx, last, first.Addr().String())
+
+	added, _, err := csr.Update(ctx, []string{first.Addr().String(), joined.Addr().String()})
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	current.rebalance(ctx, added)
+
+	// Sessions that the first node still holds, although they are owned by the last one now.
+	var tokens []string
+	for i := 0; len(tokens) < 2; i++ {
+		at := fmt.Sprintf("access-token-%d", i)
+		if _, ok := csr.GetOther(at); ok {
+			continue
+		}
+		if _, ok := current.fallback(ctx, at); !ok {
+			continue
+		}
+		if _, err := previous.storage.Start(ctx, at, "", "subject", "", map[string]string{"key": "value"}, storage.StartOpts{}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		tokens = append(tokens, at)
+	}
+	copies := make([]*mnemosynerpc.Session, 0, len(tokens))
+	for _, at := range tokens {
+		ses, err := previous.storage.Get(ctx, at)
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		copies = append(copies, ses)
+	}
+
+	t.Run("abandon", func(t *testing.T) {
+		res, err := current.Abandon(ctx, &mnemosynerpc.AbandonRequest{AccessToken: tokens[0]})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if !res.Value {
+			t.Error("session held by the previous owner should be abandoned")
+		}
+		if exists, err := previous.storage.Exists(ctx, tokens[0]); err != nil || exists {
+			t.Fatalf("previous owner should not hold abandoned session: %v %v", exists, err)
+		}
+		// Copy that was handed off before the session was abandoned arrives late.
+		if ok, err := current.accept(ctx, copies[0]); err != nil || ok {
+			t.Fatalf("abandoned session should not be brought back: %v %v", ok, err)
+		}
+		// Previous owner is asked as well, it does not hold the session anymore.
+		if _, err := current.Get(ctx, &mnemosynerpc.GetRequest{AccessToken: tokens[0]}); status.Code(err) != codes.NotFound {
+			t.Fatalf("abandoned session should not be found, got: %v", err)
+		}
+	})
+	t.Run("set-value", func(t *testing.T) {
+		if _, err := current.SetValue(ctx, &mnemosynerpc.SetValueRequest{AccessToken: tokens[1], Key: "key", Value: "changed"}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		// Copy that was handed off before the value was set arrives late.
+		if ok, err := current.accept(ctx, copies[1]); err != nil || ok {
+			t.Fatalf("outdated copy should not be accepted: %v %v", ok, err)
+		}
+		res, err := current.Get(ctx, &mnemosynerpc.GetRequest{AccessToken: tokens[1]})
+		if err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+		if res.Session.Bag["key"] != "changed" {
+			t.Errorf("value should not be lost, got %s", res.Session.Bag["key"])
+		}
+	})
+
+	current.complete(first.Addr().String(), csr.Checksum())
+	if current.buried(tokens[0]) {
+		t.Error("tombstones should be dropped once previous owners finished the handoff")
+	}
+}
@@ -1,50 +1,247 @@
 package mnemosyned
 
 import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/wrappers"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// countBatchSize is a number of sessions retrieved from the storage at once, while owned sessions are counted.
+const countBatchSize = 1000
+
 type sessionManagerList struct {
 	spanner
 
-	storage storage.Storage
+	storage    storage.Storage
+	cluster    *cluster.Cluster
+	replicator *replicator
+	logger     *zap.Logger
 }
 
 func (sml *sessionManagerList) List(ctx context.Context, req *mnemosynerpc.ListRequest) (*mnemosynerpc.ListResponse, error) {
 	span, ctx := sml.span(ctx, "session-manager.list")
 	defer span.Finish()
 
-	var (
-		expireAtFrom, expireAtTo *time.Time
-	)
+	query := storage.ListQuery{
+		RefreshToken:  req.GetQuery().GetRefreshToken(),
+		SubjectID:     req.GetQuery().GetSubjectId(),
+		SubjectClient: req.GetQuery().GetSubjectClient(),
+		Bag:           req.GetQuery().GetBag(),
+	}
 	if req.GetQuery().GetExpireAtFrom() != nil {
 		eaf, err := ptypes.Timestamp(req.GetQuery().GetExpireAtFrom())
 		if err != nil {
 			return nil, err
 		}
-		expireAtFrom = &eaf
+		query.ExpireAtFrom = &eaf
 	}
 	if req.GetQuery().GetExpireAtTo() != nil {
 		eat, err := ptypes.Timestamp(req.GetQuery().GetExpireAtTo())
 		if err != nil {
 			return nil, err
 		}
-		expireAtTo = &eat
+		query.ExpireAtTo = &eat
+	}
+	if req.PageToken != "" {
+		if req.Offset != 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "offset cannot be combined with page token")
+		}
+		cursor, err := decodePageToken(req.PageToken)
+		if err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "malformed page token")
+		}
+		query.After = cursor
 	}
 	if req.Limit == 0 {
 		req.Limit = 10
 	}
 
-	sessions, err := sml.storage.List(ctx, req.Offset, req.Limit, expireAtFrom, expireAtTo)
+	if sml.cluster == nil || cluster.IsInternalRequest(ctx) || len(sml.cluster.ExternalNodes()) == 0 {
+		return sml.local(ctx, req.Offset, req.Limit, req.IncludeTotalCount, query)
+	}
+
+	// Offset cannot be distributed among nodes,
+	// so each of them has to return everything up to the end of the requested page.
+	sub := *req
+	sub.Offset = 0
+	sub.Limit = req.Offset + req.Limit
+
+	loc, err := sml.local(ctx, 0, sub.Limit, req.IncludeTotalCount, query)
+	if err != nil {
+		return nil, err
+	}
+
+	var mu sync.Mutex
+	pages := []*mnemosynerpc.ListResponse{loc}
+	err = scatter(ctx, sml.cluster, func(ctx context.Context, node *cluster.Node) error {
+		res, err := node.Client.List(ctx, &sub)
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		pages = append(pages, res)
+		mu.Unlock()
+		return nil
+	})
+	if err != nil {
+		sml.logger.Error("list request partially failed", zap.Error(err))
+		return nil, status.Errorf(codes.Unavailable, "list partially failed, unavailable nodes: %s", err.Error())
+	}
+
+	return mergePages(pages, req.Offset, req.Limit, req.IncludeTotalCount)
+}
+
+func (sml *sessionManagerList) local(ctx context.Context, offset, limit int64, includeTotalCount bool, query storage.ListQuery) (*mnemosynerpc.ListResponse, error) {
+	// One additional session is retrieved to find out if there is a next page.
+	sessions, err := sml.storage.List(ctx, offset, limit+1, query)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &mnemosynerpc.ListResponse{}
+	if int64(len(sessions)) > limit {
+		sessions = sessions[:limit]
+		if res.NextPageToken, err = encodePageToken(sessions[len(sessions)-1]); err != nil {
+			return nil, err
+		}
+	}
+	res.Sessions = sessions
+
+	if includeTotalCount {
+		count, err := sml.count(ctx, query)
+		if err != nil {
+			return nil, err
+		}
+		res.TotalCount = &wrappers.Int64Value{Value: count}
+	}
+
+	return res, nil
+}
+
+// count returns number of sessions that satisfy given query.
+// With replication, only sessions owned by the current node are counted, so that copies held by replicas are not counted twice.
+func (sml *sessionManagerList) count(ctx context.Context, query storage.ListQuery) (int64, error) {
+	if !sml.replicator.enabled() {
+		return sml.storage.Count(ctx, query)
+	}
+
+	var count int64
+	query.After = nil
+	for {
+		sessions, err := sml.storage.List(ctx, 0, countBatchSize, query)
+		if err != nil {
+			return 0, err
+		}
+		count += int64(len(sml.replicator.owned(sessions)))
+		if len(sessions) < countBatchSize {
+			return count, nil
+		}
+
+		last := sessions[len(sessions)-1]
+		expireAt, err := ptypes.Timestamp(last.ExpireAt)
+		if err != nil {
+			return 0, err
+		}
+		query.After = &storage.Cursor{ExpireAt: expireAt, AccessToken: last.AccessToken}
+	}
+}
+
+// mergePages combines pages retrieved from cluster nodes into single one.
+// Each page is expected to be ordered by expiration time and access token and to start at the beginning of the result set.
+// Duplicates are removed from the sessions. Total count is a sum, each node counts only the sessions it owns, see count.
+func mergePages(pages []*mnemosynerpc.ListResponse, offset, limit int64, includeTotalCount bool) (*mnemosynerpc.ListResponse, error) {
+	var (
+		sessions []*mnemosynerpc.Session
+		more     bool
+		total    int64
+	)
+	// With replication, the same session can be returned by several nodes.
+	seen := make(map[string]struct{})
+	for _, p := range pages {
+		for _, ses := range p.Sessions {
+			if _, ok := seen[ses.AccessToken]; ok {
+				continue
+			}
+			seen[ses.AccessToken] = struct{}{}
+			sessions = append(sessions, ses)
+		}
+		more = more || p.NextPageToken != ""
+		total += p.GetTotalCount().GetValue()
+	}
+	sort.Slice(sessions, func(i, j int) bool {
+		a, b := sessions[i].GetExpireAt(), sessions[j].GetExpireAt()
+		switch {
+		case a.GetSeconds() != b.GetSeconds():
+			return a.GetSeconds() < b.GetSeconds()
+		case a.GetNanos() != b.GetNanos():
+			return a.GetNanos() < b.GetNanos()
+		default:
+			return sessions[i].AccessToken < sessions[j].AccessToken
+		}
+	})
+
+	if offset > int64(len(sessions)) {
+		offset = int64(len(sessions))
+	}
+	sessions = sessions[offset:]
+	if int64(len(sessions)) > limit {
+		sessions = sessions[:limit]
+		more = true
+	}
+
+	res := &mnemosynerpc.ListResponse{Sessions: sessions}
+	if more && len(sessions) > 0 {
+		var err error
+		if res.NextPageToken, err = encodePageToken(sessions[len(sessions)-1]); err != nil {
+			return nil, err
+		}
+	}
+	if includeTotalCount {
+		res.TotalCount = &wrappers.Int64Value{Value: total}
+	}
+
+	return res, nil
+}
+
+// encodePageToken builds opaque token that points at given session,
+// it consists of session expiration time followed by access token.
+func encodePageToken(ses *mnemosynerpc.Session) (string, error) {
+	expireAt, err := ptypes.Timestamp(ses.ExpireAt)
+	if err != nil {
+		return "", err
+	}
+	buf := make([]byte, 8, 8+len(ses.AccessToken))
+	binary.BigEndian.PutUint64(buf, uint64(expireAt.UnixNano()))
+	buf = append(buf, ses.AccessToken...)
+
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func decodePageToken(token string) (*storage.Cursor, error) {
+	buf, err := base64.RawURLEncoding.DecodeString(token)
 	if err != nil {
 		return nil, err
 	}
-	return &mnemosynerpc.ListResponse{
-		Sessions: sessions,
+	if len(buf) <= 8 {
+		return nil, errors.New("page token too short")
+	}
+
+	return &storage.Cursor{
+		ExpireAt:    time.Unix(0, int64(binary.BigEndian.Uint64(buf[:8]))),
+		AccessToken: string(buf[8:]),
 	}, nil
 }
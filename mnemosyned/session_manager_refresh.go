@@ -0,0 +1,138 @@
+package mnemosyned
+
+import (
+	"sync"
+
+	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type sessionManagerRefresh struct {
+	spanner
+
+	storage    storage.Storage
+	cache      *cache.Cache
+	cluster    *cluster.Cluster
+	broker     *broker
+	replicator *replicator
+	tokens     *accessTokens
+	logger     *zap.Logger
+}
+
+func (smr *sessionManagerRefresh) Refresh(ctx context.Context, req *mnemosynerpc.RefreshRequest) (*mnemosynerpc.RefreshResponse, error) {
+	span, ctx := smr.span(ctx, "session-manager.refresh")
+	defer span.Finish()
+
+	if req.RefreshToken == "" {
+		return nil, errMissingRefreshToken
+	}
+	if untrustedFingerprint(ctx, req.RefreshToken) {
+		return nil, errInvalidRefreshToken
+	}
+
+	// Refresh tokens are not routable, session can be held by any node.
+	// New session is started locally, so access token needs to belong to the current node.
+	accessToken, err := smr.randomAccessToken()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "access token generation failure: %s", err.Error())
+	}
+	refreshToken, err := mnemosyne.RandomAccessToken()
+	if err != nil {
+		return nil, status.Errorf(codes.Internal, "refresh token generation failure: %s", err.Error())
+	}
+
+	abandoned, started, err := smr.storage.Refresh(ctx, req.RefreshToken, accessToken, refreshToken)
+	switch {
+	case err == storage.ErrSessionNotFound:
+		return smr.scatter(ctx, req)
+	case err != nil:
+		return nil, err
+	}
+
+	// Fingerprint returned by the storage, if tokens are hashed, is cached under the same key as the token itself.
+	smr.cache.Del(mnemosyne.AccessTokenSum64(abandoned.AccessToken))
+	smr.broker.emit(mnemosynerpc.EventType_SESSION_REFRESHED, started)
+	smr.replicate(ctx, abandoned, started)
+
+	return &mnemosynerpc.RefreshResponse{
+		Session: started,
+	}, nil
+}
+
+func (smr *sessionManagerRefresh) randomAccessToken() (string, error) {
+	for {
+		at, err := smr.tokens.random(smr.cluster.Partition())
+		if err != nil {
+			return "", err
+		}
+		if _, ok := smr.cluster.GetOther(at); !ok {
+			return at, nil
+		}
+	}
+}
+
+// replicate copies the started session to its replicas and abandons copies of the rotated one.
+// Failures are only logged, the rotation cannot be undone and the client has to receive the new tokens.
+func (smr *sessionManagerRefresh) replicate(ctx context.Context, abandoned, started *mnemosynerpc.Session) {
+	if err := smr.replicator.write(ctx, started.AccessToken, func(ctx context.Context, node *cluster.Node) error {
+		_, err := node.Client.Start(ctx, replicaStartRequest(started))
+		return err
+	}); err != nil {
+		smr.logger.Error("refreshed session replication failure", zap.String("access_token", started.AccessToken), zap.Error(err))
+	}
+	// Copy of the rotated session would allow to use the refresh token again.
+	if err := smr.replicator.write(ctx, abandoned.AccessToken, func(ctx context.Context, node *cluster.Node) error {
+		_, err := node.Client.Abandon(ctx, &mnemosynerpc.AbandonRequest{AccessToken: abandoned.AccessToken})
+		if status.Code(err) == codes.NotFound {
+			return nil
+		}
+		return err
+	}); err != nil {
+		smr.logger.Error("rotated session replicas cannot be abandoned", zap.String("access_token", abandoned.AccessToken), zap.Error(err))
+	}
+}
+
+// scatter asks other nodes of the cluster to refresh the session.
+// Without replication at most one of them can hold a session for given refresh token.
+// With replication, the node that rotates the session first abandons copies held by the others.
+func (smr *sessionManagerRefresh) scatter(ctx context.Context, req *mnemosynerpc.RefreshRequest) (*mnemosynerpc.RefreshResponse, error) {
+	var (
+		mu     sync.Mutex
+		res    *mnemosynerpc.RefreshResponse
+		reused bool
+	)
+	err := scatter(ctx, smr.cluster, func(ctx context.Context, node *cluster.Node) error {
+		r, err := node.Client.Refresh(ctx, req)
+		switch status.Code(err) {
+		case codes.OK:
+			mu.Lock()
+			res = r
+			mu.Unlock()
+		case codes.NotFound:
+		case codes.Unauthenticated:
+			mu.Lock()
+			reused = true
+			mu.Unlock()
+		default:
+			return err
+		}
+		smr.logger.Debug("refresh request scattered", zap.String("remote_addr", node.Addr), zap.Error(err))
+		return nil
+	})
+	switch {
+	case res != nil:
+		return res, nil
+	case reused:
+		return nil, storage.ErrRefreshTokenReused
+	case err != nil:
+		return nil, status.Errorf(codes.Unavailable, "refresh failed, unavailable nodes: %s", err.Error())
+	}
+	return nil, storage.ErrSessionNotFound
+}
@@ -2,6 +2,7 @@ package mnemosyned
 
 import (
 	"github.com/opentracing/opentracing-go/log"
+	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
@@ -15,10 +16,14 @@ import (
 type sessionManagerSetValue struct {
 	spanner
 
-	storage storage.Storage
-	cache   *cache.Cache
-	cluster *cluster.Cluster
-	logger  *zap.Logger
+	storage    storage.Storage
+	cache      *cache.Cache
+	cluster    *cluster.Cluster
+	broker     *broker
+	handoff    *sessionManagerHandoff
+	replicator *replicator
+	tokens     *accessTokens
+	logger     *zap.Logger
 }
 
 func (smsv *sessionManagerSetValue) SetValue(ctx context.Context, req *mnemosynerpc.SetValueRequest) (*mnemosynerpc.SetValueResponse, error) {
@@ -31,9 +36,12 @@ func (smsv *sessionManagerSetValue) SetValue(ctx context.Context, req *mnemosyne
 	case req.Key == "":
 		return nil, status.Errorf(codes.InvalidArgument, "missing bag key")
 	}
+	if err := smsv.tokens.verify(ctx, req.AccessToken); err != nil {
+		return nil, err
+	}
 
-	if node, ok := smsv.cluster.GetOther(req.AccessToken); ok {
-		if cluster.IsInternalRequest(ctx) {
+	if node, ok := smsv.cluster.GetOther(req.AccessToken); ok && !cluster.IsLocalRequest(ctx) {
+		if cluster.Hops(ctx) >= maxHops {
 			span.LogFields(
 				log.String("error", "recursive internal call"),
 				log.String("addr", node.Addr),
@@ -45,13 +53,39 @@ func (smsv *sessionManagerSetValue) SetValue(ctx context.Context, req *mnemosyne
 			)
 		}
 		smsv.logger.Debug("set value request forwarded", zap.String("remote_addr", node.Addr), zap.String("access_token", req.AccessToken))
+		// Owner invalidates its own cache, local copy can exist only if ownership has changed.
+		defer smsv.cache.Del(mnemosyne.AccessTokenSum64(req.AccessToken))
 		return node.Client.SetValue(ctx, req)
 	}
 
 	bag, err := smsv.storage.SetValue(ctx, req.AccessToken, req.Key, req.Value)
+	if err == storage.ErrSessionNotFound {
+		// Session was not handed off yet, otherwise the value would be lost once it is.
+		if node, ok := smsv.handoff.fallback(ctx, req.AccessToken); ok {
+			if err = smsv.handoff.adopt(ctx, node, req.AccessToken); err == nil {
+				bag, err = smsv.storage.SetValue(ctx, req.AccessToken, req.Key, req.Value)
+			}
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
+	smsv.cache.Del(mnemosyne.AccessTokenSum64(req.AccessToken))
+	if err := smsv.replicator.write(ctx, req.AccessToken, func(ctx context.Context, node *cluster.Node) error {
+		_, err := node.Client.SetValue(ctx, req)
+		return err
+	}); err != nil {
+		return nil, err
+	}
+	// Replica does not emit, otherwise watchers would be notified once per copy.
+	if smsv.broker.watched() && !cluster.IsLocalRequest(ctx) {
+		// Get would extend the session, watchers should not affect its lifetime.
+		ses, err := peek(ctx, smsv.storage, req.AccessToken)
+		if err != nil {
+			return nil, err
+		}
+		smsv.broker.emit(mnemosynerpc.EventType_SESSION_VALUE_SET, ses)
+	}
 
 	return &mnemosynerpc.SetValueResponse{
 		Bag: bag,
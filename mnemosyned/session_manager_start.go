@@ -1,8 +1,12 @@
 package mnemosyned
 
 import (
+	"errors"
+	"time"
+
+	"github.com/golang/protobuf/ptypes"
+	"github.com/golang/protobuf/ptypes/duration"
 	"github.com/opentracing/opentracing-go/log"
-	"github.com/piotrkowalczuk/mnemosyne"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cache"
 	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
@@ -16,10 +20,14 @@ import (
 type sessionManagerStart struct {
 	spanner
 
-	storage storage.Storage
-	cache   *cache.Cache
-	cluster *cluster.Cluster
-	logger  *zap.Logger
+	storage    storage.Storage
+	cache      *cache.Cache
+	cluster    *cluster.Cluster
+	broker     *broker
+	replicator *replicator
+	tokens     *accessTokens
+	limiter    *sessionLimiter
+	logger     *zap.Logger
 }
 
 func (sms *sessionManagerStart) Start(ctx context.Context, req *mnemosynerpc.StartRequest) (*mnemosynerpc.StartResponse, error) {
@@ -31,7 +39,7 @@ func (sms *sessionManagerStart) Start(ctx context.Context, req *mnemosynerpc.Sta
 	}
 	if req.Session.AccessToken == "" {
 		var err error
-		req.Session.AccessToken, err = mnemosyne.RandomAccessToken()
+		req.Session.AccessToken, err = sms.tokens.random(sms.cluster.Partition())
 		if err != nil {
 			return nil, status.Errorf(codes.Internal, "access token generation failure: %s", err.Error())
 		}
@@ -39,10 +47,34 @@ func (sms *sessionManagerStart) Start(ctx context.Context, req *mnemosynerpc.Sta
 			log.String("event", "random access token generated"),
 			log.String("access_token", req.GetSession().GetAccessToken()),
 		)
+	} else if err := sms.tokens.verify(ctx, req.Session.AccessToken); err != nil {
+		// Session started under a token that does not verify could never be read.
+		return nil, err
+	}
+	if untrustedFingerprint(ctx, req.Session.RefreshToken) {
+		return nil, errInvalidRefreshToken
 	}
 
-	if node, ok := sms.cluster.GetOther(req.Session.AccessToken); ok {
-		if cluster.IsInternalRequest(ctx) {
+	if sms.limiter.applies(ctx, req.Session) {
+		if node, ok := sms.limiter.coordinator(ctx, req.Session.SubjectId); ok {
+			sms.logger.Debug("start request forwarded to subject coordinator", zap.String("remote_addr", node.Addr), zap.String("subject_id", req.Session.SubjectId))
+			span.LogFields(
+				log.String("event", "subject is coordinated by another member of the cluster"),
+				log.String("addr", node.Addr),
+			)
+			return node.Client.Start(ctx, req)
+		}
+		release, err := sms.limiter.acquire(ctx, req.Session)
+		if err != nil {
+			return nil, err
+		}
+		// Slot stays reserved until the session is stored by its owner.
+		defer release()
+		ctx = withLimited(ctx)
+	}
+
+	if node, ok := sms.cluster.GetOther(req.Session.AccessToken); ok && !cluster.IsLocalRequest(ctx) {
+		if cluster.Hops(ctx) >= maxHops {
 			span.LogFields(
 				log.String("error", "recursive internal call"),
 				log.String("addr", node.Addr),
@@ -65,18 +97,61 @@ func (sms *sessionManagerStart) Start(ctx context.Context, req *mnemosynerpc.Sta
 		return nil, errMissingSubjectID
 	}
 
+	var (
+		opts storage.StartOpts
+		err  error
+	)
+	if opts.IdleTimeout, err = optionalDuration(req.IdleTimeout); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid idle timeout: %s", err.Error())
+	}
+	if opts.MaxLifetime, err = optionalDuration(req.MaxLifetime); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid max lifetime: %s", err.Error())
+	}
+	// Only copies keep creation time of the original, clients cannot backdate sessions.
+	if req.Session.CreatedAt != nil && cluster.IsLocalRequest(ctx) {
+		if opts.CreatedAt, err = ptypes.Timestamp(req.Session.CreatedAt); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid created at: %s", err.Error())
+		}
+	}
+
 	ses, err := sms.storage.Start(ctx,
 		req.Session.AccessToken,
 		req.Session.RefreshToken,
 		req.Session.SubjectId,
 		req.Session.SubjectClient,
 		req.Session.Bag,
+		opts,
 	)
 	if err != nil {
 		return nil, err
 	}
+	// Replica does not emit, otherwise watchers would be notified once per copy.
+	if !cluster.IsLocalRequest(ctx) {
+		sms.broker.emit(mnemosynerpc.EventType_SESSION_STARTED, ses)
+	}
+	if err := sms.replicator.write(ctx, ses.AccessToken, func(ctx context.Context, node *cluster.Node) error {
+		_, err := node.Client.Start(ctx, replicaStartRequest(ses))
+		return err
+	}); err != nil {
+		return nil, err
+	}
 
 	return &mnemosynerpc.StartResponse{
 		Session: ses,
 	}, nil
 }
+
+// optionalDuration converts given duration, nil is treated as zero.
+func optionalDuration(d *duration.Duration) (time.Duration, error) {
+	if d == nil {
+		return 0, nil
+	}
+	res, err := ptypes.Duration(d)
+	if err != nil {
+		return 0, err
+	}
+	if res < 0 {
+		return 0, errors.New("duration cannot be negative")
+	}
+	return res, nil
+}
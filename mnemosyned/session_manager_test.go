@@ -1,9 +1,16 @@
 package mnemosyned
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 
@@ -11,11 +18,16 @@ import (
 	"github.com/golang/protobuf/ptypes/empty"
 	"github.com/lib/pq"
 	"github.com/piotrkowalczuk/mnemosyne"
+	"github.com/piotrkowalczuk/mnemosyne/internal/constant"
+	"github.com/piotrkowalczuk/mnemosyne/internal/jump"
 	"github.com/piotrkowalczuk/mnemosyne/internal/storage"
+	"github.com/piotrkowalczuk/mnemosyne/internal/storage/memory"
 	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
 	. "github.com/smartystreets/goconvey/convey"
 	"github.com/stretchr/testify/mock"
+	"go.uber.org/zap"
 	"golang.org/x/net/context"
+	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
@@ -75,7 +87,7 @@ func TestSessionManager_mockedStore(t *testing.T) {
 				session = &mnemosynerpc.Session{AccessToken: token, SubjectId: subjectID, Bag: bag, ExpireAt: expireAt}
 
 				Convey("Without storage error", func() {
-					suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string")).
+					suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string"), mock.AnythingOfType("storage.StartOpts")).
 						Once().
 						Return(session, expectedErr)
 
@@ -86,7 +98,7 @@ func TestSessionManager_mockedStore(t *testing.T) {
 				})
 				Convey("With storage postgres error", func() {
 					expectedErr = pq.Error{Message: "fake postgres error"}
-					suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string")).
+					suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string"), mock.AnythingOfType("storage.StartOpts")).
 						Once().
 						Return(nil, expectedErr)
 
@@ -106,7 +118,7 @@ func TestSessionManager_mockedStore(t *testing.T) {
 
 				req = &mnemosynerpc.StartRequest{Session: &mnemosynerpc.Session{SubjectId: subjectID}}
 				session = &mnemosynerpc.Session{AccessToken: token, SubjectId: subjectID, ExpireAt: expireAt}
-				suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string")).
+				suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string"), mock.AnythingOfType("storage.StartOpts")).
 					Once().
 					Return(session, expectedErr)
 
@@ -118,7 +130,7 @@ func TestSessionManager_mockedStore(t *testing.T) {
 			Convey("Without subject and with bag", func() {
 				req = &mnemosynerpc.StartRequest{Session: &mnemosynerpc.Session{Bag: bag}}
 				expectedErr = errors.New("session cannot be started, subject accessToken is missing")
-				suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string")).
+				suite.store.On("Start", mock.Anything, mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("string"), mock.AnythingOfType("map[string]string"), mock.AnythingOfType("storage.StartOpts")).
 					Once().
 					Return(session, expectedErr)
 
@@ -152,6 +164,40 @@ func TestSessionManager_Start_postgresStore(t *testing.T) {
 					So(err, ShouldBeNil)
 					So(resp, ShouldBeValidStartResponse, sid)
 				})
+				Convey("With idle timeout and max lifetime", func() {
+					resp, err := s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
+						Session:     &mnemosynerpc.Session{SubjectId: sid},
+						IdleTimeout: ptypes.DurationProto(time.Hour),
+						MaxLifetime: ptypes.DurationProto(time.Minute),
+					})
+					So(err, ShouldBeNil)
+					So(resp, ShouldBeValidStartResponse, sid)
+					So(resp.Session.CreatedAt, ShouldNotBeNil)
+					So(resp.Session.AbsoluteExpireAt, ShouldNotBeNil)
+					So(resp.Session.IdleTimeout, ShouldResemble, ptypes.DurationProto(time.Hour))
+
+					Convey("Get should not extend session past its absolute deadline", func() {
+						res, err := s.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: resp.Session.AccessToken})
+						So(err, ShouldBeNil)
+
+						expireAt, err := ptypes.Timestamp(res.Session.ExpireAt)
+						So(err, ShouldBeNil)
+						absoluteExpireAt, err := ptypes.Timestamp(resp.Session.AbsoluteExpireAt)
+						So(err, ShouldBeNil)
+						So(expireAt, ShouldEqual, absoluteExpireAt)
+					})
+				})
+				Convey("With negative idle timeout", func() {
+					Convey("Should return invalid argument gRPC error", func() {
+						resp, err := s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
+							Session:     &mnemosynerpc.Session{SubjectId: sid},
+							IdleTimeout: ptypes.DurationProto(-time.Minute),
+						})
+
+						So(resp, ShouldBeNil)
+						So(err, ShouldBeGRPCError(ShouldEqual), codes.InvalidArgument, "mnemosyned: invalid idle timeout: duration cannot be negative")
+					})
+				})
 			})
 			Convey("Without subject id", func() {
 				Convey("Should return invalid argument gRPC error", func() {
@@ -554,6 +600,40 @@ func TestSessionManager_Delete_postgresStore(t *testing.T) {
 	}))
 }
 
+func TestSessionManager_Delete_cluster_postgresStore(t *testing.T) {
+	factor := 3
+	nb := 12
+	Convey("Delete", t, WithE2ESuites(t, factor, func(s e2eSuites) {
+		Convey("Having sessions of single subject spread across the cluster", func() {
+			for i := 0; i < nb; i++ {
+				res, err := s[i%factor].client.Start(context.Background(), &mnemosynerpc.StartRequest{
+					Session: &mnemosynerpc.Session{SubjectId: "entity:1"},
+				})
+				So(err, ShouldBeNil)
+				So(res, ShouldBeValidStartResponse, "entity:1")
+			}
+			for i := 0; i < factor; i++ {
+				Convey(fmt.Sprintf("As node#%d", i), func() {
+					Convey("Should delete all of them", func() {
+						res, err := s[i].client.Delete(context.Background(), &mnemosynerpc.DeleteRequest{
+							SubjectId: "entity:1",
+						})
+
+						So(err, ShouldBeNil)
+						So(res.GetValue(), ShouldEqual, nb)
+
+						for j := 0; j < factor; j++ {
+							list, err := s[j].client.List(context.Background(), &mnemosynerpc.ListRequest{})
+							So(err, ShouldBeNil)
+							So(list.Sessions, ShouldBeEmpty)
+						}
+					})
+				})
+			}
+		})
+	}))
+}
+
 func TestSessionManager_SetValue_postgresStore(t *testing.T) {
 	var (
 		subjectID   string
@@ -618,7 +698,10 @@ func TestSessionManager_List_postgresStore(t *testing.T) {
 		Convey("Having multiple sessions active", func() {
 			for i := 0; i < nb; i++ {
 				res, err := s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
-					Session: &mnemosynerpc.Session{SubjectId: strconv.Itoa(i)},
+					Session: &mnemosynerpc.Session{
+						SubjectId:    strconv.Itoa(i),
+						RefreshToken: "refresh-" + strconv.Itoa(i),
+					},
 				})
 				So(err, ShouldBeNil)
 				So(res, ShouldBeValidStartResponse, subjectID)
@@ -686,6 +769,114 @@ func TestSessionManager_List_postgresStore(t *testing.T) {
 					So(len(res.GetSessions()), ShouldEqual, 0)
 				})
 			})
+			Convey("With subject id set", func() {
+				Convey("Should return only sessions of given subject", func() {
+					res, err := s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						Query: &mnemosynerpc.Query{
+							SubjectId: "7",
+						},
+					})
+
+					So(err, ShouldBeNil)
+					So(res, ShouldNotBeNil)
+					So(len(res.Sessions), ShouldEqual, 1)
+					So(res.Sessions[0].SubjectId, ShouldEqual, "7")
+				})
+			})
+			Convey("With refresh token set", func() {
+				Convey("Should return single session", func() {
+					res, err := s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						Query: &mnemosynerpc.Query{
+							RefreshToken: "refresh-3",
+						},
+					})
+
+					So(err, ShouldBeNil)
+					So(res, ShouldNotBeNil)
+					So(len(res.Sessions), ShouldEqual, 1)
+					So(res.Sessions[0].SubjectId, ShouldEqual, "3")
+				})
+			})
+			Convey("With bag entry that no session has", func() {
+				Convey("Should return empty collection", func() {
+					res, err := s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						Query: &mnemosynerpc.Query{
+							Bag: map[string]string{"key": "value"},
+						},
+					})
+
+					So(err, ShouldBeNil)
+					So(res, ShouldNotBeNil)
+					So(len(res.Sessions), ShouldEqual, 0)
+				})
+			})
+			Convey("With page token", func() {
+				Convey("Should iterate over all sessions without duplicates", func() {
+					seen := make(map[string]struct{}, nb)
+					req := &mnemosynerpc.ListRequest{Limit: 3}
+					for {
+						res, err := s.client.List(context.Background(), req)
+						So(err, ShouldBeNil)
+						So(res, ShouldNotBeNil)
+
+						for _, ses := range res.Sessions {
+							So(seen, ShouldNotContainKey, ses.AccessToken)
+							seen[ses.AccessToken] = struct{}{}
+						}
+						if res.NextPageToken == "" {
+							break
+						}
+						req.PageToken = res.NextPageToken
+					}
+					So(len(seen), ShouldEqual, nb)
+				})
+				Convey("Combined with offset should return invalid argument error", func() {
+					res, err := s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						Limit: 3,
+					})
+					So(err, ShouldBeNil)
+					So(res.NextPageToken, ShouldNotBeEmpty)
+
+					res, err = s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						Offset:    1,
+						PageToken: res.NextPageToken,
+					})
+					So(res, ShouldBeNil)
+					So(err, ShouldBeGRPCError(ShouldEqual), codes.InvalidArgument, "mnemosyned: offset cannot be combined with page token")
+				})
+				Convey("That is malformed should return invalid argument error", func() {
+					res, err := s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						PageToken: "!malformed!",
+					})
+					So(res, ShouldBeNil)
+					So(err, ShouldBeGRPCError(ShouldEqual), codes.InvalidArgument, "mnemosyned: malformed page token")
+				})
+			})
+			Convey("With total count requested", func() {
+				Convey("Should return number of all matching sessions", func() {
+					res, err := s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						Limit:             2,
+						IncludeTotalCount: true,
+					})
+
+					So(err, ShouldBeNil)
+					So(res, ShouldNotBeNil)
+					So(len(res.Sessions), ShouldEqual, 2)
+					So(res.TotalCount, ShouldNotBeNil)
+					So(res.TotalCount.Value, ShouldEqual, nb)
+				})
+			})
+			Convey("With limit equal to number of sessions", func() {
+				Convey("Should not return next page token", func() {
+					res, err := s.client.List(context.Background(), &mnemosynerpc.ListRequest{
+						Limit: int64(nb),
+					})
+
+					So(err, ShouldBeNil)
+					So(res.NextPageToken, ShouldBeEmpty)
+					So(res.TotalCount, ShouldBeNil)
+				})
+			})
 			Convey("With time range set very wide and maximum offset", func() {
 				Convey("Should return all possible sessions", func() {
 					from, err := ptypes.TimestampProto(time.Now().Add(-5 * time.Hour).UTC())
@@ -721,3 +912,771 @@ func TestSessionManager_List_postgresStore(t *testing.T) {
 		})
 	}))
 }
+
+func TestSessionManager_List_cluster_postgresStore(t *testing.T) {
+	factor := 3
+	nb := 20
+	Convey("List", t, WithE2ESuites(t, factor, func(s e2eSuites) {
+		Convey("Having sessions spread across the cluster", func() {
+			for i := 0; i < nb; i++ {
+				res, err := s[i%factor].client.Start(context.Background(), &mnemosynerpc.StartRequest{
+					Session: &mnemosynerpc.Session{SubjectId: strconv.Itoa(i)},
+				})
+				So(err, ShouldBeNil)
+				So(res, ShouldBeValidStartResponse, strconv.Itoa(i))
+			}
+			for i := 0; i < factor; i++ {
+				Convey(fmt.Sprintf("As node#%d", i), func() {
+					Convey("Should return ordered sessions from all nodes", func() {
+						res, err := s[i].client.List(context.Background(), &mnemosynerpc.ListRequest{
+							Limit:             int64(nb),
+							IncludeTotalCount: true,
+						})
+
+						So(err, ShouldBeNil)
+						So(res.Sessions, ShouldHaveLength, nb)
+						So(res.NextPageToken, ShouldBeEmpty)
+						So(res.GetTotalCount().GetValue(), ShouldEqual, nb)
+						for j := 1; j < len(res.Sessions); j++ {
+							prev, err := ptypes.Timestamp(res.Sessions[j-1].ExpireAt)
+							So(err, ShouldBeNil)
+							next, err := ptypes.Timestamp(res.Sessions[j].ExpireAt)
+							So(err, ShouldBeNil)
+							So(prev, ShouldHappenOnOrBefore, next)
+						}
+					})
+					Convey("Should iterate over all sessions using page token", func() {
+						seen := make(map[string]struct{}, nb)
+						req := &mnemosynerpc.ListRequest{Limit: 3}
+						for {
+							res, err := s[i].client.List(context.Background(), req)
+							So(err, ShouldBeNil)
+							So(len(res.Sessions), ShouldBeLessThanOrEqualTo, 3)
+
+							for _, ses := range res.Sessions {
+								So(seen, ShouldNotContainKey, ses.AccessToken)
+								seen[ses.AccessToken] = struct{}{}
+							}
+							if res.NextPageToken == "" {
+								break
+							}
+							req.PageToken = res.NextPageToken
+						}
+						So(len(seen), ShouldEqual, nb)
+					})
+					Convey("Should apply offset to merged result", func() {
+						all, err := s[i].client.List(context.Background(), &mnemosynerpc.ListRequest{Limit: int64(nb)})
+						So(err, ShouldBeNil)
+
+						res, err := s[i].client.List(context.Background(), &mnemosynerpc.ListRequest{Offset: 5, Limit: 5})
+						So(err, ShouldBeNil)
+						So(res.Sessions, ShouldHaveLength, 5)
+						for j, ses := range res.Sessions {
+							So(ses.AccessToken, ShouldEqual, all.Sessions[5+j].AccessToken)
+						}
+					})
+				})
+			}
+		})
+	}))
+}
+
+func TestSessionManager_Watch_postgresStore(t *testing.T) {
+	receive := func(stream mnemosynerpc.SessionManager_WatchClient) <-chan *mnemosynerpc.Event {
+		events := make(chan *mnemosynerpc.Event, 100)
+		go func() {
+			defer close(events)
+			for {
+				ev, err := stream.Recv()
+				if err != nil {
+					return
+				}
+				events <- ev
+			}
+		}()
+		return events
+	}
+	next := func(events <-chan *mnemosynerpc.Event) *mnemosynerpc.Event {
+		select {
+		case ev := <-events:
+			return ev
+		case <-time.After(5 * time.Second):
+			return nil
+		}
+	}
+
+	Convey("Watch", t, func() {
+		Convey("With single node", WithE2ESuite(t, func(s *e2eSuite) {
+			ctx, cancel := context.WithCancel(context.Background())
+			Reset(cancel)
+
+			stream, err := s.client.Watch(ctx, &mnemosynerpc.WatchRequest{SubjectId: "entity:1"})
+			So(err, ShouldBeNil)
+			// Headers are sent once subscription is established.
+			_, err = stream.Header()
+			So(err, ShouldBeNil)
+			events := receive(stream)
+
+			Convey("Should stream whole session lifecycle", func() {
+				// Session of another subject should be filtered out.
+				_, err := s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
+					Session: &mnemosynerpc.Session{SubjectId: "entity:2"},
+				})
+				So(err, ShouldBeNil)
+
+				res, err := s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
+					Session: &mnemosynerpc.Session{SubjectId: "entity:1"},
+				})
+				So(err, ShouldBeNil)
+				at := res.Session.AccessToken
+
+				_, err = s.client.SetValue(context.Background(), &mnemosynerpc.SetValueRequest{AccessToken: at, Key: "key", Value: "value"})
+				So(err, ShouldBeNil)
+				_, err = s.client.Abandon(context.Background(), &mnemosynerpc.AbandonRequest{AccessToken: at})
+				So(err, ShouldBeNil)
+
+				res, err = s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
+					Session: &mnemosynerpc.Session{SubjectId: "entity:1"},
+				})
+				So(err, ShouldBeNil)
+				_, err = s.client.Delete(context.Background(), &mnemosynerpc.DeleteRequest{SubjectId: "entity:1"})
+				So(err, ShouldBeNil)
+
+				expected := []mnemosynerpc.EventType{
+					mnemosynerpc.EventType_SESSION_STARTED,
+					mnemosynerpc.EventType_SESSION_VALUE_SET,
+					mnemosynerpc.EventType_SESSION_ABANDONED,
+					mnemosynerpc.EventType_SESSION_STARTED,
+					mnemosynerpc.EventType_SESSION_DELETED,
+				}
+				for _, typ := range expected {
+					ev := next(events)
+					So(ev, ShouldNotBeNil)
+					So(ev.Type, ShouldEqual, typ)
+					So(ev.Session.SubjectId, ShouldEqual, "entity:1")
+					So(ev.Node, ShouldEqual, s.daemon.Addr().String())
+					So(ev.OccurredAt, ShouldNotBeNil)
+				}
+			})
+		}))
+		Convey("With cluster", WithE2ESuites(t, 2, func(s e2eSuites) {
+			ctx, cancel := context.WithCancel(context.Background())
+			Reset(cancel)
+
+			stream, err := s[0].client.Watch(ctx, &mnemosynerpc.WatchRequest{
+				Types: []mnemosynerpc.EventType{mnemosynerpc.EventType_SESSION_STARTED},
+			})
+			So(err, ShouldBeNil)
+			events := receive(stream)
+
+			Convey("Should receive events emitted by other nodes", func() {
+				var remote *mnemosynerpc.Event
+			Loop:
+				for i := 0; i < 50; i++ {
+					_, err := s[1].client.Start(context.Background(), &mnemosynerpc.StartRequest{
+						Session: &mnemosynerpc.Session{SubjectId: strconv.Itoa(i)},
+					})
+					So(err, ShouldBeNil)
+
+					for {
+						select {
+						case ev := <-events:
+							if ev.Node == s[1].daemon.Addr().String() {
+								remote = ev
+								break Loop
+							}
+							continue
+						case <-time.After(100 * time.Millisecond):
+						}
+						break
+					}
+				}
+
+				So(remote, ShouldNotBeNil)
+				So(remote.Type, ShouldEqual, mnemosynerpc.EventType_SESSION_STARTED)
+			})
+		}))
+	})
+}
+
+func TestSessionManager_Refresh_postgresStore(t *testing.T) {
+	Convey("Refresh", t, func() {
+		Convey("With single node", WithE2ESuite(t, func(s *e2eSuite) {
+			Convey("With existing session", func() {
+				res, err := s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
+					Session: &mnemosynerpc.Session{
+						SubjectId:    "entity:1",
+						RefreshToken: "refresh-token",
+						Bag:          map[string]string{"key": "value"},
+					},
+				})
+				So(err, ShouldBeNil)
+				old := res.Session
+
+				Convey("Should rotate tokens", func() {
+					res, err := s.client.Refresh(context.Background(), &mnemosynerpc.RefreshRequest{RefreshToken: old.RefreshToken})
+					So(err, ShouldBeNil)
+					So(res.Session.AccessToken, ShouldNotBeEmpty)
+					So(res.Session.AccessToken, ShouldNotEqual, old.AccessToken)
+					So(res.Session.RefreshToken, ShouldNotBeEmpty)
+					So(res.Session.RefreshToken, ShouldNotEqual, old.RefreshToken)
+					So(res.Session.SubjectId, ShouldEqual, old.SubjectId)
+					So(res.Session.Bag, ShouldResemble, old.Bag)
+
+					_, err = s.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: old.AccessToken})
+					So(err, ShouldBeGRPCError(ShouldEqual), codes.NotFound, "mnemosyned: "+storage.ErrSessionNotFound.Error())
+					got, err := s.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: res.Session.AccessToken})
+					So(err, ShouldBeNil)
+					So(got.Session.SubjectId, ShouldEqual, old.SubjectId)
+
+					Convey("Reuse of rotated token should revoke whole family", func() {
+						_, err := s.client.Refresh(context.Background(), &mnemosynerpc.RefreshRequest{RefreshToken: old.RefreshToken})
+						So(err, ShouldBeGRPCError(ShouldEqual), codes.Unauthenticated, "mnemosyned: "+storage.ErrRefreshTokenReused.Error())
+
+						_, err = s.client.Refresh(context.Background(), &mnemosynerpc.RefreshRequest{RefreshToken: res.Session.RefreshToken})
+						So(err, ShouldBeGRPCError(ShouldEqual), codes.NotFound, "mnemosyned: "+storage.ErrSessionNotFound.Error())
+					})
+				})
+			})
+			Convey("With unknown refresh token", func() {
+				Convey("Should return not found gRPC error", func() {
+					res, err := s.client.Refresh(context.Background(), &mnemosynerpc.RefreshRequest{RefreshToken: "unknown"})
+
+					So(res, ShouldBeNil)
+					So(err, ShouldBeGRPCError(ShouldEqual), codes.NotFound, "mnemosyned: "+storage.ErrSessionNotFound.Error())
+				})
+			})
+			Convey("Without refresh token", func() {
+				Convey("Should return invalid argument gRPC error", func() {
+					res, err := s.client.Refresh(context.Background(), &mnemosynerpc.RefreshRequest{})
+
+					So(res, ShouldBeNil)
+					So(err, ShouldBeGRPCError(ShouldEqual), codes.InvalidArgument, status.Convert(errMissingRefreshToken).Message())
+				})
+			})
+		}))
+		Convey("With cluster", WithE2ESuites(t, 3, func(s e2eSuites) {
+			Convey("Should rotate tokens regardless of node that holds the session", func() {
+				for i := 0; i < 10; i++ {
+					rt := "refresh-token-" + strconv.Itoa(i)
+					res, err := s[0].client.Start(context.Background(), &mnemosynerpc.StartRequest{
+						Session: &mnemosynerpc.Session{SubjectId: strconv.Itoa(i), RefreshToken: rt},
+					})
+					So(err, ShouldBeNil)
+
+					ref, err := s[i%len(s)].client.Refresh(context.Background(), &mnemosynerpc.RefreshRequest{RefreshToken: rt})
+					So(err, ShouldBeNil)
+					So(ref.Session.SubjectId, ShouldEqual, res.Session.SubjectId)
+
+					got, err := s[0].client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: ref.Session.AccessToken})
+					So(err, ShouldBeNil)
+					So(got.Session.RefreshToken, ShouldEqual, ref.Session.RefreshToken)
+
+					_, err = s[(i+1)%len(s)].client.Refresh(context.Background(), &mnemosynerpc.RefreshRequest{RefreshToken: rt})
+					So(err, ShouldBeGRPCError(ShouldEqual), codes.Unauthenticated, "mnemosyned: "+storage.ErrRefreshTokenReused.Error())
+				}
+			})
+		}))
+	})
+}
+
+func TestSessionManager_ReadAfterWrite_postgresStore(t *testing.T) {
+	get := func(s *e2eSuite, accessToken string) (*mnemosynerpc.Session, error) {
+		res, err := s.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: accessToken})
+		return res.GetSession(), err
+	}
+	Convey("ReadAfterWrite", t, WithE2ESuite(t, func(s *e2eSuite) {
+		Convey("Having cached session", func() {
+			res, err := s.client.Start(context.Background(), &mnemosynerpc.StartRequest{
+				Session: &mnemosynerpc.Session{SubjectId: "entity:1"},
+			})
+			So(err, ShouldBeNil)
+			So(res, ShouldBeValidStartResponse, "entity:1")
+
+			accessToken := res.Session.AccessToken
+			_, err = get(s, accessToken)
+			So(err, ShouldBeNil)
+
+			Convey("Get should return value that was set", func() {
+				_, err := s.client.SetValue(context.Background(), &mnemosynerpc.SetValueRequest{
+					AccessToken: accessToken,
+					Key:         "key",
+					Value:       "value",
+				})
+				So(err, ShouldBeNil)
+
+				ses, err := get(s, accessToken)
+				So(err, ShouldBeNil)
+				So(ses.Bag, ShouldContainKey, "key")
+			})
+			Convey("Get should not return abandoned session", func() {
+				_, err := s.client.Abandon(context.Background(), &mnemosynerpc.AbandonRequest{AccessToken: accessToken})
+				So(err, ShouldBeNil)
+
+				_, err = get(s, accessToken)
+				So(err, ShouldBeGRPCError(ShouldEqual), codes.NotFound, "mnemosyned: "+storage.ErrSessionNotFound.Error())
+			})
+			Convey("Get should not return session deleted by subject", func() {
+				_, err := s.client.Delete(context.Background(), &mnemosynerpc.DeleteRequest{SubjectId: "entity:1"})
+				So(err, ShouldBeNil)
+
+				_, err = get(s, accessToken)
+				So(err, ShouldBeGRPCError(ShouldEqual), codes.NotFound, "mnemosyned: "+storage.ErrSessionNotFound.Error())
+			})
+		})
+	}))
+}
+
+func TestSessionManager_ReadAfterWrite_cluster_postgresStore(t *testing.T) {
+	factor := 3
+	nb := 6
+	Convey("ReadAfterWrite", t, WithE2ESuites(t, factor, func(s e2eSuites) {
+		Convey("Having sessions spread across the cluster and cached by their owners", func() {
+			tokens := make([]string, 0, nb)
+			for i := 0; i < nb; i++ {
+				res, err := s[i%factor].client.Start(context.Background(), &mnemosynerpc.StartRequest{
+					Session: &mnemosynerpc.Session{SubjectId: "entity:1"},
+				})
+				So(err, ShouldBeNil)
+				So(res, ShouldBeValidStartResponse, "entity:1")
+
+				tokens = append(tokens, res.Session.AccessToken)
+				for j := 0; j < factor; j++ {
+					_, err = s[j].client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: res.Session.AccessToken})
+					So(err, ShouldBeNil)
+				}
+			}
+
+			Convey("Every node should return value set through any other node", func() {
+				for i, at := range tokens {
+					_, err := s[i%factor].client.SetValue(context.Background(), &mnemosynerpc.SetValueRequest{
+						AccessToken: at,
+						Key:         "key",
+						Value:       strconv.Itoa(i),
+					})
+					So(err, ShouldBeNil)
+
+					for j := 0; j < factor; j++ {
+						res, err := s[j].client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: at})
+						So(err, ShouldBeNil)
+						So(res.Session.Bag, ShouldContainKey, "key")
+						So(res.Session.Bag["key"], ShouldEqual, strconv.Itoa(i))
+					}
+				}
+			})
+			Convey("No node should return session abandoned through any other node", func() {
+				for i, at := range tokens {
+					_, err := s[i%factor].client.Abandon(context.Background(), &mnemosynerpc.AbandonRequest{AccessToken: at})
+					So(err, ShouldBeNil)
+
+					for j := 0; j < factor; j++ {
+						_, err := s[j].client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: at})
+						So(status.Code(err), ShouldEqual, codes.NotFound)
+					}
+				}
+			})
+			for i := 0; i < factor; i++ {
+				Convey(fmt.Sprintf("No node should return sessions deleted through node#%d", i), func() {
+					_, err := s[i].client.Delete(context.Background(), &mnemosynerpc.DeleteRequest{SubjectId: "entity:1"})
+					So(err, ShouldBeNil)
+
+					for _, at := range tokens {
+						for j := 0; j < factor; j++ {
+							_, err := s[j].client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: at})
+							So(status.Code(err), ShouldEqual, codes.NotFound)
+						}
+					}
+				})
+			}
+		})
+	}))
+}
+
+func TestSessionManager_Handoff_postgresStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("e2e suite ignored in short mode")
+	}
+
+	var (
+		mu      sync.Mutex
+		members []string
+	)
+	catalog := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		services := make([]map[string]interface{}, 0, len(members))
+		for _, m := range members {
+			host, port, _ := net.SplitHostPort(m)
+			p, _ := strconv.Atoi(port)
+			services = append(services, map[string]interface{}{"ServiceAddress": host, "ServicePort": p})
+		}
+		json.NewEncoder(rw).Encode(services)
+	}))
+	defer catalog.Close()
+
+	nb := 30
+	Convey("Handoff", t, func() {
+		s := e2eSuites{}
+		for i := 0; i < 3; i++ {
+			s = append(s, &e2eSuite{listener: listenTCP(t), catalog: catalog.URL})
+		}
+		members = []string{s[0].listener.Addr().String(), s[1].listener.Addr().String()}
+		s[0].seeds, s[1].seeds = members, members
+		s[0].setup(t, 0)
+		s[1].setup(t, 1)
+
+		Reset(func() {
+			s.teardown(t)
+		})
+
+		tokens := make([]string, 0, nb)
+		for i := 0; i < nb; i++ {
+			res, err := s[i%2].client.Start(context.Background(), &mnemosynerpc.StartRequest{
+				Session: &mnemosynerpc.Session{SubjectId: "entity:1", Bag: map[string]string{"i": strconv.Itoa(i)}},
+			})
+			So(err, ShouldBeNil)
+			tokens = append(tokens, res.Session.AccessToken)
+		}
+
+		Convey("Once new node joins the cluster", func() {
+			mu.Lock()
+			members = append(members, s[2].listener.Addr().String())
+			s[2].seeds = members
+			mu.Unlock()
+			s[2].setup(t, 2)
+
+			addrs := append([]string{}, members...)
+			sort.Strings(addrs)
+
+			Convey("Every session should be moved to its new owner", func() {
+				owned := func() bool {
+					for _, at := range tokens {
+						owner := addrs[jump.HashString(at, len(addrs))]
+						for _, es := range s {
+							exists, err := es.daemon.storage.Exists(context.Background(), at)
+							So(err, ShouldBeNil)
+							if exists != (es.listener.Addr().String() == owner) {
+								return false
+							}
+						}
+					}
+					return true
+				}
+				deadline := time.Now().Add(5 * time.Second)
+				for !owned() && time.Now().Before(deadline) {
+					time.Sleep(50 * time.Millisecond)
+				}
+				So(owned(), ShouldBeTrue)
+
+				for i, at := range tokens {
+					for _, es := range s {
+						res, err := es.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: at})
+						So(err, ShouldBeNil)
+						So(res.Session.SubjectId, ShouldEqual, "entity:1")
+						So(res.Session.Bag["i"], ShouldEqual, strconv.Itoa(i))
+					}
+				}
+			})
+		})
+	})
+}
+
+func TestSessionManager_Replication_postgresStore(t *testing.T) {
+	if testing.Short() {
+		t.Skip("e2e suite ignored in short mode")
+	}
+
+	Convey("Replication", t, func() {
+		s := e2eSuites{}
+		for i := 0; i < 3; i++ {
+			s = append(s, &e2eSuite{listener: listenTCP(t), replication: 2})
+		}
+		addrs := make([]string, 0, len(s))
+		for _, es := range s {
+			addrs = append(addrs, es.listener.Addr().String())
+		}
+		for i, es := range s {
+			es.seeds = addrs
+			es.setup(t, i)
+		}
+		sort.Strings(addrs)
+
+		Reset(func() {
+			s.teardown(t)
+		})
+
+		// holders returns suites that hold given session, the owner first.
+		holders := func(at string) (res []*e2eSuite) {
+			owner := int(jump.HashString(at, len(addrs)))
+			for _, addr := range []string{addrs[owner], addrs[(owner+1)%len(addrs)]} {
+				for _, es := range s {
+					if es.listener.Addr().String() == addr {
+						res = append(res, es)
+					}
+				}
+			}
+			return res
+		}
+		stored := func(at string) (res []*e2eSuite) {
+			for _, es := range s {
+				exists, err := es.daemon.storage.Exists(context.Background(), at)
+				So(err, ShouldBeNil)
+				if exists {
+					res = append(res, es)
+				}
+			}
+			return res
+		}
+		// listening returns sorted addresses of given suites.
+		listening := func(suites []*e2eSuite) (res []string) {
+			for _, es := range suites {
+				res = append(res, es.listener.Addr().String())
+			}
+			sort.Strings(res)
+			return res
+		}
+		eventually := func(fn func() bool) bool {
+			deadline := time.Now().Add(5 * time.Second)
+			for !fn() && time.Now().Before(deadline) {
+				time.Sleep(50 * time.Millisecond)
+			}
+			return fn()
+		}
+
+		res, err := s[0].client.Start(context.Background(), &mnemosynerpc.StartRequest{
+			Session: &mnemosynerpc.Session{SubjectId: "entity:1", Bag: map[string]string{"key": "value"}},
+		})
+		So(err, ShouldBeNil)
+		at := res.Session.AccessToken
+
+		Convey("Started session should be held by the owner and its successor", func() {
+			So(listening(stored(at)), ShouldResemble, listening(holders(at)))
+		})
+		Convey("Value set should be written to every copy", func() {
+			_, err := s[2].client.SetValue(context.Background(), &mnemosynerpc.SetValueRequest{
+				AccessToken: at,
+				Key:         "key",
+				Value:       "changed",
+			})
+			So(err, ShouldBeNil)
+
+			for _, es := range holders(at) {
+				ses, err := es.daemon.storage.Get(context.Background(), at)
+				So(err, ShouldBeNil)
+				So(ses.Bag["key"], ShouldEqual, "changed")
+			}
+		})
+		Convey("Abandoned session should be removed from every node", func() {
+			_, err := s[1].client.Abandon(context.Background(), &mnemosynerpc.AbandonRequest{AccessToken: at})
+			So(err, ShouldBeNil)
+			So(stored(at), ShouldBeEmpty)
+		})
+		Convey("Once owner is gone, session should be read from its replica", func() {
+			owner := holders(at)[0]
+			owner.teardown(t)
+			for i, es := range s {
+				if es == owner {
+					s = append(s[:i:i], s[i+1:]...)
+					break
+				}
+			}
+
+			for _, es := range s {
+				res, err := es.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: at})
+				So(err, ShouldBeNil)
+				So(res.Session.Bag["key"], ShouldEqual, "value")
+			}
+		})
+		Convey("Once replica is gone, write should fail if quorum cannot be reached", func() {
+			replica := holders(at)[1]
+			replica.teardown(t)
+			for i, es := range s {
+				if es == replica {
+					s = append(s[:i:i], s[i+1:]...)
+					break
+				}
+			}
+
+			_, err := s[0].client.SetValue(context.Background(), &mnemosynerpc.SetValueRequest{
+				AccessToken: at,
+				Key:         "key",
+				Value:       "changed",
+			})
+			So(status.Code(err), ShouldEqual, codes.Unavailable)
+		})
+		Convey("Missing replica should be repaired on read", func() {
+			owner, replica := holders(at)[0], holders(at)[1]
+			_, err := replica.daemon.storage.Abandon(context.Background(), at)
+			So(err, ShouldBeNil)
+
+			_, err = owner.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: at})
+			So(err, ShouldBeNil)
+			So(eventually(func() bool { return len(stored(at)) == 2 }), ShouldBeTrue)
+			So(listening(stored(at)), ShouldResemble, listening(holders(at)))
+		})
+		Convey("Diverged replica should be repaired on read", func() {
+			owner, replica := holders(at)[0], holders(at)[1]
+			_, err := replica.daemon.storage.SetValue(context.Background(), at, "key", "diverged")
+			So(err, ShouldBeNil)
+
+			_, err = owner.client.Get(context.Background(), &mnemosynerpc.GetRequest{AccessToken: at})
+			So(err, ShouldBeNil)
+			So(eventually(func() bool {
+				ses, err := replica.daemon.storage.Get(context.Background(), at)
+				return err == nil && ses.Bag["key"] == "value"
+			}), ShouldBeTrue)
+		})
+	})
+}
+
+func TestSessionManager_PeerAuthentication_postgresStore(t *testing.T) {
+	Convey("PeerAuthentication", t, WithE2ESuite(t, func(s *e2eSuite) {
+		Convey("Client that pretends to be a node should not be able to handoff sessions", func() {
+			conn, err := grpc.Dial(s.listener.Addr().String(), grpc.WithInsecure(), grpc.WithUserAgent(constant.Subsystem+":spoofed"))
+			So(err, ShouldBeNil)
+			defer conn.Close()
+
+			stream, err := mnemosynerpc.NewSessionManagerClient(conn).Handoff(context.Background())
+			So(err, ShouldBeNil)
+			_, err = stream.CloseAndRecv()
+			So(status.Code(err), ShouldEqual, codes.PermissionDenied)
+		})
+		Convey("Request with forged peer signature should be rejected", func() {
+			ctx := metadata.AppendToOutgoingContext(context.Background(),
+				"mnemosyne-peer-addr", "127.0.0.1:1",
+				"mnemosyne-peer-time", strconv.FormatInt(time.Now().UnixNano(), 10),
+				"mnemosyne-hops", "1",
+				"mnemosyne-peer-signature", "forged",
+			)
+			_, err := s.client.Get(ctx, &mnemosynerpc.GetRequest{AccessToken: "access-token"})
+			So(status.Code(err), ShouldEqual, codes.Unauthenticated)
+		})
+	}))
+}
+
+func TestSessionManager_Gateway_postgresStore(t *testing.T) {
+	Convey("Gateway", t, WithE2ESuite(t, func(s *e2eSuite) {
+		call := func(method, path, authorization, body string) (int, interface{}) {
+			req, err := http.NewRequest(method, s.gateway+path, strings.NewReader(body))
+			So(err, ShouldBeNil)
+			if authorization != "" {
+				req.Header.Set("Authorization", authorization)
+			}
+			res, err := http.DefaultClient.Do(req)
+			So(err, ShouldBeNil)
+			defer res.Body.Close()
+
+			var payload interface{}
+			So(json.NewDecoder(res.Body).Decode(&payload), ShouldBeNil)
+			return res.StatusCode, payload
+		}
+
+		field := func(payload interface{}, path ...string) interface{} {
+			for _, key := range path {
+				payload = payload.(map[string]interface{})[key]
+			}
+			return payload
+		}
+
+		code, res := call(http.MethodPost, "/v1/sessions", "", `{"session": {"subject_id": "entity:1", "bag": {"key": "value"}}}`)
+		So(code, ShouldEqual, http.StatusOK)
+		session := field(res, "session").(map[string]interface{})
+		So(session["subject_id"], ShouldEqual, "entity:1")
+		accessToken := session["access_token"].(string)
+		So(accessToken, ShouldBeValidToken)
+
+		Convey("Get should return the session", func() {
+			code, res := call(http.MethodGet, "/v1/sessions/"+accessToken, "", "")
+			So(code, ShouldEqual, http.StatusOK)
+			So(field(res, "session", "bag"), ShouldResemble, map[string]interface{}{"key": "value"})
+		})
+		Convey("Context should accept bearer token", func() {
+			code, res := call(http.MethodGet, "/v1/context", "Bearer "+accessToken, "")
+			So(code, ShouldEqual, http.StatusOK)
+			So(field(res, "session", "access_token"), ShouldEqual, accessToken)
+		})
+		Convey("SetValue should change the bag", func() {
+			code, res := call(http.MethodPut, "/v1/sessions/"+accessToken+"/bag/key", "", `{"value": "changed"}`)
+			So(code, ShouldEqual, http.StatusOK)
+			So(field(res, "bag"), ShouldResemble, map[string]interface{}{"key": "changed"})
+		})
+		Convey("Abandon should remove the session", func() {
+			code, res := call(http.MethodDelete, "/v1/sessions/"+accessToken, "", "")
+			So(code, ShouldEqual, http.StatusOK)
+			// Wrapper types are encoded as plain JSON values.
+			So(res, ShouldBeTrue)
+
+			code, res = call(http.MethodGet, "/v1/sessions/"+accessToken+"/exists", "", "")
+			So(code, ShouldEqual, http.StatusOK)
+			So(res, ShouldBeFalse)
+		})
+		Convey("Unknown session should be reported as not found", func() {
+			code, res := call(http.MethodGet, "/v1/sessions/0000000000test", "", "")
+			So(code, ShouldEqual, http.StatusNotFound)
+			So(field(res, "error"), ShouldEqual, "mnemosyned: "+storage.ErrSessionNotFound.Error())
+			So(field(res, "code"), ShouldEqual, float64(codes.NotFound))
+		})
+		Convey("Missing bearer token should be reported as invalid argument", func() {
+			code, _ := call(http.MethodGet, "/v1/context", "", "")
+			So(code, ShouldEqual, http.StatusBadRequest)
+		})
+	}))
+}
+
+func TestSessionManager_expire(t *testing.T) {
+	store := memory.NewStorage(memory.StorageOpts{})
+	sm := &sessionManager{
+		storage:    store,
+		broker:     newBroker("127.0.0.1:8080"),
+		replicator: newReplicator(nil, 1, 0, zap.L()),
+	}
+	// Only some of the sessions are watched, so that the subscription keeps up.
+	sub, _ := sm.broker.subscribe(&mnemosynerpc.WatchRequest{SubjectId: "watched"}, false)
+
+	// Expired sessions span more than two pages.
+	nb, watched := 2*cleanupPageSize+1, 0
+	for i := 0; i < nb; i++ {
+		subjectID := "subject-id"
+		if i%100 == 0 {
+			subjectID = "watched"
+			watched++
+		}
+		if _, err := store.Start(context.Background(), strconv.Itoa(i), "", subjectID, "", nil, storage.StartOpts{IdleTimeout: time.Millisecond}); err != nil {
+			t.Fatalf("unexpected error: %s", err.Error())
+		}
+	}
+	if _, err := store.Start(context.Background(), "active", "", "watched", "", nil, storage.StartOpts{}); err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	announced := make(map[string]bool)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for ev := range sub.events {
+			announced[ev.Session.AccessToken] = true
+		}
+	}()
+
+	removed, err := sm.expire(context.Background(), time.Now())
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	sm.broker.close()
+	<-done
+
+	if removed != int64(nb) {
+		t.Errorf("wrong number of removed sessions, expected %d but got %d", nb, removed)
+	}
+	if len(announced) != watched {
+		t.Errorf("wrong number of announced sessions, expected %d but got %d", watched, len(announced))
+	}
+	if announced["active"] {
+		t.Error("active session should not be announced")
+	}
+	if exists, _ := store.Exists(context.Background(), "active"); !exists {
+		t.Error("active session should not be removed")
+	}
+}
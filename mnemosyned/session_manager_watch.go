@@ -0,0 +1,215 @@
+package mnemosyned
+
+import (
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/piotrkowalczuk/mnemosyne/internal/cluster"
+	"github.com/piotrkowalczuk/mnemosyne/mnemosynerpc"
+	"go.uber.org/zap"
+	"golang.org/x/net/context"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// relayRetryInterval is how long relay waits before it reconnects to a node it lost connection with.
+const relayRetryInterval = time.Second
+
+type sessionManagerWatch struct {
+	spanner
+
+	broker  *broker
+	cluster *cluster.Cluster
+	logger  *zap.Logger
+
+	// followersLock guards relay context, cancel functions of nodes that are followed and number of local watchers.
+	followersLock sync.Mutex
+	followersCtx  context.Context
+	followers     map[string]context.CancelFunc
+	watchers      int
+}
+
+func (smw *sessionManagerWatch) Watch(req *mnemosynerpc.WatchRequest, stream mnemosynerpc.SessionManager_WatchServer) error {
+	ctx := stream.Context()
+	span, ctx := smw.span(ctx, "session-manager.watch")
+	defer span.Finish()
+
+	// Other nodes of the cluster are interested only in local events, relaying them further would cause a loop.
+	internal := cluster.IsInternalRequest(ctx)
+	sub, ok := smw.broker.subscribe(req, internal)
+	if !ok {
+		return status.Errorf(codes.Unavailable, "mnemosyned: server is shutting down")
+	}
+	defer smw.broker.unsubscribe(sub)
+	if !internal {
+		smw.attach(ctx)
+		defer smw.detach()
+	}
+
+	// Headers let the client know that subscription is established.
+	if err := stream.SendHeader(metadata.MD{}); err != nil {
+		return err
+	}
+
+	for {
+		select {
+		case ev, ok := <-sub.events:
+			if !ok {
+				if sub.lagging {
+					return status.Errorf(codes.ResourceExhausted, "mnemosyned: watcher is not able to keep up with events")
+				}
+				return status.Errorf(codes.Unavailable, "mnemosyned: server is shutting down")
+			}
+			if err := stream.Send(ev); err != nil {
+				return err
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// relay enables relaying events of external nodes, they are republished locally.
+// Nodes are followed only while at least one client watches the current node,
+// otherwise nodes would keep each other watched and emit events nobody receives.
+// Relaying stops once given context is canceled.
+func (smw *sessionManagerWatch) relay(ctx context.Context) {
+	if smw.cluster == nil {
+		return
+	}
+
+	smw.followersLock.Lock()
+	smw.followersCtx = ctx
+	smw.followers = make(map[string]context.CancelFunc)
+	smw.followersLock.Unlock()
+}
+
+// attach registers a client that watches the current node, the first one starts following all external nodes.
+// It waits until they are followed, at most relayRetryInterval, so that events that happen right after are not missed.
+func (smw *sessionManagerWatch) attach(ctx context.Context) {
+	var ready []<-chan struct{}
+
+	smw.followersLock.Lock()
+	smw.watchers++
+	if smw.watchers == 1 && smw.followersCtx != nil {
+		for _, n := range smw.cluster.ExternalNodes() {
+			if r, ok := smw.start(n); ok {
+				ready = append(ready, r)
+			}
+		}
+	}
+	smw.followersLock.Unlock()
+
+	timeout := time.After(relayRetryInterval)
+	for _, r := range ready {
+		select {
+		case <-r:
+		case <-timeout:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// detach unregisters a client, the last one stops following external nodes.
+func (smw *sessionManagerWatch) detach() {
+	smw.followersLock.Lock()
+	defer smw.followersLock.Unlock()
+
+	smw.watchers--
+	if smw.watchers > 0 {
+		return
+	}
+	for addr, cancel := range smw.followers {
+		cancel()
+		delete(smw.followers, addr)
+	}
+}
+
+// join starts relaying events of a node, unless it is already followed or nobody watches the current node.
+func (smw *sessionManagerWatch) join(node *cluster.Node) {
+	smw.followersLock.Lock()
+	defer smw.followersLock.Unlock()
+
+	if smw.watchers > 0 {
+		smw.start(node)
+	}
+}
+
+// start follows given node, unless it is already followed or relay is not running.
+// Returned channel is closed once the first attempt to subscribe is over. It expects lock to be acquired.
+func (smw *sessionManagerWatch) start(node *cluster.Node) (<-chan struct{}, bool) {
+	if smw.followersCtx == nil {
+		return nil, false
+	}
+	if _, ok := smw.followers[node.Addr]; ok {
+		return nil, false
+	}
+
+	ctx, cancel := context.WithCancel(smw.followersCtx)
+	ready := make(chan struct{})
+	smw.followers[node.Addr] = cancel
+	go smw.follow(ctx, node, ready)
+
+	return ready, true
+}
+
+// leave stops relaying events of a node.
+func (smw *sessionManagerWatch) leave(node *cluster.Node) {
+	smw.followersLock.Lock()
+	defer smw.followersLock.Unlock()
+
+	if cancel, ok := smw.followers[node.Addr]; ok {
+		cancel()
+		delete(smw.followers, node.Addr)
+	}
+}
+
+func (smw *sessionManagerWatch) follow(ctx context.Context, node *cluster.Node, ready chan struct{}) {
+	var once sync.Once
+	done := func() { once.Do(func() { close(ready) }) }
+	defer done()
+
+	for {
+		err := smw.receive(ctx, node, done)
+		done()
+		if ctx.Err() != nil {
+			return
+		}
+		smw.logger.Debug("watch relay interrupted", zap.String("remote_addr", node.Addr), zap.Error(err))
+
+		select {
+		case <-time.After(relayRetryInterval):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// receive republishes events of given node until the stream breaks.
+// Given function is called once the node confirms the subscription.
+func (smw *sessionManagerWatch) receive(ctx context.Context, node *cluster.Node, subscribed func()) error {
+	if node.Client == nil {
+		return errors.New("node is not connected")
+	}
+
+	stream, err := node.Client.Watch(ctx, &mnemosynerpc.WatchRequest{}, grpc.WaitForReady(true))
+	if err != nil {
+		return err
+	}
+	if _, err := stream.Header(); err != nil {
+		return err
+	}
+	subscribed()
+	for {
+		ev, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		smw.broker.publish(ev, false)
+	}
+}
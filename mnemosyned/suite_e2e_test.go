@@ -52,9 +52,15 @@ func (es e2eSuites) teardown(t *testing.T) {
 }
 
 type e2eSuite struct {
-	listener   net.Listener
-	seeds      []string
-	daemon     *Daemon
+	listener net.Listener
+	seeds    []string
+	// catalog if set, cluster members are resolved using service catalog under given address.
+	catalog string
+	// replication is a number of nodes that hold a copy of each session.
+	replication int
+	daemon      *Daemon
+	// gateway is a base URL of HTTP/JSON gateway.
+	gateway    string
 	client     mnemosynerpc.SessionManagerClient
 	clientConn *grpc.ClientConn
 }
@@ -65,16 +71,23 @@ func (es *e2eSuite) setup(t *testing.T, i int) {
 	if es.listener == nil {
 		es.listener = listenTCP(t)
 	}
+	gatewayListener := listenTCP(t)
+	es.gateway = "http://" + gatewayListener.Addr().String()
 	es.daemon, err = NewDaemon(&DaemonOpts{
-		IsTest:            true,
-		RPCOptions:        []grpc.ServerOption{},
-		RPCListener:       es.listener,
-		Storage:           storage.EnginePostgres,
-		Logger:            zap.L(),
-		PostgresAddress:   testPostgresAddress,
-		PostgresSchema:    fmt.Sprintf("mnemosyne_test_%d", i),
-		ClusterListenAddr: es.listener.Addr().String(),
-		ClusterSeeds:      es.seeds,
+		IsTest:                   true,
+		RPCOptions:               []grpc.ServerOption{},
+		RPCListener:              es.listener,
+		GatewayListener:          gatewayListener,
+		Storage:                  storage.EnginePostgres,
+		Logger:                   zap.L(),
+		PostgresAddress:          testPostgresAddress,
+		PostgresSchema:           fmt.Sprintf("mnemosyne_test_%d", i),
+		ClusterListenAddr:        es.listener.Addr().String(),
+		ClusterSeeds:             es.seeds,
+		ClusterSecret:            testClusterSecret,
+		ClusterDiscoveryHTTP:     es.catalog,
+		ClusterDiscoveryInterval: 50 * time.Millisecond,
+		ReplicationFactor:        es.replication,
 	})
 	if err != nil {
 		t.Fatalf("unexpected deamon instantiation error: %s", err.Error())
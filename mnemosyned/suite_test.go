@@ -13,6 +13,9 @@ import (
 	"google.golang.org/grpc/status"
 )
 
+// testClusterSecret is shared by all daemons that form a cluster in tests.
+const testClusterSecret = "mnemosyned-test-secret"
+
 var (
 	testPostgresAddress string
 )
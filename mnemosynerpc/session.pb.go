@@ -9,9 +9,11 @@ import (
 	math "math"
 
 	proto "github.com/golang/protobuf/proto"
+	duration "github.com/golang/protobuf/ptypes/duration"
 	empty "github.com/golang/protobuf/ptypes/empty"
 	timestamp "github.com/golang/protobuf/ptypes/timestamp"
 	wrappers "github.com/golang/protobuf/ptypes/wrappers"
+	_ "google.golang.org/genproto/googleapis/api/annotations"
 	grpc "google.golang.org/grpc"
 	codes "google.golang.org/grpc/codes"
 	status "google.golang.org/grpc/status"
@@ -28,16 +30,62 @@ var _ = math.Inf
 // proto package needs to be updated.
 const _ = proto.ProtoPackageIsVersion3 // please upgrade the proto package
 
+type EventType int32
+
+const (
+	EventType_UNKNOWN_EVENT_TYPE EventType = 0
+	EventType_SESSION_STARTED    EventType = 1
+	EventType_SESSION_ABANDONED  EventType = 2
+	EventType_SESSION_DELETED    EventType = 3
+	EventType_SESSION_EXPIRED    EventType = 4
+	EventType_SESSION_VALUE_SET  EventType = 5
+	EventType_SESSION_REFRESHED  EventType = 6
+)
+
+var EventType_name = map[int32]string{
+	0: "UNKNOWN_EVENT_TYPE",
+	1: "SESSION_STARTED",
+	2: "SESSION_ABANDONED",
+	3: "SESSION_DELETED",
+	4: "SESSION_EXPIRED",
+	5: "SESSION_VALUE_SET",
+	6: "SESSION_REFRESHED",
+}
+
+var EventType_value = map[string]int32{
+	"UNKNOWN_EVENT_TYPE": 0,
+	"SESSION_STARTED":    1,
+	"SESSION_ABANDONED":  2,
+	"SESSION_DELETED":    3,
+	"SESSION_EXPIRED":    4,
+	"SESSION_VALUE_SET":  5,
+	"SESSION_REFRESHED":  6,
+}
+
+func (x EventType) String() string {
+	return proto.EnumName(EventType_name, int32(x))
+}
+
+func (EventType) EnumDescriptor() ([]byte, []int) {
+	return fileDescriptor_8d3beabaf79d2d7a, []int{0}
+}
+
 type Session struct {
-	AccessToken          string               `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
-	SubjectId            string               `protobuf:"bytes,2,opt,name=subject_id,json=subjectId,proto3" json:"subject_id,omitempty"`
-	SubjectClient        string               `protobuf:"bytes,3,opt,name=subject_client,json=subjectClient,proto3" json:"subject_client,omitempty"`
-	Bag                  map[string]string    `protobuf:"bytes,4,rep,name=bag,proto3" json:"bag,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
-	ExpireAt             *timestamp.Timestamp `protobuf:"bytes,5,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"`
-	RefreshToken         string               `protobuf:"bytes,6,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+	AccessToken   string               `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
+	SubjectId     string               `protobuf:"bytes,2,opt,name=subject_id,json=subjectId,proto3" json:"subject_id,omitempty"`
+	SubjectClient string               `protobuf:"bytes,3,opt,name=subject_client,json=subjectClient,proto3" json:"subject_client,omitempty"`
+	Bag           map[string]string    `protobuf:"bytes,4,rep,name=bag,proto3" json:"bag,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	ExpireAt      *timestamp.Timestamp `protobuf:"bytes,5,opt,name=expire_at,json=expireAt,proto3" json:"expire_at,omitempty"`
+	RefreshToken  string               `protobuf:"bytes,6,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	CreatedAt     *timestamp.Timestamp `protobuf:"bytes,7,opt,name=created_at,json=createdAt,proto3" json:"created_at,omitempty"`
+	// Absolute expire at is a deadline that session cannot be extended past, regardless of activity.
+	// It is not set if session lifetime is not limited.
+	AbsoluteExpireAt *timestamp.Timestamp `protobuf:"bytes,8,opt,name=absolute_expire_at,json=absoluteExpireAt,proto3" json:"absolute_expire_at,omitempty"`
+	// Idle timeout is a period of inactivity after which session expires.
+	IdleTimeout          *duration.Duration `protobuf:"bytes,9,opt,name=idle_timeout,json=idleTimeout,proto3" json:"idle_timeout,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
 }
 
 func (m *Session) Reset()         { *m = Session{} }
@@ -107,6 +155,27 @@ func (m *Session) GetRefreshToken() string {
 	return ""
 }
 
+func (m *Session) GetCreatedAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.CreatedAt
+	}
+	return nil
+}
+
+func (m *Session) GetAbsoluteExpireAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.AbsoluteExpireAt
+	}
+	return nil
+}
+
+func (m *Session) GetIdleTimeout() *duration.Duration {
+	if m != nil {
+		return m.IdleTimeout
+	}
+	return nil
+}
+
 type GetRequest struct {
 	AccessToken          string   `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -229,8 +298,14 @@ type ListRequest struct {
 	Offset int64 `protobuf:"varint,1,opt,name=offset,proto3" json:"offset,omitempty"`
 	// Limit tells how many entries should be returned.
 	// By default it's 10.
-	Limit                int64    `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
-	Query                *Query   `protobuf:"bytes,11,opt,name=query,proto3" json:"query,omitempty"`
+	Limit int64  `protobuf:"varint,2,opt,name=limit,proto3" json:"limit,omitempty"`
+	Query *Query `protobuf:"bytes,11,opt,name=query,proto3" json:"query,omitempty"`
+	// PageToken is a next_page_token returned by previous call.
+	// Sessions are ordered by expire_at and access_token, page token points to the last session seen.
+	// It cannot be combined with offset.
+	PageToken string `protobuf:"bytes,12,opt,name=page_token,json=pageToken,proto3" json:"page_token,omitempty"`
+	// IncludeTotalCount tells if total number of sessions matching the query should be returned.
+	IncludeTotalCount    bool     `protobuf:"varint,13,opt,name=include_total_count,json=includeTotalCount,proto3" json:"include_total_count,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
 	XXX_unrecognized     []byte   `json:"-"`
 	XXX_sizecache        int32    `json:"-"`
@@ -282,11 +357,29 @@ func (m *ListRequest) GetQuery() *Query {
 	return nil
 }
 
+func (m *ListRequest) GetPageToken() string {
+	if m != nil {
+		return m.PageToken
+	}
+	return ""
+}
+
+func (m *ListRequest) GetIncludeTotalCount() bool {
+	if m != nil {
+		return m.IncludeTotalCount
+	}
+	return false
+}
+
 type ListResponse struct {
-	Sessions             []*Session `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}   `json:"-"`
-	XXX_unrecognized     []byte     `json:"-"`
-	XXX_sizecache        int32      `json:"-"`
+	Sessions []*Session `protobuf:"bytes,1,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	// NextPageToken is empty if there are no more sessions to retrieve.
+	NextPageToken string `protobuf:"bytes,2,opt,name=next_page_token,json=nextPageToken,proto3" json:"next_page_token,omitempty"`
+	// TotalCount is set only if requested.
+	TotalCount           *wrappers.Int64Value `protobuf:"bytes,3,opt,name=total_count,json=totalCount,proto3" json:"total_count,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
+	XXX_unrecognized     []byte               `json:"-"`
+	XXX_sizecache        int32                `json:"-"`
 }
 
 func (m *ListResponse) Reset()         { *m = ListResponse{} }
@@ -321,13 +414,31 @@ func (m *ListResponse) GetSessions() []*Session {
 	return nil
 }
 
+func (m *ListResponse) GetNextPageToken() string {
+	if m != nil {
+		return m.NextPageToken
+	}
+	return ""
+}
+
+func (m *ListResponse) GetTotalCount() *wrappers.Int64Value {
+	if m != nil {
+		return m.TotalCount
+	}
+	return nil
+}
+
 type Query struct {
-	ExpireAtFrom         *timestamp.Timestamp `protobuf:"bytes,1,opt,name=expire_at_from,json=expireAtFrom,proto3" json:"expire_at_from,omitempty"`
-	ExpireAtTo           *timestamp.Timestamp `protobuf:"bytes,2,opt,name=expire_at_to,json=expireAtTo,proto3" json:"expire_at_to,omitempty"`
-	RefreshToken         string               `protobuf:"bytes,3,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
-	XXX_NoUnkeyedLiteral struct{}             `json:"-"`
-	XXX_unrecognized     []byte               `json:"-"`
-	XXX_sizecache        int32                `json:"-"`
+	ExpireAtFrom  *timestamp.Timestamp `protobuf:"bytes,1,opt,name=expire_at_from,json=expireAtFrom,proto3" json:"expire_at_from,omitempty"`
+	ExpireAtTo    *timestamp.Timestamp `protobuf:"bytes,2,opt,name=expire_at_to,json=expireAtTo,proto3" json:"expire_at_to,omitempty"`
+	RefreshToken  string               `protobuf:"bytes,3,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	SubjectId     string               `protobuf:"bytes,4,opt,name=subject_id,json=subjectId,proto3" json:"subject_id,omitempty"`
+	SubjectClient string               `protobuf:"bytes,5,opt,name=subject_client,json=subjectClient,proto3" json:"subject_client,omitempty"`
+	// Bag narrows down result to sessions that contain all given key/value pairs.
+	Bag                  map[string]string `protobuf:"bytes,6,rep,name=bag,proto3" json:"bag,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	XXX_NoUnkeyedLiteral struct{}          `json:"-"`
+	XXX_unrecognized     []byte            `json:"-"`
+	XXX_sizecache        int32             `json:"-"`
 }
 
 func (m *Query) Reset()         { *m = Query{} }
@@ -376,6 +487,27 @@ func (m *Query) GetRefreshToken() string {
 	return ""
 }
 
+func (m *Query) GetSubjectId() string {
+	if m != nil {
+		return m.SubjectId
+	}
+	return ""
+}
+
+func (m *Query) GetSubjectClient() string {
+	if m != nil {
+		return m.SubjectClient
+	}
+	return ""
+}
+
+func (m *Query) GetBag() map[string]string {
+	if m != nil {
+		return m.Bag
+	}
+	return nil
+}
+
 type ExistsRequest struct {
 	AccessToken          string   `protobuf:"bytes,1,opt,name=access_token,json=accessToken,proto3" json:"access_token,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -416,10 +548,15 @@ func (m *ExistsRequest) GetAccessToken() string {
 }
 
 type StartRequest struct {
-	Session              *Session `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
-	XXX_NoUnkeyedLiteral struct{} `json:"-"`
-	XXX_unrecognized     []byte   `json:"-"`
-	XXX_sizecache        int32    `json:"-"`
+	Session *Session `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	// Idle timeout overrides default time to live of the session.
+	IdleTimeout *duration.Duration `protobuf:"bytes,2,opt,name=idle_timeout,json=idleTimeout,proto3" json:"idle_timeout,omitempty"`
+	// Max lifetime limits how long session can be extended by its activity.
+	// By default session lifetime is not limited.
+	MaxLifetime          *duration.Duration `protobuf:"bytes,3,opt,name=max_lifetime,json=maxLifetime,proto3" json:"max_lifetime,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}           `json:"-"`
+	XXX_unrecognized     []byte             `json:"-"`
+	XXX_sizecache        int32              `json:"-"`
 }
 
 func (m *StartRequest) Reset()         { *m = StartRequest{} }
@@ -454,6 +591,20 @@ func (m *StartRequest) GetSession() *Session {
 	return nil
 }
 
+func (m *StartRequest) GetIdleTimeout() *duration.Duration {
+	if m != nil {
+		return m.IdleTimeout
+	}
+	return nil
+}
+
+func (m *StartRequest) GetMaxLifetime() *duration.Duration {
+	if m != nil {
+		return m.MaxLifetime
+	}
+	return nil
+}
+
 type StartResponse struct {
 	Session              *Session `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
 	XXX_NoUnkeyedLiteral struct{} `json:"-"`
@@ -697,7 +848,303 @@ func (m *DeleteRequest) GetSubjectId() string {
 	return ""
 }
 
+type WatchRequest struct {
+	SubjectId     string `protobuf:"bytes,1,opt,name=subject_id,json=subjectId,proto3" json:"subject_id,omitempty"`
+	SubjectClient string `protobuf:"bytes,2,opt,name=subject_client,json=subjectClient,proto3" json:"subject_client,omitempty"`
+	// Types narrows down stream to given event types. By default all events are streamed.
+	Types                []EventType `protobuf:"varint,3,rep,packed,name=types,proto3,enum=mnemosynerpc.EventType" json:"types,omitempty"`
+	XXX_NoUnkeyedLiteral struct{}    `json:"-"`
+	XXX_unrecognized     []byte      `json:"-"`
+	XXX_sizecache        int32       `json:"-"`
+}
+
+func (m *WatchRequest) Reset()         { *m = WatchRequest{} }
+func (m *WatchRequest) String() string { return proto.CompactTextString(m) }
+func (*WatchRequest) ProtoMessage()    {}
+func (*WatchRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8d3beabaf79d2d7a, []int{14}
+}
+
+func (m *WatchRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_WatchRequest.Unmarshal(m, b)
+}
+func (m *WatchRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_WatchRequest.Marshal(b, m, deterministic)
+}
+func (m *WatchRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_WatchRequest.Merge(m, src)
+}
+func (m *WatchRequest) XXX_Size() int {
+	return xxx_messageInfo_WatchRequest.Size(m)
+}
+func (m *WatchRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_WatchRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_WatchRequest proto.InternalMessageInfo
+
+func (m *WatchRequest) GetSubjectId() string {
+	if m != nil {
+		return m.SubjectId
+	}
+	return ""
+}
+
+func (m *WatchRequest) GetSubjectClient() string {
+	if m != nil {
+		return m.SubjectClient
+	}
+	return ""
+}
+
+func (m *WatchRequest) GetTypes() []EventType {
+	if m != nil {
+		return m.Types
+	}
+	return nil
+}
+
+type Event struct {
+	Type       EventType            `protobuf:"varint,1,opt,name=type,proto3,enum=mnemosynerpc.EventType" json:"type,omitempty"`
+	Session    *Session             `protobuf:"bytes,2,opt,name=session,proto3" json:"session,omitempty"`
+	OccurredAt *timestamp.Timestamp `protobuf:"bytes,3,opt,name=occurred_at,json=occurredAt,proto3" json:"occurred_at,omitempty"`
+	// Node is an address of the cluster node that emitted the event.
+	Node                 string   `protobuf:"bytes,4,opt,name=node,proto3" json:"node,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *Event) Reset()         { *m = Event{} }
+func (m *Event) String() string { return proto.CompactTextString(m) }
+func (*Event) ProtoMessage()    {}
+func (*Event) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8d3beabaf79d2d7a, []int{15}
+}
+
+func (m *Event) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_Event.Unmarshal(m, b)
+}
+func (m *Event) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_Event.Marshal(b, m, deterministic)
+}
+func (m *Event) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_Event.Merge(m, src)
+}
+func (m *Event) XXX_Size() int {
+	return xxx_messageInfo_Event.Size(m)
+}
+func (m *Event) XXX_DiscardUnknown() {
+	xxx_messageInfo_Event.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_Event proto.InternalMessageInfo
+
+func (m *Event) GetType() EventType {
+	if m != nil {
+		return m.Type
+	}
+	return EventType_UNKNOWN_EVENT_TYPE
+}
+
+func (m *Event) GetSession() *Session {
+	if m != nil {
+		return m.Session
+	}
+	return nil
+}
+
+func (m *Event) GetOccurredAt() *timestamp.Timestamp {
+	if m != nil {
+		return m.OccurredAt
+	}
+	return nil
+}
+
+func (m *Event) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+type RefreshRequest struct {
+	RefreshToken         string   `protobuf:"bytes,1,opt,name=refresh_token,json=refreshToken,proto3" json:"refresh_token,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RefreshRequest) Reset()         { *m = RefreshRequest{} }
+func (m *RefreshRequest) String() string { return proto.CompactTextString(m) }
+func (*RefreshRequest) ProtoMessage()    {}
+func (*RefreshRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8d3beabaf79d2d7a, []int{16}
+}
+
+func (m *RefreshRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RefreshRequest.Unmarshal(m, b)
+}
+func (m *RefreshRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RefreshRequest.Marshal(b, m, deterministic)
+}
+func (m *RefreshRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RefreshRequest.Merge(m, src)
+}
+func (m *RefreshRequest) XXX_Size() int {
+	return xxx_messageInfo_RefreshRequest.Size(m)
+}
+func (m *RefreshRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_RefreshRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RefreshRequest proto.InternalMessageInfo
+
+func (m *RefreshRequest) GetRefreshToken() string {
+	if m != nil {
+		return m.RefreshToken
+	}
+	return ""
+}
+
+type RefreshResponse struct {
+	Session              *Session `protobuf:"bytes,1,opt,name=session,proto3" json:"session,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *RefreshResponse) Reset()         { *m = RefreshResponse{} }
+func (m *RefreshResponse) String() string { return proto.CompactTextString(m) }
+func (*RefreshResponse) ProtoMessage()    {}
+func (*RefreshResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8d3beabaf79d2d7a, []int{17}
+}
+
+func (m *RefreshResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_RefreshResponse.Unmarshal(m, b)
+}
+func (m *RefreshResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_RefreshResponse.Marshal(b, m, deterministic)
+}
+func (m *RefreshResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_RefreshResponse.Merge(m, src)
+}
+func (m *RefreshResponse) XXX_Size() int {
+	return xxx_messageInfo_RefreshResponse.Size(m)
+}
+func (m *RefreshResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_RefreshResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_RefreshResponse proto.InternalMessageInfo
+
+func (m *RefreshResponse) GetSession() *Session {
+	if m != nil {
+		return m.Session
+	}
+	return nil
+}
+
+type HandoffRequest struct {
+	// Node is an address of the sender, it is enough to set it in the first message.
+	Node     string     `protobuf:"bytes,1,opt,name=node,proto3" json:"node,omitempty"`
+	Sessions []*Session `protobuf:"bytes,2,rep,name=sessions,proto3" json:"sessions,omitempty"`
+	// Ring is a checksum of cluster members, as seen by the sender.
+	Ring                 uint64   `protobuf:"varint,3,opt,name=ring,proto3" json:"ring,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HandoffRequest) Reset()         { *m = HandoffRequest{} }
+func (m *HandoffRequest) String() string { return proto.CompactTextString(m) }
+func (*HandoffRequest) ProtoMessage()    {}
+func (*HandoffRequest) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8d3beabaf79d2d7a, []int{18}
+}
+
+func (m *HandoffRequest) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HandoffRequest.Unmarshal(m, b)
+}
+func (m *HandoffRequest) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HandoffRequest.Marshal(b, m, deterministic)
+}
+func (m *HandoffRequest) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HandoffRequest.Merge(m, src)
+}
+func (m *HandoffRequest) XXX_Size() int {
+	return xxx_messageInfo_HandoffRequest.Size(m)
+}
+func (m *HandoffRequest) XXX_DiscardUnknown() {
+	xxx_messageInfo_HandoffRequest.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HandoffRequest proto.InternalMessageInfo
+
+func (m *HandoffRequest) GetNode() string {
+	if m != nil {
+		return m.Node
+	}
+	return ""
+}
+
+func (m *HandoffRequest) GetSessions() []*Session {
+	if m != nil {
+		return m.Sessions
+	}
+	return nil
+}
+
+func (m *HandoffRequest) GetRing() uint64 {
+	if m != nil {
+		return m.Ring
+	}
+	return 0
+}
+
+type HandoffResponse struct {
+	// Accepted is a number of sessions stored by the receiver.
+	Accepted             int64    `protobuf:"varint,1,opt,name=accepted,proto3" json:"accepted,omitempty"`
+	XXX_NoUnkeyedLiteral struct{} `json:"-"`
+	XXX_unrecognized     []byte   `json:"-"`
+	XXX_sizecache        int32    `json:"-"`
+}
+
+func (m *HandoffResponse) Reset()         { *m = HandoffResponse{} }
+func (m *HandoffResponse) String() string { return proto.CompactTextString(m) }
+func (*HandoffResponse) ProtoMessage()    {}
+func (*HandoffResponse) Descriptor() ([]byte, []int) {
+	return fileDescriptor_8d3beabaf79d2d7a, []int{19}
+}
+
+func (m *HandoffResponse) XXX_Unmarshal(b []byte) error {
+	return xxx_messageInfo_HandoffResponse.Unmarshal(m, b)
+}
+func (m *HandoffResponse) XXX_Marshal(b []byte, deterministic bool) ([]byte, error) {
+	return xxx_messageInfo_HandoffResponse.Marshal(b, m, deterministic)
+}
+func (m *HandoffResponse) XXX_Merge(src proto.Message) {
+	xxx_messageInfo_HandoffResponse.Merge(m, src)
+}
+func (m *HandoffResponse) XXX_Size() int {
+	return xxx_messageInfo_HandoffResponse.Size(m)
+}
+func (m *HandoffResponse) XXX_DiscardUnknown() {
+	xxx_messageInfo_HandoffResponse.DiscardUnknown(m)
+}
+
+var xxx_messageInfo_HandoffResponse proto.InternalMessageInfo
+
+func (m *HandoffResponse) GetAccepted() int64 {
+	if m != nil {
+		return m.Accepted
+	}
+	return 0
+}
+
 func init() {
+	proto.RegisterEnum("mnemosynerpc.EventType", EventType_name, EventType_value)
 	proto.RegisterType((*Session)(nil), "mnemosynerpc.Session")
 	proto.RegisterMapType((map[string]string)(nil), "mnemosynerpc.Session.BagEntry")
 	proto.RegisterType((*GetRequest)(nil), "mnemosynerpc.GetRequest")
@@ -706,6 +1153,7 @@ func init() {
 	proto.RegisterType((*ListRequest)(nil), "mnemosynerpc.ListRequest")
 	proto.RegisterType((*ListResponse)(nil), "mnemosynerpc.ListResponse")
 	proto.RegisterType((*Query)(nil), "mnemosynerpc.Query")
+	proto.RegisterMapType((map[string]string)(nil), "mnemosynerpc.Query.BagEntry")
 	proto.RegisterType((*ExistsRequest)(nil), "mnemosynerpc.ExistsRequest")
 	proto.RegisterType((*StartRequest)(nil), "mnemosynerpc.StartRequest")
 	proto.RegisterType((*StartResponse)(nil), "mnemosynerpc.StartResponse")
@@ -714,62 +1162,110 @@ func init() {
 	proto.RegisterType((*SetValueResponse)(nil), "mnemosynerpc.SetValueResponse")
 	proto.RegisterMapType((map[string]string)(nil), "mnemosynerpc.SetValueResponse.BagEntry")
 	proto.RegisterType((*DeleteRequest)(nil), "mnemosynerpc.DeleteRequest")
+	proto.RegisterType((*WatchRequest)(nil), "mnemosynerpc.WatchRequest")
+	proto.RegisterType((*Event)(nil), "mnemosynerpc.Event")
+	proto.RegisterType((*RefreshRequest)(nil), "mnemosynerpc.RefreshRequest")
+	proto.RegisterType((*RefreshResponse)(nil), "mnemosynerpc.RefreshResponse")
+	proto.RegisterType((*HandoffRequest)(nil), "mnemosynerpc.HandoffRequest")
+	proto.RegisterType((*HandoffResponse)(nil), "mnemosynerpc.HandoffResponse")
 }
 
 func init() { proto.RegisterFile("mnemosynerpc/session.proto", fileDescriptor_8d3beabaf79d2d7a) }
 
 var fileDescriptor_8d3beabaf79d2d7a = []byte{
-	// 790 bytes of a gzipped FileDescriptorProto
-	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xa4, 0x55, 0x4d, 0x4f, 0xeb, 0x46,
-	0x14, 0xc5, 0x71, 0xbe, 0xb8, 0x4e, 0x02, 0x9a, 0xb6, 0xc8, 0x75, 0x0a, 0xa5, 0xae, 0xaa, 0xd2,
-	0x8d, 0x4d, 0x43, 0x45, 0x3f, 0x84, 0x0a, 0x04, 0x52, 0x44, 0x3f, 0x16, 0x35, 0xa8, 0x8b, 0xaa,
-	0x52, 0xe4, 0x84, 0x49, 0x70, 0x63, 0x7b, 0x8c, 0x67, 0x52, 0x48, 0xf7, 0xef, 0xdf, 0xbc, 0xf5,
-	0x5b, 0xbc, 0x1f, 0xf6, 0xd6, 0x4f, 0x9e, 0x19, 0x87, 0xd8, 0x09, 0x3c, 0x02, 0xbb, 0x78, 0xee,
-	0x99, 0x7b, 0xef, 0xb9, 0x73, 0xce, 0x0d, 0x18, 0x41, 0x88, 0x03, 0x42, 0x27, 0x21, 0x8e, 0xa3,
-	0xbe, 0x4d, 0x31, 0xa5, 0x1e, 0x09, 0xad, 0x28, 0x26, 0x8c, 0xa0, 0xda, 0x6c, 0xcc, 0xf8, 0x7c,
-	0x48, 0xc8, 0xd0, 0xc7, 0x36, 0x8f, 0xf5, 0xc6, 0x03, 0x9b, 0x79, 0x01, 0xa6, 0xcc, 0x0d, 0x22,
-	0x01, 0x37, 0x9a, 0x79, 0x00, 0x0e, 0x22, 0x36, 0x91, 0xc1, 0xad, 0x7c, 0xf0, 0x36, 0x76, 0xa3,
-	0x08, 0xc7, 0x54, 0xc4, 0xcd, 0xb7, 0x05, 0xa8, 0x5c, 0x88, 0xea, 0xe8, 0x0b, 0xa8, 0xb9, 0xfd,
-	0x3e, 0xa6, 0xb4, 0xcb, 0xc8, 0x08, 0x87, 0xba, 0xb2, 0xad, 0xec, 0xac, 0x3a, 0x9a, 0x38, 0xbb,
-	0x4c, 0x8e, 0xd0, 0x26, 0x00, 0x1d, 0xf7, 0xfe, 0xc5, 0x7d, 0xd6, 0xf5, 0xae, 0xf4, 0x02, 0x07,
-	0xac, 0xca, 0x93, 0xf3, 0x2b, 0xf4, 0x15, 0x34, 0xd2, 0x70, 0xdf, 0xf7, 0x70, 0xc8, 0x74, 0x95,
-	0x43, 0xea, 0xf2, 0xf4, 0x84, 0x1f, 0xa2, 0x5d, 0x50, 0x7b, 0xee, 0x50, 0x2f, 0x6e, 0xab, 0x3b,
-	0x5a, 0x6b, 0xcb, 0x9a, 0xa5, 0x6b, 0xc9, 0x66, 0xac, 0xb6, 0x3b, 0xec, 0x84, 0x2c, 0x9e, 0x38,
-	0x09, 0x14, 0x7d, 0x0f, 0xab, 0xf8, 0x2e, 0xf2, 0x62, 0xdc, 0x75, 0x99, 0x5e, 0xda, 0x56, 0x76,
-	0xb4, 0x96, 0x61, 0x09, 0x6a, 0x56, 0x4a, 0xcd, 0xba, 0x4c, 0x07, 0xe3, 0x54, 0x05, 0xf8, 0x98,
-	0xa1, 0x2f, 0xa1, 0x1e, 0xe3, 0x41, 0x8c, 0xe9, 0xb5, 0x24, 0x55, 0xe6, 0x0d, 0xd5, 0xe4, 0x21,
-	0x67, 0x65, 0xec, 0x43, 0x35, 0x2d, 0x87, 0xd6, 0x41, 0x1d, 0xe1, 0x89, 0xe4, 0x9e, 0xfc, 0x44,
-	0x1f, 0x43, 0xe9, 0x3f, 0xd7, 0x1f, 0x63, 0x49, 0x57, 0x7c, 0xfc, 0x54, 0xf8, 0x41, 0x31, 0x6d,
-	0x80, 0x33, 0xcc, 0x1c, 0x7c, 0x33, 0xc6, 0x94, 0x3d, 0x61, 0x7c, 0xe6, 0xcf, 0xa0, 0xf1, 0x0b,
-	0x34, 0x22, 0x21, 0xc5, 0xc8, 0x86, 0x8a, 0x7c, 0x79, 0x0e, 0xd6, 0x5a, 0x9f, 0x2c, 0x9c, 0x85,
-	0x93, 0xa2, 0xcc, 0x36, 0xac, 0x9d, 0x90, 0x90, 0xe1, 0xbb, 0x17, 0xe4, 0xf0, 0x41, 0xfb, 0xdd,
-	0xa3, 0xd3, 0xae, 0x37, 0xa0, 0x4c, 0x06, 0x03, 0x8a, 0x19, 0xbf, 0xae, 0x3a, 0xf2, 0x2b, 0x61,
-	0xed, 0x7b, 0x81, 0xc7, 0x38, 0x6b, 0xd5, 0x11, 0x1f, 0xe8, 0x1b, 0x28, 0xdd, 0x8c, 0x71, 0x3c,
-	0xd1, 0x35, 0x5e, 0xeb, 0xa3, 0x6c, 0xad, 0x3f, 0x93, 0x90, 0x23, 0x10, 0xbf, 0x16, 0xab, 0xea,
-	0xba, 0x66, 0x1e, 0x43, 0x4d, 0x54, 0x93, 0xed, 0x7e, 0x0b, 0x55, 0xd9, 0x08, 0xd5, 0x15, 0xfe,
-	0xfe, 0x0f, 0xf4, 0x3b, 0x85, 0x99, 0xaf, 0x15, 0x28, 0xf1, 0xcc, 0xe8, 0x08, 0x1a, 0x53, 0x15,
-	0x74, 0x07, 0x31, 0x09, 0x24, 0xe5, 0xc7, 0xa4, 0x50, 0x4b, 0xa5, 0xf0, 0x4b, 0x4c, 0x02, 0x74,
-	0x00, 0xb5, 0xfb, 0x0c, 0x8c, 0x70, 0x72, 0x8f, 0xdf, 0x87, 0xf4, 0xfe, 0x25, 0x99, 0x17, 0x93,
-	0x3a, 0x2f, 0x26, 0xb3, 0x05, 0xf5, 0xce, 0x9d, 0x47, 0x19, 0x5d, 0x42, 0x17, 0x87, 0x50, 0xbb,
-	0x60, 0x6e, 0x3c, 0x7d, 0x94, 0xa5, 0x1f, 0xf5, 0x08, 0xea, 0x32, 0xc1, 0x73, 0x65, 0xb1, 0x07,
-	0x8d, 0xe3, 0x9e, 0x1b, 0x5e, 0x91, 0x70, 0x89, 0xbe, 0xff, 0x81, 0xb5, 0x0b, 0xcc, 0xfe, 0x4a,
-	0x0c, 0xf1, 0xf4, 0x5b, 0xa9, 0xc5, 0x0a, 0x0b, 0x2c, 0xa6, 0xce, 0x58, 0xcc, 0x7c, 0xa5, 0xc0,
-	0xfa, 0x7d, 0x7a, 0x49, 0xec, 0x47, 0xb1, 0x3b, 0x84, 0x76, 0xbe, 0xce, 0x93, 0xca, 0x82, 0xb3,
-	0x4b, 0xe4, 0xd9, 0x36, 0x7f, 0xa7, 0x40, 0xfd, 0x14, 0xfb, 0x98, 0x2d, 0x43, 0x72, 0x5e, 0xab,
-	0x85, 0x17, 0x6a, 0x55, 0x7d, 0x99, 0x56, 0x8b, 0xf3, 0x5a, 0xcd, 0xad, 0xf3, 0x52, 0x6e, 0x9d,
-	0xb7, 0xde, 0x14, 0xa1, 0x21, 0x85, 0xf2, 0x87, 0x1b, 0xba, 0x43, 0x1c, 0xa3, 0x03, 0x50, 0xcf,
-	0x30, 0x43, 0x7a, 0x76, 0xf0, 0xf7, 0x5b, 0xd0, 0xf8, 0x74, 0x41, 0x44, 0xbc, 0x86, 0xb9, 0x82,
-	0xda, 0x50, 0x91, 0xfb, 0x0b, 0x6d, 0xcc, 0xf1, 0xe8, 0x24, 0x7f, 0x5b, 0xc6, 0x66, 0xf6, 0x7e,
-	0x6e, 0xdd, 0x99, 0x2b, 0xe8, 0x10, 0x8a, 0xc9, 0x46, 0x41, 0xb9, 0x42, 0x33, 0x3b, 0xcd, 0x30,
-	0x16, 0x85, 0xa6, 0x09, 0x4e, 0xa0, 0x2c, 0x0c, 0x8a, 0x9a, 0x59, 0x5c, 0xc6, 0xb6, 0xc6, 0xfc,
-	0xa0, 0xdb, 0x84, 0xf8, 0x5c, 0x5f, 0x9c, 0x49, 0x89, 0x1b, 0x0e, 0xe5, 0x6a, 0xcd, 0xda, 0xd8,
-	0x68, 0x2e, 0x8c, 0x4d, 0x1b, 0xe9, 0x40, 0x45, 0x5a, 0x0e, 0x7d, 0x96, 0x45, 0x66, 0x9d, 0xf8,
-	0x81, 0x56, 0x7e, 0x83, 0x6a, 0x2a, 0x7c, 0xb4, 0xf9, 0x90, 0x21, 0x44, 0xa2, 0xad, 0xc7, 0xfd,
-	0x62, 0xae, 0xa0, 0x53, 0x28, 0x0b, 0xa9, 0xe7, 0x87, 0x93, 0x31, 0x80, 0xd1, 0x9c, 0xeb, 0xe8,
-	0x3c, 0x64, 0xfb, 0xdf, 0xc9, 0x96, 0xda, 0xad, 0xbf, 0x77, 0x87, 0x1e, 0xbb, 0x1e, 0xf7, 0xac,
-	0x3e, 0x09, 0xec, 0xc8, 0x23, 0x2c, 0x1e, 0x91, 0x5b, 0xd7, 0xef, 0xff, 0x3f, 0x1e, 0xd9, 0xd3,
-	0xb4, 0xf6, 0x6c, 0x81, 0x5e, 0x99, 0xa7, 0xda, 0x7b, 0x1f, 0x00, 0x00, 0xff, 0xff, 0x5e, 0xbf,
-	0x19, 0x91, 0x1a, 0x09, 0x00, 0x00,
+	// 1461 bytes of a gzipped FileDescriptorProto
+	0x1f, 0x8b, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x02, 0xff, 0xac, 0x57, 0xdb, 0x72, 0xd3, 0xd6,
+	0x1a, 0x46, 0x96, 0x9d, 0x38, 0xbf, 0x0f, 0x31, 0x2b, 0x1c, 0x84, 0x42, 0x20, 0x5b, 0x6c, 0xf6,
+	0xf6, 0xce, 0x1e, 0xec, 0x60, 0x5a, 0x5a, 0x28, 0xd3, 0xc1, 0xc1, 0x02, 0x42, 0x53, 0x43, 0x65,
+	0x73, 0x9c, 0xce, 0x68, 0x64, 0x79, 0xd9, 0x51, 0x63, 0x4b, 0x42, 0x5a, 0x86, 0xb8, 0x0c, 0x37,
+	0xed, 0xf4, 0x09, 0xfa, 0x10, 0xbc, 0x41, 0x6f, 0x78, 0x80, 0x3e, 0x40, 0xef, 0x7a, 0xdd, 0x67,
+	0xe8, 0x5d, 0x67, 0x3a, 0x6b, 0x69, 0xc9, 0x91, 0x6c, 0xc7, 0x4e, 0xa0, 0x77, 0xd6, 0x7f, 0xfe,
+	0xbf, 0xff, 0xb4, 0x0c, 0x72, 0xdf, 0xc6, 0x7d, 0xc7, 0x1f, 0xda, 0xd8, 0x73, 0xcd, 0xb2, 0x8f,
+	0x7d, 0xdf, 0x72, 0xec, 0x92, 0xeb, 0x39, 0xc4, 0x41, 0xd9, 0x28, 0x4f, 0xbe, 0xd8, 0x75, 0x9c,
+	0x6e, 0x0f, 0x97, 0x19, 0xaf, 0x35, 0xe8, 0x94, 0x89, 0xd5, 0xc7, 0x3e, 0x31, 0xfa, 0x6e, 0x20,
+	0x2e, 0x5f, 0x18, 0x17, 0x68, 0x0f, 0x3c, 0x83, 0x8c, 0xcc, 0xc9, 0xab, 0xe3, 0x7c, 0xdc, 0x77,
+	0xc9, 0xf0, 0x30, 0xe5, 0xd7, 0x9e, 0xe1, 0xba, 0xd8, 0xf3, 0x39, 0xff, 0x3c, 0xe7, 0x1b, 0xae,
+	0x55, 0x36, 0x6c, 0xdb, 0x21, 0xcc, 0x32, 0xe7, 0x2a, 0x7f, 0x89, 0xb0, 0xd8, 0x08, 0x62, 0x47,
+	0xff, 0x82, 0xac, 0x61, 0x9a, 0xd8, 0xf7, 0x75, 0xe2, 0xec, 0x61, 0x5b, 0x12, 0xd6, 0x85, 0xe2,
+	0x92, 0x96, 0x09, 0x68, 0x4d, 0x4a, 0x42, 0x6b, 0x00, 0xfe, 0xa0, 0xf5, 0x1d, 0x36, 0x89, 0x6e,
+	0xb5, 0xa5, 0x04, 0x13, 0x58, 0xe2, 0x94, 0xed, 0x36, 0xba, 0x0c, 0xf9, 0x90, 0x6d, 0xf6, 0x2c,
+	0x6c, 0x13, 0x49, 0x64, 0x22, 0x39, 0x4e, 0xbd, 0xc3, 0x88, 0x68, 0x13, 0xc4, 0x96, 0xd1, 0x95,
+	0x92, 0xeb, 0x62, 0x31, 0x53, 0xb9, 0x50, 0x8a, 0x82, 0x55, 0xe2, 0xc1, 0x94, 0xb6, 0x8c, 0xae,
+	0x6a, 0x13, 0x6f, 0xa8, 0x51, 0x51, 0xf4, 0x19, 0x2c, 0xe1, 0x7d, 0xd7, 0xf2, 0xb0, 0x6e, 0x10,
+	0x29, 0xb5, 0x2e, 0x14, 0x33, 0x15, 0xb9, 0x14, 0x24, 0x56, 0x0a, 0x13, 0x2f, 0x35, 0x43, 0x58,
+	0xb5, 0x74, 0x20, 0x5c, 0x25, 0xe8, 0x12, 0xe4, 0x3c, 0xdc, 0xf1, 0xb0, 0xbf, 0xcb, 0x93, 0x5a,
+	0x60, 0x01, 0x65, 0x39, 0x31, 0xc8, 0xea, 0x06, 0x80, 0xe9, 0x61, 0x83, 0xe0, 0x36, 0x35, 0xbf,
+	0x38, 0xd7, 0xfc, 0x12, 0x97, 0xae, 0x12, 0x74, 0x1f, 0x90, 0xd1, 0xf2, 0x9d, 0xde, 0x80, 0x60,
+	0xfd, 0x20, 0xc2, 0xf4, 0x5c, 0x13, 0x85, 0x50, 0x4b, 0x0d, 0x23, 0xbd, 0x05, 0x59, 0xab, 0xdd,
+	0xc3, 0x3a, 0x6d, 0x0e, 0x67, 0x40, 0xa4, 0x25, 0x66, 0xe3, 0xdc, 0x84, 0x8d, 0x1a, 0xef, 0x0d,
+	0x2d, 0x43, 0xc5, 0x9b, 0x81, 0xb4, 0x7c, 0x1d, 0xd2, 0x21, 0x62, 0xa8, 0x00, 0xe2, 0x1e, 0x1e,
+	0xf2, 0xf2, 0xd1, 0x9f, 0xe8, 0x14, 0xa4, 0x5e, 0x19, 0xbd, 0x01, 0xe6, 0x15, 0x0b, 0x3e, 0x6e,
+	0x26, 0x3e, 0x17, 0x94, 0x32, 0xc0, 0x3d, 0x4c, 0x34, 0xfc, 0x72, 0x80, 0x7d, 0x72, 0x84, 0x0e,
+	0x50, 0xbe, 0x84, 0x0c, 0x53, 0xf0, 0x5d, 0xc7, 0xf6, 0x31, 0x2a, 0xc3, 0x22, 0x6f, 0x7d, 0x26,
+	0x9c, 0xa9, 0x9c, 0x9e, 0x5a, 0x4e, 0x2d, 0x94, 0x52, 0xb6, 0x60, 0xf9, 0x8e, 0x63, 0x13, 0xbc,
+	0xff, 0x11, 0x36, 0xde, 0x0b, 0x90, 0xd9, 0xb1, 0xfc, 0x51, 0xd8, 0x67, 0x60, 0xc1, 0xe9, 0x74,
+	0x7c, 0x4c, 0x98, 0xbe, 0xa8, 0xf1, 0x2f, 0x9a, 0x76, 0xcf, 0xea, 0x5b, 0x84, 0xa5, 0x2d, 0x6a,
+	0xc1, 0x07, 0xfa, 0x1f, 0xa4, 0x5e, 0x0e, 0xb0, 0x37, 0x94, 0x32, 0xcc, 0xd9, 0x4a, 0xdc, 0xd9,
+	0x37, 0x94, 0xa5, 0x05, 0x12, 0xb4, 0xdd, 0x5d, 0xa3, 0x8b, 0x39, 0x1a, 0xd9, 0xa0, 0xdd, 0x29,
+	0x25, 0xe8, 0x9b, 0x12, 0xac, 0x58, 0xb6, 0xd9, 0x1b, 0xb4, 0xa9, 0x04, 0x31, 0x7a, 0xba, 0xe9,
+	0x0c, 0x6c, 0x22, 0xe5, 0xd6, 0x85, 0x62, 0x5a, 0x3b, 0xc9, 0x59, 0x4d, 0xca, 0xb9, 0x43, 0x19,
+	0x0f, 0x92, 0x69, 0xb1, 0x90, 0x51, 0xde, 0x09, 0x90, 0x0d, 0xa2, 0xe7, 0xf9, 0x5f, 0x85, 0x34,
+	0xcf, 0xcc, 0x97, 0x84, 0x75, 0xf1, 0x70, 0x00, 0x46, 0x62, 0xe8, 0x3f, 0xb0, 0x6c, 0xe3, 0x7d,
+	0xa2, 0x47, 0xa2, 0x0b, 0x4a, 0x9b, 0xa3, 0xe4, 0x47, 0xa3, 0x08, 0x6f, 0x41, 0x26, 0x1a, 0x99,
+	0xc8, 0x32, 0x5e, 0x9d, 0xe8, 0xa9, 0x6d, 0x9b, 0x5c, 0xff, 0xe4, 0x09, 0x6d, 0x0a, 0x0d, 0xc8,
+	0x28, 0x5e, 0xe5, 0xf7, 0x04, 0xa4, 0x18, 0x1e, 0xe8, 0x36, 0xe4, 0x47, 0xdd, 0xad, 0x77, 0x3c,
+	0xa7, 0x2f, 0x09, 0x73, 0x5b, 0x3c, 0x1b, 0x0e, 0xe1, 0x5d, 0xcf, 0xe9, 0xd3, 0xf6, 0x3e, 0xb0,
+	0x40, 0x1c, 0x29, 0x31, 0x57, 0x1f, 0x42, 0xfd, 0xa6, 0x33, 0x39, 0xc6, 0xe2, 0x94, 0x31, 0x8e,
+	0x2f, 0xa7, 0xe4, 0xfc, 0xe5, 0x94, 0x9a, 0xb6, 0x9c, 0x4a, 0xc1, 0x72, 0x5a, 0x60, 0x85, 0x38,
+	0x3f, 0xa5, 0x39, 0xe2, 0xab, 0xe9, 0x83, 0x27, 0xaf, 0x02, 0x39, 0x75, 0xdf, 0xf2, 0x89, 0x7f,
+	0x8c, 0xe1, 0x7b, 0x2f, 0x40, 0xb6, 0x41, 0x0c, 0x6f, 0xd4, 0xf9, 0xc7, 0x1d, 0x9d, 0x89, 0x2d,
+	0x93, 0x38, 0xce, 0x96, 0xa1, 0xda, 0x7d, 0x63, 0x5f, 0xef, 0x59, 0x1d, 0x4c, 0x0d, 0x48, 0xe2,
+	0x5c, 0xed, 0xbe, 0xb1, 0xbf, 0xc3, 0xa5, 0x95, 0xdb, 0x90, 0xe3, 0xc1, 0x7f, 0xe8, 0xe0, 0x5f,
+	0x83, 0x7c, 0xb5, 0x65, 0xd8, 0x6d, 0xc7, 0x3e, 0x06, 0x68, 0xdf, 0xc2, 0x72, 0x03, 0x93, 0xa0,
+	0xbb, 0x8f, 0xac, 0x15, 0x96, 0x32, 0x31, 0xa5, 0x94, 0x62, 0xa4, 0x94, 0xca, 0x4f, 0x02, 0x14,
+	0x0e, 0xcc, 0xf3, 0xc4, 0x6e, 0x04, 0x3d, 0x14, 0x0c, 0xf3, 0x7f, 0xc7, 0x93, 0x8a, 0x0b, 0xff,
+	0x43, 0xed, 0xf4, 0xa7, 0x00, 0xb9, 0x1a, 0xee, 0x61, 0x72, 0x9c, 0x24, 0x27, 0xc7, 0x3a, 0xf1,
+	0x91, 0x63, 0x2d, 0x7e, 0xdc, 0x58, 0x27, 0xe7, 0x8e, 0x75, 0x6a, 0x6c, 0xac, 0x95, 0x1f, 0x05,
+	0xc8, 0x3e, 0x35, 0x88, 0xb9, 0x1b, 0xe6, 0x1d, 0x97, 0x17, 0xe6, 0xaf, 0x81, 0xc4, 0xb4, 0x35,
+	0x70, 0x05, 0x52, 0x64, 0xe8, 0x62, 0x5f, 0x12, 0xd7, 0xc5, 0x62, 0xbe, 0x72, 0x36, 0x5e, 0x44,
+	0xf5, 0x15, 0xb6, 0x49, 0x73, 0xe8, 0x62, 0x2d, 0x90, 0x52, 0x7e, 0x11, 0x20, 0xc5, 0x88, 0xe8,
+	0xff, 0x90, 0xa4, 0x24, 0xe6, 0x78, 0x86, 0x1e, 0x13, 0x8a, 0x4e, 0x40, 0xe2, 0x48, 0xf3, 0xfb,
+	0x05, 0x64, 0x1c, 0xd3, 0x1c, 0x78, 0x5e, 0xf0, 0x56, 0x39, 0x02, 0xdc, 0xa1, 0x78, 0x95, 0x20,
+	0x04, 0x49, 0xdb, 0x69, 0x63, 0x8e, 0x32, 0xfb, 0xad, 0x7c, 0x0a, 0x79, 0x2d, 0x40, 0x3b, 0xc4,
+	0x6f, 0xa2, 0x28, 0xc2, 0x64, 0x51, 0xe8, 0x19, 0x1f, 0xa9, 0x7d, 0xe8, 0x34, 0xef, 0x41, 0xfe,
+	0x3e, 0x1d, 0xe6, 0x4e, 0x27, 0x74, 0x1d, 0x06, 0x28, 0x1c, 0x04, 0x18, 0xbb, 0x8e, 0x89, 0xa3,
+	0x5d, 0x47, 0x04, 0x49, 0xcf, 0xb2, 0xbb, 0x0c, 0x9d, 0xa4, 0xc6, 0x7e, 0x2b, 0x57, 0x60, 0x79,
+	0xe4, 0x8c, 0x07, 0x2c, 0x43, 0x9a, 0x0e, 0x83, 0x4b, 0x70, 0x9b, 0x3f, 0x1c, 0x46, 0xdf, 0x1b,
+	0xef, 0x04, 0x58, 0x1a, 0x15, 0x0b, 0x9d, 0x01, 0xf4, 0xb8, 0xfe, 0x55, 0xfd, 0xe1, 0xd3, 0xba,
+	0xae, 0x3e, 0x51, 0xeb, 0x4d, 0xbd, 0xf9, 0xfc, 0x91, 0x5a, 0x38, 0x81, 0x56, 0x60, 0xb9, 0xa1,
+	0x36, 0x1a, 0xdb, 0x0f, 0xeb, 0x7a, 0xa3, 0x59, 0xd5, 0x9a, 0x6a, 0xad, 0x20, 0xa0, 0xd3, 0x70,
+	0x32, 0x24, 0x56, 0xb7, 0xaa, 0xf5, 0xda, 0xc3, 0xba, 0x5a, 0x2b, 0x24, 0xa2, 0xb2, 0x35, 0x75,
+	0x47, 0xa5, 0xb2, 0x62, 0x94, 0xa8, 0x3e, 0x7b, 0xb4, 0xad, 0xa9, 0xb5, 0x42, 0x32, 0x6a, 0xe0,
+	0x49, 0x75, 0xe7, 0xb1, 0xaa, 0x37, 0xd4, 0x66, 0x21, 0x15, 0x25, 0x6b, 0xea, 0x5d, 0x4d, 0x6d,
+	0xdc, 0x57, 0x6b, 0x85, 0x85, 0xca, 0xaf, 0x69, 0xc8, 0x73, 0x08, 0xbe, 0x36, 0x6c, 0xa3, 0x8b,
+	0x3d, 0xa4, 0x83, 0x78, 0x0f, 0x13, 0x24, 0xc5, 0x71, 0x3a, 0x78, 0xe7, 0xc9, 0xe7, 0xa6, 0x70,
+	0x02, 0x50, 0x94, 0x4b, 0x3f, 0xfc, 0xf6, 0xc7, 0xcf, 0x89, 0x35, 0xb4, 0x5a, 0x7e, 0x75, 0x35,
+	0xfc, 0x57, 0xe3, 0x97, 0xdf, 0x44, 0x37, 0xc9, 0x5b, 0xf4, 0x18, 0x16, 0xf9, 0x23, 0x0e, 0x9d,
+	0x99, 0xe8, 0x3d, 0x95, 0xfe, 0x39, 0x91, 0xd7, 0xe2, 0x2e, 0xc6, 0xde, 0x7c, 0xca, 0x0a, 0x73,
+	0x93, 0x43, 0x19, 0xea, 0xc6, 0xe4, 0xb6, 0xfa, 0x90, 0xa4, 0x0f, 0x23, 0x34, 0x16, 0x5e, 0xe4,
+	0xa9, 0x27, 0xcb, 0xd3, 0x58, 0xdc, 0x66, 0x89, 0xd9, 0x2c, 0xa2, 0x6c, 0x34, 0xf4, 0x17, 0x92,
+	0xb2, 0x12, 0x4b, 0xc5, 0xc7, 0x86, 0x67, 0xee, 0xde, 0x14, 0x36, 0x50, 0x1f, 0x16, 0x82, 0x0b,
+	0x8c, 0x56, 0xc7, 0xa6, 0x34, 0x7a, 0x97, 0xe5, 0xc9, 0xe9, 0xda, 0x72, 0x9c, 0x1e, 0xdb, 0xe1,
+	0xca, 0x06, 0x73, 0xf9, 0x6f, 0xa4, 0xcc, 0x40, 0xab, 0x8c, 0x03, 0x27, 0xcf, 0x21, 0xc5, 0xce,
+	0x1f, 0x1a, 0xcb, 0x21, 0x7a, 0xd0, 0xe5, 0xd5, 0xa9, 0x3c, 0x9e, 0xe0, 0x59, 0xe6, 0xed, 0xa4,
+	0x12, 0x4b, 0x90, 0x66, 0xb2, 0x0b, 0x8b, 0xfc, 0x2e, 0xa2, 0xb1, 0x17, 0x4b, 0xfc, 0x5c, 0xce,
+	0xcc, 0x85, 0x57, 0x7e, 0x63, 0x66, 0xe5, 0xdf, 0x40, 0x3a, 0x3c, 0x60, 0x68, 0xed, 0xb0, 0xc3,
+	0x16, 0xf8, 0xba, 0x30, 0xfb, 0xee, 0x29, 0x9b, 0xcc, 0xdf, 0x86, 0x7c, 0x79, 0x16, 0x76, 0x2d,
+	0xa3, 0x5b, 0x7e, 0xb3, 0x87, 0x87, 0x6f, 0x69, 0x9a, 0xcf, 0x60, 0x21, 0x38, 0x71, 0xe3, 0x05,
+	0x8b, 0x1d, 0x3e, 0x79, 0xd6, 0xfb, 0x56, 0x39, 0xc5, 0xbc, 0xe6, 0x37, 0x62, 0x18, 0xa2, 0x3a,
+	0xa4, 0xd8, 0x0d, 0x19, 0xaf, 0x4d, 0xf4, 0xb0, 0xc8, 0x2b, 0x53, 0x76, 0xb9, 0x82, 0x98, 0xbd,
+	0x2c, 0x02, 0x6a, 0x0f, 0x53, 0x92, 0xbf, 0x29, 0xa0, 0x2e, 0x2c, 0xf2, 0xf5, 0x38, 0x5e, 0x90,
+	0xf8, 0xb2, 0x95, 0xd7, 0x0e, 0xe1, 0x72, 0x8c, 0x2e, 0x32, 0xeb, 0xe7, 0x94, 0x53, 0x31, 0x8c,
+	0xf8, 0x26, 0xa6, 0x90, 0x3c, 0x80, 0x45, 0xbe, 0xd6, 0xc6, 0x1d, 0xc5, 0x57, 0xab, 0xbc, 0x76,
+	0x08, 0x97, 0x3b, 0x3a, 0x51, 0x14, 0xb6, 0x2a, 0x2f, 0x36, 0xbb, 0x16, 0xd9, 0x1d, 0xb4, 0x4a,
+	0xa6, 0xd3, 0x2f, 0xbb, 0x96, 0x43, 0xbc, 0x3d, 0xe7, 0xb5, 0xd1, 0x33, 0xbf, 0x1f, 0xec, 0x95,
+	0x47, 0xda, 0xe5, 0xa8, 0x9d, 0xd6, 0x02, 0xc3, 0xf8, 0xda, 0xdf, 0x03, 0x00, 0x02, 0x95, 0x33,
+	0x56, 0x0e, 0x11, 0x00, 0x00,
 }
 
 // Reference imports to suppress errors if they are not otherwise used.
@@ -787,7 +1283,7 @@ type SessionManagerClient interface {
 	// Get retrieves session for given access token.
 	Get(ctx context.Context, in *GetRequest, opts ...grpc.CallOption) (*GetResponse, error)
 	// Context works like Get but takes access token from metadata within context.
-	// It expects "authorization" key to be present within metadata.
+	// It expects "authorization" key to be present within metadata, "Bearer" scheme is optional.
 	Context(ctx context.Context, in *empty.Empty, opts ...grpc.CallOption) (*ContextResponse, error)
 	List(ctx context.Context, in *ListRequest, opts ...grpc.CallOption) (*ListResponse, error)
 	Exists(ctx context.Context, in *ExistsRequest, opts ...grpc.CallOption) (*wrappers.BoolValue, error)
@@ -795,6 +1291,17 @@ type SessionManagerClient interface {
 	Abandon(ctx context.Context, in *AbandonRequest, opts ...grpc.CallOption) (*wrappers.BoolValue, error)
 	SetValue(ctx context.Context, in *SetValueRequest, opts ...grpc.CallOption) (*SetValueResponse, error)
 	Delete(ctx context.Context, in *DeleteRequest, opts ...grpc.CallOption) (*wrappers.Int64Value, error)
+	// Watch streams session lifecycle events.
+	// Events that happen on any node of the cluster are delivered, so it's enough to subscribe to a single one.
+	Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (SessionManager_WatchClient, error)
+	// Refresh abandons session that holds given refresh token and starts a new one with the same subject and bag.
+	// Refresh token can be used only once, if an already rotated token is presented again,
+	// the whole family of sessions that descend from it is revoked.
+	Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error)
+	// Handoff is an internal call, that transfers sessions to their new owner once cluster topology changes.
+	// Successfully closed stream means that the sender has no more sessions that belong to the receiver.
+	// It is not exposed over HTTP.
+	Handoff(ctx context.Context, opts ...grpc.CallOption) (SessionManager_HandoffClient, error)
 }
 
 type sessionManagerClient struct {
@@ -877,12 +1384,87 @@ func (c *sessionManagerClient) Delete(ctx context.Context, in *DeleteRequest, op
 	return out, nil
 }
 
+func (c *sessionManagerClient) Watch(ctx context.Context, in *WatchRequest, opts ...grpc.CallOption) (SessionManager_WatchClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_SessionManager_serviceDesc.Streams[0], "/mnemosynerpc.SessionManager/Watch", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sessionManagerWatchClient{stream}
+	if err := x.ClientStream.SendMsg(in); err != nil {
+		return nil, err
+	}
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return x, nil
+}
+
+type SessionManager_WatchClient interface {
+	Recv() (*Event, error)
+	grpc.ClientStream
+}
+
+type sessionManagerWatchClient struct {
+	grpc.ClientStream
+}
+
+func (x *sessionManagerWatchClient) Recv() (*Event, error) {
+	m := new(Event)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *sessionManagerClient) Refresh(ctx context.Context, in *RefreshRequest, opts ...grpc.CallOption) (*RefreshResponse, error) {
+	out := new(RefreshResponse)
+	err := c.cc.Invoke(ctx, "/mnemosynerpc.SessionManager/Refresh", in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *sessionManagerClient) Handoff(ctx context.Context, opts ...grpc.CallOption) (SessionManager_HandoffClient, error) {
+	stream, err := c.cc.NewStream(ctx, &_SessionManager_serviceDesc.Streams[1], "/mnemosynerpc.SessionManager/Handoff", opts...)
+	if err != nil {
+		return nil, err
+	}
+	x := &sessionManagerHandoffClient{stream}
+	return x, nil
+}
+
+type SessionManager_HandoffClient interface {
+	Send(*HandoffRequest) error
+	CloseAndRecv() (*HandoffResponse, error)
+	grpc.ClientStream
+}
+
+type sessionManagerHandoffClient struct {
+	grpc.ClientStream
+}
+
+func (x *sessionManagerHandoffClient) Send(m *HandoffRequest) error {
+	return x.ClientStream.SendMsg(m)
+}
+
+func (x *sessionManagerHandoffClient) CloseAndRecv() (*HandoffResponse, error) {
+	if err := x.ClientStream.CloseSend(); err != nil {
+		return nil, err
+	}
+	m := new(HandoffResponse)
+	if err := x.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 // SessionManagerServer is the server API for SessionManager service.
 type SessionManagerServer interface {
 	// Get retrieves session for given access token.
 	Get(context.Context, *GetRequest) (*GetResponse, error)
 	// Context works like Get but takes access token from metadata within context.
-	// It expects "authorization" key to be present within metadata.
+	// It expects "authorization" key to be present within metadata, "Bearer" scheme is optional.
 	Context(context.Context, *empty.Empty) (*ContextResponse, error)
 	List(context.Context, *ListRequest) (*ListResponse, error)
 	Exists(context.Context, *ExistsRequest) (*wrappers.BoolValue, error)
@@ -890,6 +1472,17 @@ type SessionManagerServer interface {
 	Abandon(context.Context, *AbandonRequest) (*wrappers.BoolValue, error)
 	SetValue(context.Context, *SetValueRequest) (*SetValueResponse, error)
 	Delete(context.Context, *DeleteRequest) (*wrappers.Int64Value, error)
+	// Watch streams session lifecycle events.
+	// Events that happen on any node of the cluster are delivered, so it's enough to subscribe to a single one.
+	Watch(*WatchRequest, SessionManager_WatchServer) error
+	// Refresh abandons session that holds given refresh token and starts a new one with the same subject and bag.
+	// Refresh token can be used only once, if an already rotated token is presented again,
+	// the whole family of sessions that descend from it is revoked.
+	Refresh(context.Context, *RefreshRequest) (*RefreshResponse, error)
+	// Handoff is an internal call, that transfers sessions to their new owner once cluster topology changes.
+	// Successfully closed stream means that the sender has no more sessions that belong to the receiver.
+	// It is not exposed over HTTP.
+	Handoff(SessionManager_HandoffServer) error
 }
 
 // UnimplementedSessionManagerServer can be embedded to have forward compatible implementations.
@@ -920,6 +1513,15 @@ func (*UnimplementedSessionManagerServer) SetValue(ctx context.Context, req *Set
 func (*UnimplementedSessionManagerServer) Delete(ctx context.Context, req *DeleteRequest) (*wrappers.Int64Value, error) {
 	return nil, status.Errorf(codes.Unimplemented, "method Delete not implemented")
 }
+func (*UnimplementedSessionManagerServer) Watch(req *WatchRequest, srv SessionManager_WatchServer) error {
+	return status.Errorf(codes.Unimplemented, "method Watch not implemented")
+}
+func (*UnimplementedSessionManagerServer) Refresh(ctx context.Context, req *RefreshRequest) (*RefreshResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method Refresh not implemented")
+}
+func (*UnimplementedSessionManagerServer) Handoff(srv SessionManager_HandoffServer) error {
+	return status.Errorf(codes.Unimplemented, "method Handoff not implemented")
+}
 
 func RegisterSessionManagerServer(s *grpc.Server, srv SessionManagerServer) {
 	s.RegisterService(&_SessionManager_serviceDesc, srv)
@@ -1069,6 +1671,71 @@ func _SessionManager_Delete_Handler(srv interface{}, ctx context.Context, dec fu
 	return interceptor(ctx, in, info, handler)
 }
 
+func _SessionManager_Watch_Handler(srv interface{}, stream grpc.ServerStream) error {
+	m := new(WatchRequest)
+	if err := stream.RecvMsg(m); err != nil {
+		return err
+	}
+	return srv.(SessionManagerServer).Watch(m, &sessionManagerWatchServer{stream})
+}
+
+type SessionManager_WatchServer interface {
+	Send(*Event) error
+	grpc.ServerStream
+}
+
+type sessionManagerWatchServer struct {
+	grpc.ServerStream
+}
+
+func (x *sessionManagerWatchServer) Send(m *Event) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func _SessionManager_Refresh_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RefreshRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(SessionManagerServer).Refresh(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: "/mnemosynerpc.SessionManager/Refresh",
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(SessionManagerServer).Refresh(ctx, req.(*RefreshRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _SessionManager_Handoff_Handler(srv interface{}, stream grpc.ServerStream) error {
+	return srv.(SessionManagerServer).Handoff(&sessionManagerHandoffServer{stream})
+}
+
+type SessionManager_HandoffServer interface {
+	SendAndClose(*HandoffResponse) error
+	Recv() (*HandoffRequest, error)
+	grpc.ServerStream
+}
+
+type sessionManagerHandoffServer struct {
+	grpc.ServerStream
+}
+
+func (x *sessionManagerHandoffServer) SendAndClose(m *HandoffResponse) error {
+	return x.ServerStream.SendMsg(m)
+}
+
+func (x *sessionManagerHandoffServer) Recv() (*HandoffRequest, error) {
+	m := new(HandoffRequest)
+	if err := x.ServerStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
 var _SessionManager_serviceDesc = grpc.ServiceDesc{
 	ServiceName: "mnemosynerpc.SessionManager",
 	HandlerType: (*SessionManagerServer)(nil),
@@ -1105,7 +1772,22 @@ var _SessionManager_serviceDesc = grpc.ServiceDesc{
 			MethodName: "Delete",
 			Handler:    _SessionManager_Delete_Handler,
 		},
+		{
+			MethodName: "Refresh",
+			Handler:    _SessionManager_Refresh_Handler,
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "Watch",
+			Handler:       _SessionManager_Watch_Handler,
+			ServerStreams: true,
+		},
+		{
+			StreamName:    "Handoff",
+			Handler:       _SessionManager_Handoff_Handler,
+			ClientStreams: true,
+		},
 	},
-	Streams:  []grpc.StreamDesc{},
 	Metadata: "mnemosynerpc/session.proto",
 }
@@ -3,6 +3,7 @@
 
 import sys
 _b=sys.version_info[0]<3 and (lambda x:x) or (lambda x:x.encode('latin1'))
+from google.protobuf.internal import enum_type_wrapper
 from google.protobuf import descriptor as _descriptor
 from google.protobuf import message as _message
 from google.protobuf import reflection as _reflection
@@ -14,19 +15,71 @@ _sym_db = _symbol_database.Default()
 
 
 from google.protobuf import timestamp_pb2 as google_dot_protobuf_dot_timestamp__pb2
+from google.protobuf import duration_pb2 as google_dot_protobuf_dot_duration__pb2
 from google.protobuf import empty_pb2 as google_dot_protobuf_dot_empty__pb2
 from google.protobuf import wrappers_pb2 as google_dot_protobuf_dot_wrappers__pb2
+from google.api import annotations_pb2 as google_dot_api_dot_annotations__pb2
 
 
 DESCRIPTOR = _descriptor.FileDescriptor(
   name='mnemosynerpc/session.proto',
   package='mnemosynerpc',
   syntax='proto3',
-  serialized_pb=_b('\n\x1amnemosynerpc/session.proto\x12\x0cmnemosynerpc\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1egoogle/protobuf/wrappers.proto\"\xea\x01\n\x07Session\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\x12\x12\n\nsubject_id\x18\x02 \x01(\t\x12\x16\n\x0esubject_client\x18\x03 \x01(\t\x12+\n\x03\x62\x61g\x18\x04 \x03(\x0b\x32\x1e.mnemosynerpc.Session.BagEntry\x12-\n\texpire_at\x18\x05 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x15\n\rrefresh_token\x18\x06 \x01(\t\x1a*\n\x08\x42\x61gEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\"\n\nGetRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\"5\n\x0bGetResponse\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"9\n\x0f\x43ontextResponse\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"V\n\x0bListRequest\x12\x0e\n\x06offset\x18\x01 \x01(\x03\x12\r\n\x05limit\x18\x02 \x01(\x03\x12\"\n\x05query\x18\x0b \x01(\x0b\x32\x13.mnemosynerpc.QueryJ\x04\x08\x03\x10\x0b\"7\n\x0cListResponse\x12\'\n\x08sessions\x18\x01 \x03(\x0b\x32\x15.mnemosynerpc.Session\"\x84\x01\n\x05Query\x12\x32\n\x0e\x65xpire_at_from\x18\x01 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x30\n\x0c\x65xpire_at_to\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x15\n\rrefresh_token\x18\x03 \x01(\t\"%\n\rExistsRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\"6\n\x0cStartRequest\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"7\n\rStartResponse\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"&\n\x0e\x41\x62\x61ndonRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\"C\n\x0fSetValueRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05value\x18\x03 \x01(\t\"t\n\x10SetValueResponse\x12\x34\n\x03\x62\x61g\x18\x01 \x03(\x0b\x32\'.mnemosynerpc.SetValueResponse.BagEntry\x1a*\n\x08\x42\x61gEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xb6\x01\n\rDeleteRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\x12\x32\n\x0e\x65xpire_at_from\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x30\n\x0c\x65xpire_at_to\x18\x03 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x15\n\rrefresh_token\x18\x04 \x01(\t\x12\x12\n\nsubject_id\x18\x05 \x01(\t2\xb6\x04\n\x0eSessionManager\x12<\n\x03Get\x12\x18.mnemosynerpc.GetRequest\x1a\x19.mnemosynerpc.GetResponse\"\x00\x12\x42\n\x07\x43ontext\x12\x16.google.protobuf.Empty\x1a\x1d.mnemosynerpc.ContextResponse\"\x00\x12?\n\x04List\x12\x19.mnemosynerpc.ListRequest\x1a\x1a.mnemosynerpc.ListResponse\"\x00\x12\x43\n\x06\x45xists\x12\x1b.mnemosynerpc.ExistsRequest\x1a\x1a.google.protobuf.BoolValue\"\x00\x12\x42\n\x05Start\x12\x1a.mnemosynerpc.StartRequest\x1a\x1b.mnemosynerpc.StartResponse\"\x00\x12\x45\n\x07\x41\x62\x61ndon\x12\x1c.mnemosynerpc.AbandonRequest\x1a\x1a.google.protobuf.BoolValue\"\x00\x12K\n\x08SetValue\x12\x1d.mnemosynerpc.SetValueRequest\x1a\x1e.mnemosynerpc.SetValueResponse\"\x00\x12\x44\n\x06\x44\x65lete\x12\x1b.mnemosynerpc.DeleteRequest\x1a\x1b.google.protobuf.Int64Value\"\x00\x42\x32Z0github.com/piotrkowalczuk/mnemosyne/mnemosynerpcb\x06proto3')
+  serialized_pb=_b('\n\x1amnemosynerpc/session.proto\x12\x0cmnemosynerpc\x1a\x1fgoogle/protobuf/timestamp.proto\x1a\x1egoogle/protobuf/duration.proto\x1a\x1bgoogle/protobuf/empty.proto\x1a\x1egoogle/protobuf/wrappers.proto\x1a\x1cgoogle/api/annotations.proto\"\x83\x03\n\x07Session\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\x12\x12\n\nsubject_id\x18\x02 \x01(\t\x12\x16\n\x0esubject_client\x18\x03 \x01(\t\x12+\n\x03\x62\x61g\x18\x04 \x03(\x0b\x32\x1e.mnemosynerpc.Session.BagEntry\x12-\n\texpire_at\x18\x05 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x15\n\rrefresh_token\x18\x06 \x01(\t\x12.\n\ncreated_at\x18\x07 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x36\n\x12\x61\x62solute_expire_at\x18\x08 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12/\n\x0cidle_timeout\x18\t \x01(\x0b\x32\x19.google.protobuf.Duration\x1a*\n\x08\x42\x61gEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\"\n\nGetRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\"5\n\x0bGetResponse\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"9\n\x0f\x43ontextResponse\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"\x87\x01\n\x0bListRequest\x12\x0e\n\x06offset\x18\x01 \x01(\x03\x12\r\n\x05limit\x18\x02 \x01(\x03\x12\"\n\x05query\x18\x0b \x01(\x0b\x32\x13.mnemosynerpc.Query\x12\x12\n\npage_token\x18\x0c \x01(\t\x12\x1b\n\x13include_total_count\x18\r \x01(\x08J\x04\x08\x03\x10\x0b\"\x82\x01\n\x0cListResponse\x12\'\n\x08sessions\x18\x01 \x03(\x0b\x32\x15.mnemosynerpc.Session\x12\x17\n\x0fnext_page_token\x18\x02 \x01(\t\x12\x30\n\x0btotal_count\x18\x03 \x01(\x0b\x32\x1b.google.protobuf.Int64Value\"\x87\x02\n\x05Query\x12\x32\n\x0e\x65xpire_at_from\x18\x01 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x30\n\x0c\x65xpire_at_to\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x15\n\rrefresh_token\x18\x03 \x01(\t\x12\x12\n\nsubject_id\x18\x04 \x01(\t\x12\x16\n\x0esubject_client\x18\x05 \x01(\t\x12)\n\x03\x62\x61g\x18\x06 \x03(\x0b\x32\x1c.mnemosynerpc.Query.BagEntry\x1a*\n\x08\x42\x61gEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"%\n\rExistsRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\"\x98\x01\n\x0cStartRequest\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\x12/\n\x0cidle_timeout\x18\x02 \x01(\x0b\x32\x19.google.protobuf.Duration\x12/\n\x0cmax_lifetime\x18\x03 \x01(\x0b\x32\x19.google.protobuf.Duration\"7\n\rStartResponse\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"&\n\x0e\x41\x62\x61ndonRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\"C\n\x0fSetValueRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\x12\x0b\n\x03key\x18\x02 \x01(\t\x12\r\n\x05value\x18\x03 \x01(\t\"t\n\x10SetValueResponse\x12\x34\n\x03\x62\x61g\x18\x01 \x03(\x0b\x32\'.mnemosynerpc.SetValueResponse.BagEntry\x1a*\n\x08\x42\x61gEntry\x12\x0b\n\x03key\x18\x01 \x01(\t\x12\r\n\x05value\x18\x02 \x01(\t:\x02\x38\x01\"\xb6\x01\n\rDeleteRequest\x12\x14\n\x0c\x61\x63\x63\x65ss_token\x18\x01 \x01(\t\x12\x32\n\x0e\x65xpire_at_from\x18\x02 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x30\n\x0c\x65xpire_at_to\x18\x03 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x15\n\rrefresh_token\x18\x04 \x01(\t\x12\x12\n\nsubject_id\x18\x05 \x01(\t\"b\n\x0cWatchRequest\x12\x12\n\nsubject_id\x18\x01 \x01(\t\x12\x16\n\x0esubject_client\x18\x02 \x01(\t\x12&\n\x05types\x18\x03 \x03(\x0e\x32\x17.mnemosynerpc.EventType\"\x95\x01\n\x05\x45vent\x12%\n\x04type\x18\x01 \x01(\x0e\x32\x17.mnemosynerpc.EventType\x12&\n\x07session\x18\x02 \x01(\x0b\x32\x15.mnemosynerpc.Session\x12/\n\x0boccurred_at\x18\x03 \x01(\x0b\x32\x1a.google.protobuf.Timestamp\x12\x0c\n\x04node\x18\x04 \x01(\t\"\'\n\x0eRefreshRequest\x12\x15\n\rrefresh_token\x18\x01 \x01(\t\"9\n\x0fRefreshResponse\x12&\n\x07session\x18\x01 \x01(\x0b\x32\x15.mnemosynerpc.Session\"U\n\x0eHandoffRequest\x12\x0c\n\x04node\x18\x01 \x01(\t\x12\'\n\x08sessions\x18\x02 \x03(\x0b\x32\x15.mnemosynerpc.Session\x12\x0c\n\x04ring\x18\x03 \x01(\x04\"#\n\x0fHandoffResponse\x12\x10\n\x08\x61\x63\x63\x65pted\x18\x01 \x01(\x03*\xa7\x01\n\tEventType\x12\x16\n\x12UNKNOWN_EVENT_TYPE\x10\x00\x12\x13\n\x0fSESSION_STARTED\x10\x01\x12\x15\n\x11SESSION_ABANDONED\x10\x02\x12\x13\n\x0fSESSION_DELETED\x10\x03\x12\x13\n\x0fSESSION_EXPIRED\x10\x04\x12\x15\n\x11SESSION_VALUE_SET\x10\x05\x12\x15\n\x11SESSION_REFRESHED\x10\x06\x32\xc7\x08\n\x0eSessionManager\x12_\n\x03Get\x12\x18.mnemosynerpc.GetRequest\x1a\x19.mnemosynerpc.GetResponse\"#\x82\xd3\xe4\x93\x02\x1d\x12\x1b/v1/sessions/{access_token}\x12U\n\x07\x43ontext\x12\x16.google.protobuf.Empty\x1a\x1d.mnemosynerpc.ContextResponse\"\x13\x82\xd3\xe4\x93\x02\r\x12\x0b/v1/context\x12m\n\x04List\x12\x19.mnemosynerpc.ListRequest\x1a\x1a.mnemosynerpc.ListResponse\".\x82\xd3\xe4\x93\x02(\x12\x0c/v1/sessionsZ\x18\"\x13/v1/sessions/search:\x01*\x12m\n\x06\x45xists\x12\x1b.mnemosynerpc.ExistsRequest\x1a\x1a.google.protobuf.BoolValue\"*\x82\xd3\xe4\x93\x02$\x12\"/v1/sessions/{access_token}/exists\x12Y\n\x05Start\x12\x1a.mnemosynerpc.StartRequest\x1a\x1b.mnemosynerpc.StartResponse\"\x17\x82\xd3\xe4\x93\x02\x11\"\x0c/v1/sessions:\x01*\x12h\n\x07\x41\x62\x61ndon\x12\x1c.mnemosynerpc.AbandonRequest\x1a\x1a.google.protobuf.BoolValue\"#\x82\xd3\xe4\x93\x02\x1d*\x1b/v1/sessions/{access_token}\x12{\n\x08SetValue\x12\x1d.mnemosynerpc.SetValueRequest\x1a\x1e.mnemosynerpc.SetValueResponse\"0\x82\xd3\xe4\x93\x02*\x1a%/v1/sessions/{access_token}/bag/{key}:\x01*\x12X\n\x06\x44\x65lete\x12\x1b.mnemosynerpc.DeleteRequest\x1a\x1b.google.protobuf.Int64Value\"\x14\x82\xd3\xe4\x93\x02\x0e*\x0c/v1/sessions\x12N\n\x05Watch\x12\x1a.mnemosynerpc.WatchRequest\x1a\x13.mnemosynerpc.Event\"\x12\x82\xd3\xe4\x93\x02\x0c\x12\n/v1/events0\x01\x12g\n\x07Refresh\x12\x1c.mnemosynerpc.RefreshRequest\x1a\x1d.mnemosynerpc.RefreshResponse\"\x1f\x82\xd3\xe4\x93\x02\x19\"\x14/v1/sessions/refresh:\x01*\x12J\n\x07Handoff\x12\x1c.mnemosynerpc.HandoffRequest\x1a\x1d.mnemosynerpc.HandoffResponse\"\x00(\x01\x42\x32Z0github.com/piotrkowalczuk/mnemosyne/mnemosynerpcb\x06proto3')
   ,
-  dependencies=[google_dot_protobuf_dot_timestamp__pb2.DESCRIPTOR,google_dot_protobuf_dot_empty__pb2.DESCRIPTOR,google_dot_protobuf_dot_wrappers__pb2.DESCRIPTOR,])
+  dependencies=[google_dot_protobuf_dot_timestamp__pb2.DESCRIPTOR,google_dot_protobuf_dot_duration__pb2.DESCRIPTOR,google_dot_protobuf_dot_empty__pb2.DESCRIPTOR,google_dot_protobuf_dot_wrappers__pb2.DESCRIPTOR,google_dot_api_dot_annotations__pb2.DESCRIPTOR,])
 
+_EVENTTYPE = _descriptor.EnumDescriptor(
+  name='EventType',
+  full_name='mnemosynerpc.EventType',
+  filename=None,
+  file=DESCRIPTOR,
+  values=[
+    _descriptor.EnumValueDescriptor(
+      name='UNKNOWN_EVENT_TYPE', index=0, number=0,
+      options=None,
+      type=None),
+    _descriptor.EnumValueDescriptor(
+      name='SESSION_STARTED', index=1, number=1,
+      options=None,
+      type=None),
+    _descriptor.EnumValueDescriptor(
+      name='SESSION_ABANDONED', index=2, number=2,
+      options=None,
+      type=None),
+    _descriptor.EnumValueDescriptor(
+      name='SESSION_DELETED', index=3, number=3,
+      options=None,
+      type=None),
+    _descriptor.EnumValueDescriptor(
+      name='SESSION_EXPIRED', index=4, number=4,
+      options=None,
+      type=None),
+    _descriptor.EnumValueDescriptor(
+      name='SESSION_VALUE_SET', index=5, number=5,
+      options=None,
+      type=None),
+    _descriptor.EnumValueDescriptor(
+      name='SESSION_REFRESHED', index=6, number=6,
+      options=None,
+      type=None),
+  ],
+  containing_type=None,
+  options=None,
+  serialized_start=2417,
+  serialized_end=2584,
+)
+_sym_db.RegisterEnumDescriptor(_EVENTTYPE)
 
+EventType = enum_type_wrapper.EnumTypeWrapper(_EVENTTYPE)
+
+UNKNOWN_EVENT_TYPE = 0
+SESSION_STARTED = 1
+SESSION_ABANDONED = 2
+SESSION_DELETED = 3
+SESSION_EXPIRED = 4
+SESSION_VALUE_SET = 5
+SESSION_REFRESHED = 6
 
 
 _SESSION_BAGENTRY = _descriptor.Descriptor(
@@ -62,8 +115,8 @@ _SESSION_BAGENTRY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=331,
-  serialized_end=373,
+  serialized_start=546,
+  serialized_end=588,
 )
 
 _SESSION = _descriptor.Descriptor(
@@ -115,6 +168,27 @@ _SESSION = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='created_at', full_name='mnemosynerpc.Session.created_at', index=6,
+      number=7, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='absolute_expire_at', full_name='mnemosynerpc.Session.absolute_expire_at', index=7,
+      number=8, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='idle_timeout', full_name='mnemosynerpc.Session.idle_timeout', index=8,
+      number=9, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
   ],
   extensions=[
   ],
@@ -127,8 +201,8 @@ _SESSION = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=139,
-  serialized_end=373,
+  serialized_start=201,
+  serialized_end=588,
 )
 
 
@@ -158,8 +232,8 @@ _GETREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=375,
-  serialized_end=409,
+  serialized_start=590,
+  serialized_end=624,
 )
 
 
@@ -189,8 +263,8 @@ _GETRESPONSE = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=411,
-  serialized_end=464,
+  serialized_start=626,
+  serialized_end=679,
 )
 
 
@@ -220,8 +294,8 @@ _CONTEXTRESPONSE = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=466,
-  serialized_end=523,
+  serialized_start=681,
+  serialized_end=738,
 )
 
 
@@ -253,6 +327,20 @@ _LISTREQUEST = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='page_token', full_name='mnemosynerpc.ListRequest.page_token', index=3,
+      number=12, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='include_total_count', full_name='mnemosynerpc.ListRequest.include_total_count', index=4,
+      number=13, type=8, cpp_type=7, label=1,
+      has_default_value=False, default_value=False,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
   ],
   extensions=[
   ],
@@ -265,8 +353,8 @@ _LISTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=525,
-  serialized_end=611,
+  serialized_start=741,
+  serialized_end=876,
 )
 
 
@@ -284,6 +372,20 @@ _LISTRESPONSE = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='next_page_token', full_name='mnemosynerpc.ListResponse.next_page_token', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='total_count', full_name='mnemosynerpc.ListResponse.total_count', index=2,
+      number=3, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
   ],
   extensions=[
   ],
@@ -296,11 +398,48 @@ _LISTRESPONSE = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=613,
-  serialized_end=668,
+  serialized_start=879,
+  serialized_end=1009,
 )
 
 
+_QUERY_BAGENTRY = _descriptor.Descriptor(
+  name='BagEntry',
+  full_name='mnemosynerpc.Query.BagEntry',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='key', full_name='mnemosynerpc.Query.BagEntry.key', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='value', full_name='mnemosynerpc.Query.BagEntry.value', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=_descriptor._ParseOptions(descriptor_pb2.MessageOptions(), _b('8\001')),
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=546,
+  serialized_end=588,
+)
+
 _QUERY = _descriptor.Descriptor(
   name='Query',
   full_name='mnemosynerpc.Query',
@@ -329,10 +468,31 @@ _QUERY = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='subject_id', full_name='mnemosynerpc.Query.subject_id', index=3,
+      number=4, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='subject_client', full_name='mnemosynerpc.Query.subject_client', index=4,
+      number=5, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='bag', full_name='mnemosynerpc.Query.bag', index=5,
+      number=6, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
   ],
   extensions=[
   ],
-  nested_types=[],
+  nested_types=[_QUERY_BAGENTRY, ],
   enum_types=[
   ],
   options=None,
@@ -341,8 +501,8 @@ _QUERY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=671,
-  serialized_end=803,
+  serialized_start=1012,
+  serialized_end=1275,
 )
 
 
@@ -372,8 +532,8 @@ _EXISTSREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=805,
-  serialized_end=842,
+  serialized_start=1277,
+  serialized_end=1314,
 )
 
 
@@ -391,6 +551,20 @@ _STARTREQUEST = _descriptor.Descriptor(
       message_type=None, enum_type=None, containing_type=None,
       is_extension=False, extension_scope=None,
       options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='idle_timeout', full_name='mnemosynerpc.StartRequest.idle_timeout', index=1,
+      number=2, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='max_lifetime', full_name='mnemosynerpc.StartRequest.max_lifetime', index=2,
+      number=3, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
   ],
   extensions=[
   ],
@@ -403,8 +577,8 @@ _STARTREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=844,
-  serialized_end=898,
+  serialized_start=1317,
+  serialized_end=1469,
 )
 
 
@@ -434,8 +608,8 @@ _STARTRESPONSE = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=900,
-  serialized_end=955,
+  serialized_start=1471,
+  serialized_end=1526,
 )
 
 
@@ -465,8 +639,8 @@ _ABANDONREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=957,
-  serialized_end=995,
+  serialized_start=1528,
+  serialized_end=1566,
 )
 
 
@@ -510,8 +684,8 @@ _SETVALUEREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=997,
-  serialized_end=1064,
+  serialized_start=1568,
+  serialized_end=1635,
 )
 
 
@@ -548,8 +722,8 @@ _SETVALUERESPONSE_BAGENTRY = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=331,
-  serialized_end=373,
+  serialized_start=546,
+  serialized_end=588,
 )
 
 _SETVALUERESPONSE = _descriptor.Descriptor(
@@ -578,8 +752,8 @@ _SETVALUERESPONSE = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1066,
-  serialized_end=1182,
+  serialized_start=1637,
+  serialized_end=1753,
 )
 
 
@@ -637,25 +811,274 @@ _DELETEREQUEST = _descriptor.Descriptor(
   extension_ranges=[],
   oneofs=[
   ],
-  serialized_start=1185,
-  serialized_end=1367,
+  serialized_start=1756,
+  serialized_end=1938,
+)
+
+
+_WATCHREQUEST = _descriptor.Descriptor(
+  name='WatchRequest',
+  full_name='mnemosynerpc.WatchRequest',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='subject_id', full_name='mnemosynerpc.WatchRequest.subject_id', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='subject_client', full_name='mnemosynerpc.WatchRequest.subject_client', index=1,
+      number=2, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='types', full_name='mnemosynerpc.WatchRequest.types', index=2,
+      number=3, type=14, cpp_type=8, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=1940,
+  serialized_end=2038,
+)
+
+
+_EVENT = _descriptor.Descriptor(
+  name='Event',
+  full_name='mnemosynerpc.Event',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='type', full_name='mnemosynerpc.Event.type', index=0,
+      number=1, type=14, cpp_type=8, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='session', full_name='mnemosynerpc.Event.session', index=1,
+      number=2, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='occurred_at', full_name='mnemosynerpc.Event.occurred_at', index=2,
+      number=3, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='node', full_name='mnemosynerpc.Event.node', index=3,
+      number=4, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2041,
+  serialized_end=2190,
+)
+
+
+_REFRESHREQUEST = _descriptor.Descriptor(
+  name='RefreshRequest',
+  full_name='mnemosynerpc.RefreshRequest',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='refresh_token', full_name='mnemosynerpc.RefreshRequest.refresh_token', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2192,
+  serialized_end=2231,
+)
+
+
+_REFRESHRESPONSE = _descriptor.Descriptor(
+  name='RefreshResponse',
+  full_name='mnemosynerpc.RefreshResponse',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='session', full_name='mnemosynerpc.RefreshResponse.session', index=0,
+      number=1, type=11, cpp_type=10, label=1,
+      has_default_value=False, default_value=None,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2233,
+  serialized_end=2290,
+)
+
+
+_HANDOFFREQUEST = _descriptor.Descriptor(
+  name='HandoffRequest',
+  full_name='mnemosynerpc.HandoffRequest',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='node', full_name='mnemosynerpc.HandoffRequest.node', index=0,
+      number=1, type=9, cpp_type=9, label=1,
+      has_default_value=False, default_value=_b("").decode('utf-8'),
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='sessions', full_name='mnemosynerpc.HandoffRequest.sessions', index=1,
+      number=2, type=11, cpp_type=10, label=3,
+      has_default_value=False, default_value=[],
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+    _descriptor.FieldDescriptor(
+      name='ring', full_name='mnemosynerpc.HandoffRequest.ring', index=2,
+      number=3, type=4, cpp_type=4, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2292,
+  serialized_end=2377,
+)
+
+
+_HANDOFFRESPONSE = _descriptor.Descriptor(
+  name='HandoffResponse',
+  full_name='mnemosynerpc.HandoffResponse',
+  filename=None,
+  file=DESCRIPTOR,
+  containing_type=None,
+  fields=[
+    _descriptor.FieldDescriptor(
+      name='accepted', full_name='mnemosynerpc.HandoffResponse.accepted', index=0,
+      number=1, type=3, cpp_type=2, label=1,
+      has_default_value=False, default_value=0,
+      message_type=None, enum_type=None, containing_type=None,
+      is_extension=False, extension_scope=None,
+      options=None, file=DESCRIPTOR),
+  ],
+  extensions=[
+  ],
+  nested_types=[],
+  enum_types=[
+  ],
+  options=None,
+  is_extendable=False,
+  syntax='proto3',
+  extension_ranges=[],
+  oneofs=[
+  ],
+  serialized_start=2379,
+  serialized_end=2414,
 )
 
 _SESSION_BAGENTRY.containing_type = _SESSION
 _SESSION.fields_by_name['bag'].message_type = _SESSION_BAGENTRY
 _SESSION.fields_by_name['expire_at'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_SESSION.fields_by_name['created_at'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_SESSION.fields_by_name['absolute_expire_at'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_SESSION.fields_by_name['idle_timeout'].message_type = google_dot_protobuf_dot_duration__pb2._DURATION
 _GETRESPONSE.fields_by_name['session'].message_type = _SESSION
 _CONTEXTRESPONSE.fields_by_name['session'].message_type = _SESSION
 _LISTREQUEST.fields_by_name['query'].message_type = _QUERY
 _LISTRESPONSE.fields_by_name['sessions'].message_type = _SESSION
+_LISTRESPONSE.fields_by_name['total_count'].message_type = google_dot_protobuf_dot_wrappers__pb2._INT64VALUE
+_QUERY_BAGENTRY.containing_type = _QUERY
 _QUERY.fields_by_name['expire_at_from'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
 _QUERY.fields_by_name['expire_at_to'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_QUERY.fields_by_name['bag'].message_type = _QUERY_BAGENTRY
 _STARTREQUEST.fields_by_name['session'].message_type = _SESSION
+_STARTREQUEST.fields_by_name['idle_timeout'].message_type = google_dot_protobuf_dot_duration__pb2._DURATION
+_STARTREQUEST.fields_by_name['max_lifetime'].message_type = google_dot_protobuf_dot_duration__pb2._DURATION
 _STARTRESPONSE.fields_by_name['session'].message_type = _SESSION
 _SETVALUERESPONSE_BAGENTRY.containing_type = _SETVALUERESPONSE
 _SETVALUERESPONSE.fields_by_name['bag'].message_type = _SETVALUERESPONSE_BAGENTRY
 _DELETEREQUEST.fields_by_name['expire_at_from'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
 _DELETEREQUEST.fields_by_name['expire_at_to'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_WATCHREQUEST.fields_by_name['types'].enum_type = _EVENTTYPE
+_EVENT.fields_by_name['type'].enum_type = _EVENTTYPE
+_EVENT.fields_by_name['session'].message_type = _SESSION
+_EVENT.fields_by_name['occurred_at'].message_type = google_dot_protobuf_dot_timestamp__pb2._TIMESTAMP
+_REFRESHRESPONSE.fields_by_name['session'].message_type = _SESSION
+_HANDOFFREQUEST.fields_by_name['sessions'].message_type = _SESSION
 DESCRIPTOR.message_types_by_name['Session'] = _SESSION
 DESCRIPTOR.message_types_by_name['GetRequest'] = _GETREQUEST
 DESCRIPTOR.message_types_by_name['GetResponse'] = _GETRESPONSE
@@ -670,6 +1093,13 @@ DESCRIPTOR.message_types_by_name['AbandonRequest'] = _ABANDONREQUEST
 DESCRIPTOR.message_types_by_name['SetValueRequest'] = _SETVALUEREQUEST
 DESCRIPTOR.message_types_by_name['SetValueResponse'] = _SETVALUERESPONSE
 DESCRIPTOR.message_types_by_name['DeleteRequest'] = _DELETEREQUEST
+DESCRIPTOR.message_types_by_name['WatchRequest'] = _WATCHREQUEST
+DESCRIPTOR.message_types_by_name['Event'] = _EVENT
+DESCRIPTOR.message_types_by_name['RefreshRequest'] = _REFRESHREQUEST
+DESCRIPTOR.message_types_by_name['RefreshResponse'] = _REFRESHRESPONSE
+DESCRIPTOR.message_types_by_name['HandoffRequest'] = _HANDOFFREQUEST
+DESCRIPTOR.message_types_by_name['HandoffResponse'] = _HANDOFFRESPONSE
+DESCRIPTOR.enum_types_by_name['EventType'] = _EVENTTYPE
 _sym_db.RegisterFileDescriptor(DESCRIPTOR)
 
 Session = _reflection.GeneratedProtocolMessageType('Session', (_message.Message,), dict(
@@ -723,11 +1153,19 @@ ListResponse = _reflection.GeneratedProtocolMessageType('ListResponse', (_messag
 _sym_db.RegisterMessage(ListResponse)
 
 Query = _reflection.GeneratedProtocolMessageType('Query', (_message.Message,), dict(
+
+  BagEntry = _reflection.GeneratedProtocolMessageType('BagEntry', (_message.Message,), dict(
+    DESCRIPTOR = _QUERY_BAGENTRY,
+    __module__ = 'mnemosynerpc.session_pb2'
+    # @@protoc_insertion_point(class_scope:mnemosynerpc.Query.BagEntry)
+    ))
+  ,
   DESCRIPTOR = _QUERY,
   __module__ = 'mnemosynerpc.session_pb2'
   # @@protoc_insertion_point(class_scope:mnemosynerpc.Query)
   ))
 _sym_db.RegisterMessage(Query)
+_sym_db.RegisterMessage(Query.BagEntry)
 
 ExistsRequest = _reflection.GeneratedProtocolMessageType('ExistsRequest', (_message.Message,), dict(
   DESCRIPTOR = _EXISTSREQUEST,
@@ -786,11 +1224,55 @@ DeleteRequest = _reflection.GeneratedProtocolMessageType('DeleteRequest', (_mess
   ))
 _sym_db.RegisterMessage(DeleteRequest)
 
+WatchRequest = _reflection.GeneratedProtocolMessageType('WatchRequest', (_message.Message,), dict(
+  DESCRIPTOR = _WATCHREQUEST,
+  __module__ = 'mnemosynerpc.session_pb2'
+  # @@protoc_insertion_point(class_scope:mnemosynerpc.WatchRequest)
+  ))
+_sym_db.RegisterMessage(WatchRequest)
+
+Event = _reflection.GeneratedProtocolMessageType('Event', (_message.Message,), dict(
+  DESCRIPTOR = _EVENT,
+  __module__ = 'mnemosynerpc.session_pb2'
+  # @@protoc_insertion_point(class_scope:mnemosynerpc.Event)
+  ))
+_sym_db.RegisterMessage(Event)
+
+RefreshRequest = _reflection.GeneratedProtocolMessageType('RefreshRequest', (_message.Message,), dict(
+  DESCRIPTOR = _REFRESHREQUEST,
+  __module__ = 'mnemosynerpc.session_pb2'
+  # @@protoc_insertion_point(class_scope:mnemosynerpc.RefreshRequest)
+  ))
+_sym_db.RegisterMessage(RefreshRequest)
+
+RefreshResponse = _reflection.GeneratedProtocolMessageType('RefreshResponse', (_message.Message,), dict(
+  DESCRIPTOR = _REFRESHRESPONSE,
+  __module__ = 'mnemosynerpc.session_pb2'
+  # @@protoc_insertion_point(class_scope:mnemosynerpc.RefreshResponse)
+  ))
+_sym_db.RegisterMessage(RefreshResponse)
+
+HandoffRequest = _reflection.GeneratedProtocolMessageType('HandoffRequest', (_message.Message,), dict(
+  DESCRIPTOR = _HANDOFFREQUEST,
+  __module__ = 'mnemosynerpc.session_pb2'
+  # @@protoc_insertion_point(class_scope:mnemosynerpc.HandoffRequest)
+  ))
+_sym_db.RegisterMessage(HandoffRequest)
+
+HandoffResponse = _reflection.GeneratedProtocolMessageType('HandoffResponse', (_message.Message,), dict(
+  DESCRIPTOR = _HANDOFFRESPONSE,
+  __module__ = 'mnemosynerpc.session_pb2'
+  # @@protoc_insertion_point(class_scope:mnemosynerpc.HandoffResponse)
+  ))
+_sym_db.RegisterMessage(HandoffResponse)
+
 
 DESCRIPTOR.has_options = True
 DESCRIPTOR._options = _descriptor._ParseOptions(descriptor_pb2.FileOptions(), _b('Z0github.com/piotrkowalczuk/mnemosyne/mnemosynerpc'))
 _SESSION_BAGENTRY.has_options = True
 _SESSION_BAGENTRY._options = _descriptor._ParseOptions(descriptor_pb2.MessageOptions(), _b('8\001'))
+_QUERY_BAGENTRY.has_options = True
+_QUERY_BAGENTRY._options = _descriptor._ParseOptions(descriptor_pb2.MessageOptions(), _b('8\001'))
 _SETVALUERESPONSE_BAGENTRY.has_options = True
 _SETVALUERESPONSE_BAGENTRY._options = _descriptor._ParseOptions(descriptor_pb2.MessageOptions(), _b('8\001'))
 
@@ -800,8 +1282,8 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
   file=DESCRIPTOR,
   index=0,
   options=None,
-  serialized_start=1370,
-  serialized_end=1936,
+  serialized_start=2587,
+  serialized_end=3682,
   methods=[
   _descriptor.MethodDescriptor(
     name='Get',
@@ -810,7 +1292,7 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=_GETREQUEST,
     output_type=_GETRESPONSE,
-    options=None,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002\035\022\033/v1/sessions/{access_token}')),
   ),
   _descriptor.MethodDescriptor(
     name='Context',
@@ -819,7 +1301,7 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=google_dot_protobuf_dot_empty__pb2._EMPTY,
     output_type=_CONTEXTRESPONSE,
-    options=None,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002\r\022\013/v1/context')),
   ),
   _descriptor.MethodDescriptor(
     name='List',
@@ -828,7 +1310,7 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=_LISTREQUEST,
     output_type=_LISTRESPONSE,
-    options=None,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002(\022\014/v1/sessionsZ\030\"\023/v1/sessions/search:\001*')),
   ),
   _descriptor.MethodDescriptor(
     name='Exists',
@@ -837,7 +1319,7 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=_EXISTSREQUEST,
     output_type=google_dot_protobuf_dot_wrappers__pb2._BOOLVALUE,
-    options=None,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002$\022\"/v1/sessions/{access_token}/exists')),
   ),
   _descriptor.MethodDescriptor(
     name='Start',
@@ -846,7 +1328,7 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=_STARTREQUEST,
     output_type=_STARTRESPONSE,
-    options=None,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002\021\"\014/v1/sessions:\001*')),
   ),
   _descriptor.MethodDescriptor(
     name='Abandon',
@@ -855,7 +1337,7 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=_ABANDONREQUEST,
     output_type=google_dot_protobuf_dot_wrappers__pb2._BOOLVALUE,
-    options=None,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002\035*\033/v1/sessions/{access_token}')),
   ),
   _descriptor.MethodDescriptor(
     name='SetValue',
@@ -864,7 +1346,7 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=_SETVALUEREQUEST,
     output_type=_SETVALUERESPONSE,
-    options=None,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002*\032%/v1/sessions/{access_token}/bag/{key}:\001*')),
   ),
   _descriptor.MethodDescriptor(
     name='Delete',
@@ -873,6 +1355,33 @@ _SESSIONMANAGER = _descriptor.ServiceDescriptor(
     containing_service=None,
     input_type=_DELETEREQUEST,
     output_type=google_dot_protobuf_dot_wrappers__pb2._INT64VALUE,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002\016*\014/v1/sessions')),
+  ),
+  _descriptor.MethodDescriptor(
+    name='Watch',
+    full_name='mnemosynerpc.SessionManager.Watch',
+    index=8,
+    containing_service=None,
+    input_type=_WATCHREQUEST,
+    output_type=_EVENT,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002\014\022\n/v1/events')),
+  ),
+  _descriptor.MethodDescriptor(
+    name='Refresh',
+    full_name='mnemosynerpc.SessionManager.Refresh',
+    index=9,
+    containing_service=None,
+    input_type=_REFRESHREQUEST,
+    output_type=_REFRESHRESPONSE,
+    options=_descriptor._ParseOptions(descriptor_pb2.MethodOptions(), _b('\202\323\344\223\002\031\"\024/v1/sessions/refresh:\001*')),
+  ),
+  _descriptor.MethodDescriptor(
+    name='Handoff',
+    full_name='mnemosynerpc.SessionManager.Handoff',
+    index=10,
+    containing_service=None,
+    input_type=_HANDOFFREQUEST,
+    output_type=_HANDOFFRESPONSE,
     options=None,
   ),
 ])
@@ -56,6 +56,21 @@ class SessionManagerStub(object):
         request_serializer=mnemosynerpc_dot_session__pb2.DeleteRequest.SerializeToString,
         response_deserializer=google_dot_protobuf_dot_wrappers__pb2.Int64Value.FromString,
         )
+    self.Watch = channel.unary_stream(
+        '/mnemosynerpc.SessionManager/Watch',
+        request_serializer=mnemosynerpc_dot_session__pb2.WatchRequest.SerializeToString,
+        response_deserializer=mnemosynerpc_dot_session__pb2.Event.FromString,
+        )
+    self.Refresh = channel.unary_unary(
+        '/mnemosynerpc.SessionManager/Refresh',
+        request_serializer=mnemosynerpc_dot_session__pb2.RefreshRequest.SerializeToString,
+        response_deserializer=mnemosynerpc_dot_session__pb2.RefreshResponse.FromString,
+        )
+    self.Handoff = channel.stream_unary(
+        '/mnemosynerpc.SessionManager/Handoff',
+        request_serializer=mnemosynerpc_dot_session__pb2.HandoffRequest.SerializeToString,
+        response_deserializer=mnemosynerpc_dot_session__pb2.HandoffResponse.FromString,
+        )
 
 
 class SessionManagerServicer(object):
@@ -71,7 +86,7 @@ class SessionManagerServicer(object):
 
   def Context(self, request, context):
     """Context works like Get but takes access token from metadata within context.
-    It expects "authorization" key to be present within metadata.
+    It expects "authorization" key to be present within metadata, "Bearer" scheme is optional.
     """
     context.set_code(grpc.StatusCode.UNIMPLEMENTED)
     context.set_details('Method not implemented!')
@@ -119,6 +134,32 @@ class SessionManagerServicer(object):
     context.set_details('Method not implemented!')
     raise NotImplementedError('Method not implemented!')
 
+  def Watch(self, request, context):
+    """Watch streams session lifecycle events.
+    Events that happen on any node of the cluster are delivered, so it's enough to subscribe to a single one.
+    """
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def Refresh(self, request, context):
+    """Refresh abandons session that holds given refresh token and starts a new one with the same subject and bag.
+    Refresh token can be used only once, if an already rotated token is presented again,
+    the whole family of sessions that descend from it is revoked.
+    """
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
+  def Handoff(self, request_iterator, context):
+    """Handoff is an internal call, that transfers sessions to their new owner once cluster topology changes.
+    Successfully closed stream means that the sender has no more sessions that belong to the receiver.
+    It is not exposed over HTTP.
+    """
+    context.set_code(grpc.StatusCode.UNIMPLEMENTED)
+    context.set_details('Method not implemented!')
+    raise NotImplementedError('Method not implemented!')
+
 
 def add_SessionManagerServicer_to_server(servicer, server):
   rpc_method_handlers = {
@@ -162,6 +203,21 @@ def add_SessionManagerServicer_to_server(servicer, server):
           request_deserializer=mnemosynerpc_dot_session__pb2.DeleteRequest.FromString,
           response_serializer=google_dot_protobuf_dot_wrappers__pb2.Int64Value.SerializeToString,
       ),
+      'Watch': grpc.unary_stream_rpc_method_handler(
+          servicer.Watch,
+          request_deserializer=mnemosynerpc_dot_session__pb2.WatchRequest.FromString,
+          response_serializer=mnemosynerpc_dot_session__pb2.Event.SerializeToString,
+      ),
+      'Refresh': grpc.unary_unary_rpc_method_handler(
+          servicer.Refresh,
+          request_deserializer=mnemosynerpc_dot_session__pb2.RefreshRequest.FromString,
+          response_serializer=mnemosynerpc_dot_session__pb2.RefreshResponse.SerializeToString,
+      ),
+      'Handoff': grpc.stream_unary_rpc_method_handler(
+          servicer.Handoff,
+          request_deserializer=mnemosynerpc_dot_session__pb2.HandoffRequest.FromString,
+          response_serializer=mnemosynerpc_dot_session__pb2.HandoffResponse.SerializeToString,
+      ),
   }
   generic_handler = grpc.method_handlers_generic_handler(
       'mnemosynerpc.SessionManager', rpc_method_handlers)
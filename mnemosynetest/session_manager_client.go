@@ -164,6 +164,36 @@ func (_m *SessionManagerClient) Get(ctx context.Context, in *mnemosynerpc.GetReq
 	return r0, r1
 }
 
+// Handoff provides a mock function with given fields: ctx, opts
+func (_m *SessionManagerClient) Handoff(ctx context.Context, opts ...grpc.CallOption) (mnemosynerpc.SessionManager_HandoffClient, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 mnemosynerpc.SessionManager_HandoffClient
+	if rf, ok := ret.Get(0).(func(context.Context, ...grpc.CallOption) mnemosynerpc.SessionManager_HandoffClient); ok {
+		r0 = rf(ctx, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mnemosynerpc.SessionManager_HandoffClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // List provides a mock function with given fields: ctx, in, opts
 func (_m *SessionManagerClient) List(ctx context.Context, in *mnemosynerpc.ListRequest, opts ...grpc.CallOption) (*mnemosynerpc.ListResponse, error) {
 	_va := make([]interface{}, len(opts))
@@ -194,6 +224,36 @@ func (_m *SessionManagerClient) List(ctx context.Context, in *mnemosynerpc.ListR
 	return r0, r1
 }
 
+// Refresh provides a mock function with given fields: ctx, in, opts
+func (_m *SessionManagerClient) Refresh(ctx context.Context, in *mnemosynerpc.RefreshRequest, opts ...grpc.CallOption) (*mnemosynerpc.RefreshResponse, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 *mnemosynerpc.RefreshResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *mnemosynerpc.RefreshRequest, ...grpc.CallOption) *mnemosynerpc.RefreshResponse); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mnemosynerpc.RefreshResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *mnemosynerpc.RefreshRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SetValue provides a mock function with given fields: ctx, in, opts
 func (_m *SessionManagerClient) SetValue(ctx context.Context, in *mnemosynerpc.SetValueRequest, opts ...grpc.CallOption) (*mnemosynerpc.SetValueResponse, error) {
 	_va := make([]interface{}, len(opts))
@@ -253,3 +313,33 @@ func (_m *SessionManagerClient) Start(ctx context.Context, in *mnemosynerpc.Star
 
 	return r0, r1
 }
+
+// Watch provides a mock function with given fields: ctx, in, opts
+func (_m *SessionManagerClient) Watch(ctx context.Context, in *mnemosynerpc.WatchRequest, opts ...grpc.CallOption) (mnemosynerpc.SessionManager_WatchClient, error) {
+	_va := make([]interface{}, len(opts))
+	for _i := range opts {
+		_va[_i] = opts[_i]
+	}
+	var _ca []interface{}
+	_ca = append(_ca, ctx, in)
+	_ca = append(_ca, _va...)
+	ret := _m.Called(_ca...)
+
+	var r0 mnemosynerpc.SessionManager_WatchClient
+	if rf, ok := ret.Get(0).(func(context.Context, *mnemosynerpc.WatchRequest, ...grpc.CallOption) mnemosynerpc.SessionManager_WatchClient); ok {
+		r0 = rf(ctx, in, opts...)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(mnemosynerpc.SessionManager_WatchClient)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *mnemosynerpc.WatchRequest, ...grpc.CallOption) error); ok {
+		r1 = rf(ctx, in, opts...)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
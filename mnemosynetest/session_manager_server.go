@@ -128,6 +128,20 @@ func (_m *SessionManagerServer) Get(_a0 context.Context, _a1 *mnemosynerpc.GetRe
 	return r0, r1
 }
 
+// Handoff provides a mock function with given fields: _a0
+func (_m *SessionManagerServer) Handoff(_a0 mnemosynerpc.SessionManager_HandoffServer) error {
+	ret := _m.Called(_a0)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(mnemosynerpc.SessionManager_HandoffServer) error); ok {
+		r0 = rf(_a0)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
+
 // List provides a mock function with given fields: _a0, _a1
 func (_m *SessionManagerServer) List(_a0 context.Context, _a1 *mnemosynerpc.ListRequest) (*mnemosynerpc.ListResponse, error) {
 	ret := _m.Called(_a0, _a1)
@@ -151,6 +165,29 @@ func (_m *SessionManagerServer) List(_a0 context.Context, _a1 *mnemosynerpc.List
 	return r0, r1
 }
 
+// Refresh provides a mock function with given fields: _a0, _a1
+func (_m *SessionManagerServer) Refresh(_a0 context.Context, _a1 *mnemosynerpc.RefreshRequest) (*mnemosynerpc.RefreshResponse, error) {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 *mnemosynerpc.RefreshResponse
+	if rf, ok := ret.Get(0).(func(context.Context, *mnemosynerpc.RefreshRequest) *mnemosynerpc.RefreshResponse); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		if ret.Get(0) != nil {
+			r0 = ret.Get(0).(*mnemosynerpc.RefreshResponse)
+		}
+	}
+
+	var r1 error
+	if rf, ok := ret.Get(1).(func(context.Context, *mnemosynerpc.RefreshRequest) error); ok {
+		r1 = rf(_a0, _a1)
+	} else {
+		r1 = ret.Error(1)
+	}
+
+	return r0, r1
+}
+
 // SetValue provides a mock function with given fields: _a0, _a1
 func (_m *SessionManagerServer) SetValue(_a0 context.Context, _a1 *mnemosynerpc.SetValueRequest) (*mnemosynerpc.SetValueResponse, error) {
 	ret := _m.Called(_a0, _a1)
@@ -196,3 +233,17 @@ func (_m *SessionManagerServer) Start(_a0 context.Context, _a1 *mnemosynerpc.Sta
 
 	return r0, r1
 }
+
+// Watch provides a mock function with given fields: _a0, _a1
+func (_m *SessionManagerServer) Watch(_a0 *mnemosynerpc.WatchRequest, _a1 mnemosynerpc.SessionManager_WatchServer) error {
+	ret := _m.Called(_a0, _a1)
+
+	var r0 error
+	if rf, ok := ret.Get(0).(func(*mnemosynerpc.WatchRequest, mnemosynerpc.SessionManager_WatchServer) error); ok {
+		r0 = rf(_a0, _a1)
+	} else {
+		r0 = ret.Error(0)
+	}
+
+	return r0
+}
@@ -1,9 +1,16 @@
 package mnemosyne
 
 import (
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
 	"io"
+	"strconv"
+	"strings"
 
 	"golang.org/x/crypto/sha3"
 	"golang.org/x/net/context"
@@ -14,6 +21,27 @@ const (
 	AccessTokenMetadataKey = "authorization"
 )
 
+const (
+	// SignedAccessTokenVersion prefixes every signed access token.
+	SignedAccessTokenVersion = "v1"
+	// signedAccessTokenSeparator separates parts of a signed access token.
+	// It never appears in tokens generated by RandomAccessToken.
+	signedAccessTokenSeparator = "."
+	// Partitions is the number of partitions an access token can be assigned to.
+	Partitions = 1 << 16
+	// partitionPrefix starts the partition embedded in an access token, it is never a hex digit.
+	partitionPrefix = "p"
+	// partitionLength is the length of a hex encoded partition, prefix included.
+	partitionLength = len(partitionPrefix) + 4
+)
+
+var (
+	// ErrInvalidAccessToken is returned if access token is malformed, signed with unknown key or its tag does not match.
+	ErrInvalidAccessToken = errors.New("mnemosyne: invalid access token")
+	// ErrUnsignedAccessToken is returned if access token is not signed at all, e.g. generated by RandomAccessToken.
+	ErrUnsignedAccessToken = errors.New("mnemosyne: unsigned access token")
+)
+
 type key struct{}
 
 var accessTokenContextKey = key{}
@@ -53,3 +81,145 @@ func generateRandomBytes(length int) ([]byte, error) {
 	}
 	return k, nil
 }
+
+// AccessTokenKey signs access tokens. Its id is embedded in every token it signs,
+// so that the token can be verified as long as the key is active.
+type AccessTokenKey struct {
+	// ID can consist of letters, digits, dashes and underscores only.
+	ID     string
+	Secret []byte
+}
+
+// Validate returns an error if the key cannot be used to sign access tokens.
+func (k AccessTokenKey) Validate() error {
+	if k.ID == "" {
+		return errors.New("mnemosyne: access token key id is empty")
+	}
+	for _, r := range k.ID {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return errors.New("mnemosyne: access token key id contains forbidden character: " + string(r))
+		}
+	}
+	if len(k.Secret) == 0 {
+		return errors.New("mnemosyne: access token key " + k.ID + " has empty secret")
+	}
+	return nil
+}
+
+func (k AccessTokenKey) tag(payload string) string {
+	mac := hmac.New(sha256.New, k.Secret)
+	mac.Write([]byte(payload))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// SignedAccessToken is a parsed access token in the format: version.key_id.random.tag,
+// where tag is a hex encoded HMAC-SHA256 of everything that precedes it.
+type SignedAccessToken struct {
+	Version string
+	KeyID   string
+	Random  string
+	Tag     string
+}
+
+// RandomSignedAccessToken generates random access token signed with given key.
+// Unlike RandomAccessToken, it can be verified using ParseSignedAccessToken without a storage lookup.
+func RandomSignedAccessToken(key AccessTokenKey) (string, error) {
+	if err := key.Validate(); err != nil {
+		return "", err
+	}
+	buf, err := generateRandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+
+	return signAccessToken(key, hex.EncodeToString(buf)), nil
+}
+
+// RandomSignedAccessTokenInPartition works like RandomSignedAccessToken, but the token carries given partition.
+// The partition is covered by the tag.
+func RandomSignedAccessTokenInPartition(key AccessTokenKey, partition uint16) (string, error) {
+	if err := key.Validate(); err != nil {
+		return "", err
+	}
+	buf, err := generateRandomBytes(32)
+	if err != nil {
+		return "", err
+	}
+
+	return signAccessToken(key, formatPartition(partition)+hex.EncodeToString(buf)), nil
+}
+
+func signAccessToken(key AccessTokenKey, random string) string {
+	payload := strings.Join([]string{SignedAccessTokenVersion, key.ID, random}, signedAccessTokenSeparator)
+	return payload + signedAccessTokenSeparator + key.tag(payload)
+}
+
+// ParseSignedAccessToken parses given access token and verifies its tag using a key with matching id.
+// It returns ErrUnsignedAccessToken if token is not signed at all and ErrInvalidAccessToken if it cannot be verified.
+func ParseSignedAccessToken(token string, keys ...AccessTokenKey) (*SignedAccessToken, error) {
+	if !strings.Contains(token, signedAccessTokenSeparator) {
+		return nil, ErrUnsignedAccessToken
+	}
+	parts := strings.Split(token, signedAccessTokenSeparator)
+	if len(parts) != 4 || parts[0] != SignedAccessTokenVersion || parts[2] == "" {
+		return nil, ErrInvalidAccessToken
+	}
+	at := &SignedAccessToken{
+		Version: parts[0],
+		KeyID:   parts[1],
+		Random:  parts[2],
+		Tag:     parts[3],
+	}
+
+	payload := token[:len(token)-len(at.Tag)-len(signedAccessTokenSeparator)]
+	for _, k := range keys {
+		if k.ID != at.KeyID {
+			continue
+		}
+		if hmac.Equal([]byte(at.Tag), []byte(k.tag(payload))) {
+			return at, nil
+		}
+		break
+	}
+	return nil, ErrInvalidAccessToken
+}
+
+// RandomAccessTokenInPartition works like RandomAccessToken, but the token carries given partition.
+func RandomAccessTokenInPartition(partition uint16) (string, error) {
+	at, err := RandomAccessToken()
+	if err != nil {
+		return "", err
+	}
+	return formatPartition(partition) + at, nil
+}
+
+// AccessTokenPartition returns partition carried by given access token, signed or not.
+// The tag of a signed token is not verified.
+func AccessTokenPartition(token string) (uint16, bool) {
+	if parts := strings.Split(token, signedAccessTokenSeparator); len(parts) == 4 {
+		token = parts[2]
+	}
+	if len(token) < partitionLength || !strings.HasPrefix(token, partitionPrefix) {
+		return 0, false
+	}
+	p, err := strconv.ParseUint(token[len(partitionPrefix):partitionLength], 16, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(p), true
+}
+
+// HomePartition returns partition of a node listening on given address.
+// Access tokens that carry it are routed to that node, as long as it is a member of the cluster,
+// which allows clients to send requests directly to the owner.
+func HomePartition(addr string) uint16 {
+	h := fnv.New32a()
+	h.Write([]byte(addr))
+
+	return uint16(h.Sum32())
+}
+
+func formatPartition(partition uint16) string {
+	return fmt.Sprintf("%s%04x", partitionPrefix, partition)
+}
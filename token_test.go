@@ -46,3 +46,101 @@ func BenchmarkRandomAccessToken(b *testing.B) {
 		benchAccessToken = at
 	}
 }
+
+func TestParseSignedAccessToken(t *testing.T) {
+	current := mnemosyne.AccessTokenKey{ID: "current", Secret: []byte("current-secret")}
+	previous := mnemosyne.AccessTokenKey{ID: "previous", Secret: []byte("previous-secret")}
+
+	token, err := mnemosyne.RandomSignedAccessToken(previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	at, err := mnemosyne.ParseSignedAccessToken(token, current, previous)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if at.Version != mnemosyne.SignedAccessTokenVersion || at.KeyID != previous.ID {
+		t.Errorf("wrong token: %v", at)
+	}
+
+	unsigned, err := mnemosyne.RandomAccessToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	cases := map[string]struct {
+		token string
+		keys  []mnemosyne.AccessTokenKey
+		err   error
+	}{
+		"unsigned":      {token: unsigned, keys: []mnemosyne.AccessTokenKey{current}, err: mnemosyne.ErrUnsignedAccessToken},
+		"unknown-key":   {token: token, keys: []mnemosyne.AccessTokenKey{current}, err: mnemosyne.ErrInvalidAccessToken},
+		"wrong-secret":  {token: token, keys: []mnemosyne.AccessTokenKey{{ID: previous.ID, Secret: []byte("other")}}, err: mnemosyne.ErrInvalidAccessToken},
+		"wrong-version": {token: "v0" + token[2:], keys: []mnemosyne.AccessTokenKey{previous}, err: mnemosyne.ErrInvalidAccessToken},
+		"tampered":      {token: token[:len(token)-1] + "x", keys: []mnemosyne.AccessTokenKey{previous}, err: mnemosyne.ErrInvalidAccessToken},
+		"malformed":     {token: "v1.previous", keys: []mnemosyne.AccessTokenKey{previous}, err: mnemosyne.ErrInvalidAccessToken},
+	}
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			if _, err := mnemosyne.ParseSignedAccessToken(c.token, c.keys...); err != c.err {
+				t.Errorf("wrong error, expected %v but got %v", c.err, err)
+			}
+		})
+	}
+}
+
+func TestAccessTokenKey_Validate(t *testing.T) {
+	for hint, key := range map[string]mnemosyne.AccessTokenKey{
+		"empty-id":     {Secret: []byte("secret")},
+		"separator":    {ID: "a.b", Secret: []byte("secret")},
+		"empty-secret": {ID: "a"},
+	} {
+		if err := key.Validate(); err == nil {
+			t.Errorf("%s: expected error", hint)
+		}
+	}
+	if err := (mnemosyne.AccessTokenKey{ID: "2019-01_a", Secret: []byte("secret")}).Validate(); err != nil {
+		t.Errorf("unexpected error: %s", err.Error())
+	}
+}
+
+func TestAccessTokenPartition(t *testing.T) {
+	key := mnemosyne.AccessTokenKey{ID: "current", Secret: []byte("secret")}
+
+	unsigned, err := mnemosyne.RandomAccessTokenInPartition(0xbeef)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	signed, err := mnemosyne.RandomSignedAccessTokenInPartition(key, 7)
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+	if _, err := mnemosyne.ParseSignedAccessToken(signed, key); err != nil {
+		t.Fatalf("token that carries partition should be verified, got %s", err.Error())
+	}
+	plain, err := mnemosyne.RandomAccessToken()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err.Error())
+	}
+
+	cases := map[string]struct {
+		token string
+		exp   uint16
+		ok    bool
+	}{
+		"unsigned":         {token: unsigned, exp: 0xbeef, ok: true},
+		"signed":           {token: signed, exp: 7, ok: true},
+		"plain":            {token: plain},
+		"too-short":        {token: "p12"},
+		"not-hex":          {token: "pxyz0123"},
+		"signed-not-hex":   {token: "v1.current.pxyz0123.tag"},
+		"signed-too-short": {token: "v1.current.p1.tag"},
+	}
+	for hint, c := range cases {
+		t.Run(hint, func(t *testing.T) {
+			got, ok := mnemosyne.AccessTokenPartition(c.token)
+			if ok != c.ok || got != c.exp {
+				t.Errorf("wrong partition, expected %d (%t) but got %d (%t)", c.exp, c.ok, got, ok)
+			}
+		})
+	}
+}